@@ -0,0 +1,52 @@
+/*
+Command sfdcschema verifies the force tags of the webcore DTOs against the
+describe of the SFDC org configured by the BBWEBCORE_SFDC* environmental
+variables (see package salesforce). It prints a drift report and exits with a
+non-zero status if any field is missing, has an incompatible type or can't be
+written where webcore writes it.
+
+	sfdcschema [-json]
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/blackbaudIT/webcore/data/salesforce"
+)
+
+var jsonOutput = flag.Bool("json", false, "print the report as JSON")
+
+func main() {
+	flag.Parse()
+
+	api, err := salesforce.NewAPIWithConfig(salesforce.FromEnv())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	report, err := api.VerifySchema()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Println(report)
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
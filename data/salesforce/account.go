@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
 	"github.com/blackbaudIT/webcore/entities"
 	"github.com/blackbaudIT/webcore/services"
 )
@@ -33,6 +35,15 @@ func (s SFDCAccount) ExternalIdApiName() string {
 	return "Clarify_Site_ID__c"
 }
 
+// accountQueryFields are the Account fields mapped onto services.AccountDTO
+const accountQueryFields = "Id, ParentId, Name, Clarify_Site_ID__c, Business_Unit__c, Industry, Payer__c, " +
+	"Billing_Street__c, Billing_City__c, Billing_State_Province__c, Billing_Zip_Postal_Code__c, " +
+	"Billing_Country__c, Physical_Street__c, Physical_City__c, Physical_State_Province__c, " +
+	"Physical_Zip_Postal_Code__c, Physical_Country__c"
+
+// maxAccountHierarchyDepth bounds the walk up an account hierarchy
+const maxAccountHierarchyDepth = 50
+
 // GetAccount returns a SalesForce account for the ID specified
 func (a API) GetAccount(id string) (*services.AccountDTO, error) {
 	account := &SFDCAccount{}
@@ -91,56 +102,196 @@ func (a API) QueryAccounts(query string) ([]*services.AccountDTO, error) {
 	return queryResponse.Records, err
 }
 
-// CreateAccount creates a new SFDC Account and returns the Clarify Site ID
+// CreateAccount creates a new SFDC Account and returns the Clarify Site ID.
+// The account is inserted and its Site ID read back in a single composite
+// request.
 func (a API) CreateAccount(account *entities.Account) (string, int, error) {
-	dto := services.ConvertAccountEntityToAccountDTO(account)
+	id, siteID, _, err := a.CreateAccountWithContacts(account, nil)
+	return id, siteID, err
+}
+
+// CreateAccountWithContacts creates a new SFDC Account along with its initial
+// contacts and their roles. It returns the SFDC ids of the account and the
+// contacts and the account's Clarify Site ID. Everything is sent in a single
+// composite request, so either all of the records are created or none are.
+func (a API) CreateAccountWithContacts(account *entities.Account, contacts []*entities.Contact) (string, int, []string, error) {
+	requests, err := newCreateAccountRequests(account, contacts)
+	if err == nil {
+		err = checkCompositeSize(requests)
+	}
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Error building account creation: %s", err)
+	}
+
+	results, err := a.client.CompositeSFDCRequest(true, requests)
+	if err == nil {
+		err = compositeError(results)
+	}
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("Error creating account in SFDC: %s", err)
+	}
 
-	sfdcAccount := SFDCAccount{AccountDTO: *dto}
-	resp, err := a.client.InsertSFDCObject(sfdcAccount)
+	byReference := map[string]*SFDCCompositeResult{}
+	for _, result := range results {
+		byReference[result.ReferenceID] = result
+	}
+
+	accountID, err := insertedID(byReference["newAccount"])
 	if err != nil {
-		return "", 0, fmt.Errorf("Error creating account in SFDC: %s", err)
+		return "", 0, nil, fmt.Errorf("Error creating account in SFDC: %s", err)
 	}
-	if !resp.Success {
-		return "", 0,
-			fmt.Errorf("Error creating account in SFDC: %s", resp.ErrorMessage)
+
+	contactIDs := make([]string, len(contacts))
+	for i := range contacts {
+		contactIDs[i], err = insertedID(byReference[fmt.Sprintf("newContact%d", i)])
+		if err != nil {
+			return "", 0, nil, fmt.Errorf("Error creating contact in SFDC: %s", err)
+		}
 	}
 
 	newAccount := &SFDCAccount{}
-	err = a.client.GetSFDCObject(resp.ID, newAccount)
+	siteResult, ok := byReference["newAccountSiteID"]
+	if !ok {
+		return "", 0, nil, errors.New("Error getting newly created account: no result was returned")
+	}
+	err = forcejson.Unmarshal(siteResult.Body, newAccount)
 	if err != nil {
-		return "", 0, fmt.Errorf("Error getting newly created account: %s", err)
+		return "", 0, nil, fmt.Errorf("Error getting newly created account: %s", err)
 	}
 
 	var siteID int
 	if newAccount.SiteID != "" {
 		siteID, err = strconv.Atoi(newAccount.SiteID)
 		if err != nil {
-			return "", 0,
+			return "", 0, nil,
 				fmt.Errorf("Error getting SiteID for newly created account: %s", err)
 		}
 	}
 
-	return resp.ID, siteID, nil
+	return accountID, siteID, contactIDs, nil
+}
+
+// newCreateAccountRequests builds the subrequests that insert an account, read
+// back its Site ID, and insert its contacts and their roles. Contacts and roles
+// refer to the records they belong to by the results of earlier subrequests.
+func newCreateAccountRequests(account *entities.Account, contacts []*entities.Contact) ([]*SFDCCompositeSubrequest, error) {
+	dto := services.ConvertAccountEntityToAccountDTO(account)
+	dto.SalesForceID = ""
+
+	requests := []*SFDCCompositeSubrequest{
+		{Method: "POST", SObject: SFDCAccount{}, Body: SFDCAccount{AccountDTO: *dto}, ReferenceID: "newAccount"},
+		{Method: "GET", SObject: SFDCAccount{}, ID: compositeReference("newAccount"),
+			Fields: []string{"Id", "Clarify_Site_ID__c"}, ReferenceID: "newAccountSiteID"},
+	}
+
+	for i, contact := range contacts {
+		contactRequests, err := newCreateContactRequests(contact, compositeReference("newAccount"),
+			fmt.Sprintf("newContact%d", i))
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, contactRequests...)
+	}
+
+	return requests, nil
+}
+
+// newCreateContactRequests builds the subrequests that insert a contact of the
+// given account and its roles. The contact's subrequest has the given
+// reference, which its roles refer to.
+func newCreateContactRequests(contact *entities.Contact, accountID, reference string) ([]*SFDCCompositeSubrequest, error) {
+	contactDTO := services.ConvertContactEntityToContactDTO(contact)
+	contactDTO.SalesForceID = ""
+
+	insert, err := newSObjectInsert(SFDCContact{}, contactDTO)
+	if err != nil {
+		return nil, err
+	}
+	insert.Fields["AccountId"] = accountID
+	requests := []*SFDCCompositeSubrequest{
+		{Method: "POST", SObject: SFDCContact{}, Body: insert, ReferenceID: reference},
+	}
+
+	for j, role := range contactDTO.ContactRoles.Roles {
+		roleInsert, err := newSObjectInsert(contactRoleSObject, role)
+		if err != nil {
+			return nil, err
+		}
+		roleInsert.Fields["Contact__c"] = compositeReference(reference)
+		requests = append(requests, &SFDCCompositeSubrequest{
+			Method: "POST", SObject: contactRoleSObject, Body: roleInsert,
+			ReferenceID: fmt.Sprintf("%sRole%d", reference, j),
+		})
+	}
+
+	return requests, nil
+}
+
+// insertedID returns the id of the record inserted by a subrequest
+func insertedID(result *SFDCCompositeResult) (string, error) {
+	if result == nil {
+		return "", errors.New("no result was returned")
+	}
+
+	resp := force.SObjectResponse{}
+	if err := forcejson.Unmarshal(result.Body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Id == "" {
+		return "", fmt.Errorf("%s: no id was returned", result.ReferenceID)
+	}
+	return resp.Id, nil
+}
+
+// BulkUpsertAccounts creates or updates accounts with a job of the SFDC Bulk
+// API, matching existing accounts by their Clarify Site ID. The Row of each
+// result is the index of the account it's for.
+func (a API) BulkUpsertAccounts(accounts []*entities.Account) ([]*services.BulkRowResult, error) {
+	records := make([]map[string]string, len(accounts))
+	for i, account := range accounts {
+		insert, err := newSObjectInsert(SFDCAccount{}, services.ConvertAccountEntityToAccountDTO(account))
+		if err != nil {
+			return nil, fmt.Errorf("Error building account upsert: %s", err)
+		}
+		records[i] = bulkRecord(insert)
+	}
+
+	results, err := a.client.BulkUpsertSFDCObjects(SFDCAccount{}, SFDCAccount{}.ExternalIdApiName(), records)
+	if err != nil {
+		return nil, fmt.Errorf("Error upserting accounts in SFDC: %s", err)
+	}
+	return bulkRowResults(results), nil
 }
 
-// UpdateAccount updates an SFDC Account
+// UpdateAccount updates an SFDC Account. Only the fields modified since the
+// account was marked clean are sent, and cleared fields are set to null.
 func (a API) UpdateAccount(account *entities.Account) error {
 	if account.SiteID() <= 0 {
 		return fmt.Errorf("A valid SiteID is required to update an account (SiteID: %v)",
 			account.SiteID())
 	}
 
-	dto := services.ConvertAccountEntityToAccountDTO(account)
+	// the SiteID is used as the external ID for the upsert, so it can't be
+	// included in the field list. if it is, SFDC will error with: "The
+	// Clarify_Site_ID__c field should not be specified in the sobject data"
+	fields := []string{}
+	for _, field := range account.ModifiedFields() {
+		if field != "siteId" {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
 
-	// this is necessary because we are using the SiteID as the external ID for
-	// the upsert, so it can't be included in the field list. if we don't clear
-	// it out, SFDC will error with: "The Clarify_Site_ID__c field should not be
-	// specified in the sobject data"
-	siteID := dto.SiteID
-	dto.SiteID = ""
+	dto := services.ConvertAccountEntityToAccountDTO(account)
+	patch, err := newSObjectPatch(SFDCAccount{}, dto, fields)
+	if err != nil {
+		return fmt.Errorf("Error building account update: %s", err)
+	}
 
-	sfdcAccount := SFDCAccount{AccountDTO: *dto}
-	err := a.client.UpsertSFDCObjectByExternalID(siteID, sfdcAccount)
+	err = a.client.UpsertSFDCObjectByExternalID(strconv.Itoa(account.SiteID()), patch)
 	if err != nil {
 		return fmt.Errorf("Error updating account in SFDC: %s", err)
 	}
@@ -157,3 +308,48 @@ func (a API) GetContactCount(accountID string) (int, error) {
 
 	return int(queryResponse.TotalSize), err
 }
+
+//GetChildAccounts returns the accounts whose parent is the given SFDC account.
+func (a API) GetChildAccounts(parentID string) ([]*services.AccountDTO, error) {
+	if len(parentID) != 15 && len(parentID) != 18 {
+		return nil, errors.New("parentID must be a valid 15 or 18 character SFDC id")
+	}
+
+	query := "SELECT " + accountQueryFields + " FROM Account WHERE ParentId = '" + parentID + "'"
+
+	return a.QueryAccounts(query)
+}
+
+//GetAncestorAccounts returns the parent of the given account, then its parent,
+//and so on up to the top level account. An error is returned if the hierarchy
+//loops back on itself or is deeper than maxAccountHierarchyDepth.
+func (a API) GetAncestorAccounts(id string) ([]*services.AccountDTO, error) {
+	account, err := a.GetAccount(id)
+	if err != nil {
+		return nil, err
+	}
+
+	visited := map[string]bool{account.SalesForceID: true}
+	ancestors := []*services.AccountDTO{}
+
+	for parentID := account.ParentID; parentID != ""; {
+		if visited[parentID] {
+			return ancestors, fmt.Errorf("Account hierarchy of %s contains a cycle at %s", id, parentID)
+		}
+		if len(ancestors) >= maxAccountHierarchyDepth {
+			return ancestors, fmt.Errorf("Account hierarchy of %s is deeper than %d levels",
+				id, maxAccountHierarchyDepth)
+		}
+		visited[parentID] = true
+
+		parent, err := a.GetAccount(parentID)
+		if err != nil {
+			return ancestors, err
+		}
+
+		ancestors = append(ancestors, parent)
+		parentID = parent.ParentID
+	}
+
+	return ancestors, nil
+}
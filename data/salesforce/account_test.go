@@ -7,6 +7,7 @@ import (
 
 	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
 	"github.com/blackbaudIT/webcore/entities"
+	"github.com/blackbaudIT/webcore/services"
 )
 
 func TestAccountApiName(t *testing.T) {
@@ -164,6 +165,73 @@ func TestCreateAccount(t *testing.T) {
 	})
 }
 
+func TestCreateAccountWithContacts(t *testing.T) {
+	Convey("Given an account with a contact that has a role", t, func() {
+		account, _ := entities.NewAccount("Test Org Name")
+		name, _ := entities.BuildName("", "Erik", "Tate")
+		contact, _ := entities.NewContact(name, account, entities.USD)
+		contact.SetEmail("erik.tate@example.com")
+		contact.SetRoles([]*entities.ContactRole{{RoleType: "Billing", RoleName: "Primary", RoleStatus: "Active"}})
+
+		Convey("When creating the account with its contacts", func() {
+			id, siteID, contactIDs, err := api.CreateAccountWithContacts(account, []*entities.Contact{contact})
+			Convey("Then all of the records should be created in one request", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "001d000001TweFmAAJ")
+				So(siteID, ShouldEqual, 5740)
+				So(contactIDs, ShouldResemble, []string{"003d000001NEW002AA"})
+				So(len(lastCompositeRequests), ShouldEqual, 4)
+			})
+			Convey("Then the contact should refer to the new account", func() {
+				insert := lastCompositeRequests[2].Body.(sobjectPatch)
+				So(insert.Fields["AccountId"], ShouldEqual, "@{newAccount.id}")
+				So(insert.Fields["Email"], ShouldEqual, "erik.tate@example.com")
+				So(insert.Fields, ShouldNotContainKey, "Id")
+			})
+			Convey("Then the role should refer to the new contact", func() {
+				role := lastCompositeRequests[3]
+				So(role.SObject.ApiName(), ShouldEqual, "Contact_Role__c")
+				So(role.Body.(sobjectPatch).Fields, ShouldResemble, map[string]interface{}{
+					"Contact__c":     "@{newContact0.id}",
+					"Role_Type__c":   "Billing",
+					"Role_Name__c":   "Primary",
+					"Role_Status__c": "Active",
+				})
+			})
+		})
+		Convey("When the account fails to insert", func() {
+			getSFDCResposne = func() SFDCResponse {
+				return SFDCResponse{ErrorMessage: "fake error", Success: false}
+			}
+			_, _, _, err := api.CreateAccountWithContacts(account, []*entities.Contact{contact})
+			Convey("Then the account's error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "fake error")
+				So(err.Error(), ShouldNotContainSubstring, processingHaltedErrorCode)
+			})
+		})
+		Convey("When there are too many contacts for one request", func() {
+			contacts := make([]*entities.Contact, maxCompositeSubrequests)
+			for i := range contacts {
+				contacts[i] = contact
+			}
+			_, _, _, err := api.CreateAccountWithContacts(account, contacts)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			getSFDCResposne = func() SFDCResponse {
+				return SFDCResponse{
+					ID:           "001d000001TweFmAAJ",
+					ErrorMessage: "",
+					Success:      true,
+				}
+			}
+		})
+	})
+}
+
 func TestUpdateAccount(t *testing.T) {
 	Convey("Given an SFDCAccount object", t, func() {
 		account, _ := entities.NewAccount("Test Org Name")
@@ -193,6 +261,51 @@ func TestUpdateAccount(t *testing.T) {
 			getQueryError = func() error { return nil }
 		})
 	})
+	Convey("Given an account loaded from SFDC", t, func() {
+		account, _ := entities.NewAccount("Test Org Name")
+		account.SetSiteID(5740)
+		account.Industry = "Education"
+		account.Payer = "001d000001TwuXwAAZ"
+		account.MarkClean()
+		lastCommandObject = nil
+		Convey("When the industry is changed and the payer cleared", func() {
+			account.Industry = "Cause & Cure"
+			account.Payer = ""
+			err := api.UpdateAccount(account)
+			Convey("Then only those fields should be sent, with the payer cleared", func() {
+				So(err, ShouldBeNil)
+				patch := lastCommandObject.(sobjectPatch)
+				So(patch.ExternalIdApiName(), ShouldEqual, "Clarify_Site_ID__c")
+				So(patch.Fields, ShouldResemble, map[string]interface{}{
+					"Industry": "Cause & Cure",
+					"Payer__c": nil,
+				})
+			})
+		})
+		Convey("When the account hasn't been modified", func() {
+			err := api.UpdateAccount(account)
+			Convey("Then nothing should be sent to SFDC", func() {
+				So(err, ShouldBeNil)
+				So(lastCommandObject, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestUpdateAccountThroughService(t *testing.T) {
+	Convey("Given an account service using the SFDC API", t, func() {
+		service := services.AccountService{AccountRepo: api}
+		lastCommandObject = nil
+		Convey("When an update clears the industry", func() {
+			err := service.UpdateAccount(services.AccountDTO{SalesForceID: "001d000001UPDATEAA",
+				Name: "Test Org Name", Clear: []string{"industry"}})
+			Convey("Then the industry should be sent to SFDC as null", func() {
+				So(err, ShouldBeNil)
+				patch := lastCommandObject.(sobjectPatch)
+				So(patch.Fields, ShouldResemble, map[string]interface{}{"Industry": nil})
+			})
+		})
+	})
 }
 
 func TestGetContactCount(t *testing.T) {
@@ -221,3 +334,60 @@ func TestGetContactCount(t *testing.T) {
 		})
 	})
 }
+
+func TestGetChildAccounts(t *testing.T) {
+	Convey("Given a valid parent account ID", t, func() {
+		parentID := "001d000001DISTRTAA"
+		Convey("When the child accounts are requested", func() {
+			children, err := api.GetChildAccounts(parentID)
+			Convey("Then the accounts with that parent should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(children), ShouldEqual, 1)
+				So(children[0].ParentID, ShouldEqual, parentID)
+			})
+		})
+	})
+	Convey("Given an invalid parent account ID", t, func() {
+		parentID := "5740"
+		Convey("When the child accounts are requested", func() {
+			_, err := api.GetChildAccounts(parentID)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestGetAncestorAccounts(t *testing.T) {
+	Convey("Given an account two levels down an account hierarchy", t, func() {
+		id := "001d000001SCHOOLAA"
+		Convey("When the ancestor accounts are requested", func() {
+			ancestors, err := api.GetAncestorAccounts(id)
+			Convey("Then the parent and grandparent should be returned in order", func() {
+				So(err, ShouldBeNil)
+				So(len(ancestors), ShouldEqual, 2)
+				So(ancestors[0].SalesForceID, ShouldEqual, "001d000001DISTRTAA")
+				So(ancestors[1].SalesForceID, ShouldEqual, "001d000001STATE1AA")
+			})
+		})
+	})
+	Convey("Given a top level account", t, func() {
+		id := "001d000001TweFmAAJ"
+		Convey("When the ancestor accounts are requested", func() {
+			ancestors, err := api.GetAncestorAccounts(id)
+			Convey("Then no accounts should be returned", func() {
+				So(err, ShouldBeNil)
+				So(ancestors, ShouldBeEmpty)
+			})
+		})
+	})
+	Convey("Given an account hierarchy that contains a cycle", t, func() {
+		id := "001d000001CYCLE1AA"
+		Convey("When the ancestor accounts are requested", func() {
+			_, err := api.GetAncestorAccounts(id)
+			Convey("Then an error should be returned instead of looping forever", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
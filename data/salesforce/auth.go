@@ -0,0 +1,247 @@
+package salesforce
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//jwtLifetime is how long a JWT bearer assertion is valid for. SFDC accepts
+//assertions that expire within 3 minutes.
+const jwtLifetime = 3 * time.Minute
+
+//session is an SFDC access token and the instance it's valid for
+type session struct {
+	accessToken string
+	instanceURL string
+}
+
+//authenticator starts SFDC sessions
+type authenticator interface {
+	authenticate(client *http.Client) (session, error)
+	String() string
+}
+
+//TokenSource returns an access token and instance URL issued outside of
+//webcore. It's called whenever the session expires.
+type TokenSource func() (accessToken, instanceURL string, err error)
+
+//WithJWT logs in with the OAuth 2.0 JWT bearer flow as the given user. The
+//Connected App must have the certificate of the private key, which is PEM
+//encoded in PKCS #1 or PKCS #8 form.
+func WithJWT(clientID, userName string, privateKeyPEM []byte) Option {
+	return func(c *Config) error {
+		key, err := parsePrivateKey(privateKeyPEM)
+		if err != nil {
+			return err
+		}
+		c.ClientID = clientID
+		c.UserName = userName
+		c.PrivateKey = key
+		return nil
+	}
+}
+
+//WithJWTKeyFile logs in with the JWT bearer flow using the private key in
+//the given PEM file
+func WithJWTKeyFile(clientID, userName, path string) Option {
+	return func(c *Config) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading private key: %s", err)
+		}
+		return WithJWT(clientID, userName, data)(c)
+	}
+}
+
+//WithAccessToken uses an access token issued outside of webcore rather than
+//logging in. When the session expires a new one is started with the
+//TokenSource, JWT or password settings, if any were given.
+func WithAccessToken(accessToken, instanceURL string) Option {
+	return func(c *Config) error {
+		if accessToken == "" || instanceURL == "" {
+			return errors.New("both an access token and an instance URL are required")
+		}
+		c.AccessToken = accessToken
+		c.InstanceURL = instanceURL
+		return nil
+	}
+}
+
+//WithTokenSource gets access tokens from the given function, both to start
+//the first session and whenever the session expires
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Config) error {
+		if source == nil {
+			return errors.New("the token source can't be nil")
+		}
+		c.TokenSource = source
+		return nil
+	}
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key isn't PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing private key: %s", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key must be an RSA key")
+	}
+	return key, nil
+}
+
+//authenticator returns the way sessions are started with the config, in
+//order of preference, or nil if there's none (ex. a lone access token)
+func (c Config) authenticator() authenticator {
+	switch {
+	case c.TokenSource != nil:
+		return tokenSourceAuth{source: c.TokenSource}
+	case c.PrivateKey != nil:
+		return jwtAuth{loginURL: c.loginURL(), clientID: c.ClientID, userName: c.UserName, key: c.PrivateKey}
+	case c.Password != "":
+		return passwordAuth{loginURL: c.loginURL(), clientID: c.ClientID, clientSecret: c.ClientSecret,
+			userName: c.UserName, password: c.Password + c.SecurityToken}
+	}
+	return nil
+}
+
+//passwordAuth logs in with the OAuth username-password flow
+type passwordAuth struct {
+	loginURL, clientID, clientSecret, userName, password string
+}
+
+func (a passwordAuth) authenticate(client *http.Client) (session, error) {
+	return requestToken(client, a.loginURL, url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {a.clientID},
+		"client_secret": {a.clientSecret},
+		"username":      {a.userName},
+		"password":      {a.password},
+	})
+}
+
+func (a passwordAuth) String() string {
+	return "the password of " + a.userName
+}
+
+//jwtAuth logs in with the OAuth 2.0 JWT bearer flow
+type jwtAuth struct {
+	loginURL, clientID, userName string
+	key                          *rsa.PrivateKey
+}
+
+func (a jwtAuth) authenticate(client *http.Client) (session, error) {
+	assertion, err := a.assertion(time.Now())
+	if err != nil {
+		return session{}, err
+	}
+
+	return requestToken(client, a.loginURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
+
+//assertion builds a JWT signed with RS256 that asserts the user's identity
+func (a jwtAuth) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": a.clientID,
+		"sub": a.userName,
+		"aud": a.loginURL,
+		"exp": now.Add(jwtLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtEncode(header) + "." + jwtEncode(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("Error signing JWT: %s", err)
+	}
+
+	return unsigned + "." + jwtEncode(signature), nil
+}
+
+func (a jwtAuth) String() string {
+	return "a JWT for " + a.userName
+}
+
+//jwtEncode is base64url encoding without padding
+func jwtEncode(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
+
+//tokenSourceAuth gets sessions from a TokenSource
+type tokenSourceAuth struct {
+	source TokenSource
+}
+
+func (a tokenSourceAuth) authenticate(client *http.Client) (session, error) {
+	accessToken, instanceURL, err := a.source()
+	if err != nil {
+		return session{}, fmt.Errorf("Error getting SFDC access token: %s", err)
+	}
+	if accessToken == "" || instanceURL == "" {
+		return session{}, errors.New("The token source didn't return an access token and instance URL")
+	}
+	return session{accessToken: accessToken, instanceURL: instanceURL}, nil
+}
+
+func (a tokenSourceAuth) String() string {
+	return "the token source"
+}
+
+//oauthResponse is the response of the OAuth token endpoint
+type oauthResponse struct {
+	AccessToken      string `json:"access_token"`
+	InstanceURL      string `json:"instance_url"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func requestToken(client *http.Client, loginURL string, form url.Values) (session, error) {
+	resp, err := client.PostForm(loginURL+"/services/oauth2/token", form)
+	if err != nil {
+		return session{}, fmt.Errorf("Error logging in to SFDC: %s", err)
+	}
+	defer resp.Body.Close()
+
+	token := oauthResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return session{}, fmt.Errorf("Error reading SFDC login response (status %d): %s", resp.StatusCode, err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return session{}, fmt.Errorf("Error logging in to SFDC: %s %s", token.Error, token.ErrorDescription)
+	}
+
+	return session{accessToken: token.AccessToken, instanceURL: token.InstanceURL}, nil
+}
@@ -0,0 +1,147 @@
+package salesforce
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+//verifyJWT checks the RS256 signature and expiry of a JWT bearer assertion
+func verifyJWT(assertion string, key *rsa.PublicKey) error {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed JWT")
+	}
+
+	decode := func(s string) ([]byte, error) {
+		if m := len(s) % 4; m != 0 {
+			s += strings.Repeat("=", 4-m)
+		}
+		return base64.URLEncoding.DecodeString(s)
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return err
+	}
+
+	data, err := decode(parts[1])
+	if err != nil {
+		return err
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	if time.Unix(claims.Exp, 0).Before(time.Now()) {
+		return errors.New("JWT has expired")
+	}
+	return nil
+}
+
+func TestJWTAuth(t *testing.T) {
+	Convey("Given a Connected App with a certificate", t, func() {
+		sfdc := newFakeSFDC()
+		sfdc.jwtKey, _ = rsa.GenerateKey(rand.Reader, 1024)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(sfdc.jwtKey)})
+
+		Convey("When the API logs in with the certificate's private key", func() {
+			api, err := NewAPIWithConfig(WithVersion("v32.0"), WithLoginURL(sfdc.server.URL),
+				WithJWT("clientid", "user@example.com", keyPEM))
+			Convey("Then a session should be started without a password", func() {
+				So(err, ShouldBeNil)
+				_, err = api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+				So(sfdc.logins, ShouldEqual, 1)
+			})
+		})
+		Convey("When the API logs in with another key", func() {
+			other, _ := rsa.GenerateKey(rand.Reader, 1024)
+			otherPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(other)})
+			_, err := NewAPIWithConfig(WithVersion("v32.0"), WithLoginURL(sfdc.server.URL),
+				WithJWT("clientid", "user@example.com", otherPEM))
+			Convey("Then the login should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "invalid assertion")
+			})
+		})
+		Convey("When the private key isn't PEM encoded", func() {
+			_, err := NewAPIWithConfig(WithJWT("clientid", "user@example.com", []byte("not a key")))
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			sfdc.server.Close()
+		})
+	})
+}
+
+func TestAccessTokenAuth(t *testing.T) {
+	Convey("Given an access token issued outside of webcore", t, func() {
+		sfdc := newFakeSFDC()
+
+		Convey("When the API uses the access token", func() {
+			api, err := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("external", sfdc.server.URL))
+			Convey("Then requests should be sent without logging in", func() {
+				So(err, ShouldBeNil)
+				_, err = api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+				So(sfdc.logins, ShouldEqual, 0)
+			})
+			Convey("Then an expired token should be reported when it can't be renewed", func() {
+				sfdc.expiredToken = "external"
+				_, err = api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "session has expired")
+			})
+		})
+		Convey("When the access token expires and password credentials were given", func() {
+			options := append(sfdc.options(), WithAccessToken("external", sfdc.server.URL))
+			api, _ := NewAPIWithConfig(options...)
+			sfdc.expiredToken = "external"
+			_, err := api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then a new session should be started with the password", func() {
+				So(err, ShouldBeNil)
+				So(sfdc.logins, ShouldEqual, 1)
+			})
+		})
+		Convey("When the access token expires and a token source was given", func() {
+			issued := 0
+			source := func() (string, string, error) {
+				issued++
+				return "renewed", sfdc.server.URL, nil
+			}
+			api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("external", sfdc.server.URL),
+				WithTokenSource(source))
+			sfdc.expiredToken = "external"
+			_, err := api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then a new token should be taken from the source", func() {
+				So(err, ShouldBeNil)
+				So(issued, ShouldEqual, 1)
+			})
+		})
+
+		Reset(func() {
+			sfdc.server.Close()
+		})
+	})
+}
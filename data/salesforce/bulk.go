@@ -0,0 +1,377 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//maxBulkBatchRows is the most records SFDC accepts in one batch of a bulk job
+const maxBulkBatchRows = 10000
+
+const bulkInvalidSessionErrorCode = "InvalidSessionId"
+
+//States of bulk batches
+const (
+	bulkBatchCompleted    = "Completed"
+	bulkBatchFailed       = "Failed"
+	bulkBatchNotProcessed = "NotProcessed"
+)
+
+//SFDCBulkResult is the result of one record of a bulk job
+type SFDCBulkResult struct {
+	ID      string
+	Success bool
+	Created bool
+	Error   string
+}
+
+//bulkJobInfo is a job of the Bulk API. The order of the fields is the order
+//SFDC expects them in.
+type bulkJobInfo struct {
+	XMLName             xml.Name `xml:"http://www.force.com/2009/06/asyncapi/dataload jobInfo"`
+	ID                  string   `xml:"id,omitempty"`
+	Operation           string   `xml:"operation,omitempty"`
+	Object              string   `xml:"object,omitempty"`
+	ExternalIDFieldName string   `xml:"externalIdFieldName,omitempty"`
+	State               string   `xml:"state,omitempty"`
+	ContentType         string   `xml:"contentType,omitempty"`
+}
+
+//bulkBatchInfo is a batch of records of a bulk job
+type bulkBatchInfo struct {
+	ID           string `xml:"id"`
+	JobID        string `xml:"jobId"`
+	State        string `xml:"state"`
+	StateMessage string `xml:"stateMessage"`
+}
+
+//bulkError is the body of a failed Bulk API request
+type bulkError struct {
+	ExceptionCode    string `xml:"exceptionCode"`
+	ExceptionMessage string `xml:"exceptionMessage"`
+}
+
+func (e bulkError) Error() string {
+	return e.ExceptionCode + ": " + e.ExceptionMessage
+}
+
+//bulkPath is the path of a Bulk API resource. The Bulk API is versioned by
+//number only (ex. "32.0").
+func (c *restClient) bulkPath(path string) string {
+	return "/services/async/" + strings.TrimPrefix(c.config.Version, "v") + "/" + path
+}
+
+//bulkRequest sends a request to the Bulk API and returns the body of the
+//response, decoding it into out if it's given. If the session has expired
+//the client logs in again and resends the request once.
+func (c *restClient) bulkRequest(method, path, contentType string, body []byte, out interface{}) ([]byte, error) {
+	data, err := c.bulkSend(method, path, contentType, body)
+	if bulkErr, ok := err.(bulkError); ok && bulkErr.ExceptionCode == bulkInvalidSessionErrorCode {
+		if err := c.authenticate(); err != nil {
+			return nil, err
+		}
+		data, err = c.bulkSend(method, path, contentType, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if out != nil {
+		if err := xml.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("Unable to unmarshal bulk response to object: %s", err)
+		}
+	}
+	return data, nil
+}
+
+func (c *restClient) bulkSend(method, path, contentType string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.url(c.bulkPath(path), nil), reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating bulk %s request: %s", method, err)
+	}
+
+	c.lock.RLock()
+	req.Header.Set("X-SFDC-Session", c.accessToken)
+	c.lock.RUnlock()
+	if body != nil {
+		req.Header.Set("Content-Type", contentType+"; charset=UTF-8")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error sending bulk %s request: %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	c.logf("%s %s: %s", method, path, resp.Status)
+	c.observeLimits(resp)
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading bulk %s response: %s", method, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		bulkErr := bulkError{}
+		if err := xml.Unmarshal(data, &bulkErr); err == nil && bulkErr.ExceptionCode != "" {
+			return nil, bulkErr
+		}
+		return nil, fmt.Errorf("Bulk %s %s failed: %s", method, path, resp.Status)
+	}
+
+	return data, nil
+}
+
+//BulkUpsertSFDCObjects upserts records with a Bulk API job, matching them by
+//the external id field. The records are uploaded as CSV in batches of at
+//most maxBulkBatchRows, and the results are returned in the order of the
+//records once every batch has been processed. Empty values are left
+//unchanged by SFDC. If the batches aren't processed within the bulk timeout
+//the job is aborted and an error is returned; rows already processed by SFDC
+//stay written.
+func (c *restClient) BulkUpsertSFDCObjects(sobject force.SObject, externalIDField string,
+	records []map[string]string) ([]*SFDCBulkResult, error) {
+
+	job := &bulkJobInfo{}
+	body, err := xml.Marshal(bulkJobInfo{Operation: "upsert", Object: sobject.ApiName(),
+		ExternalIDFieldName: externalIDField, ContentType: "CSV"})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.bulkRequest("POST", "job", "application/xml", body, job)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating bulk job: %s", err)
+	}
+
+	columns := bulkColumns(externalIDField, records)
+	batches := []*bulkBatchInfo{}
+	for start := 0; start < len(records); start += maxBulkBatchRows {
+		end := start + maxBulkBatchRows
+		if end > len(records) {
+			end = len(records)
+		}
+
+		data, err := bulkCSV(columns, records[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		batch := &bulkBatchInfo{}
+		_, err = c.bulkRequest("POST", "job/"+job.ID+"/batch", "text/csv", data, batch)
+		if err != nil {
+			return nil, fmt.Errorf("Error uploading bulk batch: %s", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	body, err = xml.Marshal(bulkJobInfo{State: "Closed"})
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.bulkRequest("POST", "job/"+job.ID, "application/xml", body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error closing bulk job: %s", err)
+	}
+
+	deadline := time.Now().Add(c.config.BulkTimeout)
+	results := make([]*SFDCBulkResult, 0, len(records))
+	for i, batch := range batches {
+		rows := maxBulkBatchRows
+		if i == len(batches)-1 {
+			rows = len(records) - i*maxBulkBatchRows
+		}
+
+		batchResults, err := c.bulkBatchResults(job.ID, batch, rows, deadline)
+		if err == errBulkTimeout {
+			c.abortBulkJob(job.ID)
+			return nil, fmt.Errorf("Bulk job %s wasn't processed within %s and was aborted", job.ID,
+				c.config.BulkTimeout)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batchResults...)
+	}
+
+	return results, nil
+}
+
+//errBulkTimeout is returned by bulkBatchResults when the deadline passes
+//before the batch is processed
+var errBulkTimeout = errors.New("bulk batch wasn't processed in time")
+
+//bulkBatchResults waits for a batch to be processed and returns the results
+//of its rows. When the batch fails as a whole, every row fails with its
+//state message.
+func (c *restClient) bulkBatchResults(jobID string, batch *bulkBatchInfo, rows int,
+	deadline time.Time) ([]*SFDCBulkResult, error) {
+	path := "job/" + jobID + "/batch/" + batch.ID
+
+	for batch.State != bulkBatchCompleted {
+		if batch.State == bulkBatchFailed || batch.State == bulkBatchNotProcessed {
+			results := make([]*SFDCBulkResult, rows)
+			for i := range results {
+				results[i] = &SFDCBulkResult{Error: fmt.Sprintf("Batch %s: %s", batch.State, batch.StateMessage)}
+			}
+			return results, nil
+		}
+
+		if !time.Now().Add(c.config.BulkPollInterval).Before(deadline) {
+			return nil, errBulkTimeout
+		}
+		time.Sleep(c.config.BulkPollInterval)
+		_, err := c.bulkRequest("GET", path, "", nil, batch)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting status of bulk batch: %s", err)
+		}
+	}
+
+	data, err := c.bulkRequest("GET", path+"/result", "", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting results of bulk batch: %s", err)
+	}
+
+	results, err := parseBulkResults(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != rows {
+		return nil, fmt.Errorf("Bulk batch %s returned %d results for %d rows", batch.ID, len(results), rows)
+	}
+	return results, nil
+}
+
+//abortBulkJob stops SFDC from processing the batches of a job that are still
+//queued. It's a best effort, so errors are ignored.
+func (c *restClient) abortBulkJob(jobID string) {
+	body, err := xml.Marshal(bulkJobInfo{State: "Aborted"})
+	if err == nil {
+		c.bulkRequest("POST", "job/"+jobID, "application/xml", body, nil)
+	}
+}
+
+//bulkColumns returns the external id field followed by every other field of
+//the records, sorted
+func bulkColumns(externalIDField string, records []map[string]string) []string {
+	fields := map[string]bool{}
+	for _, record := range records {
+		for field := range record {
+			if field != externalIDField {
+				fields[field] = true
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(fields))
+	for field := range fields {
+		columns = append(columns, field)
+	}
+	sort.Strings(columns)
+
+	return append([]string{externalIDField}, columns...)
+}
+
+//bulkCSV writes the records as CSV with a header of the columns
+func bulkCSV(columns []string, records []map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	err := writer.Write(columns)
+	for _, record := range records {
+		if err != nil {
+			break
+		}
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = record[column]
+		}
+		err = writer.Write(row)
+	}
+	writer.Flush()
+
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error writing bulk batch: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+//parseBulkResults reads the CSV results of a batch, which has the columns
+//Id, Success, Created and Error
+func parseBulkResults(data []byte) ([]*SFDCBulkResult, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading bulk batch results: %s", err)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("Bulk batch results are empty")
+	}
+
+	columns := map[string]int{}
+	for i, column := range rows[0] {
+		columns[column] = i
+	}
+	value := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	results := make([]*SFDCBulkResult, len(rows)-1)
+	for i, row := range rows[1:] {
+		results[i] = &SFDCBulkResult{
+			ID:      value(row, "Id"),
+			Success: value(row, "Success") == "true",
+			Created: value(row, "Created") == "true",
+			Error:   value(row, "Error"),
+		}
+	}
+	return results, nil
+}
+
+//bulkRecord is the CSV row of an insert body
+func bulkRecord(insert sobjectPatch) map[string]string {
+	record := make(map[string]string, len(insert.Fields))
+	for field, value := range insert.Fields {
+		if s, ok := value.(string); ok {
+			record[field] = s
+		}
+	}
+	return record
+}
+
+//bulkRowResults converts the results of a bulk job into the results the
+//services report, where the row is the index of the record
+func bulkRowResults(results []*SFDCBulkResult) []*services.BulkRowResult {
+	rows := make([]*services.BulkRowResult, len(results))
+	for i, result := range results {
+		rows[i] = &services.BulkRowResult{
+			Row:     i,
+			ID:      result.ID,
+			Created: result.Created,
+			Success: result.Success,
+			Error:   result.Error,
+		}
+	}
+	return rows
+}
@@ -0,0 +1,203 @@
+package salesforce
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//fakeBulk serves the Bulk API resources of a single job. Its one batch is
+//in progress the first time its status is read, and then completes or fails,
+//or stays in progress when it's stuck.
+type fakeBulk struct {
+	server   *httptest.Server
+	job      bulkJobInfo
+	closed   bool
+	aborted  bool
+	uploaded [][]string
+	polls    int
+	failed   bool
+	stuck    bool
+}
+
+func newFakeBulk() *fakeBulk {
+	f := &fakeBulk{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/services/async/32.0/job", func(w http.ResponseWriter, r *http.Request) {
+		xml.NewDecoder(r.Body).Decode(&f.job)
+		f.job.ID = "750d0000000BULKAAA"
+		xml.NewEncoder(w).Encode(f.job)
+	})
+	mux.HandleFunc("/services/async/32.0/job/750d0000000BULKAAA", func(w http.ResponseWriter, r *http.Request) {
+		job := bulkJobInfo{}
+		xml.NewDecoder(r.Body).Decode(&job)
+		f.closed = f.closed || job.State == "Closed"
+		f.aborted = job.State == "Aborted"
+		fmt.Fprint(w, `<jobInfo xmlns="http://www.force.com/2009/06/asyncapi/dataload"><state>Closed</state></jobInfo>`)
+	})
+	mux.HandleFunc("/services/async/32.0/job/750d0000000BULKAAA/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-SFDC-Session") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<error><exceptionCode>InvalidSessionId</exceptionCode><exceptionMessage>Invalid session id</exceptionMessage></error>`)
+			return
+		}
+		f.uploaded, _ = csv.NewReader(r.Body).ReadAll()
+		fmt.Fprint(w, `<batchInfo><id>751d0000000BATCHAA</id><state>Queued</state></batchInfo>`)
+	})
+	mux.HandleFunc("/services/async/32.0/job/750d0000000BULKAAA/batch/751d0000000BATCHAA", func(w http.ResponseWriter, r *http.Request) {
+		f.polls++
+		switch {
+		case f.polls == 1 || f.stuck:
+			fmt.Fprint(w, `<batchInfo><id>751d0000000BATCHAA</id><state>InProgress</state></batchInfo>`)
+		case f.failed:
+			fmt.Fprint(w, `<batchInfo><id>751d0000000BATCHAA</id><state>Failed</state>`+
+				`<stateMessage>InvalidBatch : Field name not found : Bogus__c</stateMessage></batchInfo>`)
+		default:
+			fmt.Fprint(w, `<batchInfo><id>751d0000000BATCHAA</id><state>Completed</state></batchInfo>`)
+		}
+	})
+	mux.HandleFunc("/services/async/32.0/job/750d0000000BULKAAA/batch/751d0000000BATCHAA/result", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "\"Id\",\"Success\",\"Created\",\"Error\"\n"+
+			"\"001d000001BULK0AAA\",\"true\",\"false\",\"\"\n"+
+			"\"\",\"false\",\"false\",\"DUPLICATE_VALUE:duplicate value found\"\n")
+	})
+
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func TestBulkUpsertAccounts(t *testing.T) {
+	Convey("Given an SFDC org with the Bulk API", t, func() {
+		bulk := newFakeBulk()
+		api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("token", bulk.server.URL),
+			WithBulkPollInterval(time.Millisecond))
+
+		first, _ := entities.NewAccount("First Org")
+		first.SetSiteID(5740)
+		second, _ := entities.NewAccount("Second Org")
+		second.SetSiteID(5741)
+		accounts := []*entities.Account{first, second}
+
+		Convey("When accounts are upserted in bulk", func() {
+			results, err := api.BulkUpsertAccounts(accounts)
+			Convey("Then a CSV batch should be uploaded to an upsert job by Site ID", func() {
+				So(err, ShouldBeNil)
+				So(bulk.job.Operation, ShouldEqual, "upsert")
+				So(bulk.job.Object, ShouldEqual, "Account")
+				So(bulk.job.ExternalIDFieldName, ShouldEqual, "Clarify_Site_ID__c")
+				So(bulk.closed, ShouldBeTrue)
+				So(bulk.uploaded[0][0], ShouldEqual, "Clarify_Site_ID__c")
+				So(bulk.uploaded[0], ShouldContain, "Name")
+				So(bulk.uploaded[0], ShouldNotContain, "Id")
+				So(len(bulk.uploaded), ShouldEqual, 3)
+				So(bulk.uploaded[2][0], ShouldEqual, "5741")
+			})
+			Convey("Then the result of every row should be returned once the batch completes", func() {
+				So(bulk.polls, ShouldEqual, 2)
+				So(len(results), ShouldEqual, 2)
+				So(results[0].Success, ShouldBeTrue)
+				So(results[0].ID, ShouldEqual, "001d000001BULK0AAA")
+				So(results[1].Row, ShouldEqual, 1)
+				So(results[1].Success, ShouldBeFalse)
+				So(results[1].Error, ShouldContainSubstring, "DUPLICATE_VALUE")
+			})
+		})
+		Convey("When the batch fails", func() {
+			bulk.failed = true
+			results, err := api.BulkUpsertAccounts(accounts)
+			Convey("Then every row should fail with the batch's message", func() {
+				So(err, ShouldBeNil)
+				So(len(results), ShouldEqual, 2)
+				So(results[1].Success, ShouldBeFalse)
+				So(results[1].Error, ShouldContainSubstring, "Bogus__c")
+			})
+		})
+		Convey("When the batch isn't processed within the bulk timeout", func() {
+			bulk.stuck = true
+			api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("token", bulk.server.URL),
+				WithBulkPollInterval(time.Millisecond), WithBulkTimeout(20*time.Millisecond))
+			_, err := api.BulkUpsertAccounts(accounts)
+			Convey("Then the job should be aborted and an error returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "wasn't processed within 20ms")
+				So(bulk.aborted, ShouldBeTrue)
+				So(bulk.polls, ShouldBeGreaterThan, 1)
+			})
+		})
+		Convey("When the session has expired and can't be renewed", func() {
+			api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("expired", bulk.server.URL))
+			_, err := api.BulkUpsertAccounts(accounts)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "session has expired")
+			})
+		})
+
+		Reset(func() {
+			bulk.server.Close()
+		})
+	})
+}
+
+func TestBulkUpsertContacts(t *testing.T) {
+	Convey("Given an existing contact and a new contact", t, func() {
+		account, _ := entities.NewAccount("Test Org Name")
+		account.SetID("001d000001TweFmAAJ")
+		name, _ := entities.BuildName("", "Erik", "Tate")
+		existing, _ := entities.NewContact(name, account, entities.USD)
+		existing.SetID("003d000001TESTCAAA")
+		newName, _ := entities.BuildName("", "Jane", "Doe")
+		created, _ := entities.NewContact(newName, account, entities.USD)
+		duplicateName, _ := entities.BuildName("", "Jane", "Duplicate")
+		duplicate, _ := entities.NewContact(duplicateName, account, entities.USD)
+
+		Convey("When they're upserted in bulk", func() {
+			results, err := api.BulkUpsertContacts([]*entities.Contact{existing, created, duplicate})
+			Convey("Then contacts should be matched by SFDC ID and linked to their account", func() {
+				So(err, ShouldBeNil)
+				So(lastBulkRecords[0]["Id"], ShouldEqual, "003d000001TESTCAAA")
+				So(lastBulkRecords[1]["Id"], ShouldEqual, "")
+				So(lastBulkRecords[1]["AccountId"], ShouldEqual, "001d000001TweFmAAJ")
+				So(lastBulkRecords[1]["LastName"], ShouldEqual, "Doe")
+			})
+			Convey("Then the result of every contact should be returned", func() {
+				So(results[0].ID, ShouldEqual, "003d000001TESTCAAA")
+				So(results[1].Created, ShouldBeTrue)
+				So(results[2].Success, ShouldBeFalse)
+				So(strings.HasPrefix(results[2].Error, "DUPLICATE_VALUE"), ShouldBeTrue)
+			})
+		})
+		Convey("When the bulk job can't be created", func() {
+			getCommandError = func() error { return fmt.Errorf("fake error") }
+			_, err := api.BulkUpsertContacts([]*entities.Contact{existing})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			getCommandError = func() error { return nil }
+		})
+	})
+}
+
+func TestParseBulkResults(t *testing.T) {
+	Convey("Given batch results that aren't CSV", t, func() {
+		data := []byte("\"Id\n")
+		Convey("When they're parsed", func() {
+			_, err := parseBulkResults(data)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
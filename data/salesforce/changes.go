@@ -0,0 +1,272 @@
+package salesforce
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//changesPageSize is the most changed records returned by one call
+const changesPageSize = 2000
+
+//sfdcDateTimeFormat is the format of the datetimes in SFDC responses
+const sfdcDateTimeFormat = "2006-01-02T15:04:05.000-0700"
+
+//soqlDateTimeFormat is the format of datetime literals in SOQL
+const soqlDateTimeFormat = "2006-01-02T15:04:05Z"
+
+//ErrChangesExpired is returned when deletions older than SFDC keeps (about
+//15 days) were requested. Deleted records may have been missed, so a full
+//sync is needed.
+var ErrChangesExpired = errors.New("The deleted records since the checkpoint are no longer available")
+
+//Changes are the records of an object type that were modified or deleted
+//since a point in time. Only the slice of the requested object type is set.
+type Changes struct {
+	Accounts   []*services.AccountDTO
+	Contacts   []*services.ContactDTO
+	DeletedIDs []string
+	//More is true when there are more modified records than fit in one call.
+	//They're returned by resuming from the Checkpoint.
+	More bool
+	//Checkpoint is an opaque token to persist and resume from with
+	//ResumeChanges
+	Checkpoint string
+}
+
+//changesCheckpoint is how far changes have been read. Modified records are
+//read in order of SystemModstamp and Id, so the Id of the last record read
+//breaks ties between records modified at the same time.
+type changesCheckpoint struct {
+	Object   string    `json:"object"`
+	Modified time.Time `json:"modified"`
+	LastID   string    `json:"lastId,omitempty"`
+	Deleted  time.Time `json:"deleted"`
+}
+
+func (c changesCheckpoint) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.URLEncoding.EncodeToString(data)
+}
+
+func decodeChangesCheckpoint(token string) (changesCheckpoint, error) {
+	checkpoint := changesCheckpoint{}
+
+	data, err := base64.URLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &checkpoint)
+	}
+	if err == nil && checkpoint.Object == "" {
+		err = errors.New("no object type")
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("Invalid changes checkpoint: %s", err)
+	}
+	return checkpoint, nil
+}
+
+//changedAccount is an account along with when it was last modified
+type changedAccount struct {
+	services.AccountDTO
+	SystemModstamp string `force:"SystemModstamp"`
+}
+
+type changedAccountsQueryResponse struct {
+	SFDCQueryResponse
+	Records []*changedAccount `force:"records"`
+}
+
+//changedContact is a contact along with when it was last modified
+type changedContact struct {
+	services.ContactDTO
+	SystemModstamp string `force:"SystemModstamp"`
+}
+
+type changedContactsQueryResponse struct {
+	SFDCQueryResponse
+	Records []*changedContact `force:"records"`
+}
+
+//SFDCDeletedResponse is the response of the getDeleted resource of an object
+type SFDCDeletedResponse struct {
+	DeletedRecords []struct {
+		ID          string `force:"id"`
+		DeletedDate string `force:"deletedDate"`
+	} `force:"deletedRecords"`
+	EarliestDateAvailable string `force:"earliestDateAvailable"`
+	LatestDateCovered     string `force:"latestDateCovered"`
+}
+
+//ChangesSince returns the accounts or contacts ("Account" or "Contact")
+//modified since a point in time, by their SystemModstamp, and the ids of
+//those deleted since then. At most 2000 modified records are returned at a
+//time; the rest are returned by resuming from the checkpoint of the changes.
+func (a API) ChangesSince(objectType string, since time.Time) (*Changes, error) {
+	since = since.UTC()
+	return a.changes(changesCheckpoint{Object: objectType, Modified: since, Deleted: since})
+}
+
+//ResumeChanges returns the changes since a checkpoint returned by
+//ChangesSince or a previous ResumeChanges
+func (a API) ResumeChanges(checkpoint string) (*Changes, error) {
+	c, err := decodeChangesCheckpoint(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return a.changes(c)
+}
+
+func (a API) changes(checkpoint changesCheckpoint) (*Changes, error) {
+	//changes are read up to a fixed time so that records modified while
+	//they're read are left for the next call rather than being missed
+	until := time.Now().UTC().Truncate(time.Second)
+	changes := &Changes{}
+
+	var modified []string
+	var done bool
+	var err error
+	switch checkpoint.Object {
+	case "Account":
+		modified, done, err = a.changedAccounts(checkpoint, until, changes)
+	case "Contact":
+		modified, done, err = a.changedContacts(checkpoint, until, changes)
+	default:
+		return nil, fmt.Errorf("Changes of %s can't be read; use Account or Contact", checkpoint.Object)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting modified %s records: %s", checkpoint.Object, err)
+	}
+
+	//a full page may be followed by more records, and SFDC may return fewer
+	//records than the LIMIT in a batch, leaving the rest to its next records
+	//URL. Either way the next call resumes after the last record read.
+	changes.More = len(modified) > 0 && (len(modified) >= changesPageSize || !done)
+	if changes.More {
+		last := len(modified) - 1
+		lastModified, err := time.Parse(sfdcDateTimeFormat, modified[last])
+		if err != nil {
+			return nil, fmt.Errorf("Error reading SystemModstamp: %s", err)
+		}
+		checkpoint.Modified = lastModified.UTC()
+		checkpoint.LastID = lastRecordID(changes, last)
+	} else {
+		checkpoint.Modified = until
+		checkpoint.LastID = ""
+	}
+
+	deleted, latest, err := a.deletedSince(checkpoint.Object, checkpoint.Deleted, until)
+	if err != nil {
+		return nil, err
+	}
+	changes.DeletedIDs = deleted
+	checkpoint.Deleted = latest
+
+	changes.Checkpoint = checkpoint.encode()
+	return changes, nil
+}
+
+//changesFilter selects the records modified after the checkpoint and up to
+//until, in the order they're read in
+func changesFilter(checkpoint changesCheckpoint, until time.Time) string {
+	modified := checkpoint.Modified.UTC().Format(soqlDateTimeFormat)
+
+	filter := "SystemModstamp > " + modified
+	if checkpoint.LastID != "" {
+		filter = "(" + filter + " OR (SystemModstamp = " + modified + " AND Id > '" + checkpoint.LastID + "'))"
+	}
+
+	return fmt.Sprintf(" WHERE %s AND SystemModstamp <= %s ORDER BY SystemModstamp, Id LIMIT %d",
+		filter, until.Format(soqlDateTimeFormat), changesPageSize)
+}
+
+//changedAccounts reads the modified accounts into changes and returns their
+//SystemModstamps and whether SFDC returned every record of the query
+func (a API) changedAccounts(checkpoint changesCheckpoint, until time.Time, changes *Changes) ([]string, bool, error) {
+	response := &changedAccountsQueryResponse{}
+	query := "SELECT " + accountQueryFields + ", SystemModstamp FROM Account" + changesFilter(checkpoint, until)
+	if err := a.client.QuerySFDCObject(query, response); err != nil {
+		return nil, false, err
+	}
+
+	modified := make([]string, len(response.Records))
+	changes.Accounts = make([]*services.AccountDTO, len(response.Records))
+	for i, record := range response.Records {
+		account := record.AccountDTO
+		changes.Accounts[i] = &account
+		modified[i] = record.SystemModstamp
+	}
+	return modified, response.Done, nil
+}
+
+//changedContacts reads the modified contacts into changes and returns their
+//SystemModstamps and whether SFDC returned every record of the query
+func (a API) changedContacts(checkpoint changesCheckpoint, until time.Time, changes *Changes) ([]string, bool, error) {
+	response := &changedContactsQueryResponse{}
+	query := "SELECT " + contactQueryFields + ", SystemModstamp FROM Contact" + changesFilter(checkpoint, until)
+	if err := a.client.QuerySFDCObject(query, response); err != nil {
+		return nil, false, err
+	}
+
+	modified := make([]string, len(response.Records))
+	changes.Contacts = make([]*services.ContactDTO, len(response.Records))
+	for i, record := range response.Records {
+		contact := record.ContactDTO
+		changes.Contacts[i] = &contact
+		modified[i] = record.SystemModstamp
+	}
+	return modified, response.Done, nil
+}
+
+func lastRecordID(changes *Changes, i int) string {
+	if changes.Accounts != nil {
+		return changes.Accounts[i].SalesForceID
+	}
+	return changes.Contacts[i].SalesForceID
+}
+
+//deletedSince returns the ids of the records deleted between since and until
+//with the getDeleted resource, and the time up to which SFDC covered them.
+//SFDC covers deletions to the minute, so a range shorter than a minute is
+//left for the next call.
+func (a API) deletedSince(objectType string, since, until time.Time) ([]string, time.Time, error) {
+	deleted := []string{}
+	if until.Sub(since) < time.Minute {
+		return deleted, since, nil
+	}
+
+	params := url.Values{
+		"start": {since.UTC().Format(time.RFC3339)},
+		"end":   {until.Format(time.RFC3339)},
+	}
+	response := &SFDCDeletedResponse{}
+	err := a.client.GetSFDCResource("sobjects/"+objectType+"/deleted/?"+params.Encode(), response)
+	if err != nil {
+		return nil, since, fmt.Errorf("Error getting deleted %s records: %s", objectType, err)
+	}
+
+	if response.EarliestDateAvailable != "" {
+		earliest, err := time.Parse(sfdcDateTimeFormat, response.EarliestDateAvailable)
+		if err == nil && since.Before(earliest) {
+			return nil, since, ErrChangesExpired
+		}
+	}
+
+	for _, record := range response.DeletedRecords {
+		deleted = append(deleted, record.ID)
+	}
+
+	latest := until
+	if response.LatestDateCovered != "" {
+		covered, err := time.Parse(sfdcDateTimeFormat, response.LatestDateCovered)
+		if err != nil {
+			return nil, since, fmt.Errorf("Error reading latestDateCovered: %s", err)
+		}
+		latest = covered.UTC()
+	}
+	return deleted, latest, nil
+}
@@ -0,0 +1,96 @@
+package salesforce
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestChangesSince(t *testing.T) {
+	Convey("Given accounts that were modified and deleted", t, func() {
+		since := time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		Convey("When the changes since a point in time are requested", func() {
+			changes, err := api.ChangesSince("Account", since)
+			Convey("Then the modified accounts and the deleted ids should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(changes.Accounts), ShouldEqual, 2)
+				So(changes.Contacts, ShouldBeNil)
+				So(changes.DeletedIDs, ShouldResemble, []string{"001d000001DELETEAA"})
+				So(changes.More, ShouldBeFalse)
+				So(lastChangesQuery, ShouldContainSubstring, "WHERE SystemModstamp > 2016-03-01T00:00:00Z AND")
+				So(lastChangesQuery, ShouldContainSubstring, "ORDER BY SystemModstamp, Id")
+			})
+			Convey("Then the checkpoint should cover the deletions SFDC reported", func() {
+				checkpoint, err := decodeChangesCheckpoint(changes.Checkpoint)
+				So(err, ShouldBeNil)
+				So(checkpoint.Object, ShouldEqual, "Account")
+				So(checkpoint.Deleted, ShouldResemble, time.Date(2016, 3, 2, 0, 0, 0, 0, time.UTC))
+				So(checkpoint.LastID, ShouldEqual, "")
+			})
+		})
+		Convey("When more accounts were modified than fit in one call", func() {
+			changedRecordCount = changesPageSize + 1
+			changes, err := api.ChangesSince("Account", since)
+			Convey("Then a page should be returned with a checkpoint to resume from", func() {
+				So(err, ShouldBeNil)
+				So(changes.More, ShouldBeTrue)
+				So(len(changes.Accounts), ShouldEqual, changesPageSize)
+
+				changedRecordCount = 1
+				resumed, err := api.ResumeChanges(changes.Checkpoint)
+				So(err, ShouldBeNil)
+				So(resumed.More, ShouldBeFalse)
+				So(lastChangesQuery, ShouldContainSubstring,
+					"(SystemModstamp > 2016-03-01T12:00:00Z OR (SystemModstamp = 2016-03-01T12:00:00Z AND Id > '001d000001CHG1999A'))")
+				So(lastChangesQuery, ShouldEndWith, "LIMIT 2000")
+			})
+		})
+		Convey("When SFDC returns fewer records in a batch than the query matched", func() {
+			queryBatchSize = 200
+			changedRecordCount = 500
+			changes, err := api.ChangesSince("Account", since)
+			Convey("Then the batch should be returned with a checkpoint after its last record", func() {
+				So(err, ShouldBeNil)
+				So(changes.More, ShouldBeTrue)
+				So(len(changes.Accounts), ShouldEqual, 200)
+				checkpoint, _ := decodeChangesCheckpoint(changes.Checkpoint)
+				So(checkpoint.LastID, ShouldEqual, "001d000001CHG0199A")
+			})
+		})
+		Convey("When the changes of contacts are requested", func() {
+			changes, err := api.ChangesSince("Contact", since)
+			Convey("Then the modified contacts should be returned", func() {
+				So(err, ShouldBeNil)
+				So(changes.Contacts[0].SalesForceID, ShouldEqual, "003d000001CHANGEAA")
+				So(changes.More, ShouldBeFalse)
+			})
+		})
+		Convey("When the deletions since then are no longer kept", func() {
+			earliestDeletedDate = "2016-03-15T00:00:00.000+0000"
+			_, err := api.ChangesSince("Account", since)
+			Convey("Then ErrChangesExpired should be returned", func() {
+				So(err, ShouldEqual, ErrChangesExpired)
+			})
+		})
+		Convey("When the changes of another object type are requested", func() {
+			_, err := api.ChangesSince("Opportunity", since)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When an invalid checkpoint is resumed", func() {
+			_, err := api.ResumeChanges("not a checkpoint")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			changedRecordCount = 2
+			queryBatchSize = 2000
+			earliestDeletedDate = "2016-01-01T00:00:00.000+0000"
+		})
+	})
+}
@@ -0,0 +1,140 @@
+package salesforce
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+)
+
+//maxCompositeSubrequests is the most subrequests SFDC accepts in one
+//composite request
+const maxCompositeSubrequests = 25
+
+//processingHaltedErrorCode is returned for the subrequests that weren't run
+//because an earlier one failed in an all-or-none composite request
+const processingHaltedErrorCode = "PROCESSING_HALTED"
+
+//SFDCCompositeSubrequest is one request of a composite request. Later
+//subrequests can use the results of earlier ones with references like
+//"@{newAccount.id}", in the ID or in the fields of the Body.
+type SFDCCompositeSubrequest struct {
+	Method string
+	//SObject is the object type the request is for
+	SObject force.SObject
+	//ID of the record, if any. It isn't escaped so that it can be a reference.
+	ID string
+	//Fields limits the fields read by a GET
+	Fields []string
+	//Body is sent with POST and PATCH requests
+	Body        interface{}
+	ReferenceID string
+}
+
+//path is the subrequest's path relative to the versioned data URL
+func (r *SFDCCompositeSubrequest) path() string {
+	path := "sobjects/" + r.SObject.ApiName()
+	if r.ID != "" {
+		path += "/" + r.ID
+	}
+	if len(r.Fields) > 0 {
+		path += "?fields=" + strings.Join(r.Fields, ",")
+	}
+	return path
+}
+
+//SFDCCompositeResult is the result of one subrequest of a composite request
+type SFDCCompositeResult struct {
+	ReferenceID    string          `force:"referenceId"`
+	HTTPStatusCode int             `force:"httpStatusCode"`
+	Body           json.RawMessage `force:"body"`
+}
+
+//Err returns the SFDC errors of a failed subrequest, or nil if it succeeded
+func (r *SFDCCompositeResult) Err() error {
+	if r.HTTPStatusCode < 300 {
+		return nil
+	}
+
+	apiErrors := force.ApiErrors{}
+	if err := json.Unmarshal(r.Body, &apiErrors); err == nil && apiErrors.Validate() {
+		return apiErrors
+	}
+	return fmt.Errorf("%s failed with status %d", r.ReferenceID, r.HTTPStatusCode)
+}
+
+//halted reports whether the subrequest wasn't run because another failed
+func (r *SFDCCompositeResult) halted() bool {
+	apiErrors, ok := r.Err().(force.ApiErrors)
+	return ok && len(apiErrors) == 1 && apiErrors[0].ErrorCode == processingHaltedErrorCode
+}
+
+type compositeRequest struct {
+	AllOrNone        bool                  `force:"allOrNone"`
+	CompositeRequest []compositeSubrequest `force:"compositeRequest"`
+}
+
+type compositeSubrequest struct {
+	Method      string      `force:"method"`
+	URL         string      `force:"url"`
+	ReferenceID string      `force:"referenceId"`
+	Body        interface{} `force:"body,omitempty"`
+}
+
+type compositeResponse struct {
+	CompositeResponse []*SFDCCompositeResult `force:"compositeResponse"`
+}
+
+//newCompositeRequest builds the body of a composite request for the given
+//API version
+func newCompositeRequest(version string, allOrNone bool, requests []*SFDCCompositeSubrequest) (compositeRequest, error) {
+	if err := checkCompositeSize(requests); err != nil {
+		return compositeRequest{}, err
+	}
+
+	composite := compositeRequest{
+		AllOrNone:        allOrNone,
+		CompositeRequest: make([]compositeSubrequest, len(requests)),
+	}
+	for i, r := range requests {
+		composite.CompositeRequest[i] = compositeSubrequest{
+			Method:      r.Method,
+			URL:         "/services/data/" + version + "/" + r.path(),
+			ReferenceID: r.ReferenceID,
+			Body:        r.Body,
+		}
+	}
+	return composite, nil
+}
+
+//checkCompositeSize checks that SFDC accepts the number of subrequests
+func checkCompositeSize(requests []*SFDCCompositeSubrequest) error {
+	if len(requests) > maxCompositeSubrequests {
+		return fmt.Errorf("A composite request can have at most %d subrequests (%d given)",
+			maxCompositeSubrequests, len(requests))
+	}
+	return nil
+}
+
+//compositeError returns the first error of the results, skipping the
+//subrequests that were halted because of it
+func compositeError(results []*SFDCCompositeResult) error {
+	for _, result := range results {
+		if result.Err() != nil && !result.halted() {
+			return fmt.Errorf("%s: %s", result.ReferenceID, result.Err())
+		}
+	}
+	for _, result := range results {
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("%s: %s", result.ReferenceID, err)
+		}
+	}
+	return nil
+}
+
+//compositeReference is a reference to the id of an earlier subrequest's
+//result
+func compositeReference(referenceID string) string {
+	return "@{" + referenceID + ".id}"
+}
@@ -0,0 +1,71 @@
+package salesforce
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+func TestCompositeRequest(t *testing.T) {
+	Convey("Given an SFDC org that accepts composite requests", t, func() {
+		var sent map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/services/data/v32.0/composite" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&sent)
+			fmt.Fprint(w, `{"compositeResponse": [
+				{"referenceId": "newAccount", "httpStatusCode": 201, "body": {"id": "001d000001NEWACCAA", "success": true}},
+				{"referenceId": "newAccountSiteID", "httpStatusCode": 200, "body": {"Id": "001d000001NEWACCAA", "Clarify_Site_ID__c": "5740"}}
+			]}`)
+		}))
+		api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("token", server.URL))
+
+		Convey("When an account is created", func() {
+			account, _ := entities.NewAccount("Test Org Name")
+			id, siteID, err := api.CreateAccount(account)
+			Convey("Then the insert and read back should be sent together", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "001d000001NEWACCAA")
+				So(siteID, ShouldEqual, 5740)
+				So(sent["allOrNone"], ShouldEqual, true)
+
+				requests := sent["compositeRequest"].([]interface{})
+				So(len(requests), ShouldEqual, 2)
+				So(requests[0].(map[string]interface{})["url"], ShouldEqual, "/services/data/v32.0/sobjects/Account")
+				So(requests[0].(map[string]interface{})["body"].(map[string]interface{})["Name"], ShouldEqual, "Test Org Name")
+				So(requests[1].(map[string]interface{})["url"], ShouldEqual,
+					"/services/data/v32.0/sobjects/Account/@{newAccount.id}?fields=Id,Clarify_Site_ID__c")
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestCompositeError(t *testing.T) {
+	Convey("Given the results of a failed all-or-none composite request", t, func() {
+		results := []*SFDCCompositeResult{
+			{ReferenceID: "newAccount", HTTPStatusCode: 400,
+				Body: json.RawMessage(`[{"errorCode": "PROCESSING_HALTED", "message": "halted"}]`)},
+			{ReferenceID: "newContact0", HTTPStatusCode: 400,
+				Body: json.RawMessage(`[{"errorCode": "REQUIRED_FIELD_MISSING", "message": "LastName is required"}]`)},
+		}
+		Convey("When the error is read", func() {
+			err := compositeError(results)
+			Convey("Then the subrequest that caused the failure should be reported", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "newContact0")
+				So(err.Error(), ShouldContainSubstring, "REQUIRED_FIELD_MISSING")
+			})
+		})
+	})
+}
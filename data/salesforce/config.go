@@ -0,0 +1,336 @@
+package salesforce
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/spf13/viper"
+)
+
+//DefaultTimeout bounds every request to SFDC unless another timeout or an
+//http.Client with its own timeout is given
+const DefaultTimeout = 30 * time.Second
+
+//DefaultBulkPollInterval is how often the status of a bulk job is checked
+//unless another interval is given
+const DefaultBulkPollInterval = 5 * time.Second
+
+//DefaultBulkTimeout is how long a bulk job is waited for unless another
+//timeout is given
+const DefaultBulkTimeout = 30 * time.Minute
+
+//Login URLs of the SFDC environments
+const (
+	ProductionLoginURL = "https://login.salesforce.com"
+	SandboxLoginURL    = "https://test.salesforce.com"
+)
+
+//Logger receives a line for every request sent to SFDC. *log.Logger
+//satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+//Config holds the settings used to connect to SFDC. It's built by the
+//options passed to NewAPIWithConfig.
+type Config struct {
+	Version       string
+	ClientID      string
+	ClientSecret  string
+	UserName      string
+	Password      string
+	SecurityToken string
+	//PrivateKey signs the assertions of the JWT bearer flow
+	PrivateKey *rsa.PrivateKey
+	//AccessToken and InstanceURL are a session issued outside of webcore
+	AccessToken string
+	InstanceURL string
+	TokenSource TokenSource
+	//Environment is either "production" or "sandbox"
+	Environment string
+	//LoginURL overrides the login URL of the environment
+	LoginURL     string
+	HTTPClient   *http.Client
+	Timeout      time.Duration
+	Logger       Logger
+	FieldMapping *FieldMapping
+	//BulkPollInterval is how often the status of a bulk job is checked
+	BulkPollInterval time.Duration
+	//BulkTimeout is how long the batches of a bulk job are waited for
+	BulkTimeout time.Duration
+	LimitPolicy LimitPolicy
+}
+
+//Option sets part of a Config
+type Option func(*Config) error
+
+//WithVersion sets the version of the SFDC API (ex. "v32.0")
+func WithVersion(version string) Option {
+	return func(c *Config) error {
+		c.Version = version
+		return nil
+	}
+}
+
+//WithCredentials sets the Connected App and user used to log in with the
+//OAuth username-password flow
+func WithCredentials(clientID, clientSecret, userName, password, securityToken string) Option {
+	return func(c *Config) error {
+		c.ClientID = clientID
+		c.ClientSecret = clientSecret
+		c.UserName = userName
+		c.Password = password
+		c.SecurityToken = securityToken
+		return nil
+	}
+}
+
+//WithEnvironment sets the environment, either "production" or "sandbox"
+func WithEnvironment(environment string) Option {
+	return func(c *Config) error {
+		if environment != "production" && environment != "sandbox" {
+			return errors.New(`environment must be either "production" or "sandbox"`)
+		}
+		c.Environment = environment
+		return nil
+	}
+}
+
+//WithLoginURL logs in at a URL other than that of the environment (ex. a
+//My Domain URL)
+func WithLoginURL(loginURL string) Option {
+	return func(c *Config) error {
+		c.LoginURL = loginURL
+		return nil
+	}
+}
+
+//WithHTTPClient sends every request with the given client
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Config) error {
+		if client == nil {
+			return errors.New("the HTTP client can't be nil")
+		}
+		c.HTTPClient = client
+		return nil
+	}
+}
+
+//WithTimeout bounds every request to SFDC. A timeout of 0 leaves requests
+//unbounded.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Config) error {
+		if timeout < 0 {
+			return errors.New("the timeout can't be negative")
+		}
+		c.Timeout = timeout
+		return nil
+	}
+}
+
+//WithLogger logs every request sent to SFDC
+func WithLogger(logger Logger) Option {
+	return func(c *Config) error {
+		c.Logger = logger
+		return nil
+	}
+}
+
+//WithBulkPollInterval sets how often the status of a bulk job is checked
+func WithBulkPollInterval(interval time.Duration) Option {
+	return func(c *Config) error {
+		if interval <= 0 {
+			return errors.New("the bulk poll interval must be positive")
+		}
+		c.BulkPollInterval = interval
+		return nil
+	}
+}
+
+//WithBulkTimeout sets how long the batches of a bulk job are waited for
+//before the job is aborted
+func WithBulkTimeout(timeout time.Duration) Option {
+	return func(c *Config) error {
+		if timeout <= 0 {
+			return errors.New("the bulk timeout must be positive")
+		}
+		c.BulkTimeout = timeout
+		return nil
+	}
+}
+
+//WithFieldMappingFile maps the names of the DTOs to those of the org with
+//the mapping in the given file (see LoadFieldMapping)
+func WithFieldMappingFile(path string) Option {
+	return func(c *Config) error {
+		mapping, err := LoadFieldMappingFile(path)
+		if err != nil {
+			return err
+		}
+		c.FieldMapping = mapping
+		return nil
+	}
+}
+
+//FromEnv reads the settings in the BBWEBCORE_SFDC* environmental variables
+//(see the package documentation). Variables that aren't set leave the
+//settings unchanged, so options after FromEnv override it and options
+//before it supply defaults.
+func FromEnv() Option {
+	return func(c *Config) error {
+		getConfigSettings()
+		return configFromViper(c, viperSFDC)
+	}
+}
+
+//FromEnvFor reads the settings of a named connection (see Connections) from
+//environmental variables prefixed with BBWEBCORE_<NAME>_ rather than
+//BBWEBCORE_, ex. BBWEBCORE_SANDBOX_SFDCUSERNAME for the "sandbox" connection.
+func FromEnvFor(name string) Option {
+	return func(c *Config) error {
+		v := viper.New()
+		v.SetEnvPrefix("bbwebcore_" + name)
+		v.AutomaticEnv()
+		return configFromViper(c, v)
+	}
+}
+
+func configFromViper(c *Config, v *viper.Viper) error {
+	settings := map[string]*string{
+		"sfdcVersion":      &c.Version,
+		"sfdcClientId":     &c.ClientID,
+		"sfdcClientSecret": &c.ClientSecret,
+		"sfdcUserName":     &c.UserName,
+		"sfdcPassword":     &c.Password,
+		"sfdcToken":        &c.SecurityToken,
+	}
+	for key, setting := range settings {
+		if value := v.GetString(key); value != "" {
+			*setting = value
+		}
+	}
+
+	if environment := v.GetString("sfdcEnvironment"); environment != "" {
+		if err := WithEnvironment(environment)(c); err != nil {
+			return err
+		}
+	}
+
+	if path := v.GetString("sfdcPrivateKeyFile"); path != "" {
+		err := WithJWTKeyFile(c.ClientID, c.UserName, path)(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if token := v.GetString("sfdcAccessToken"); token != "" {
+		err := WithAccessToken(token, v.GetString("sfdcInstanceUrl"))(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if path := v.GetString("sfdcFieldMapping"); path != "" {
+		return WithFieldMappingFile(path)(c)
+	}
+
+	return nil
+}
+
+//NewAPIWithConfig connects to SFDC with the settings of the given options and
+//returns an API that uses the connection. Sessions are started with, in order
+//of preference, a TokenSource, the JWT bearer flow or the username-password
+//flow; an access token is used until it expires. Unlike NewAPI it returns an error
+//rather than panicking if the settings are incomplete or the login fails.
+//
+//	api, err := salesforce.NewAPIWithConfig(salesforce.FromEnv(),
+//		salesforce.WithTimeout(10*time.Second))
+func NewAPIWithConfig(options ...Option) (API, error) {
+	config, err := newConfig(options)
+	if err != nil {
+		return API{}, err
+	}
+
+	client, err := newRESTClient(config)
+	if err != nil {
+		return API{}, err
+	}
+
+	return API{client: newMappedClient(client, config.FieldMapping), monitor: client.monitor}, nil
+}
+
+//newConfig applies the options to the default settings
+func newConfig(options []Option) (Config, error) {
+	config := Config{Environment: "production", Timeout: DefaultTimeout,
+		BulkPollInterval: DefaultBulkPollInterval, BulkTimeout: DefaultBulkTimeout}
+
+	for _, option := range options {
+		if err := option(&config); err != nil {
+			return config, fmt.Errorf("Error configuring the SFDC API: %s", err)
+		}
+	}
+	return config, nil
+}
+
+//validate checks that the config has a version and a way to start a session
+func (c Config) validate() error {
+	if c.Version == "" {
+		return errors.New("Missing SFDC settings: version")
+	}
+
+	switch {
+	case c.AccessToken != "" || c.TokenSource != nil:
+		return nil
+	case c.PrivateKey != nil:
+		return missingSettings(map[string]string{"client id": c.ClientID, "user name": c.UserName},
+			"client id", "user name")
+	}
+
+	return missingSettings(map[string]string{
+		"client id":     c.ClientID,
+		"client secret": c.ClientSecret,
+		"user name":     c.UserName,
+		"password":      c.Password,
+	}, "client id", "client secret", "user name", "password")
+}
+
+func missingSettings(settings map[string]string, names ...string) error {
+	missing := []string{}
+	for _, name := range names {
+		if settings[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Missing SFDC settings: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (c Config) loginURL() string {
+	if c.LoginURL != "" {
+		return strings.TrimSuffix(c.LoginURL, "/")
+	}
+	if c.Environment == "sandbox" {
+		return SandboxLoginURL
+	}
+	return ProductionLoginURL
+}
+
+func (c Config) httpClient() *http.Client {
+	client := &http.Client{}
+	if c.HTTPClient != nil {
+		copied := *c.HTTPClient
+		client = &copied
+	}
+
+	if c.Timeout > 0 && client.Timeout == 0 {
+		client.Timeout = c.Timeout
+	}
+	return client
+}
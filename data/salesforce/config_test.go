@@ -0,0 +1,144 @@
+package salesforce
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+//fakeSFDC serves the OAuth token endpoint and a contact query. Requests
+//with the expiredToken are rejected as having an invalid session, and the
+//JWT bearer flow is accepted for assertions signed with jwtKey.
+type fakeSFDC struct {
+	server       *httptest.Server
+	logins       int
+	expiredToken string
+	jwtKey       *rsa.PrivateKey
+}
+
+func newFakeSFDC() *fakeSFDC {
+	f := &fakeSFDC{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/services/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") == "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			if f.jwtKey == nil || verifyJWT(r.FormValue("assertion"), &f.jwtKey.PublicKey) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "invalid assertion"}`)
+				return
+			}
+		} else if r.FormValue("username") != "user@example.com" || r.FormValue("password") != "secrettoken" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "authentication failure"}`)
+			return
+		}
+		f.logins++
+		fmt.Fprintf(w, `{"access_token": "token%d", "instance_url": "%s"}`, f.logins, f.server.URL)
+	})
+
+	mux.HandleFunc("/services/data/v32.0/query", func(w http.ResponseWriter, r *http.Request) {
+		if f.expiredToken != "" && r.Header.Get("Authorization") == "Bearer "+f.expiredToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `[{"message": "Session expired or invalid", "errorCode": "INVALID_SESSION_ID"}]`)
+			return
+		}
+		if r.URL.Query().Get("q") != "SELECT Id FROM Contact" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `[{"message": "unexpected token", "errorCode": "MALFORMED_QUERY"}]`)
+			return
+		}
+		fmt.Fprint(w, `{"totalSize": 1, "done": true, "records": [{"Id": "003d000001TESTCAAA"}]}`)
+	})
+
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeSFDC) options() []Option {
+	return []Option{
+		WithVersion("v32.0"),
+		WithCredentials("clientid", "clientsecret", "user@example.com", "secret", "token"),
+		WithLoginURL(f.server.URL),
+	}
+}
+
+func TestNewAPIWithConfig(t *testing.T) {
+	Convey("Given an SFDC org", t, func() {
+		sfdc := newFakeSFDC()
+
+		Convey("When the API is created with valid credentials", func() {
+			var logs bytes.Buffer
+			options := append(sfdc.options(), WithLogger(log.New(&logs, "", 0)))
+			api, err := NewAPIWithConfig(options...)
+			Convey("Then queries should be sent to the org's instance", func() {
+				So(err, ShouldBeNil)
+				contacts, err := api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+				So(contacts[0].SalesForceID, ShouldEqual, "003d000001TESTCAAA")
+				So(logs.String(), ShouldContainSubstring, "GET query: 200 OK")
+			})
+			Convey("Then SFDC errors should be returned", func() {
+				_, err := api.QueryContacts("SELECT FROM Contact")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "MALFORMED_QUERY")
+			})
+			Convey("Then an expired session should be renewed", func() {
+				sfdc.expiredToken = "token1"
+				_, err := api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+				So(sfdc.logins, ShouldEqual, 2)
+			})
+		})
+		Convey("When the credentials are wrong", func() {
+			options := append(sfdc.options(), WithCredentials("clientid", "clientsecret", "user@example.com", "wrong", ""))
+			_, err := NewAPIWithConfig(options...)
+			Convey("Then the login error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "authentication failure")
+			})
+		})
+		Convey("When settings are missing", func() {
+			_, err := NewAPIWithConfig(WithVersion("v32.0"))
+			Convey("Then the missing settings should be named", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "client id, client secret, user name, password")
+			})
+		})
+		Convey("When an option is invalid", func() {
+			_, err := NewAPIWithConfig(WithEnvironment("staging"))
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			sfdc.server.Close()
+		})
+	})
+}
+
+func TestConfigHTTPClient(t *testing.T) {
+	Convey("Given a config", t, func() {
+		config := Config{Timeout: DefaultTimeout}
+		Convey("When no HTTP client is given", func() {
+			Convey("Then the timeout should be used", func() {
+				So(config.httpClient().Timeout, ShouldEqual, DefaultTimeout)
+			})
+		})
+		Convey("When an HTTP client with its own timeout is given", func() {
+			client := &http.Client{Timeout: time.Second}
+			WithHTTPClient(client)(&config)
+			Convey("Then its timeout should be kept", func() {
+				So(config.httpClient().Timeout, ShouldEqual, time.Second)
+				So(config.httpClient(), ShouldNotEqual, client)
+			})
+		})
+	})
+}
@@ -0,0 +1,166 @@
+package salesforce
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/gorilla/context"
+)
+
+//Connections is a registry of APIs connected to different SFDC orgs, ex. a
+//"production" org that's read from and a "sandbox" org that's written to.
+//Each API has its own credentials and session, so an expired session in one
+//org is renewed without affecting the others.
+type Connections struct {
+	lock        sync.RWMutex
+	apis        map[string]API
+	defaultName string
+}
+
+//NewConnections returns an empty registry
+func NewConnections() *Connections {
+	return &Connections{apis: map[string]API{}}
+}
+
+//Add registers an API under a name. The first API added is the default.
+func (c *Connections) Add(name string, api API) error {
+	if name == "" {
+		return fmt.Errorf("SFDC connections must be named")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.apis[name]; ok {
+		return fmt.Errorf("SFDC connection %q already exists", name)
+	}
+
+	c.apis[name] = api
+	if c.defaultName == "" {
+		c.defaultName = name
+	}
+	return nil
+}
+
+//Connect connects to an org with the given options and registers the API
+//under a name, ex.
+//
+//	connections.Connect("sandbox", salesforce.FromEnvFor("sandbox"))
+func (c *Connections) Connect(name string, options ...Option) (API, error) {
+	api, err := NewAPIWithConfig(options...)
+	if err != nil {
+		return API{}, fmt.Errorf("Error connecting to SFDC connection %q: %s", name, err)
+	}
+
+	return api, c.Add(name, api)
+}
+
+//Get returns the API registered under a name
+func (c *Connections) Get(name string) (API, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	api, ok := c.apis[name]
+	if !ok {
+		return API{}, fmt.Errorf("SFDC connection %q doesn't exist", name)
+	}
+	return api, nil
+}
+
+//Default returns the default API
+func (c *Connections) Default() (API, error) {
+	c.lock.RLock()
+	name := c.defaultName
+	c.lock.RUnlock()
+
+	if name == "" {
+		return API{}, fmt.Errorf("No SFDC connections have been added")
+	}
+	return c.Get(name)
+}
+
+//SetDefault makes a registered API the default
+func (c *Connections) SetDefault(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.apis[name]; !ok {
+		return fmt.Errorf("SFDC connection %q doesn't exist", name)
+	}
+	c.defaultName = name
+	return nil
+}
+
+//Remove unregisters an API. If it was the default there's no default until
+//another is set.
+func (c *Connections) Remove(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.apis, name)
+	if c.defaultName == name {
+		c.defaultName = ""
+	}
+}
+
+//Names returns the names of the registered APIs, sorted
+func (c *Connections) Names() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	names := make([]string, 0, len(c.apis))
+	for name := range c.apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type connectionKey int
+
+const requestAPIKey connectionKey = 0
+
+//ConnectionSelector returns the name of the connection a request should use.
+//An empty name selects the default.
+type ConnectionSelector func(r *http.Request) string
+
+//HeaderSelector selects connections by the value of a request header
+func HeaderSelector(header string) ConnectionSelector {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+//Handler selects a connection for each request and stores its API in the
+//request's gorilla/context, where RequestAPI reads it. Requests naming a
+//connection that doesn't exist are rejected with a 400. As with any
+//gorilla/context value, the API is cleared at the end of the request by
+//mux.Router or context.ClearHandler.
+func (c *Connections) Handler(selector ConnectionSelector, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var api API
+		var err error
+
+		if name := selector(r); name != "" {
+			api, err = c.Get(name)
+		} else {
+			api, err = c.Default()
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		context.Set(r, requestAPIKey, api)
+		next.ServeHTTP(w, r)
+	})
+}
+
+//RequestAPI returns the API selected for a request by Connections.Handler
+func RequestAPI(r *http.Request) (API, bool) {
+	api, ok := context.Get(r, requestAPIKey).(API)
+	return api, ok
+}
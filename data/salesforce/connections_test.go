@@ -0,0 +1,118 @@
+package salesforce
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/gorilla/context"
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnections(t *testing.T) {
+	Convey("Given connections to two orgs", t, func() {
+		production, sandbox := newFakeSFDC(), newFakeSFDC()
+		connections := NewConnections()
+		_, err := connections.Connect("production", production.options()...)
+		So(err, ShouldBeNil)
+		_, err = connections.Connect("sandbox", sandbox.options()...)
+		So(err, ShouldBeNil)
+
+		Convey("Then the first connection should be the default", func() {
+			So(connections.Names(), ShouldResemble, []string{"production", "sandbox"})
+			api, err := connections.Default()
+			So(err, ShouldBeNil)
+			So(api.client.(*restClient).instanceURL, ShouldEqual, production.server.URL)
+		})
+		Convey("When the sandbox session expires", func() {
+			sandbox.expiredToken = "token1"
+			api, _ := connections.Get("sandbox")
+			_, err := api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then only the sandbox session should be renewed", func() {
+				So(err, ShouldBeNil)
+				So(sandbox.logins, ShouldEqual, 2)
+				So(production.logins, ShouldEqual, 1)
+			})
+		})
+		Convey("When a connection is added twice", func() {
+			err := connections.Add("sandbox", api)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When a connection doesn't exist", func() {
+			_, err := connections.Get("uat")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(connections.SetDefault("uat"), ShouldNotBeNil)
+			})
+		})
+		Convey("When the default connection is removed", func() {
+			connections.Remove("production")
+			_, err := connections.Default()
+			Convey("Then there should be no default", func() {
+				So(err, ShouldNotBeNil)
+				So(connections.SetDefault("sandbox"), ShouldBeNil)
+			})
+		})
+
+		Convey("When requests select a connection by header", func() {
+			var selected *restClient
+			handler := connections.Handler(HeaderSelector("X-SFDC-Org"),
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					api, ok := RequestAPI(r)
+					So(ok, ShouldBeTrue)
+					selected = api.client.(*restClient)
+				}))
+			serve := func(org string) int {
+				r, _ := http.NewRequest("GET", "/accounts", nil)
+				if org != "" {
+					r.Header.Set("X-SFDC-Org", org)
+				}
+				w := httptest.NewRecorder()
+				context.ClearHandler(handler).ServeHTTP(w, r)
+				return w.Code
+			}
+
+			Convey("Then the named connection should be used", func() {
+				So(serve("sandbox"), ShouldEqual, 200)
+				So(selected.instanceURL, ShouldEqual, sandbox.server.URL)
+			})
+			Convey("Then the default connection should be used without a name", func() {
+				So(serve(""), ShouldEqual, 200)
+				So(selected.instanceURL, ShouldEqual, production.server.URL)
+			})
+			Convey("Then an unknown connection should be rejected", func() {
+				So(serve("uat"), ShouldEqual, 400)
+			})
+		})
+
+		Reset(func() {
+			production.server.Close()
+			sandbox.server.Close()
+		})
+	})
+}
+
+func TestFromEnvFor(t *testing.T) {
+	Convey("Given settings for a named connection in the environment", t, func() {
+		os.Setenv("BBWEBCORE_SANDBOX_SFDCUSERNAME", "sandbox@example.com")
+		os.Setenv("BBWEBCORE_SANDBOX_SFDCENVIRONMENT", "sandbox")
+
+		Convey("When the connection's settings are read", func() {
+			config := Config{}
+			err := FromEnvFor("sandbox")(&config)
+			Convey("Then only its variables should be used", func() {
+				So(err, ShouldBeNil)
+				So(config.UserName, ShouldEqual, "sandbox@example.com")
+				So(config.loginURL(), ShouldEqual, SandboxLoginURL)
+			})
+		})
+
+		Reset(func() {
+			os.Unsetenv("BBWEBCORE_SANDBOX_SFDCUSERNAME")
+			os.Unsetenv("BBWEBCORE_SANDBOX_SFDCENVIRONMENT")
+		})
+	})
+}
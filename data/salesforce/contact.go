@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/blackbaudIT/webcore/entities"
 	"github.com/blackbaudIT/webcore/services"
 )
 
@@ -13,6 +14,18 @@ type SFDCContact struct {
 	services.ContactDTO
 }
 
+//contactQueryFields are the Contact fields, including those of its account and
+//roles, mapped onto services.ContactDTO
+const contactQueryFields = "Id, Salutation, FirstName, LastName, Email, Phone, Fax, Title, AccountId, AccountName__c," +
+	"SFDC_Contact_Status__c, CurrencyIsoCode, BBAuthID__c, BBAuth_Email__c, BBAuth_First_Name__c," +
+	"BBAuth_Last_Name__c, Default_Account__c, Account.Name, Account.Id, Account.Clarify_Site_ID__c," +
+	"Account.Business_unit__c, Account.Industry, Account.Payer__c," +
+	"Account.Billing_street__c, Account.Billing_City__c, Account.Billing_State_Province__c," +
+	"Account.Billing_Zip_Postal_Code__c, Account.Billing_Country__c," +
+	"Account.Physical_Street__c, Account.Physical_City__c, Account.Physical_State_Province__c," +
+	"Account.Physical_Zip_Postal_Code__c, Account.Physical_Country__c, " +
+	"(SELECT Role_Type__c, Role_Name__c, Role_Status__c FROM Contact_Roles1__r)"
+
 //SFDCContactQueryResponse wraps the base SFDCQueryResponse and attaches a slice of SFDCContact pointers which will be written into.
 type SFDCContactQueryResponse struct {
 	SFDCQueryResponse
@@ -71,16 +84,7 @@ func (a API) GetByAuthID(id string) (string, error) {
 		return "", fmt.Errorf("BBAuthID incorrectly formatted: %s", err)
 	}
 
-	query := "SELECT Id, Salutation, FirstName, LastName, Email, Phone, Fax, Title, AccountId, AccountName__c," +
-		"SFDC_Contact_Status__c, CurrencyIsoCode, BBAuthID__c, BBAuth_Email__c, BBAuth_First_Name__c," +
-		"BBAuth_Last_Name__c, Default_Account__c, Account.Name, Account.Id, Account.Clarify_Site_ID__c," +
-		"Account.Business_unit__c, Account.Industry, Account.Payer__c," +
-		"Account.Billing_street__c, Account.Billing_City__c, Account.Billing_State_Province__c," +
-		"Account.Billing_Zip_Postal_Code__c, Account.Billing_Country__c," +
-		"Account.Physical_Street__c, Account.Physical_City__c, Account.Physical_State_Province__c," +
-		"Account.Physical_Zip_Postal_Code__c, Account.Physical_Country__c, " +
-		"(SELECT Role_Type__c, Role_Name__c, Role_Status__c FROM Contact_Roles1__r) " +
-		"FROM Contact WHERE BBAuthID__c = '" + id + "'"
+	query := "SELECT " + contactQueryFields + " FROM Contact WHERE BBAuthID__c = '" + id + "'"
 
 	return query, nil
 }
@@ -94,16 +98,7 @@ func (a API) GetByEmail(email string) (string, error) {
 		return "", fmt.Errorf("Email incorrectly formatted: %s", err)
 	}
 
-	query := "SELECT Id, Salutation, FirstName, LastName, Email, Phone, Fax, Title, AccountId, AccountName__c," +
-		"SFDC_Contact_Status__c, CurrencyIsoCode, BBAuthID__c, BBAuth_Email__c, BBAuth_First_Name__c," +
-		"BBAuth_Last_Name__c, Default_Account__c, Account.Name, Account.Id, Account.Clarify_Site_ID__c," +
-		"Account.Business_unit__c, Account.Industry, Account.Payer__c," +
-		"Account.Billing_street__c, Account.Billing_City__c, Account.Billing_State_Province__c," +
-		"Account.Billing_Zip_Postal_Code__c, Account.Billing_Country__c," +
-		"Account.Physical_Street__c, Account.Physical_City__c, Account.Physical_State_Province__c," +
-		"Account.Physical_Zip_Postal_Code__c, Account.Physical_Country__c, " +
-		"(SELECT Role_Type__c, Role_Name__c, Role_Status__c FROM Contact_Roles1__r) " +
-		"FROM Contact WHERE BBAuth_Email__c = '" + email + "'"
+	query := "SELECT " + contactQueryFields + " FROM Contact WHERE BBAuth_Email__c = '" + email + "'"
 
 	return query, nil
 }
@@ -111,34 +106,107 @@ func (a API) GetByEmail(email string) (string, error) {
 //GetByIDs returns a contact query string that selects contacts with the given
 //SFDC IDs.
 func (a API) GetByIDs(ids []string) (string, error) {
-	query := "SELECT Id, Salutation, FirstName, LastName, Email, Phone, Fax, Title, AccountId, AccountName__c," +
-		"SFDC_Contact_Status__c, CurrencyIsoCode, BBAuthID__c, BBAuth_Email__c, BBAuth_First_Name__c," +
-		"BBAuth_Last_Name__c, Default_Account__c, Account.Name, Account.Id, Account.Clarify_Site_ID__c," +
-		"Account.Business_unit__c, Account.Industry, Account.Payer__c," +
-		"Account.Billing_street__c, Account.Billing_City__c, Account.Billing_State_Province__c," +
-		"Account.Billing_Zip_Postal_Code__c, Account.Billing_Country__c," +
-		"Account.Physical_Street__c, Account.Physical_City__c, Account.Physical_State_Province__c," +
-		"Account.Physical_Zip_Postal_Code__c, Account.Physical_Country__c, " +
-		"(SELECT Role_Type__c, Role_Name__c, Role_Status__c FROM Contact_Roles1__r) " +
-		"FROM Contact WHERE Id in " + parseIDs(ids)
+	query := "SELECT " + contactQueryFields + " FROM Contact WHERE Id in " + parseIDs(ids)
+
+	return query, nil
+}
+
+//GetByAccountID returns a contact query string that selects the contacts of the
+//account with the given SFDC ID.
+func (a API) GetByAccountID(accountID string) (string, error) {
+	if len(accountID) != 15 && len(accountID) != 18 {
+		return "", errors.New("Account id must be a valid 15 or 18 character SFDC id")
+	}
+
+	query := "SELECT " + contactQueryFields + " FROM Contact WHERE AccountId = '" + accountID + "'"
 
 	return query, nil
 }
 
-//UpdateContact updates a given contact.
-func (a API) UpdateContact(contact *services.ContactDTO) error {
-	//This is a bit weird, but we can't update a record if the ID is part of the
-	//object and updates fail whenever we try and set the Account field on the
-	//contact object. Since we don't have a reason yet to update a contact with
-	//a new account, this isn't majorly impacting. However, in the future we'll
-	//need to figure out a way around this.
-	sfdcContact := SFDCContact{ContactDTO: *contact}
-	id := sfdcContact.SalesForceID
-	sfdcContact.SalesForceID = ""
-	sfdcContact.Account = nil
-	sfdcContact.ContactRoles = nil
-
-	return a.client.UpdateSFDCObject(id, sfdcContact)
+//CreateContact creates a contact of an existing account along with its roles
+//and returns the SFDC ID of the contact. The contact and its roles are sent in
+//a single composite request, so either all of them are created or none are.
+func (a API) CreateContact(contact *entities.Contact) (string, error) {
+	if contact.Account() == nil || contact.Account().ID() == "" {
+		return "", errors.New("An account SFDC ID is required to create a contact")
+	}
+
+	requests, err := newCreateContactRequests(contact, contact.Account().ID(), "newContact")
+	if err == nil {
+		err = checkCompositeSize(requests)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error building contact creation: %s", err)
+	}
+
+	results, err := a.client.CompositeSFDCRequest(true, requests)
+	if err == nil {
+		err = compositeError(results)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error creating contact in SFDC: %s", err)
+	}
+
+	for _, result := range results {
+		if result.ReferenceID == "newContact" {
+			id, err := insertedID(result)
+			if err != nil {
+				return "", fmt.Errorf("Error creating contact in SFDC: %s", err)
+			}
+			return id, nil
+		}
+	}
+	return "", errors.New("Error creating contact in SFDC: no result was returned")
+}
+
+//UpdateContact updates a given contact. Only the fields modified since the
+//contact was marked clean are sent, and cleared fields are set to null.
+func (a API) UpdateContact(contact *entities.Contact) error {
+	//Updates fail whenever we try and set the Account field on the contact
+	//object, and its roles are a separate object, so neither is tracked as a
+	//modified field. Since we don't have a reason yet to update a contact with
+	//a new account, this isn't majorly impacting.
+	if contact.ID() == "" {
+		return errors.New("An SFDC ID is required to update a contact")
+	}
+
+	fields := contact.ModifiedFields()
+	if len(fields) == 0 {
+		return nil
+	}
+
+	dto := services.ConvertContactEntityToContactDTO(contact)
+	patch, err := newSObjectPatch(SFDCContact{}, dto, fields)
+	if err != nil {
+		return fmt.Errorf("Error building contact update: %s", err)
+	}
+
+	return a.client.UpdateSFDCObject(contact.ID(), patch)
+}
+
+//BulkUpsertContacts creates or updates contacts with a job of the SFDC Bulk
+//API. Contacts with an SFDC ID are updated and the others are created. Roles
+//are a separate object and aren't written. The Row of each result is the index
+//of the contact it's for.
+func (a API) BulkUpsertContacts(contacts []*entities.Contact) ([]*services.BulkRowResult, error) {
+	records := make([]map[string]string, len(contacts))
+	for i, contact := range contacts {
+		insert, err := newSObjectInsert(SFDCContact{}, services.ConvertContactEntityToContactDTO(contact))
+		if err != nil {
+			return nil, fmt.Errorf("Error building contact upsert: %s", err)
+		}
+		records[i] = bulkRecord(insert)
+		records[i]["Id"] = contact.ID()
+		if contact.Account() != nil && contact.Account().ID() != "" {
+			records[i]["AccountId"] = contact.Account().ID()
+		}
+	}
+
+	results, err := a.client.BulkUpsertSFDCObjects(SFDCContact{}, "Id", records)
+	if err != nil {
+		return nil, fmt.Errorf("Error upserting contacts in SFDC: %s", err)
+	}
+	return bulkRowResults(results), nil
 }
 
 func parseIDs(ids []string) string {
@@ -161,3 +229,6 @@ func parseIDs(ids []string) string {
 
 	return contactDTO
 }*/
+
+// contactRoleSObject is the SFDC object that a contact's roles are stored in
+var contactRoleSObject = sobjectName("Contact_Role__c")
@@ -1,10 +1,12 @@
 package salesforce
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
 	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
 	"github.com/blackbaudIT/webcore/services"
 )
 
@@ -146,14 +148,139 @@ func TestGetByIDs(t *testing.T) {
 	})
 }
 
+func TestGetByAccountID(t *testing.T) {
+	Convey("Given an account's SFDC ID", t, func() {
+		Convey("When requesting a contact query string", func() {
+			query, err := api.GetByAccountID("001d000001TweFSAAZ")
+			Convey("Then the query should select the account's contacts", func() {
+				So(err, ShouldBeNil)
+				So(query, ShouldEndWith, "FROM Contact WHERE AccountId = '001d000001TweFSAAZ'")
+			})
+		})
+		Convey("When the id isn't an SFDC ID", func() {
+			_, err := api.GetByAccountID("5740")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestCreateContact(t *testing.T) {
+	Convey("Given a new contact of an existing account", t, func() {
+		account, _ := entities.NewAccount("Test Org Name")
+		account.SetID("001d000001TweFSAAZ")
+		name, _ := entities.BuildName("", "Erik", "Tate")
+		contact, _ := entities.NewContact(name, account, entities.USD)
+		contact.SetRoles([]*entities.ContactRole{{RoleType: "Billing", RoleName: "Primary", RoleStatus: "Active"}})
+
+		Convey("When creating the contact", func() {
+			id, err := api.CreateContact(contact)
+			Convey("Then the contact and its role should be created in one request", func() {
+				So(err, ShouldBeNil)
+				So(id, ShouldEqual, "003d000001NEW000AA")
+				So(len(lastCompositeRequests), ShouldEqual, 2)
+				So(lastCompositeRequests[0].Body.(sobjectPatch).Fields["AccountId"], ShouldEqual, "001d000001TweFSAAZ")
+				So(lastCompositeRequests[1].Body.(sobjectPatch).Fields["Contact__c"], ShouldEqual, "@{newContact.id}")
+			})
+		})
+		Convey("When the contact has no account", func() {
+			account.SetID("")
+			_, err := api.CreateContact(contact)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When SFDC fails the request", func() {
+			getCommandError = func() error { return errors.New("fake error") }
+			_, err := api.CreateContact(contact)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			getCommandError = func() error { return nil }
+			lastCompositeRequests = nil
+		})
+	})
+}
+
 func TestUpdateContact(t *testing.T) {
-	Convey("Given a valid contactDTO", t, func() {
-		contact := &services.ContactDTO{SalesForceID: "12345", LastName: "Tate", Currency: "USD - U.S. Dollar"}
-		Convey("When attemtping to update the first name field", func() {
-			contact.FirstName = "Erik"
+	Convey("Given a contact loaded from SFDC", t, func() {
+		dto := &services.ContactDTO{SalesForceID: "003d0000026MOlUAAW", LastName: "Tate",
+			Title: "Developer", Currency: "USD", Account: &services.AccountDTO{Name: "Test Account"}}
+		contact, _ := dto.ToEntity()
+		contact.MarkClean()
+		lastCommandObject = nil
+		Convey("When attemtping to update the first name field and clear the title", func() {
+			contact.Name.FirstName = "Erik"
+			contact.Title = ""
+			err := api.UpdateContact(contact)
+			Convey("Then only those fields should be sent, with the title cleared", func() {
+				So(err, ShouldBeNil)
+				patch := lastCommandObject.(sobjectPatch)
+				So(patch.ApiName(), ShouldEqual, "Contact")
+				So(patch.Fields, ShouldResemble, map[string]interface{}{
+					"FirstName": "Erik",
+					"Title":     nil,
+				})
+			})
+		})
+		Convey("When the contact hasn't been modified", func() {
 			err := api.UpdateContact(contact)
-			Convey("Then no error should be returned", func() {
+			Convey("Then nothing should be sent to SFDC", func() {
 				So(err, ShouldBeNil)
+				So(lastCommandObject, ShouldBeNil)
+			})
+		})
+		Convey("When the contact has no SFDC ID", func() {
+			contact.SetID("")
+			err := api.UpdateContact(contact)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestUpdateContactThroughService(t *testing.T) {
+	Convey("Given a contact service using the SFDC API that blocks duplicates", t, func() {
+		service := services.ContactService{ContactRepo: api, DuplicatePolicy: services.DuplicatesBlock}
+		lastCommandObject = nil
+		Convey("When an update makes the contact a duplicate of another contact of its account", func() {
+			err := service.UpdateContact(&services.ContactDTO{SalesForceID: "003d000001UPDATEAA",
+				FirstName: "Bob", LastName: "Smith", Email: "bob.smith@example.com"})
+			Convey("Then the update should be refused without writing to SFDC", func() {
+				So(err, ShouldHaveSameTypeAs, &services.DuplicateContactError{})
+				So(err.(*services.DuplicateContactError).Matches[0].Contact.SalesForceID, ShouldEqual,
+					"003d000001SMITH0AA")
+				So(lastCommandObject, ShouldBeNil)
+			})
+		})
+		Convey("When an update changes the email to one no other contact has", func() {
+			err := service.UpdateContact(&services.ContactDTO{SalesForceID: "003d000001UPDATEAA",
+				Email: "robert.jones@example.com"})
+			Convey("Then only the email should be sent to SFDC", func() {
+				So(err, ShouldBeNil)
+				patch := lastCommandObject.(sobjectPatch)
+				So(patch.Fields, ShouldResemble, map[string]interface{}{"Email": "robert.jones@example.com"})
+			})
+		})
+		Convey("When an update clears the title", func() {
+			err := service.UpdateContact(&services.ContactDTO{SalesForceID: "003d000001UPDATEAA",
+				Clear: []string{"title"}})
+			Convey("Then the title should be sent to SFDC as null", func() {
+				So(err, ShouldBeNil)
+				patch := lastCommandObject.(sobjectPatch)
+				So(patch.Fields, ShouldResemble, map[string]interface{}{"Title": nil})
+			})
+		})
+		Convey("When the contact doesn't exist", func() {
+			err := service.UpdateContact(&services.ContactDTO{SalesForceID: "003d000001MISSINGA", Title: "CEO"})
+			Convey("Then a not found error should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &services.NotFoundError{})
+				So(lastCommandObject, ShouldBeNil)
 			})
 		})
 	})
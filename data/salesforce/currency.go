@@ -0,0 +1,35 @@
+package salesforce
+
+//activeCurrenciesQuery selects the currencies enabled in a multi-currency org
+const activeCurrenciesQuery = "SELECT IsoCode FROM CurrencyType WHERE IsActive = true ORDER BY IsoCode"
+
+//SFDCCurrencyType is a currency configured in the SFDC org
+type SFDCCurrencyType struct {
+	IsoCode string `json:"isoCode,omitempty" force:"IsoCode,omitempty"`
+}
+
+//SFDCCurrencyTypeQueryResponse wraps the base SFDCQueryResponse and attaches
+//a slice of SFDCCurrencyType pointers that will be written into
+type SFDCCurrencyTypeQueryResponse struct {
+	SFDCQueryResponse
+
+	Records []*SFDCCurrencyType `json:"Records" force:"records"`
+}
+
+//GetActiveCurrencies returns the ISO codes of the currencies that are active
+//in the SFDC org
+func (a API) GetActiveCurrencies() ([]string, error) {
+	queryResponse := &SFDCCurrencyTypeQueryResponse{}
+
+	err := a.client.QuerySFDCObject(activeCurrenciesQuery, queryResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, len(queryResponse.Records))
+	for index, currency := range queryResponse.Records {
+		codes[index] = currency.IsoCode
+	}
+
+	return codes, nil
+}
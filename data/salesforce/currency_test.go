@@ -0,0 +1,30 @@
+package salesforce
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetActiveCurrencies(t *testing.T) {
+	Convey("Given a multi-currency SFDC org", t, func() {
+		Convey("When the active currencies are requested", func() {
+			codes, err := api.GetActiveCurrencies()
+			Convey("Then the ISO codes should be returned", func() {
+				So(err, ShouldBeNil)
+				So(codes, ShouldResemble, []string{"CAD", "USD"})
+			})
+		})
+		Convey("When an error occurs while querying SFDC", func() {
+			getQueryError = func() error { return errors.New("fake error") }
+			_, err := api.GetActiveCurrencies()
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			getQueryError = func() error { return nil }
+		})
+	})
+}
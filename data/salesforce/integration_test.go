@@ -92,8 +92,7 @@ func TestInsertSFDCObjectByExternalID(t *testing.T) {
 					// delete the account we just created
 					id := resp.ID
 					if id != "" {
-						fc := forceClient{getForceAPIClient()}
-						fc.DeleteSObject(id, obj)
+						qasAPI.client.DeleteSFDCObject(id, obj)
 					}
 				})
 			})
@@ -148,8 +147,10 @@ func TestInvalidConfig(t *testing.T) {
 		viperSFDC.Set("sfdcClientId", "")
 		viperSFDC.Set("sfdcClientSecret", "")
 		Convey("When SFDC is accessed", func() {
-			f := func() { getForceAPIClient() }
-			Convey("Then the application should panic", func() {
+			_, err := NewAPIWithConfig(FromEnv())
+			f := func() { NewAPI() }
+			Convey("Then an error should be returned or the application should panic", func() {
+				So(err, ShouldNotBeNil)
 				So(f, ShouldPanic)
 			})
 		})
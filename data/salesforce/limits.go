@@ -0,0 +1,347 @@
+package salesforce
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+)
+
+//limitInfoHeader is the response header SFDC reports API usage in, ex.
+//"api-usage=18/5000"
+const limitInfoHeader = "Sforce-Limit-Info"
+
+//dailyAPIRequestsLimit is the limit of the limits resource that the usage of
+//the daily API request limit is read from
+const dailyAPIRequestsLimit = "DailyApiRequests"
+
+//ErrAPILimitThreshold is returned for non-critical calls rejected because the
+//threshold of the LimitPolicy has been reached. API.APIUsage reports how much
+//of the limit has been used.
+var ErrAPILimitThreshold = errors.New("The SFDC API usage threshold has been reached")
+
+//APIUsage is how much of the org's daily API request limit has been used
+type APIUsage struct {
+	Used int
+	Max  int
+	//Updated is when the usage was last read from SFDC. It's zero until the
+	//first response is received.
+	Updated time.Time
+}
+
+//Percent is the percentage of the daily limit that has been used
+func (u APIUsage) Percent() float64 {
+	if u.Max == 0 {
+		return 0
+	}
+	return 100 * float64(u.Used) / float64(u.Max)
+}
+
+//LimitPolicy protects the daily API request limit from non-critical calls
+//(see API.NonCritical). Once Threshold percent of the limit has been used,
+//non-critical calls are delayed by Delay, or rejected with
+//ErrAPILimitThreshold if there's no delay. A warning is logged when the
+//threshold is first reached.
+type LimitPolicy struct {
+	Threshold float64
+	Delay     time.Duration
+}
+
+//WithLimitPolicy throttles or rejects non-critical calls once a percentage
+//of the daily API request limit has been used
+func WithLimitPolicy(policy LimitPolicy) Option {
+	return func(c *Config) error {
+		if policy.Threshold <= 0 || policy.Threshold > 100 {
+			return errors.New("the limit threshold must be a percentage greater than 0")
+		}
+		if policy.Delay < 0 {
+			return errors.New("the limit delay can't be negative")
+		}
+		c.LimitPolicy = policy
+		return nil
+	}
+}
+
+//limitMonitor tracks the API usage reported by SFDC and applies the
+//LimitPolicy to non-critical calls
+type limitMonitor struct {
+	lock      sync.RWMutex
+	usage     APIUsage
+	policy    LimitPolicy
+	warned    bool
+	rejected  int64
+	throttled int64
+}
+
+func newLimitMonitor(policy LimitPolicy) *limitMonitor {
+	return &limitMonitor{policy: policy}
+}
+
+//observe reads the usage from the Sforce-Limit-Info header of a response. It
+//reports whether the usage has reached the threshold for the first time.
+func (m *limitMonitor) observe(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "api-usage=") {
+			continue
+		}
+
+		counts := strings.Split(strings.TrimPrefix(part, "api-usage="), "/")
+		if len(counts) != 2 {
+			return false
+		}
+		used, err := strconv.Atoi(counts[0])
+		if err != nil {
+			return false
+		}
+		max, err := strconv.Atoi(counts[1])
+		if err != nil {
+			return false
+		}
+		return m.set(used, max)
+	}
+	return false
+}
+
+//set records the usage and reports whether it has reached the threshold for
+//the first time
+func (m *limitMonitor) set(used, max int) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.usage = APIUsage{Used: used, Max: max, Updated: time.Now()}
+
+	reached := m.policy.Threshold > 0 && m.usage.Percent() >= m.policy.Threshold
+	if !reached {
+		m.warned = false
+		return false
+	}
+	if m.warned {
+		return false
+	}
+	m.warned = true
+	return true
+}
+
+//Usage is the last usage reported by SFDC
+func (m *limitMonitor) Usage() APIUsage {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.usage
+}
+
+//admit applies the policy to a non-critical call, delaying it or returning
+//ErrAPILimitThreshold once the threshold has been reached
+func (m *limitMonitor) admit() error {
+	m.lock.Lock()
+	policy := m.policy
+	percent := m.usage.Percent()
+	reached := policy.Threshold > 0 && percent >= policy.Threshold
+	if reached && policy.Delay > 0 {
+		m.throttled++
+	} else if reached {
+		m.rejected++
+	}
+	m.lock.Unlock()
+
+	if !reached {
+		return nil
+	}
+	if policy.Delay > 0 {
+		time.Sleep(policy.Delay)
+		return nil
+	}
+	return ErrAPILimitThreshold
+}
+
+//metrics is the usage and the number of calls throttled and rejected
+func (m *limitMonitor) metrics() map[string]interface{} {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return map[string]interface{}{
+		"used":      m.usage.Used,
+		"max":       m.usage.Max,
+		"percent":   m.usage.Percent(),
+		"throttled": m.throttled,
+		"rejected":  m.rejected,
+	}
+}
+
+//APIUsage returns the usage of the daily API request limit reported by the
+//last response from SFDC. It's zero for APIs that weren't created with
+//NewAPIWithConfig.
+func (a API) APIUsage() APIUsage {
+	if a.monitor == nil {
+		return APIUsage{}
+	}
+	return a.monitor.Usage()
+}
+
+//RefreshAPIUsage reads the usage of the daily API request limit from the
+//limits resource of SFDC
+func (a API) RefreshAPIUsage() (APIUsage, error) {
+	limits, err := a.client.GetSFDCLimits()
+	if err != nil {
+		return APIUsage{}, fmt.Errorf("Error getting SFDC limits: %s", err)
+	}
+
+	limit, ok := limits[dailyAPIRequestsLimit]
+	if !ok {
+		return APIUsage{}, fmt.Errorf("SFDC didn't return the %s limit", dailyAPIRequestsLimit)
+	}
+
+	used, max := int(limit.Max-limit.Remaining), int(limit.Max)
+	if a.monitor == nil {
+		return APIUsage{Used: used, Max: max, Updated: time.Now()}, nil
+	}
+	a.monitor.set(used, max)
+	return a.monitor.Usage(), nil
+}
+
+//NonCritical returns a copy of the API whose calls are subject to the
+//LimitPolicy, ex. for background jobs that can wait until tomorrow:
+//
+//	children, err := api.NonCritical().GetChildAccounts(id)
+func (a API) NonCritical() API {
+	if a.monitor == nil {
+		return a
+	}
+	return API{client: nonCriticalClient{client: a.client, monitor: a.monitor}, monitor: a.monitor}
+}
+
+//PublishMetrics publishes the API usage and the number of throttled and
+//rejected calls with expvar under the given name. Like expvar.Publish, it
+//panics if the name is already in use.
+func (a API) PublishMetrics(name string) {
+	monitor := a.monitor
+	if monitor == nil {
+		monitor = newLimitMonitor(LimitPolicy{})
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return monitor.metrics()
+	}))
+}
+
+//nonCriticalClient applies the LimitPolicy before passing calls on to a
+//client
+type nonCriticalClient struct {
+	client  sfdcClient
+	monitor *limitMonitor
+}
+
+func (c nonCriticalClient) GetSFDCObject(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.GetSFDCObject(id, obj)
+}
+
+func (c nonCriticalClient) GetSFDCObjectByExternalID(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.GetSFDCObjectByExternalID(id, obj)
+}
+
+func (c nonCriticalClient) QuerySFDCObject(query string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.QuerySFDCObject(query, obj)
+}
+
+func (c nonCriticalClient) InsertSFDCObject(obj interface{}) (SFDCResponse, error) {
+	if err := c.monitor.admit(); err != nil {
+		return SFDCResponse{}, err
+	}
+	return c.client.InsertSFDCObject(obj)
+}
+
+func (c nonCriticalClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.UpsertSFDCObjectByExternalID(id, obj)
+}
+
+func (c nonCriticalClient) UpdateSFDCObject(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.UpdateSFDCObject(id, obj)
+}
+
+func (c nonCriticalClient) DescribeSFDCObject(obj interface{}) (*force.SObjectDescription, error) {
+	if err := c.monitor.admit(); err != nil {
+		return nil, err
+	}
+	return c.client.DescribeSFDCObject(obj)
+}
+
+func (c nonCriticalClient) GetSFDCResource(path string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.GetSFDCResource(path, obj)
+}
+
+func (c nonCriticalClient) CompositeSFDCRequest(allOrNone bool, requests []*SFDCCompositeSubrequest) ([]*SFDCCompositeResult, error) {
+	if err := c.monitor.admit(); err != nil {
+		return nil, err
+	}
+	return c.client.CompositeSFDCRequest(allOrNone, requests)
+}
+
+func (c nonCriticalClient) BulkUpsertSFDCObjects(sobject force.SObject, externalIDField string,
+	records []map[string]string) ([]*SFDCBulkResult, error) {
+	if err := c.monitor.admit(); err != nil {
+		return nil, err
+	}
+	return c.client.BulkUpsertSFDCObjects(sobject, externalIDField, records)
+}
+
+func (c nonCriticalClient) DeleteSFDCObject(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.DeleteSFDCObject(id, obj)
+}
+
+func (c nonCriticalClient) DeleteSFDCObjectByExternalID(id string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.DeleteSFDCObjectByExternalID(id, obj)
+}
+
+func (c nonCriticalClient) QueryAllSFDCObject(query string, obj interface{}) error {
+	if err := c.monitor.admit(); err != nil {
+		return err
+	}
+	return c.client.QueryAllSFDCObject(query, obj)
+}
+
+func (c nonCriticalClient) UndeleteSFDCObjects(ids []string) ([]SFDCResponse, error) {
+	if err := c.monitor.admit(); err != nil {
+		return nil, err
+	}
+	return c.client.UndeleteSFDCObjects(ids)
+}
+
+func (c nonCriticalClient) MergeSFDCObjects(masterID string, obj interface{}, duplicateIDs []string) (*SFDCMergeResult, error) {
+	if err := c.monitor.admit(); err != nil {
+		return nil, err
+	}
+	return c.client.MergeSFDCObjects(masterID, obj, duplicateIDs)
+}
+
+//GetSFDCLimits is always sent so that the usage can be refreshed
+func (c nonCriticalClient) GetSFDCLimits() (force.Limits, error) {
+	return c.client.GetSFDCLimits()
+}
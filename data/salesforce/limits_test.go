@@ -0,0 +1,112 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPIUsage(t *testing.T) {
+	Convey("Given an org that has used 90% of its daily API requests", t, func() {
+		usage := "api-usage=4500/5000"
+		queries := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries++
+			w.Header().Set("Sforce-Limit-Info", usage)
+			fmt.Fprint(w, `{"totalSize": 0, "done": true, "records": []}`)
+		}))
+		var logs bytes.Buffer
+		options := []Option{WithVersion("v32.0"), WithAccessToken("token", server.URL),
+			WithLogger(log.New(&logs, "", 0))}
+
+		Convey("When a response is received", func() {
+			api, _ := NewAPIWithConfig(options...)
+			_, err := api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then the usage should be read from its header", func() {
+				So(err, ShouldBeNil)
+				So(api.APIUsage().Used, ShouldEqual, 4500)
+				So(api.APIUsage().Max, ShouldEqual, 5000)
+				So(api.APIUsage().Percent(), ShouldEqual, 90)
+			})
+		})
+		Convey("When the usage passes the threshold of a rejecting policy", func() {
+			api, _ := NewAPIWithConfig(append(options, WithLimitPolicy(LimitPolicy{Threshold: 80}))...)
+			api.QueryContacts("SELECT Id FROM Contact")
+			api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then a warning should be logged once", func() {
+				So(bytes.Count(logs.Bytes(), []byte("WARNING")), ShouldEqual, 1)
+			})
+			Convey("Then non-critical calls should be rejected", func() {
+				_, err := api.NonCritical().QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldEqual, ErrAPILimitThreshold)
+				So(queries, ShouldEqual, 2)
+			})
+			Convey("Then critical calls should still be sent", func() {
+				_, err := api.QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+				So(queries, ShouldEqual, 3)
+			})
+			Convey("Then non-critical calls should be sent again once the usage drops", func() {
+				usage = "api-usage=10/5000"
+				api.QueryContacts("SELECT Id FROM Contact")
+				_, err := api.NonCritical().QueryContacts("SELECT Id FROM Contact")
+				So(err, ShouldBeNil)
+			})
+		})
+		Convey("When the usage passes the threshold of a throttling policy", func() {
+			api, _ := NewAPIWithConfig(append(options,
+				WithLimitPolicy(LimitPolicy{Threshold: 80, Delay: 20 * time.Millisecond}))...)
+			api.QueryContacts("SELECT Id FROM Contact")
+			start := time.Now()
+			_, err := api.NonCritical().QueryContacts("SELECT Id FROM Contact")
+			Convey("Then non-critical calls should be delayed", func() {
+				So(err, ShouldBeNil)
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+				So(api.monitor.metrics()["throttled"], ShouldEqual, 1)
+			})
+		})
+		Convey("When the metrics are published", func() {
+			api, _ := NewAPIWithConfig(options...)
+			api.PublishMetrics("sfdc_test_usage")
+			api.QueryContacts("SELECT Id FROM Contact")
+			Convey("Then the usage should be available from expvar", func() {
+				metrics := map[string]interface{}{}
+				err := json.Unmarshal([]byte(expvar.Get("sfdc_test_usage").String()), &metrics)
+				So(err, ShouldBeNil)
+				So(metrics["used"], ShouldEqual, 4500)
+				So(metrics["percent"], ShouldEqual, 90)
+			})
+		})
+		Convey("When the threshold isn't a percentage", func() {
+			_, err := NewAPIWithConfig(append(options, WithLimitPolicy(LimitPolicy{Threshold: 120}))...)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestRefreshAPIUsage(t *testing.T) {
+	Convey("Given an API", t, func() {
+		Convey("When the usage is refreshed from the limits resource", func() {
+			usage, err := api.RefreshAPIUsage()
+			Convey("Then the daily API request limit should be read", func() {
+				So(err, ShouldBeNil)
+				So(usage.Used, ShouldEqual, 4000)
+				So(usage.Max, ShouldEqual, 5000)
+			})
+		})
+	})
+}
@@ -0,0 +1,497 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/spf13/cast"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/spf13/viper"
+)
+
+//FieldMapping maps the logical object and field names used in the force tags
+//of the DTOs (and in the queries built by the API) to the API names of a
+//particular SFDC org, ex. a sandbox where Clarify_Site_ID__c is Site_ID__c.
+//Names are matched without regard to case, the same as SFDC matches them.
+//
+//Field names are mapped the same way for every object, including in queries
+//that traverse relationships (ex. Account.Name), so a field can only be
+//mapped if no other object used by the API has a field of the same name.
+//Relationship names (ex. Contact_Roles1__r) are mapped as fields.
+type FieldMapping struct {
+	objects map[string]string
+	fields  map[string]string
+
+	//org names mapped back to logical names
+	logicalObjects map[string]string
+	logicalFields  map[string]string
+}
+
+//NewFieldMapping builds a mapping from logical object names to org object
+//names and, for each object, logical field names to org field names.
+func NewFieldMapping(objects map[string]string, fields map[string]map[string]string) (*FieldMapping, error) {
+	m := &FieldMapping{
+		objects:        map[string]string{},
+		fields:         map[string]string{},
+		logicalObjects: map[string]string{},
+		logicalFields:  map[string]string{},
+	}
+
+	for logical, name := range objects {
+		err := addMappedName(m.objects, m.logicalObjects, logical, name)
+		if err != nil {
+			return nil, fmt.Errorf("Error mapping object %s: %s", logical, err)
+		}
+	}
+
+	for object, objectFields := range fields {
+		for logical, name := range objectFields {
+			err := checkFieldObject(object, logical)
+			if err == nil {
+				err = addMappedName(m.fields, m.logicalFields, logical, name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Error mapping field %s.%s: %s", object, logical, err)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func addMappedName(names, logicalNames map[string]string, logical, name string) error {
+	logical, name = strings.TrimSpace(logical), strings.TrimSpace(name)
+	if logical == "" || name == "" {
+		return fmt.Errorf("names can't be blank")
+	}
+
+	key, reverseKey := strings.ToLower(logical), strings.ToLower(name)
+	if other, ok := names[key]; ok && !strings.EqualFold(other, name) {
+		return fmt.Errorf("%s is already mapped to %s", logical, other)
+	}
+	if other, ok := logicalNames[reverseKey]; ok && !strings.EqualFold(other, logical) {
+		return fmt.Errorf("%s is already mapped from %s", name, other)
+	}
+
+	names[key] = name
+	logicalNames[reverseKey] = logical
+	return nil
+}
+
+//commonFields are standard fields that every SFDC object has
+var commonFields = []string{"Id", "Name", "OwnerId", "CreatedById", "CreatedDate", "LastModifiedById",
+	"LastModifiedDate", "SystemModstamp", "IsDeleted"}
+
+//checkFieldObject returns an error if a field of an object can't be mapped
+//because other objects have a field of the same name, which the mapping
+//would rename as well
+func checkFieldObject(object, field string) error {
+	if containsFold(commonFields, field) {
+		return fmt.Errorf("%s is a field of every object", field)
+	}
+
+	for _, other := range schemaObjects {
+		name := other.sobject.ApiName()
+		if strings.EqualFold(name, object) {
+			continue
+		}
+		if containsFold(other.lookups, field) {
+			return fmt.Errorf("%s is also a field of %s", field, name)
+		}
+		for _, f := range forceFields(reflect.TypeOf(other.dto)) {
+			if strings.EqualFold(f.sfdcName, field) {
+				return fmt.Errorf("%s is also a field of %s", field, name)
+			}
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+//LoadFieldMapping reads a mapping in the given format ("yaml", "toml" or
+//"json") with viper. Names are listed under "objects" and "fields", ex.
+//
+//	objects:
+//	  Client_Asset__c: Client_Asset2__c
+//	fields:
+//	  Account:
+//	    Clarify_Site_ID__c: Site_ID__c
+func LoadFieldMapping(in io.Reader, configType string) (*FieldMapping, error) {
+	v := viper.New()
+	v.SetConfigType(configType)
+	err := v.ReadConfig(in)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading field mapping: %s", err)
+	}
+
+	fields := map[string]map[string]string{}
+	for object, objectFields := range v.GetStringMap("fields") {
+		fields[object] = cast.ToStringMapString(objectFields)
+	}
+
+	return NewFieldMapping(v.GetStringMapString("objects"), fields)
+}
+
+//LoadFieldMappingFile reads a mapping from a file. The format is taken from
+//the extension of the file.
+func LoadFieldMappingFile(path string) (*FieldMapping, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening field mapping: %s", err)
+	}
+	defer file.Close()
+
+	return LoadFieldMapping(file, strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+//Object returns the org name of a logical object name
+func (m *FieldMapping) Object(name string) string {
+	return mappedName(m.objects, name)
+}
+
+//Field returns the org name of a logical field name
+func (m *FieldMapping) Field(name string) string {
+	return mappedName(m.fields, name)
+}
+
+func mappedName(names map[string]string, name string) string {
+	if mapped, ok := names[strings.ToLower(name)]; ok {
+		return mapped
+	}
+	return name
+}
+
+//Query maps the object and field names in a SOQL query. String literals
+//aren't changed.
+func (m *FieldMapping) Query(query string) string {
+	var b bytes.Buffer
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			end := i + 1
+			for ; end < len(query); end++ {
+				if query[end] == '\\' {
+					end++
+				} else if query[end] == '\'' {
+					end++
+					break
+				}
+			}
+			if end > len(query) {
+				end = len(query)
+			}
+			b.WriteString(query[i:end])
+			i = end
+		case isIdentifierStart(c):
+			end := i + 1
+			for end < len(query) && (isIdentifierStart(query[end]) || query[end] >= '0' && query[end] <= '9') {
+				end++
+			}
+			b.WriteString(m.name(query[i:end]))
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+func (m *FieldMapping) name(name string) string {
+	if mapped, ok := m.fields[strings.ToLower(name)]; ok {
+		return mapped
+	}
+	return m.Object(name)
+}
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+//path maps the object and field names in the segments of a resource path
+func (m *FieldMapping) path(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = m.name(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+//logicalDescription returns a copy of an org's describe of an object with
+//the object, field and relationship names mapped back to logical names. The
+//describe returned by the client is left with the org's names.
+func (m *FieldMapping) logicalDescription(description *force.SObjectDescription) *force.SObjectDescription {
+	logical := *description
+	logical.Name = mappedName(m.logicalObjects, description.Name)
+
+	logical.Fields = make([]*force.SObjectField, len(description.Fields))
+	for i, field := range description.Fields {
+		f := *field
+		f.Name = mappedName(m.logicalFields, f.Name)
+		f.RelationshipName = mappedName(m.logicalFields, f.RelationshipName)
+		f.ControllerName = mappedName(m.logicalFields, f.ControllerName)
+		f.ReferenceTo = make([]string, len(field.ReferenceTo))
+		for j, object := range field.ReferenceTo {
+			f.ReferenceTo[j] = mappedName(m.logicalObjects, object)
+		}
+		logical.Fields[i] = &f
+	}
+
+	logical.ChildRelationsips = make([]*force.ChildRelationship, len(description.ChildRelationsips))
+	for i, relationship := range description.ChildRelationsips {
+		r := *relationship
+		r.Field = mappedName(m.logicalFields, r.Field)
+		r.ChildSObject = mappedName(m.logicalObjects, r.ChildSObject)
+		r.RelationshipName = mappedName(m.logicalFields, r.RelationshipName)
+		logical.ChildRelationsips[i] = &r
+	}
+
+	return &logical
+}
+
+//renameFields renames the keys of every JSON object in data, at any depth,
+//that are in names
+func renameFields(data []byte, names map[string]string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(renameValueFields(v, names))
+}
+
+func renameValueFields(v interface{}, names map[string]string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(value))
+		for key, field := range value {
+			renamed[mappedName(names, key)] = renameValueFields(field, names)
+		}
+		return renamed
+	case []interface{}:
+		for i, item := range value {
+			value[i] = renameValueFields(item, names)
+		}
+	}
+	return v
+}
+
+//mappedSObject stands in for an object sent to or read from SFDC, mapping
+//its API names and the names of its fields between the logical names of the
+//force tags and the org's names
+type mappedSObject struct {
+	obj     interface{}
+	mapping *FieldMapping
+}
+
+//ApiName is the org's API name of the object
+func (s *mappedSObject) ApiName() string {
+	return s.mapping.Object(s.obj.(force.SObject).ApiName())
+}
+
+//ExternalIdApiName is the org's API name of the object's external id
+func (s *mappedSObject) ExternalIdApiName() string {
+	return s.mapping.Field(s.obj.(force.SObject).ExternalIdApiName())
+}
+
+//MarshalJSON encodes the object under the org's field names
+func (s *mappedSObject) MarshalJSON() ([]byte, error) {
+	data, err := forcejson.Marshal(s.obj)
+	if err != nil {
+		return nil, err
+	}
+	return renameFields(data, s.mapping.fields)
+}
+
+//UnmarshalJSON decodes a response that uses the org's field names
+func (s *mappedSObject) UnmarshalJSON(data []byte) error {
+	data, err := renameFields(data, s.mapping.logicalFields)
+	if err != nil {
+		return err
+	}
+	return forcejson.Unmarshal(data, s.obj)
+}
+
+//mappedClient maps the names used by the API to those of an org before
+//passing requests on to a client, and maps the names in the responses back
+type mappedClient struct {
+	client  sfdcClient
+	mapping *FieldMapping
+}
+
+func newMappedClient(client sfdcClient, mapping *FieldMapping) sfdcClient {
+	if mapping == nil {
+		return client
+	}
+	return mappedClient{client: client, mapping: mapping}
+}
+
+func (m mappedClient) sobject(obj interface{}) (*mappedSObject, error) {
+	if _, ok := obj.(force.SObject); !ok {
+		return nil, fmt.Errorf("unable to convert data to SObject")
+	}
+	return &mappedSObject{obj: obj, mapping: m.mapping}, nil
+}
+
+func (m mappedClient) GetSFDCObject(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.GetSFDCObject(id, sobject)
+}
+
+func (m mappedClient) GetSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.GetSFDCObjectByExternalID(id, sobject)
+}
+
+func (m mappedClient) QuerySFDCObject(query string, obj interface{}) error {
+	return m.client.QuerySFDCObject(m.mapping.Query(query), &mappedSObject{obj: obj, mapping: m.mapping})
+}
+
+func (m mappedClient) QueryAllSFDCObject(query string, obj interface{}) error {
+	return m.client.QueryAllSFDCObject(m.mapping.Query(query), &mappedSObject{obj: obj, mapping: m.mapping})
+}
+
+func (m mappedClient) InsertSFDCObject(obj interface{}) (SFDCResponse, error) {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return SFDCResponse{}, err
+	}
+	return m.client.InsertSFDCObject(sobject)
+}
+
+func (m mappedClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.UpsertSFDCObjectByExternalID(id, sobject)
+}
+
+func (m mappedClient) UpdateSFDCObject(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.UpdateSFDCObject(id, sobject)
+}
+
+func (m mappedClient) DeleteSFDCObject(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.DeleteSFDCObject(id, sobject)
+}
+
+func (m mappedClient) DeleteSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return err
+	}
+	return m.client.DeleteSFDCObjectByExternalID(id, sobject)
+}
+
+func (m mappedClient) UndeleteSFDCObjects(ids []string) ([]SFDCResponse, error) {
+	return m.client.UndeleteSFDCObjects(ids)
+}
+
+func (m mappedClient) MergeSFDCObjects(masterID string, obj interface{}, duplicateIDs []string) (*SFDCMergeResult, error) {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return nil, err
+	}
+	return m.client.MergeSFDCObjects(masterID, sobject, duplicateIDs)
+}
+
+func (m mappedClient) DescribeSFDCObject(obj interface{}) (*force.SObjectDescription, error) {
+	sobject, err := m.sobject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := m.client.DescribeSFDCObject(sobject)
+	if err != nil || description == nil {
+		return description, err
+	}
+	return m.mapping.logicalDescription(description), nil
+}
+
+func (m mappedClient) GetSFDCResource(path string, obj interface{}) error {
+	return m.client.GetSFDCResource(m.mapping.path(path), obj)
+}
+
+//CompositeSFDCRequest maps the objects, fields and bodies of the subrequests
+//and maps the field names of the results' bodies back
+func (m mappedClient) CompositeSFDCRequest(allOrNone bool, requests []*SFDCCompositeSubrequest) ([]*SFDCCompositeResult, error) {
+	mapped := make([]*SFDCCompositeSubrequest, len(requests))
+	for i, r := range requests {
+		request := *r
+		request.SObject = &mappedSObject{obj: r.SObject, mapping: m.mapping}
+		if _, ok := r.Body.(force.SObject); ok {
+			request.Body = &mappedSObject{obj: r.Body, mapping: m.mapping}
+		}
+		request.Fields = make([]string, len(r.Fields))
+		for j, field := range r.Fields {
+			request.Fields[j] = m.mapping.Field(field)
+		}
+		mapped[i] = &request
+	}
+
+	results, err := m.client.CompositeSFDCRequest(allOrNone, mapped)
+	for _, result := range results {
+		if len(result.Body) == 0 {
+			continue
+		}
+		if body, renameErr := renameFields(result.Body, m.mapping.logicalFields); renameErr == nil {
+			result.Body = body
+		}
+	}
+	return results, err
+}
+
+//BulkUpsertSFDCObjects maps the object and the fields of the records
+func (m mappedClient) BulkUpsertSFDCObjects(sobject force.SObject, externalIDField string,
+	records []map[string]string) ([]*SFDCBulkResult, error) {
+
+	mapped := make([]map[string]string, len(records))
+	for i, record := range records {
+		mapped[i] = make(map[string]string, len(record))
+		for field, value := range record {
+			mapped[i][m.mapping.Field(field)] = value
+		}
+	}
+
+	return m.client.BulkUpsertSFDCObjects(&mappedSObject{obj: sobject, mapping: m.mapping},
+		m.mapping.Field(externalIDField), mapped)
+}
+
+func (m mappedClient) GetSFDCLimits() (force.Limits, error) {
+	return m.client.GetSFDCLimits()
+}
@@ -0,0 +1,165 @@
+package salesforce
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//rawClient stands in for go-force, encoding objects and decoding responses
+//with forcejson so that the JSON sent to and read from an org can be checked
+type rawClient struct {
+	mockClient
+	request *rawRequest
+}
+
+type rawRequest struct {
+	apiName, externalID, query, path string
+	body, response                   string
+}
+
+func (r rawClient) record(obj interface{}) error {
+	if sobject, ok := obj.(force.SObject); ok {
+		r.request.apiName = sobject.ApiName()
+		r.request.externalID = sobject.ExternalIdApiName()
+	}
+
+	data, err := forcejson.Marshal(obj)
+	r.request.body = string(data)
+	return err
+}
+
+func (r rawClient) QuerySFDCObject(query string, obj interface{}) error {
+	r.request.query = query
+	return forcejson.Unmarshal([]byte(r.request.response), obj)
+}
+
+func (r rawClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) error {
+	return r.record(obj)
+}
+
+func (r rawClient) DescribeSFDCObject(obj interface{}) (*force.SObjectDescription, error) {
+	r.request.apiName = obj.(force.SObject).ApiName()
+	return &force.SObjectDescription{
+		Name: "Client_Asset2__c",
+		Fields: []*force.SObjectField{
+			{Name: "Line__c", Type: "picklist", PicklistValues: []*force.PicklistValue{
+				{Value: "RE NXT", Label: "RE NXT", Active: true},
+			}},
+		},
+	}, nil
+}
+
+func (r rawClient) GetSFDCResource(path string, obj interface{}) error {
+	r.request.path = path
+	return nil
+}
+
+const testFieldMapping = `
+objects:
+  Client_Asset__c: Client_Asset2__c
+fields:
+  Account:
+    Clarify_Site_ID__c: Site_ID__c
+    Payer__c: Paying_Account__c
+  Client_Asset__c:
+    Product_Line__c: Line__c
+    Account__r: Org__r
+`
+
+func TestLoadFieldMapping(t *testing.T) {
+	Convey("Given a YAML field mapping", t, func() {
+		mapping, err := LoadFieldMapping(strings.NewReader(testFieldMapping), "yaml")
+		Convey("Then object and field names should be mapped regardless of case", func() {
+			So(err, ShouldBeNil)
+			So(mapping.Object("Client_Asset__c"), ShouldEqual, "Client_Asset2__c")
+			So(mapping.Field("clarify_site_id__c"), ShouldEqual, "Site_ID__c")
+			So(mapping.Field("Name"), ShouldEqual, "Name")
+		})
+		Convey("Then queries should be mapped without changing string literals", func() {
+			query := mapping.Query("SELECT Product_Line__c FROM Client_Asset__c " +
+				"WHERE Account__r.Id = 'Product_Line__c \\' Account__r'")
+			So(query, ShouldEqual, "SELECT Line__c FROM Client_Asset2__c "+
+				"WHERE Org__r.Id = 'Product_Line__c \\' Account__r'")
+		})
+	})
+	Convey("Given a field that other objects have too", t, func() {
+		_, nameErr := NewFieldMapping(nil, map[string]map[string]string{"Account": {"Name": "Org_Name__c"}})
+		_, emailErr := NewFieldMapping(nil, map[string]map[string]string{"Account": {"Email": "Org_Email__c"}})
+		Convey("Then an error should be returned", func() {
+			So(nameErr, ShouldNotBeNil)
+			So(nameErr.Error(), ShouldContainSubstring, "Name is a field of every object")
+			So(emailErr, ShouldNotBeNil)
+			So(emailErr.Error(), ShouldContainSubstring, "Email is also a field of Contact")
+		})
+	})
+	Convey("Given a field mapped to two names", t, func() {
+		_, err := NewFieldMapping(nil, map[string]map[string]string{
+			"Account": {"Payer__c": "Paying_Account__c"},
+			"Contact": {"payer__c": "Payer2__c"},
+		})
+		Convey("Then an error should be returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMappedClient(t *testing.T) {
+	Convey("Given an API with a field mapping", t, func() {
+		mapping, _ := LoadFieldMapping(strings.NewReader(testFieldMapping), "yaml")
+		client := rawClient{request: &rawRequest{}}
+		mapped := API{client: client}.WithFieldMapping(mapping)
+
+		Convey("When assets are queried", func() {
+			client.request.response = `{"totalSize": 1, "done": true, "records": [
+				{"Line__c": "RE NXT", "End_Date__c": "2016-01-31", "Material_Type__c": "Subscription"}]}`
+			assets, err := mapped.QueryAssets(mapped.BuildAssetsByAccountIDQuery("001d000001TweFmAAJ"))
+			Convey("Then the query should use the org's names", func() {
+				So(client.request.query, ShouldEqual, "SELECT Line__c, End_Date__c, Material_Type__c "+
+					"FROM Client_Asset2__c WHERE Org__r.Id = '001d000001TweFmAAJ'")
+			})
+			Convey("Then the org's fields should be read into the DTO", func() {
+				So(err, ShouldBeNil)
+				So(len(assets), ShouldEqual, 1)
+				So(assets[0].ProductLine, ShouldEqual, "RE NXT")
+				So(assets[0].MaterialType, ShouldEqual, "Subscription")
+			})
+		})
+		Convey("When an account is updated", func() {
+			account, _ := entities.NewAccount("Test Account")
+			account.SetSiteID(5740)
+			account.Payer = "Yes"
+			err := mapped.UpdateAccount(account)
+			Convey("Then it should be upserted by the org's external id and field names", func() {
+				So(err, ShouldBeNil)
+				So(client.request.apiName, ShouldEqual, "Account")
+				So(client.request.externalID, ShouldEqual, "Site_ID__c")
+				So(client.request.body, ShouldContainSubstring, `"Paying_Account__c":"Yes"`)
+				So(client.request.body, ShouldNotContainSubstring, "Payer__c")
+			})
+		})
+		Convey("When a picklist is requested by its logical names", func() {
+			picklist, err := mapped.GetPicklist("Client_Asset__c", "Product_Line__c", "")
+			Convey("Then the org's object should be described", func() {
+				So(err, ShouldBeNil)
+				So(client.request.apiName, ShouldEqual, "Client_Asset2__c")
+				So(picklist.Values[0].Value, ShouldEqual, "RE NXT")
+			})
+		})
+		Convey("When a resource is requested", func() {
+			mapped.client.GetSFDCResource("ui-api/object-info/Client_Asset__c/picklist-values/012/Product_Line__c", nil)
+			Convey("Then the path should use the org's names", func() {
+				So(client.request.path, ShouldEqual, "ui-api/object-info/Client_Asset2__c/picklist-values/012/Line__c")
+			})
+		})
+	})
+	Convey("Given an API without a field mapping", t, func() {
+		Convey("Then the client should be used as is", func() {
+			So(api.WithFieldMapping(nil).client, ShouldResemble, api.client)
+		})
+	})
+}
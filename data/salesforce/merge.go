@@ -0,0 +1,201 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+	"github.com/blackbaudIT/webcore/entities"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//maxMergeIDs is the most records SFDC merges into a master record in one
+//request
+const maxMergeIDs = 2
+
+//SFDCMergeResult is the result of merging records into a master record
+type SFDCMergeResult struct {
+	MergedIDs []string
+	//UpdatedRelatedIDs are the child records that now belong to the master
+	UpdatedRelatedIDs []string
+}
+
+//mergeBody is a merge call of the SOAP partner API. The REST API has no
+//merge.
+type mergeBody struct {
+	Request mergeRequest `xml:"urn:merge>urn:request"`
+}
+
+type mergeRequest struct {
+	Master    mergeMaster `xml:"urn:masterRecord"`
+	RecordIDs []string    `xml:"urn:recordToMergeIds"`
+}
+
+//mergeMaster is the master record of a merge, with the fields to set on it
+type mergeMaster struct {
+	Type         string      `xml:"urn1:type"`
+	FieldsToNull []string    `xml:"urn1:fieldsToNull"`
+	ID           string      `xml:"urn1:Id"`
+	Fields       []soapField `xml:",any"`
+}
+
+//soapField is a field of an sObject named by its XMLName
+type soapField struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type mergeResponse struct {
+	Results []mergeResult `xml:"Body>mergeResponse>result"`
+}
+
+type mergeResult struct {
+	ID                string      `xml:"id"`
+	MergedRecordIDs   []string    `xml:"mergedRecordIds"`
+	UpdatedRelatedIDs []string    `xml:"updatedRelatedIds"`
+	Success           bool        `xml:"success"`
+	Errors            []soapError `xml:"errors"`
+}
+
+//MergeSFDCObjects merges records into a master record of the same object with
+//the SOAP API, which moves their child records to the master and deletes
+//them. The fields of obj are set on the master. SFDC merges at most
+//maxMergeIDs records at a time, so more are merged in several calls; the
+//records merged before a failed call stay merged.
+func (c *restClient) MergeSFDCObjects(masterID string, obj interface{}, duplicateIDs []string) (*SFDCMergeResult, error) {
+	sobject, ok := obj.(force.SObject)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert data to SObject")
+	}
+
+	master := mergeMaster{Type: sobject.ApiName(), ID: masterID}
+	fields, err := soapFields(obj)
+	if err != nil {
+		return nil, fmt.Errorf("Error building merge: %s", err)
+	}
+	for _, name := range sortedKeys(fields) {
+		if fields[name] == nil {
+			master.FieldsToNull = append(master.FieldsToNull, name)
+			continue
+		}
+		master.Fields = append(master.Fields, soapField{XMLName: xml.Name{Local: name}, Value: fmt.Sprint(fields[name])})
+	}
+
+	result := &SFDCMergeResult{}
+	for start := 0; start < len(duplicateIDs); start += maxMergeIDs {
+		end := start + maxMergeIDs
+		if end > len(duplicateIDs) {
+			end = len(duplicateIDs)
+		}
+
+		response := mergeResponse{}
+		err := c.callSOAP("merge", mergeBody{Request: mergeRequest{Master: master, RecordIDs: duplicateIDs[start:end]}},
+			&response)
+		if err == nil && len(response.Results) != 1 {
+			err = fmt.Errorf("%d results were returned for 1 request", len(response.Results))
+		}
+		if err == nil && !response.Results[0].Success {
+			err = errors.New(soapErrorMessage(response.Results[0].Errors))
+		}
+		if err != nil {
+			return result, fmt.Errorf("Error merging records: %s", err)
+		}
+
+		result.MergedIDs = append(result.MergedIDs, response.Results[0].MergedRecordIDs...)
+		result.UpdatedRelatedIDs = append(result.UpdatedRelatedIDs, response.Results[0].UpdatedRelatedIDs...)
+
+		//the fields only need to be set once
+		master = mergeMaster{Type: master.Type, ID: master.ID}
+	}
+
+	return result, nil
+}
+
+//soapFields reads the fields of an object as they're sent to the REST API.
+//Null fields have a nil value.
+func soapFields(obj interface{}) (map[string]interface{}, error) {
+	data, err := forcejson.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "attributes")
+	delete(fields, "Id")
+	return fields, nil
+}
+
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//MergeContacts merges duplicate contacts into a master contact. The modified
+//fields of the master are set on it, and the roles of the duplicates are
+//moved to it before the duplicates are deleted.
+func (a API) MergeContacts(master *entities.Contact, duplicateIDs []string) (*services.MergeResult, error) {
+	if master.ID() == "" {
+		return nil, errors.New("An SFDC ID is required to merge contacts")
+	}
+
+	patch, err := newSObjectPatch(SFDCContact{}, services.ConvertContactEntityToContactDTO(master),
+		master.ModifiedFields())
+	if err != nil {
+		return nil, fmt.Errorf("Error building contact merge: %s", err)
+	}
+
+	return a.merge(master.ID(), patch, duplicateIDs)
+}
+
+//MergeAccounts merges duplicate accounts into a master account. The modified
+//fields of the master are set on it, except its Site ID, and the contacts,
+//assets and child accounts of the duplicates are moved to it before the
+//duplicates are deleted.
+func (a API) MergeAccounts(master *entities.Account, duplicateIDs []string) (*services.MergeResult, error) {
+	if master.ID() == "" {
+		return nil, errors.New("An SFDC ID is required to merge accounts")
+	}
+
+	fields := []string{}
+	for _, field := range master.ModifiedFields() {
+		if field != "siteId" {
+			fields = append(fields, field)
+		}
+	}
+	patch, err := newSObjectPatch(SFDCAccount{}, services.ConvertAccountEntityToAccountDTO(master), fields)
+	if err != nil {
+		return nil, fmt.Errorf("Error building account merge: %s", err)
+	}
+
+	return a.merge(master.ID(), patch, duplicateIDs)
+}
+
+//merge merges records with the SFDC merge operation, which moves the child
+//records of the duplicates to the master
+func (a API) merge(masterID string, patch sobjectPatch, duplicateIDs []string) (*services.MergeResult, error) {
+	for _, id := range append([]string{masterID}, duplicateIDs...) {
+		if len(id) != 15 && len(id) != 18 {
+			return nil, fmt.Errorf("%s isn't a valid 15 or 18 character SFDC id", id)
+		}
+	}
+
+	result, err := a.client.MergeSFDCObjects(masterID, patch, duplicateIDs)
+	if err != nil {
+		return nil, fmt.Errorf("Error merging %s records in SFDC: %s", patch.ApiName(), err)
+	}
+	return &services.MergeResult{RelatedIDs: result.UpdatedRelatedIDs, Native: true}, nil
+}
@@ -0,0 +1,158 @@
+package salesforce
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//soapMergeRequest is a merge call as the SFDC SOAP API reads it
+type soapMergeRequest struct {
+	Type         string   `xml:"Body>merge>request>masterRecord>type"`
+	ID           string   `xml:"Body>merge>request>masterRecord>Id"`
+	FieldsToNull []string `xml:"Body>merge>request>masterRecord>fieldsToNull"`
+	Email        string   `xml:"Body>merge>request>masterRecord>Email"`
+	RecordIDs    []string `xml:"Body>merge>request>recordToMergeIds"`
+}
+
+func TestMergeSFDCObjects(t *testing.T) {
+	Convey("Given an SFDC org with a SOAP API", t, func() {
+		requests := []soapMergeRequest{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			request := soapMergeRequest{}
+			xml.Unmarshal(body, &request)
+			requests = append(requests, request)
+
+			fmt.Fprint(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" `+
+				`xmlns="urn:partner.soap.sforce.com"><soapenv:Body><mergeResponse><result>`)
+			if request.RecordIDs[0] == "003d000001LOCKEDAA" {
+				fmt.Fprint(w, `<errors><message>entity is locked</message><statusCode>ENTITY_IS_LOCKED</statusCode>`+
+					`</errors><success>false</success>`)
+			} else {
+				fmt.Fprintf(w, `<id>%s</id><success>true</success>`, request.ID)
+				for _, id := range request.RecordIDs {
+					fmt.Fprintf(w, `<mergedRecordIds>%s</mergedRecordIds>`, id)
+				}
+				fmt.Fprint(w, `<updatedRelatedIds>a0Xd000001ROLE01AA</updatedRelatedIds>`)
+			}
+			fmt.Fprint(w, `</result></mergeResponse></soapenv:Body></soapenv:Envelope>`)
+		}))
+		client, _ := newRESTClient(Config{Version: "v32.0", AccessToken: "token", InstanceURL: server.URL,
+			HTTPClient: http.DefaultClient})
+		patch := sobjectPatch{apiName: "Contact", Fields: map[string]interface{}{"Email": "bob@example.com", "Title": nil}}
+
+		Convey("When three records are merged into a master", func() {
+			result, err := client.MergeSFDCObjects("003d000001MASTERAA", patch,
+				[]string{"003d000001DUPE01AA", "003d000001DUPE02AA", "003d000001DUPE03AA"})
+			Convey("Then they should be merged two at a time", func() {
+				So(err, ShouldBeNil)
+				So(len(requests), ShouldEqual, 2)
+				So(requests[0].RecordIDs, ShouldResemble, []string{"003d000001DUPE01AA", "003d000001DUPE02AA"})
+				So(requests[1].RecordIDs, ShouldResemble, []string{"003d000001DUPE03AA"})
+				So(result.MergedIDs, ShouldResemble,
+					[]string{"003d000001DUPE01AA", "003d000001DUPE02AA", "003d000001DUPE03AA"})
+				So(len(result.UpdatedRelatedIDs), ShouldEqual, 2)
+			})
+			Convey("Then the fields should be set on the master once", func() {
+				So(requests[0].Type, ShouldEqual, "Contact")
+				So(requests[0].ID, ShouldEqual, "003d000001MASTERAA")
+				So(requests[0].Email, ShouldEqual, "bob@example.com")
+				So(requests[0].FieldsToNull, ShouldResemble, []string{"Title"})
+				So(requests[1].Email, ShouldBeEmpty)
+				So(requests[1].FieldsToNull, ShouldBeEmpty)
+			})
+		})
+		Convey("When SFDC refuses the merge", func() {
+			_, err := client.MergeSFDCObjects("003d000001MASTERAA", patch, []string{"003d000001LOCKEDAA"})
+			Convey("Then its error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "ENTITY_IS_LOCKED")
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
+
+func TestMergeContacts(t *testing.T) {
+	Convey("Given a master contact with a changed title", t, func() {
+		contact, _ := (&services.ContactDTO{SalesForceID: "003d000001MASTERAA", LastName: "Smith",
+			Account: &services.AccountDTO{Name: "Blackbaud"}, Currency: "USD"}).ToEntity()
+		contact.MarkClean()
+		contact.Title = "Director"
+
+		Convey("When duplicates are merged into it", func() {
+			result, err := api.MergeContacts(contact, []string{"003d000001DUPE01AA"})
+			Convey("Then the SFDC merge should be used", func() {
+				So(err, ShouldBeNil)
+				So(result.Native, ShouldBeTrue)
+				So(result.RelatedIDs, ShouldResemble, []string{"a0Xd000001ROLE01AA"})
+				So(lastMergeIDs, ShouldResemble, []string{"003d000001DUPE01AA"})
+				So(lastMergeObject.(sobjectPatch).Fields, ShouldResemble, map[string]interface{}{"Title": "Director"})
+			})
+		})
+		Convey("When a duplicate isn't an SFDC ID", func() {
+			_, err := api.MergeContacts(contact, []string{"5740"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When SFDC fails the merge", func() {
+			getCommandError = func() error { return errors.New("fake error") }
+			_, err := api.MergeContacts(contact, []string{"003d000001DUPE01AA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			getCommandError = func() error { return nil }
+			lastMergeObject = nil
+			lastMergeIDs = nil
+		})
+	})
+}
+
+func TestMergeAccounts(t *testing.T) {
+	Convey("Given a master account", t, func() {
+		account, _ := entities.NewAccount("Blackbaud")
+		account.SetID("001d000001MASTERAA")
+		account.SetSiteID(5740)
+		account.MarkClean()
+
+		Convey("When a duplicate is merged into it", func() {
+			account.SetSiteID(5741)
+			result, err := api.MergeAccounts(account, []string{"001d000001DUPE01AA"})
+			Convey("Then the SFDC merge should be used without changing the master's Site ID", func() {
+				So(err, ShouldBeNil)
+				So(result.Native, ShouldBeTrue)
+				So(lastMergeIDs, ShouldResemble, []string{"001d000001DUPE01AA"})
+				So(lastMergeObject.(sobjectPatch).ApiName(), ShouldEqual, "Account")
+				So(lastMergeObject.(sobjectPatch).Fields, ShouldBeEmpty)
+			})
+		})
+		Convey("When the master has no SFDC ID", func() {
+			account.SetID("")
+			_, err := api.MergeAccounts(account, []string{"001d000001DUPE01AA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			lastMergeObject = nil
+			lastMergeIDs = nil
+		})
+	})
+}
@@ -1,16 +1,22 @@
 package salesforce
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
 	"github.com/blackbaudIT/webcore/services"
 )
 
-var api = API{mockClient{}}
+var api = API{client: mockClient{}}
 var getCommandError = func() error { return nil }
+
+// lastCommandObject records the object sent by the last upsert or update
+var lastCommandObject interface{}
 var getQueryError = func() error { return nil }
 var getSFDCResposne = func() SFDCResponse {
 	return SFDCResponse{
@@ -45,8 +51,18 @@ func (m mockClient) GetSFDCObject(id string, obj interface{}) (err error) {
 	return fmt.Errorf("unused sObject given. Webcore does not work with: %T", obj)
 }
 
+// accountParents mocks the ParentId of accounts in an account hierarchy. The
+// 001d000001CYCLE accounts are each other's parent.
+var accountParents = map[string]string{
+	"001d000001SCHOOLAA": "001d000001DISTRTAA",
+	"001d000001DISTRTAA": "001d000001STATE1AA",
+	"001d000001CYCLE1AA": "001d000001CYCLE2AA",
+	"001d000001CYCLE2AA": "001d000001CYCLE1AA",
+}
+
 func getAccount(id string, sobject *SFDCAccount) (err error) {
 	sobject.SalesForceID = id
+	sobject.ParentID = accountParents[id]
 
 	// used to return a valid SiteID during create test
 	if id == "001d000001TweFmAAJ" {
@@ -58,6 +74,14 @@ func getAccount(id string, sobject *SFDCAccount) (err error) {
 		sobject.SiteID = "a5740"
 	}
 
+	// used to return a complete account during update tests
+	if id == "001d000001UPDATEAA" {
+		sobject.Name = "Test Org Name"
+		sobject.SiteID = "5740"
+		sobject.Industry = "Education"
+		sobject.Payer = "001d000001TwuXwAAZ"
+	}
+
 	return getQueryError()
 }
 
@@ -89,6 +113,7 @@ func (m mockClient) InsertSFDCObject(obj interface{}) (resposne SFDCResponse, er
 }
 
 func (m mockClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) (err error) {
+	lastCommandObject = obj
 	return getCommandError()
 }
 
@@ -105,19 +130,207 @@ func (m mockClient) QuerySFDCObject(query string, obj interface{}) (err error) {
 		return queryAccounts(query, account)
 	}
 
+	currencies, ok := obj.(*SFDCCurrencyTypeQueryResponse)
+
+	if ok {
+		currencies.Records = []*SFDCCurrencyType{{IsoCode: "CAD"}, {IsoCode: "USD"}}
+		return getQueryError()
+	}
+
+	changedAccounts, ok := obj.(*changedAccountsQueryResponse)
+
+	if ok {
+		lastChangesQuery = query
+		count, done := queryPage(query, changedRecordCount)
+		for i := 0; i < count; i++ {
+			changedAccounts.Records = append(changedAccounts.Records, &changedAccount{
+				AccountDTO:     services.AccountDTO{SalesForceID: fmt.Sprintf("001d000001CHG%04dA", i), Name: "Changed"},
+				SystemModstamp: "2016-03-01T12:00:00.000+0000",
+			})
+		}
+		changedAccounts.Done = done
+		if !done {
+			changedAccounts.NextRecordsURI = "/services/data/v32.0/query/01gd0000000CHGAAA-" + strconv.Itoa(count)
+		}
+		return getQueryError()
+	}
+
+	changedContacts, ok := obj.(*changedContactsQueryResponse)
+
+	if ok {
+		lastChangesQuery = query
+		changedContacts.Records = []*changedContact{{
+			ContactDTO:     services.ContactDTO{SalesForceID: "003d000001CHANGEAA", LastName: "Changed"},
+			SystemModstamp: "2016-03-01T12:00:00.000+0000",
+		}}
+		changedContacts.Done = true
+		return getQueryError()
+	}
+
 	return errors.New("obj is not a valid SFDCQueryResponse")
 }
 
 func (m mockClient) UpdateSFDCObject(id string, obj interface{}) error {
+	lastCommandObject = obj
 	return getCommandError()
 }
 
+func (m mockClient) DescribeSFDCObject(obj interface{}) (*force.SObjectDescription, error) {
+	sobject, ok := obj.(force.SObject)
+	if !ok {
+		return nil, fmt.Errorf("unable to describe object. Unexpected type: %T", obj)
+	}
+
+	description := &force.SObjectDescription{Name: sobject.ApiName()}
+
+	switch sobject.ApiName() {
+	case "Account":
+		description.Fields = []*force.SObjectField{
+			{Name: "Id", Type: "id"},
+			{Name: "Name", Type: "string", Createable: true, Updateable: true},
+			{Name: "ParentId", Type: "reference", RelationshipName: "Parent", Createable: true, Updateable: true},
+			{Name: "Clarify_Site_ID__c", Type: "string", ExternalId: true, Createable: true},
+			{Name: "Payer__c", Type: "string", Createable: true, Updateable: true},
+			{Name: "Business_Unit__c", Type: "picklist", Createable: true, Updateable: true, PicklistValues: []*force.PicklistValue{
+				{Value: "GMBU", Label: "GMBU", Active: true, DefaulValue: true},
+				{Value: "K12", Label: "K-12", Active: true},
+				{Value: "IBU", Label: "IBU", Active: false},
+			}},
+			// Industry depends on the business unit. "gA==" is valid for
+			// GMBU only and "YA==" for K12 and IBU.
+			{Name: "Industry", Type: "picklist", DependentPicklist: true, Createable: true, Updateable: true,
+				ControllerName: "Business_Unit__c", PicklistValues: []*force.PicklistValue{
+					{Value: "Cause & Cure", Label: "Cause & Cure", Active: true, ValidFor: "gA=="},
+					{Value: "Education", Label: "Education", Active: true, ValidFor: "YA=="},
+				}},
+		}
+		description.Fields = append(description.Fields, writableFields("textarea",
+			"Billing_Street__c", "Physical_Street__c")...)
+		description.Fields = append(description.Fields, writableFields("string",
+			"Billing_City__c", "Billing_State_Province__c", "Billing_Zip_Postal_Code__c", "Billing_Country__c",
+			"Physical_City__c", "Physical_State_Province__c", "Physical_Zip_Postal_Code__c", "Physical_Country__c")...)
+	case "Contact":
+		description.Fields = []*force.SObjectField{
+			{Name: "Id", Type: "id", IdLookup: true},
+			{Name: "AccountId", Type: "reference", RelationshipName: "Account", Createable: true, Updateable: true},
+			{Name: "Email", Type: "email", Createable: true, Updateable: true},
+			{Name: "Phone", Type: "phone", Createable: true, Updateable: true},
+			{Name: "Fax", Type: "phone", Createable: true, Updateable: true},
+			{Name: "Salutation", Type: "picklist", Createable: true, Updateable: true},
+			{Name: "SFDC_Contact_Status__c", Type: "picklist", Createable: true, Updateable: true},
+			{Name: "CurrencyIsoCode", Type: "picklist", Createable: true, Updateable: true},
+		}
+		description.Fields = append(description.Fields, writableFields("string",
+			"FirstName", "LastName", "Title", "Default_Account__c", "BBAuthID__c", "BBAuth_Email__c",
+			"BBAuth_First_Name__c", "BBAuth_Last_Name__c")...)
+		description.ChildRelationsips = []*force.ChildRelationship{
+			{RelationshipName: "Contact_Roles1__r", ChildSObject: "Contact_Role__c", Field: "Contact__c"},
+		}
+	case "Contact_Role__c":
+		description.Fields = []*force.SObjectField{
+			{Name: "Contact__c", Type: "reference", RelationshipName: "Contact__r", Createable: true, Updateable: true},
+			{Name: "Role_Type__c", Type: "picklist", Createable: true, Updateable: true},
+			{Name: "Role_Name__c", Type: "string", Createable: true, Updateable: true},
+			{Name: "Role_Status__c", Type: "picklist", Createable: true, Updateable: true},
+		}
+	case "Client_Asset__c":
+		description.Fields = []*force.SObjectField{
+			{Name: "Product_Line__c", Type: "picklist"},
+			{Name: "End_Date__c", Type: "date"},
+			{Name: "Material_Type__c", Type: "string"},
+			{Name: "FI_Reference_ID__c", Type: "string", ExternalId: true},
+		}
+	default:
+		return nil, fmt.Errorf("unable to find metadata for object: %s", sobject.ApiName())
+	}
+
+	describeDrift(description)
+	return description, getQueryError()
+}
+
+// describeDrift lets tests change the mocked describe of an object
+var describeDrift = func(description *force.SObjectDescription) {}
+
+// writableFields mocks createable and updateable fields of the given type
+func writableFields(fieldType string, names ...string) []*force.SObjectField {
+	fields := make([]*force.SObjectField, len(names))
+	for i, name := range names {
+		fields[i] = &force.SObjectField{Name: name, Type: fieldType, Createable: true, Updateable: true}
+	}
+	return fields
+}
+
+// changedRecordCount is the number of accounts the mocked changes query
+// matches, and queryBatchSize the most records SFDC returns in one response
+var (
+	changedRecordCount = 2
+	queryBatchSize     = 2000
+)
+
+// queryPage returns how many of the records matched by a query SFDC returns
+// in the first response, given its LIMIT, and whether that's all of them
+func queryPage(query string, matched int) (int, bool) {
+	if i := strings.LastIndex(query, " LIMIT "); i >= 0 {
+		if limit, err := strconv.Atoi(strings.TrimSpace(query[i+len(" LIMIT "):])); err == nil && limit < matched {
+			matched = limit
+		}
+	}
+	if matched > queryBatchSize {
+		return queryBatchSize, false
+	}
+	return matched, true
+}
+
+// lastChangesQuery records the last query for changed records
+var lastChangesQuery string
+
+// earliestDeletedDate mocks how far back SFDC keeps deleted records
+var earliestDeletedDate = "2016-01-01T00:00:00.000+0000"
+
+func (m mockClient) GetSFDCResource(path string, obj interface{}) error {
+	if deleted, ok := obj.(*SFDCDeletedResponse); ok {
+		if !strings.HasPrefix(path, "sobjects/Account/deleted/?") && !strings.HasPrefix(path, "sobjects/Contact/deleted/?") {
+			return fmt.Errorf("resource not found: %s", path)
+		}
+		return forcejson.Unmarshal([]byte(`{
+			"deletedRecords": [{"id": "001d000001DELETEAA", "deletedDate": "2016-03-01T11:00:00.000+0000"}],
+			"earliestDateAvailable": "`+earliestDeletedDate+`",
+			"latestDateCovered": "2016-03-02T00:00:00.000+0000"
+		}`), deleted)
+	}
+
+	picklist, ok := obj.(*SFDCRecordTypePicklist)
+	if !ok {
+		return fmt.Errorf("unexpected resource type: %T", obj)
+	}
+
+	if path != "ui-api/object-info/Account/picklist-values/012d0000000RTK12AA/Industry" {
+		return fmt.Errorf("resource not found: %s", path)
+	}
+
+	err := forcejson.Unmarshal([]byte(`{
+		"controllerValues": {"GMBU": 0, "K12": 1},
+		"defaultValue": {"value": "Education"},
+		"values": [{"label": "Education", "value": "Education", "validFor": [1]}]
+	}`), picklist)
+	if err != nil {
+		return err
+	}
+
+	return getQueryError()
+}
+
 func queryContacts(query string, res *SFDCContactQueryResponse) error {
 	res.TotalSize = 0
 	if strings.Split(query, " ")[0] == "delect" {
 		return errors.New("Invalid query passed to QuerySFDCObject")
 	}
 
+	if records, ok := accountContactQueries[query[strings.LastIndex(query, " FROM ")+1:]]; ok {
+		res.Records = records
+		return getQueryError()
+	}
+
 	contacts := make([]*services.ContactDTO, 1)
 	account := &services.AccountDTO{Name: "Test Account"}
 	contact := &services.ContactDTO{FirstName: "Test", LastName: "Contact", Account: account, Currency: "US"}
@@ -135,6 +348,24 @@ func queryContacts(query string, res *SFDCContactQueryResponse) error {
 	return nil
 }
 
+// updateAccount is the account of updatedContactDTO, whose other contact is a
+// duplicate of a contact named Bob Smith
+var (
+	updateAccount     = &services.AccountDTO{SalesForceID: "001d000001UPDATEAA", Name: "Test Org Name"}
+	updatedContactDTO = &services.ContactDTO{SalesForceID: "003d000001UPDATEAA", FirstName: "Robert",
+		LastName: "Jones", Email: "rjones@example.com", Title: "Director", Currency: "USD", Account: updateAccount}
+	smithContactDTO = &services.ContactDTO{SalesForceID: "003d000001SMITH0AA", FirstName: "Bob",
+		LastName: "Smith", Email: "bob.smith@example.com", Currency: "USD", Account: updateAccount}
+)
+
+// accountContactQueries are the contacts returned by queries, from their
+// FROM clause on
+var accountContactQueries = map[string][]*services.ContactDTO{
+	"FROM Contact WHERE Id in ('003d000001UPDATEAA')":     {updatedContactDTO},
+	"FROM Contact WHERE Id in ('003d000001MISSINGA')":     {},
+	"FROM Contact WHERE AccountId = '001d000001UPDATEAA'": {updatedContactDTO, smithContactDTO},
+}
+
 func queryAccounts(query string, res *SFDCAccountQueryResponse) error {
 	if strings.Split(query, " ")[0] == "delect" {
 		return errors.New("Invalid query passed to QuerySFDCObject")
@@ -144,6 +375,197 @@ func queryAccounts(query string, res *SFDCAccountQueryResponse) error {
 	account := &services.AccountDTO{Name: "Test Account"}
 	accounts[0] = account
 
+	if strings.HasSuffix(query, "WHERE ParentId = '001d000001DISTRTAA'") {
+		accounts = []*services.AccountDTO{
+			{Name: "School", SalesForceID: "001d000001SCHOOLAA", ParentID: "001d000001DISTRTAA"},
+		}
+	}
+
 	res.Records = accounts
-	return nil
+	return getQueryError()
+}
+
+// keyPrefixes mocks the first characters of the ids of each object
+var keyPrefixes = map[string]string{"Account": "001", "Contact": "003", "Contact_Role__c": "a0X"}
+
+// lastCompositeRequests records the subrequests of the last composite request
+var lastCompositeRequests []*SFDCCompositeSubrequest
+
+// CompositeSFDCRequest mocks an all-or-none composite request. Inserted
+// accounts are given the id of getSFDCResposne and other records a new id,
+// and records are read with GetSFDCObject.
+func (m mockClient) CompositeSFDCRequest(allOrNone bool, requests []*SFDCCompositeSubrequest) ([]*SFDCCompositeResult, error) {
+	lastCompositeRequests = requests
+	if err := getCommandError(); err != nil {
+		return nil, err
+	}
+
+	ids := map[string]string{}
+	resolve := func(id string) string {
+		if strings.HasPrefix(id, "@{") && strings.HasSuffix(id, ".id}") {
+			return ids[strings.TrimSuffix(strings.TrimPrefix(id, "@{"), ".id}")]
+		}
+		return id
+	}
+	failure := func(code, message string) json.RawMessage {
+		data, _ := json.Marshal(force.ApiErrors{{ErrorCode: code, Message: message}})
+		return data
+	}
+
+	failed := false
+	results := make([]*SFDCCompositeResult, len(requests))
+	for i, r := range requests {
+		result := &SFDCCompositeResult{ReferenceID: r.ReferenceID}
+		results[i] = result
+
+		if failed {
+			result.HTTPStatusCode = 400
+			result.Body = failure(processingHaltedErrorCode, "The transaction was rolled back")
+			continue
+		}
+
+		switch {
+		case r.Method == "POST":
+			resp := SFDCResponse{ID: fmt.Sprintf("%sd000001NEW%03dAA", keyPrefixes[r.SObject.ApiName()], i), Success: true}
+			if r.SObject.ApiName() == "Account" {
+				resp = getSFDCResposne()
+			}
+			if !resp.Success || resp.ErrorMessage != "" {
+				result.HTTPStatusCode = 400
+				result.Body = failure("FIELD_CUSTOM_VALIDATION_EXCEPTION", resp.ErrorMessage)
+				break
+			}
+			ids[r.ReferenceID] = resp.ID
+			result.HTTPStatusCode = 201
+			result.Body, _ = json.Marshal(map[string]interface{}{"id": resp.ID, "success": true, "errors": []string{}})
+		case r.Method == "PATCH" || r.Method == "DELETE":
+			result.HTTPStatusCode = 204
+		case r.Method == "GET" && r.SObject.ApiName() == "Account":
+			account := &SFDCAccount{}
+			if err := m.GetSFDCObject(resolve(r.ID), account); err != nil {
+				result.HTTPStatusCode = 404
+				result.Body = failure("NOT_FOUND", err.Error())
+				break
+			}
+			result.HTTPStatusCode = 200
+			result.Body, _ = forcejson.Marshal(account)
+		default:
+			return nil, fmt.Errorf("unexpected subrequest: %s %s", r.Method, r.path())
+		}
+
+		failed = allOrNone && result.HTTPStatusCode >= 300
+	}
+
+	return results, nil
+}
+
+// lastBulkRecords records the records of the last bulk upsert
+var lastBulkRecords []map[string]string
+
+// BulkUpsertSFDCObjects mocks a bulk upsert by Id. Records without an Id are
+// created and records with the last name "Duplicate" are rejected.
+func (m mockClient) BulkUpsertSFDCObjects(sobject force.SObject, externalIDField string,
+	records []map[string]string) ([]*SFDCBulkResult, error) {
+
+	lastBulkRecords = records
+	if err := getCommandError(); err != nil {
+		return nil, err
+	}
+
+	results := make([]*SFDCBulkResult, len(records))
+	for i, record := range records {
+		results[i] = &SFDCBulkResult{ID: record[externalIDField], Success: true}
+		if record["LastName"] == "Duplicate" {
+			results[i] = &SFDCBulkResult{Error: "DUPLICATE_VALUE:duplicate value found"}
+		} else if results[i].ID == "" {
+			results[i].ID = fmt.Sprintf("%sd000001NEW%03dAA", keyPrefixes[sobject.ApiName()], i)
+			results[i].Created = true
+		}
+	}
+	return results, nil
+}
+
+// GetSFDCLimits mocks an org that has used 4000 of its 5000 daily API requests
+func (m mockClient) GetSFDCLimits() (force.Limits, error) {
+	return force.Limits{"DailyApiRequests": {Max: 5000, Remaining: 1000}}, getQueryError()
+}
+
+// lastDeleted records the path of the last deleted record, ex. "Account/001..."
+// or "Account/Clarify_Site_ID__c/5740"
+var lastDeleted string
+
+func (m mockClient) DeleteSFDCObject(id string, obj interface{}) error {
+	sobject, ok := obj.(force.SObject)
+	if !ok {
+		return fmt.Errorf("unable to convert data to SObject. Unexpected type: %T", obj)
+	}
+	lastDeleted = sobject.ApiName() + "/" + id
+	return getCommandError()
+}
+
+func (m mockClient) DeleteSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, ok := obj.(force.SObject)
+	if !ok {
+		return fmt.Errorf("unable to convert data to SObject. Unexpected type: %T", obj)
+	}
+	lastDeleted = sobject.ApiName() + "/" + sobject.ExternalIdApiName() + "/" + id
+	return getCommandError()
+}
+
+// lastQueryAll records the last query that included deleted records
+var lastQueryAll string
+
+// QueryAllSFDCObject mocks a recycle bin with one account and one contact.
+// The account with Site ID 404 isn't in it.
+func (m mockClient) QueryAllSFDCObject(query string, obj interface{}) error {
+	lastQueryAll = query
+
+	switch response := obj.(type) {
+	case *SFDCAccountQueryResponse:
+		if !strings.Contains(query, "Clarify_Site_ID__c = '404'") {
+			response.Records = []*services.AccountDTO{{Name: "Deleted Account", SalesForceID: "001d000001DELETEAA"}}
+		}
+	case *SFDCContactQueryResponse:
+		response.Records = []*services.ContactDTO{{LastName: "Deleted", SalesForceID: "003d000001DELETEAA"}}
+	default:
+		return errors.New("obj is not a valid SFDCQueryResponse")
+	}
+	return getQueryError()
+}
+
+// lastUndeleted records the ids of the last undelete
+var lastUndeleted []string
+
+// UndeleteSFDCObjects mocks an undelete where records whose ids end in
+// "PURGED" have been emptied from the recycle bin
+func (m mockClient) UndeleteSFDCObjects(ids []string) ([]SFDCResponse, error) {
+	lastUndeleted = ids
+	if err := getCommandError(); err != nil {
+		return nil, err
+	}
+
+	responses := make([]SFDCResponse, len(ids))
+	for i, id := range ids {
+		responses[i] = SFDCResponse{ID: id, Success: true}
+		if strings.HasSuffix(id, "PURGED") {
+			responses[i] = SFDCResponse{ErrorMessage: "ENTITY_IS_DELETED: entity is deleted"}
+		}
+	}
+	return responses, nil
+}
+
+// lastMergeObject and lastMergeIDs record the last merge
+var (
+	lastMergeObject interface{}
+	lastMergeIDs    []string
+)
+
+// MergeSFDCObjects mocks a merge that moved a contact role to the master
+func (m mockClient) MergeSFDCObjects(masterID string, obj interface{}, duplicateIDs []string) (*SFDCMergeResult, error) {
+	lastMergeObject = obj
+	lastMergeIDs = duplicateIDs
+	if err := getCommandError(); err != nil {
+		return nil, err
+	}
+	return &SFDCMergeResult{MergedIDs: duplicateIDs, UpdatedRelatedIDs: []string{"a0Xd000001ROLE01AA"}}, nil
 }
@@ -0,0 +1,152 @@
+package salesforce
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+)
+
+//sobjectPatch is the body of a PATCH request that only contains the fields
+//being changed. Fields with a nil value are cleared in SFDC.
+type sobjectPatch struct {
+	apiName           string
+	externalIDAPIName string
+	Fields            map[string]interface{}
+}
+
+//ApiName is the SFDC ApiName of the object being patched
+func (p sobjectPatch) ApiName() string {
+	return p.apiName
+}
+
+//ExternalIdApiName is the SFDC external id of the object being patched
+func (p sobjectPatch) ExternalIdApiName() string {
+	return p.externalIDAPIName
+}
+
+//MarshalJSON writes the patched fields as a flat JSON object
+func (p sobjectPatch) MarshalJSON() ([]byte, error) {
+	return forcejson.Marshal(p.Fields)
+}
+
+//newSObjectPatch builds a patch for the object of the given sobject type from
+//the fields of dto named in fields. Fields are named by their json tag and
+//sent under their force tag; empty values are sent as null so that cleared
+//fields are cleared in SFDC. Fields that aren't stored in SFDC (force:"-") are
+//skipped.
+func newSObjectPatch(sobject force.SObject, dto interface{}, fields []string) (sobjectPatch, error) {
+	patch := sobjectPatch{
+		apiName:           sobject.ApiName(),
+		externalIDAPIName: sobject.ExternalIdApiName(),
+		Fields:            map[string]interface{}{},
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(dto))
+	if v.Kind() != reflect.Struct {
+		return patch, fmt.Errorf("unable to build a patch from type %T", dto)
+	}
+
+	for _, name := range fields {
+		field, sfdcName, ok := fieldByJSONName(v, name)
+		if !ok {
+			return patch, fmt.Errorf("%s has no field named %s", v.Type(), name)
+		}
+		if sfdcName == "-" {
+			continue
+		}
+		if field.Kind() != reflect.String {
+			return patch, fmt.Errorf("field %s can not be patched", name)
+		}
+
+		if field.String() == "" {
+			patch.Fields[sfdcName] = nil
+		} else {
+			patch.Fields[sfdcName] = field.String()
+		}
+	}
+
+	return patch, nil
+}
+
+//fieldByJSONName finds the struct field with the given json tag name and
+//returns it along with its SFDC name from the force tag.
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, string, bool) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if field, sfdcName, ok := fieldByJSONName(v.Field(i), name); ok {
+				return field, sfdcName, true
+			}
+			continue
+		}
+
+		if tagName(f.Tag.Get("json")) != name {
+			continue
+		}
+
+		sfdcName := tagName(f.Tag.Get("force"))
+		if sfdcName == "" {
+			sfdcName = f.Name
+		}
+		return v.Field(i), sfdcName, true
+	}
+
+	return reflect.Value{}, "", false
+}
+
+func tagName(tag string) string {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+//newSObjectInsert builds the body of an insert from the string fields of dto
+//that aren't empty. Related records, the SFDC Id and fields that aren't
+//stored in SFDC (force:"-") are left out.
+func newSObjectInsert(sobject force.SObject, dto interface{}) (sobjectPatch, error) {
+	insert := sobjectPatch{
+		apiName:           sobject.ApiName(),
+		externalIDAPIName: sobject.ExternalIdApiName(),
+		Fields:            map[string]interface{}{},
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(dto))
+	if v.Kind() != reflect.Struct {
+		return insert, fmt.Errorf("unable to build an insert from type %T", dto)
+	}
+
+	addInsertFields(insert.Fields, v)
+	return insert, nil
+}
+
+func addInsertFields(fields map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addInsertFields(fields, v.Field(i))
+			continue
+		}
+		if f.PkgPath != "" || f.Type.Kind() != reflect.String || v.Field(i).String() == "" {
+			continue
+		}
+
+		sfdcName := tagName(f.Tag.Get("force"))
+		if sfdcName == "" {
+			sfdcName = f.Name
+		}
+		if sfdcName == "-" || sfdcName == "Id" {
+			continue
+		}
+		fields[sfdcName] = v.Field(i).String()
+	}
+}
@@ -0,0 +1,35 @@
+package salesforce
+
+import (
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+func TestNewSObjectPatch(t *testing.T) {
+	Convey("Given an account DTO", t, func() {
+		dto := &services.AccountDTO{Name: "Test Account", PrimaryCity: "Charleston"}
+		Convey("When a patch is built for set, cleared and unstored fields", func() {
+			patch, err := newSObjectPatch(SFDCAccount{}, dto, []string{"name", "industry", "primaryCity"})
+			Convey("Then the fields should be named by their SFDC names", func() {
+				So(err, ShouldBeNil)
+				So(patch.Fields, ShouldResemble, map[string]interface{}{
+					"Name":     "Test Account",
+					"Industry": nil,
+				})
+			})
+			Convey("Then the patch should marshal to a flat JSON object with nulls", func() {
+				body, err := patch.MarshalJSON()
+				So(err, ShouldBeNil)
+				So(string(body), ShouldEqual, `{"Industry":null,"Name":"Test Account"}`)
+			})
+		})
+		Convey("When a patch is built for an unknown field", func() {
+			_, err := newSObjectPatch(SFDCAccount{}, dto, []string{"nickname"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
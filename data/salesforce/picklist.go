@@ -0,0 +1,191 @@
+package salesforce
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//sobjectName lets any SFDC object be described by its API name
+type sobjectName string
+
+//ApiName is the SFDC ApiName of the object
+func (s sobjectName) ApiName() string {
+	return string(s)
+}
+
+//ExternalIdApiName isn't used when describing an object
+func (s sobjectName) ExternalIdApiName() string {
+	return ""
+}
+
+//SFDCRecordTypePicklist is the response of the UI API picklist-values
+//resource, which lists the values of a picklist available to a record type
+type SFDCRecordTypePicklist struct {
+	ControllerValues map[string]int `force:"controllerValues,omitempty"`
+	DefaultValue     *struct {
+		Value string `force:"value,omitempty"`
+	} `force:"defaultValue,omitempty"`
+	Values []*struct {
+		Label    string `force:"label,omitempty"`
+		Value    string `force:"value,omitempty"`
+		ValidFor []int  `force:"validFor,omitempty"`
+	} `force:"values,omitempty"`
+}
+
+//GetBusinessUnitPicklist returns the values of the Account Business_Unit__c
+//picklist, including inactive values
+func (a API) GetBusinessUnitPicklist() ([]*services.PicklistValueDTO, error) {
+	picklist, err := a.GetPicklist("Account", "Business_Unit__c", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return picklist.Values, nil
+}
+
+//GetPicklist returns the values of a picklist field. Without a recordTypeID
+//every value from the describe of the object is returned, including inactive
+//values. With one, the UI API is used to return only the active values
+//available to that record type.
+func (a API) GetPicklist(object, field, recordTypeID string) (*services.PicklistDTO, error) {
+	description, err := a.client.DescribeSFDCObject(sobjectName(object))
+	if err != nil {
+		return nil, fmt.Errorf("Error describing %s: %s", object, err)
+	}
+
+	f := findSObjectField(description, field)
+	if f == nil {
+		return nil, fmt.Errorf("%s has no field named %s", object, field)
+	}
+	if f.Type != "picklist" && f.Type != "multipicklist" {
+		return nil, fmt.Errorf("%s.%s is not a picklist (type: %s)", object, field, f.Type)
+	}
+
+	picklist := &services.PicklistDTO{
+		Object:       object,
+		Field:        field,
+		RecordTypeID: recordTypeID,
+	}
+	if f.DependentPicklist {
+		picklist.ControllerField = f.ControllerName
+	}
+
+	if recordTypeID != "" {
+		err = a.getRecordTypePicklistValues(picklist)
+		return picklist, err
+	}
+
+	var controllerValues []string
+	if picklist.ControllerField != "" {
+		controllerValues = picklistControllerValues(findSObjectField(description, picklist.ControllerField))
+	}
+
+	for _, value := range f.PicklistValues {
+		picklist.Values = append(picklist.Values, &services.PicklistValueDTO{
+			Value:    value.Value,
+			Label:    value.Label,
+			Active:   value.Active,
+			Default:  value.DefaulValue,
+			ValidFor: decodeValidFor(value.ValidFor, controllerValues),
+		})
+	}
+
+	return picklist, nil
+}
+
+func (a API) getRecordTypePicklistValues(picklist *services.PicklistDTO) error {
+	if len(picklist.RecordTypeID) != 15 && len(picklist.RecordTypeID) != 18 {
+		return fmt.Errorf("recordTypeID must be a valid 15 or 18 character SFDC id")
+	}
+
+	response := &SFDCRecordTypePicklist{}
+	path := fmt.Sprintf("ui-api/object-info/%s/picklist-values/%s/%s",
+		picklist.Object, picklist.RecordTypeID, picklist.Field)
+
+	err := a.client.GetSFDCResource(path, response)
+	if err != nil {
+		return fmt.Errorf("Error getting %s.%s values for record type %s: %s",
+			picklist.Object, picklist.Field, picklist.RecordTypeID, err)
+	}
+
+	controllerValues := make([]string, len(response.ControllerValues))
+	for value, index := range response.ControllerValues {
+		if index >= 0 && index < len(controllerValues) {
+			controllerValues[index] = value
+		}
+	}
+
+	for _, value := range response.Values {
+		dto := &services.PicklistValueDTO{Value: value.Value, Label: value.Label, Active: true}
+		dto.Default = response.DefaultValue != nil && response.DefaultValue.Value == value.Value
+
+		if picklist.ControllerField != "" {
+			for _, index := range value.ValidFor {
+				if index >= 0 && index < len(controllerValues) {
+					dto.ValidFor = append(dto.ValidFor, controllerValues[index])
+				}
+			}
+		}
+
+		picklist.Values = append(picklist.Values, dto)
+	}
+
+	return nil
+}
+
+func findSObjectField(description *force.SObjectDescription, name string) *force.SObjectField {
+	if description == nil {
+		return nil
+	}
+
+	for _, f := range description.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+//picklistControllerValues returns the values of a controlling field in the
+//order used by the validFor bitmaps of its dependent picklists. Checkbox
+//controllers have the values "false" and "true".
+func picklistControllerValues(controller *force.SObjectField) []string {
+	if controller == nil {
+		return nil
+	}
+
+	if controller.Type == "boolean" {
+		return []string{"false", "true"}
+	}
+
+	values := make([]string, len(controller.PicklistValues))
+	for index, value := range controller.PicklistValues {
+		values[index] = value.Value
+	}
+	return values
+}
+
+//decodeValidFor decodes the base64 validFor bitmap of a dependent picklist
+//value. Bit n, counting from the most significant bit of the first byte, is
+//set if the value is valid for the nth controlling value.
+func decodeValidFor(validFor string, controllerValues []string) []string {
+	if validFor == "" || len(controllerValues) == 0 {
+		return nil
+	}
+
+	bitmap, err := base64.StdEncoding.DecodeString(validFor)
+	if err != nil {
+		return nil
+	}
+
+	values := []string{}
+	for index, value := range controllerValues {
+		if index/8 < len(bitmap) && bitmap[index/8]&(0x80>>uint(index%8)) != 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
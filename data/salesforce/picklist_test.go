@@ -0,0 +1,127 @@
+package salesforce
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+func TestGetBusinessUnitPicklist(t *testing.T) {
+	Convey("Given the Account object in SFDC", t, func() {
+		Convey("When the business unit picklist is requested", func() {
+			values, err := api.GetBusinessUnitPicklist()
+			Convey("Then the active and inactive values should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(values), ShouldEqual, 3)
+				So(values[0].Default, ShouldBeTrue)
+				So(values[1].Label, ShouldEqual, "K-12")
+				So(values[2].Active, ShouldBeFalse)
+			})
+		})
+		Convey("When the picklist field doesn't exist", func() {
+			_, err := api.GetPicklist("Account", "Region__c", "")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When describing the object fails", func() {
+			getQueryError = func() error { return errors.New("fake error") }
+			_, err := api.GetBusinessUnitPicklist()
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			getQueryError = func() error { return nil }
+		})
+	})
+}
+
+func TestGetPicklist(t *testing.T) {
+	Convey("Given a dependent picklist", t, func() {
+		Convey("When all of its values are requested", func() {
+			picklist, err := api.GetPicklist("Account", "Industry", "")
+			Convey("Then each value should list the controlling values it's valid for", func() {
+				So(err, ShouldBeNil)
+				So(picklist.ControllerField, ShouldEqual, "Business_Unit__c")
+				So(picklist.Values[0].ValidFor, ShouldResemble, []string{"GMBU"})
+				So(picklist.Values[1].ValidFor, ShouldResemble, []string{"K12", "IBU"})
+			})
+		})
+		Convey("When the values of a record type are requested", func() {
+			picklist, err := api.GetPicklist("Account", "Industry", "012d0000000RTK12AA")
+			Convey("Then only the values of the record type should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(picklist.Values), ShouldEqual, 1)
+				So(picklist.Values[0].Default, ShouldBeTrue)
+				So(picklist.Values[0].ValidFor, ShouldResemble, []string{"K12"})
+			})
+		})
+		Convey("When the record type ID is invalid", func() {
+			_, err := api.GetPicklist("Account", "Industry", "012")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a field that isn't a picklist", t, func() {
+		Convey("When its values are requested", func() {
+			_, err := api.GetPicklist("Account", "Name", "")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given an object SFDC doesn't know", t, func() {
+		Convey("When a picklist of it is requested", func() {
+			_, err := api.GetPicklist("Widget__c", "Color__c", "")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRefreshPicklist(t *testing.T) {
+	Convey("Given a PicklistService reading an org's describe", t, func() {
+		industries := `{"value": "Education", "label": "Education", "active": true}`
+		describes := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/services/data/v32.0/sobjects/Account/describe" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			describes++
+			fmt.Fprintf(w, `{"name": "Account", "fields": [
+				{"name": "Industry", "type": "picklist", "picklistValues": [%s]}
+			]}`, industries)
+		}))
+		api, _ := NewAPIWithConfig(WithVersion("v32.0"), WithAccessToken("token", server.URL))
+		ps := services.NewPicklistService(api, time.Hour)
+		picklist, err := ps.GetPicklist("Account", "Industry", "")
+		So(err, ShouldBeNil)
+		So(len(picklist.Values), ShouldEqual, 1)
+
+		Convey("When a value is added in the org and the picklists are refreshed", func() {
+			industries += `, {"value": "Healthcare", "label": "Healthcare", "active": true}`
+			ps.Refresh()
+			picklist, err := ps.GetPicklist("Account", "Industry", "")
+			Convey("Then the object should be described again and the new value returned", func() {
+				So(err, ShouldBeNil)
+				So(describes, ShouldEqual, 2)
+				So(len(picklist.Values), ShouldEqual, 2)
+				So(picklist.Values[1].Value, ShouldEqual, "Healthcare")
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
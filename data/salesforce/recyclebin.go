@@ -0,0 +1,114 @@
+package salesforce
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//DeleteAccount moves an SFDC Account to the recycle bin, by its SFDC ID or its
+//Clarify Site ID. SFDC also deletes the account's contacts and other records
+//that belong to it.
+func (a API) DeleteAccount(id string) error {
+	var err error
+	if siteID, convErr := strconv.Atoi(id); convErr == nil && siteID > 0 {
+		err = a.client.DeleteSFDCObjectByExternalID(id, &SFDCAccount{})
+	} else if len(id) == 15 || len(id) == 18 {
+		err = a.client.DeleteSFDCObject(id, &SFDCAccount{})
+	} else {
+		return errors.New("id must be a Clarify Site ID or a valid 15 or 18 character SFDC id")
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error deleting account in SFDC: %s", err)
+	}
+	return nil
+}
+
+//DeleteContact moves an SFDC Contact to the recycle bin
+func (a API) DeleteContact(id string) error {
+	if len(id) != 15 && len(id) != 18 {
+		return errors.New("id must be a valid 15 or 18 character SFDC id")
+	}
+
+	err := a.client.DeleteSFDCObject(id, &SFDCContact{})
+	if err != nil {
+		return fmt.Errorf("Error deleting contact in SFDC: %s", err)
+	}
+	return nil
+}
+
+//QueryAllAccounts returns the results of a query that includes the accounts
+//in the recycle bin. Select IsDeleted to tell them apart.
+func (a API) QueryAllAccounts(query string) ([]*services.AccountDTO, error) {
+	queryResponse := &SFDCAccountQueryResponse{}
+
+	err := a.client.QueryAllSFDCObject(query, queryResponse)
+
+	return queryResponse.Records, err
+}
+
+//QueryAllContacts returns the results of a query that includes the contacts
+//in the recycle bin
+func (a API) QueryAllContacts(query string) ([]*services.ContactDTO, error) {
+	queryResponse := &SFDCContactQueryResponse{}
+
+	err := a.client.QueryAllSFDCObject(query, queryResponse)
+
+	return queryResponse.Records, err
+}
+
+//GetDeletedAccounts returns the accounts in the recycle bin
+func (a API) GetDeletedAccounts() ([]*services.AccountDTO, error) {
+	return a.QueryAllAccounts("SELECT " + accountQueryFields + " FROM Account WHERE IsDeleted = true")
+}
+
+//GetDeletedContacts returns the contacts in the recycle bin
+func (a API) GetDeletedContacts() ([]*services.ContactDTO, error) {
+	return a.QueryAllContacts("SELECT " + contactQueryFields + " FROM Contact WHERE IsDeleted = true")
+}
+
+//UndeleteAccount restores an account from the recycle bin, by its SFDC ID or
+//its Clarify Site ID
+func (a API) UndeleteAccount(id string) error {
+	if siteID, err := strconv.Atoi(id); err == nil && siteID > 0 {
+		accounts, err := a.QueryAllAccounts("SELECT Id FROM Account WHERE Clarify_Site_ID__c = '" + id +
+			"' AND IsDeleted = true")
+		if err != nil {
+			return fmt.Errorf("Error finding deleted account: %s", err)
+		}
+		if len(accounts) == 0 {
+			return fmt.Errorf("No account with Site ID %s is in the recycle bin", id)
+		}
+		id = accounts[0].SalesForceID
+	} else if len(id) != 15 && len(id) != 18 {
+		return errors.New("id must be a Clarify Site ID or a valid 15 or 18 character SFDC id")
+	}
+
+	return a.undelete(id)
+}
+
+//UndeleteContact restores a contact from the recycle bin
+func (a API) UndeleteContact(id string) error {
+	if len(id) != 15 && len(id) != 18 {
+		return errors.New("id must be a valid 15 or 18 character SFDC id")
+	}
+	return a.undelete(id)
+}
+
+func (a API) undelete(id string) error {
+	responses, err := a.client.UndeleteSFDCObjects([]string{id})
+	if err != nil {
+		return err
+	}
+	if len(responses) != 1 || !responses[0].Success {
+		message := "no result was returned"
+		if len(responses) == 1 {
+			message = responses[0].ErrorMessage
+		}
+		return fmt.Errorf("Error undeleting %s in SFDC: %s", id, message)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package salesforce
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	Convey("Given an API", t, func() {
+		Convey("When an account is deleted by its SFDC ID", func() {
+			err := api.DeleteAccount("001d000001TweFSAAZ")
+			Convey("Then the account should be deleted", func() {
+				So(err, ShouldBeNil)
+				So(lastDeleted, ShouldEqual, "Account/001d000001TweFSAAZ")
+			})
+		})
+		Convey("When an account is deleted by its Site ID", func() {
+			err := api.DeleteAccount("5740")
+			Convey("Then the account should be deleted by its external id", func() {
+				So(err, ShouldBeNil)
+				So(lastDeleted, ShouldEqual, "Account/Clarify_Site_ID__c/5740")
+			})
+		})
+		Convey("When the id isn't valid", func() {
+			err := api.DeleteAccount("abc")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When SFDC refuses the delete", func() {
+			getCommandError = func() error { return errors.New("ENTITY_IS_LOCKED") }
+			err := api.DeleteAccount("001d000001TweFSAAZ")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "ENTITY_IS_LOCKED")
+			})
+		})
+
+		Reset(func() {
+			getCommandError = func() error { return nil }
+			lastDeleted = ""
+		})
+	})
+}
+
+func TestDeleteContact(t *testing.T) {
+	Convey("Given an API", t, func() {
+		Convey("When a contact is deleted", func() {
+			err := api.DeleteContact("003d000001SeyhqAAB")
+			Convey("Then the contact should be deleted", func() {
+				So(err, ShouldBeNil)
+				So(lastDeleted, ShouldEqual, "Contact/003d000001SeyhqAAB")
+			})
+		})
+		Convey("When the id isn't an SFDC ID", func() {
+			err := api.DeleteContact("5740")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestGetDeletedRecords(t *testing.T) {
+	Convey("Given an API", t, func() {
+		Convey("When the deleted accounts are listed", func() {
+			accounts, err := api.GetDeletedAccounts()
+			Convey("Then the recycle bin should be queried", func() {
+				So(err, ShouldBeNil)
+				So(len(accounts), ShouldEqual, 1)
+				So(accounts[0].SalesForceID, ShouldEqual, "001d000001DELETEAA")
+				So(lastQueryAll, ShouldEndWith, "FROM Account WHERE IsDeleted = true")
+			})
+		})
+		Convey("When the deleted contacts are listed", func() {
+			contacts, err := api.GetDeletedContacts()
+			Convey("Then the recycle bin should be queried", func() {
+				So(err, ShouldBeNil)
+				So(len(contacts), ShouldEqual, 1)
+				So(lastQueryAll, ShouldEndWith, "FROM Contact WHERE IsDeleted = true")
+			})
+		})
+	})
+}
+
+func TestUndeleteAccount(t *testing.T) {
+	Convey("Given an API", t, func() {
+		Convey("When an account is undeleted by its Site ID", func() {
+			err := api.UndeleteAccount("5740")
+			Convey("Then the deleted account with that Site ID should be restored", func() {
+				So(err, ShouldBeNil)
+				So(lastQueryAll, ShouldContainSubstring, "Clarify_Site_ID__c = '5740' AND IsDeleted = true")
+				So(lastUndeleted, ShouldResemble, []string{"001d000001DELETEAA"})
+			})
+		})
+		Convey("When no account with the Site ID is in the recycle bin", func() {
+			err := api.UndeleteAccount("404")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When the account has been emptied from the recycle bin", func() {
+			err := api.UndeleteAccount("001d00000PURGED")
+			Convey("Then the error of SFDC should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "ENTITY_IS_DELETED")
+			})
+		})
+	})
+}
+
+func TestUndeleteSFDCObjects(t *testing.T) {
+	Convey("Given an SFDC org with a SOAP API", t, func() {
+		sessions := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/services/Soap/u/32.0" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			request := struct {
+				SessionID string   `xml:"Header>SessionHeader>sessionId"`
+				IDs       []string `xml:"Body>undelete>ids"`
+			}{}
+			xml.Unmarshal(body, &request)
+			sessions = append(sessions, request.SessionID)
+
+			fmt.Fprint(w, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" `+
+				`xmlns="urn:partner.soap.sforce.com"><soapenv:Body><undeleteResponse>`)
+			for _, id := range request.IDs {
+				if strings.HasSuffix(id, "PURGED") {
+					fmt.Fprint(w, `<result><errors><message>entity is deleted</message>`+
+						`<statusCode>ENTITY_IS_DELETED</statusCode></errors><id xsi:nil="true"/><success>false</success></result>`)
+					continue
+				}
+				fmt.Fprintf(w, `<result><id>%s</id><success>true</success></result>`, id)
+			}
+			fmt.Fprint(w, `</undeleteResponse></soapenv:Body></soapenv:Envelope>`)
+		}))
+		client, _ := newRESTClient(Config{Version: "v32.0", AccessToken: "token", InstanceURL: server.URL,
+			HTTPClient: http.DefaultClient})
+
+		Convey("When records are undeleted", func() {
+			responses, err := client.UndeleteSFDCObjects([]string{"001d000001DELETEAA", "001d00000PURGED"})
+			Convey("Then the result of each record should be returned", func() {
+				So(err, ShouldBeNil)
+				So(sessions, ShouldResemble, []string{"token"})
+				So(len(responses), ShouldEqual, 2)
+				So(responses[0], ShouldResemble, SFDCResponse{ID: "001d000001DELETEAA", Success: true})
+				So(responses[1].Success, ShouldBeFalse)
+				So(responses[1].ErrorMessage, ShouldEqual, "ENTITY_IS_DELETED: entity is deleted")
+			})
+		})
+		Convey("When more records than fit in one call are undeleted", func() {
+			ids := make([]string, maxUndeleteIDs+1)
+			for i := range ids {
+				ids[i] = fmt.Sprintf("001d000001D%05dAA", i)
+			}
+			responses, err := client.UndeleteSFDCObjects(ids)
+			Convey("Then they should be sent in several calls", func() {
+				So(err, ShouldBeNil)
+				So(len(sessions), ShouldEqual, 2)
+				So(len(responses), ShouldEqual, maxUndeleteIDs+1)
+				So(responses[maxUndeleteIDs].ID, ShouldEqual, ids[maxUndeleteIDs])
+			})
+		})
+
+		Reset(func() {
+			server.Close()
+		})
+	})
+}
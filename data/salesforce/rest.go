@@ -0,0 +1,320 @@
+package salesforce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+)
+
+const invalidSessionErrorCode = "INVALID_SESSION_ID"
+
+//restClient implements sfdcClient with the SFDC REST API. Unlike go-force it
+//sends requests with a configurable http.Client and starts a new session
+//when its session expires.
+type restClient struct {
+	config     Config
+	httpClient *http.Client
+	auth       authenticator
+
+	lock        sync.RWMutex
+	accessToken string
+	instanceURL string
+
+	monitor *limitMonitor
+}
+
+//newRESTClient connects with the given settings. An access token is used as
+//is; otherwise the client logs in straight away.
+func newRESTClient(config Config) (*restClient, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	client := &restClient{
+		config:     config,
+		httpClient: config.httpClient(),
+		auth:       config.authenticator(),
+		monitor:    newLimitMonitor(config.LimitPolicy),
+	}
+
+	if config.AccessToken != "" {
+		client.setSession(session{accessToken: config.AccessToken, instanceURL: config.InstanceURL})
+		return client, nil
+	}
+
+	if err := client.authenticate(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+//authenticate starts a new session
+func (c *restClient) authenticate() error {
+	if c.auth == nil {
+		return errors.New("The SFDC session has expired and no credentials were given to log in again")
+	}
+
+	s, err := c.auth.authenticate(c.httpClient)
+	if err != nil {
+		return err
+	}
+
+	c.setSession(s)
+	c.logf("started SFDC session with %s", c.auth)
+	return nil
+}
+
+func (c *restClient) setSession(s session) {
+	c.lock.Lock()
+	c.accessToken = s.accessToken
+	c.instanceURL = strings.TrimSuffix(s.instanceURL, "/")
+	c.lock.Unlock()
+}
+
+func (c *restClient) logf(format string, v ...interface{}) {
+	if c.config.Logger != nil {
+		c.config.Logger.Printf(format, v...)
+	}
+}
+
+//url returns the URL of a resource. Paths that don't start with a "/" are
+//relative to the versioned data URL.
+func (c *restClient) url(path string, params url.Values) string {
+	c.lock.RLock()
+	instanceURL := c.instanceURL
+	c.lock.RUnlock()
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/services/data/" + c.config.Version + "/" + path
+	}
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return instanceURL + path
+}
+
+//request sends a request and decodes the response into out. If the session
+//has expired the client logs in again and resends the request once.
+func (c *restClient) request(method, path string, params url.Values, payload, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = forcejson.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("Error encoding %s request: %s", method, err)
+		}
+	}
+
+	err := c.send(method, path, params, body, out)
+	if apiErrors, ok := err.(force.ApiErrors); ok && isInvalidSession(apiErrors) {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+		err = c.send(method, path, params, body, out)
+	}
+
+	return err
+}
+
+func (c *restClient) send(method, path string, params url.Values, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.url(path, params), reader)
+	if err != nil {
+		return fmt.Errorf("Error creating %s request: %s", method, err)
+	}
+
+	c.lock.RLock()
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	c.lock.RUnlock()
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error sending %s request: %s", method, err)
+	}
+	defer resp.Body.Close()
+
+	c.logf("%s %s: %s", method, path, resp.Status)
+	c.observeLimits(resp)
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading %s response: %s", method, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErrors := force.ApiErrors{}
+		if err := forcejson.Unmarshal(data, &apiErrors); err == nil && apiErrors.Validate() {
+			return apiErrors
+		}
+		return fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent || len(data) == 0 {
+		return nil
+	}
+
+	err = forcejson.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("Unable to unmarshal response to object: %s", err)
+	}
+	return nil
+}
+
+//observeLimits records the API usage reported by a response, warning when
+//the threshold of the LimitPolicy is reached
+func (c *restClient) observeLimits(resp *http.Response) {
+	if c.monitor.observe(resp.Header.Get(limitInfoHeader)) {
+		usage := c.monitor.Usage()
+		c.logf("WARNING SFDC API usage is at %.1f%% of the daily limit (%d/%d)",
+			usage.Percent(), usage.Used, usage.Max)
+	}
+}
+
+func isInvalidSession(apiErrors force.ApiErrors) bool {
+	for _, apiError := range apiErrors {
+		if apiError.ErrorCode == invalidSessionErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+func sobjectPath(sobject force.SObject, elements ...string) string {
+	path := "sobjects/" + sobject.ApiName()
+	for _, element := range elements {
+		path += "/" + url.QueryEscape(element)
+	}
+	return path
+}
+
+func toSObject(obj interface{}) (force.SObject, error) {
+	sobject, ok := obj.(force.SObject)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert data to SObject")
+	}
+	return sobject, nil
+}
+
+func (c *restClient) GetSFDCObject(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("GET", sobjectPath(sobject, id), nil, nil, obj)
+}
+
+func (c *restClient) GetSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("GET", sobjectPath(sobject, sobject.ExternalIdApiName(), id), nil, nil, obj)
+}
+
+func (c *restClient) QuerySFDCObject(query string, obj interface{}) error {
+	return c.request("GET", "query", url.Values{"q": {query}}, nil, obj)
+}
+
+func (c *restClient) QueryAllSFDCObject(query string, obj interface{}) error {
+	return c.request("GET", "queryAll", url.Values{"q": {query}}, nil, obj)
+}
+
+func (c *restClient) InsertSFDCObject(obj interface{}) (SFDCResponse, error) {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return SFDCResponse{}, err
+	}
+
+	resp := &force.SObjectResponse{}
+	err = c.request("POST", sobjectPath(sobject), nil, obj, resp)
+
+	return SFDCResponse{ID: resp.Id, ErrorMessage: resp.Errors.Error(), Success: resp.Success}, err
+}
+
+func (c *restClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("PATCH", sobjectPath(sobject, sobject.ExternalIdApiName(), id), nil, obj, nil)
+}
+
+func (c *restClient) UpdateSFDCObject(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("PATCH", sobjectPath(sobject, id), nil, obj, nil)
+}
+
+func (c *restClient) DeleteSFDCObject(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("DELETE", sobjectPath(sobject, id), nil, nil, nil)
+}
+
+func (c *restClient) DeleteSFDCObjectByExternalID(id string, obj interface{}) error {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return err
+	}
+	return c.request("DELETE", sobjectPath(sobject, sobject.ExternalIdApiName(), id), nil, nil, nil)
+}
+
+//DescribeSFDCObject describes an object. The describe is read from the org
+//on every call rather than cached, so that a refreshed PicklistService or a
+//new schema check sees the org's current fields.
+func (c *restClient) DescribeSFDCObject(obj interface{}) (*force.SObjectDescription, error) {
+	sobject, err := toSObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	description := &force.SObjectDescription{}
+	err = c.request("GET", sobjectPath(sobject, "describe"), nil, nil, description)
+	if err != nil {
+		return nil, err
+	}
+	return description, nil
+}
+
+func (c *restClient) GetSFDCResource(path string, obj interface{}) error {
+	return c.request("GET", path, nil, nil, obj)
+}
+
+func (c *restClient) CompositeSFDCRequest(allOrNone bool, requests []*SFDCCompositeSubrequest) ([]*SFDCCompositeResult, error) {
+	composite, err := newCompositeRequest(c.config.Version, allOrNone, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &compositeResponse{}
+	err = c.request("POST", "composite", nil, composite, resp)
+
+	return resp.CompositeResponse, err
+}
+
+func (c *restClient) GetSFDCLimits() (force.Limits, error) {
+	limits := force.Limits{}
+	err := c.request("GET", "limits", nil, nil, &limits)
+	return limits, err
+}
@@ -23,6 +23,25 @@ BBWEBCORE_SFDCTOKEN
 
 BBWEBCORE_SFDCENVIRONMENT (use either "sandbox" or "production")
 
+BBWEBCORE_SFDCPRIVATEKEYFILE (optional, a PEM encoded RSA key used to log in
+with the JWT bearer flow instead of a password)
+
+BBWEBCORE_SFDCACCESSTOKEN and BBWEBCORE_SFDCINSTANCEURL (optional, a session
+issued outside of webcore)
+
+BBWEBCORE_SFDCFIELDMAPPING (optional, a YAML, TOML or JSON file mapping the
+object and field names of the DTOs to an org's names. See LoadFieldMapping.)
+
+NewAPIWithConfig builds an API from options instead, returning an error rather
+than panicking if the login fails. FromEnv reads the variables above, and the
+other options set the version, credentials, environment, http.Client, timeout
+and logger explicitly:
+
+	api, err := salesforce.NewAPIWithConfig(
+		salesforce.FromEnv(),
+		salesforce.WithTimeout(10*time.Second),
+		salesforce.WithLogger(log.New(os.Stderr, "sfdc ", log.LstdFlags)),
+	)
 */
 package salesforce
 
@@ -37,14 +56,25 @@ var viperSFDC = viper.New()
 
 // API provides access to SalesForce Data
 type API struct {
-	client sfdcClient
+	client  sfdcClient
+	monitor *limitMonitor
 }
 
-// NewAPI returns an API object with a default client
+// NewAPI returns an API object with a default client configured from the
+// environmental variables. It panics if the settings are incomplete or the
+// login fails; use NewAPIWithConfig(FromEnv()) to handle the error instead.
 func NewAPI() API {
-	getConfigSettings()
-	fc := forceClient{getForceAPIClient()}
-	return API{client: fc}
+	api, err := NewAPIWithConfig(FromEnv())
+	if err != nil {
+		panic(fmt.Errorf("Fatal error creating SFDC API: %s \n", err))
+	}
+	return api
+}
+
+// WithFieldMapping returns a copy of the API that maps the object and field
+// names of the DTOs to those of an org with different customizations
+func (a API) WithFieldMapping(mapping *FieldMapping) API {
+	return API{client: newMappedClient(a.client, mapping), monitor: a.monitor}
 }
 
 // SFDCResponse contains the SalesForce response info after an insert/update
@@ -68,104 +98,19 @@ type sfdcClient interface {
 	InsertSFDCObject(object interface{}) (resposne SFDCResponse, err error)
 	UpsertSFDCObjectByExternalID(id string, obj interface{}) (err error)
 	UpdateSFDCObject(id string, obj interface{}) (err error)
-}
-
-type forceClient struct {
-	*force.ForceApi
-}
-
-func (f forceClient) GetSFDCObject(id string, obj interface{}) (err error) {
-	sobject, ok := obj.(force.SObject)
-	if !ok {
-		err = fmt.Errorf("unable to convert data to SObject")
-		return err
-	}
-
-	err = f.GetSObject(id, sobject)
-	return err
-}
-
-func (f forceClient) GetSFDCObjectByExternalID(id string, obj interface{}) (err error) {
-	sobject, ok := obj.(force.SObject)
-	if !ok {
-		err = fmt.Errorf("unable to convert data to SObject")
-		return err
-	}
-
-	err = f.GetSObjectByExternalId(id, sobject)
-	return err
-}
-
-func (f forceClient) QuerySFDCObject(query string, obj interface{}) (err error) {
-	err = f.Query(query, obj)
-	return err
-}
-
-func (f forceClient) InsertSFDCObject(obj interface{}) (resposne SFDCResponse, err error) {
-	sobject, ok := obj.(force.SObject)
-	if !ok {
-		err = fmt.Errorf("unable to convert data to SObject")
-		return SFDCResponse{}, err
-	}
-
-	resp, err := f.InsertSObject(sobject)
-
-	sfdcResp := SFDCResponse{}
-	if resp != nil {
-		sfdcResp.ID = resp.Id
-		sfdcResp.ErrorMessage = resp.Errors.Error()
-		sfdcResp.Success = resp.Success
-	}
-
-	return sfdcResp, err
-}
-
-func (f forceClient) UpsertSFDCObjectByExternalID(id string, obj interface{}) (err error) {
-	sobject, ok := obj.(force.SObject)
-	if !ok {
-		err = fmt.Errorf("unable to convert data to SObject")
-		return err
-	}
-
-	// no response object is returned for upserts
-	_, err = f.UpsertSObjectByExternalId(id, sobject)
-
-	return err
-}
-
-//UpdateSFDCObject currently has to be explicitly handed the SFDC ID of the object being passed. This should be changed
-//in the future to read that property from the object itself.
-func (f forceClient) UpdateSFDCObject(id string, obj interface{}) (err error) {
-	sobject, ok := obj.(force.SObject)
-	if !ok {
-		err = fmt.Errorf("unable to convert data to SObject")
-		return err
-	}
-
-	err = f.UpdateSObject(id, sobject)
-
-	return err
+	DescribeSFDCObject(obj interface{}) (description *force.SObjectDescription, err error)
+	GetSFDCResource(path string, obj interface{}) (err error)
+	CompositeSFDCRequest(allOrNone bool, requests []*SFDCCompositeSubrequest) (results []*SFDCCompositeResult, err error)
+	BulkUpsertSFDCObjects(sobject force.SObject, externalIDField string, records []map[string]string) (results []*SFDCBulkResult, err error)
+	GetSFDCLimits() (limits force.Limits, err error)
+	DeleteSFDCObject(id string, obj interface{}) (err error)
+	DeleteSFDCObjectByExternalID(id string, obj interface{}) (err error)
+	QueryAllSFDCObject(query string, obj interface{}) (err error)
+	UndeleteSFDCObjects(ids []string) (results []SFDCResponse, err error)
+	MergeSFDCObjects(masterID string, obj interface{}, duplicateIDs []string) (result *SFDCMergeResult, err error)
 }
 
 func getConfigSettings() {
 	viperSFDC.SetEnvPrefix("bbwebcore")
 	viperSFDC.AutomaticEnv()
 }
-
-func getForceAPIClient() *force.ForceApi {
-	forceAPI, err := force.Create(
-		viperSFDC.GetString("sfdcVersion"),
-		viperSFDC.GetString("sfdcClientId"),
-		viperSFDC.GetString("sfdcClientSecret"),
-		viperSFDC.GetString("sfdcUserName"),
-		viperSFDC.GetString("sfdcPassword"),
-		viperSFDC.GetString("sfdcToken"),
-		viperSFDC.GetString("sfdcEnvironment"),
-	)
-
-	if err != nil {
-		panic(fmt.Errorf("Fatal error creating forceAPI: %s \n", err))
-	}
-
-	return forceAPI
-}
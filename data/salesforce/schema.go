@@ -0,0 +1,362 @@
+package salesforce
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//SchemaIssue is a field of a DTO that doesn't match the SFDC schema
+type SchemaIssue struct {
+	Object  string `json:"object"`
+	Field   string `json:"field"`
+	GoField string `json:"goField"`
+	Problem string `json:"problem"`
+}
+
+//String describes the issue on a single line
+func (i SchemaIssue) String() string {
+	return fmt.Sprintf("%s.%s (%s): %s", i.Object, i.Field, i.GoField, i.Problem)
+}
+
+//SchemaReport is the result of comparing the force tags of the DTOs with the
+//describe of the SFDC objects they're read from and written to
+type SchemaReport struct {
+	Objects []string      `json:"objects"`
+	Issues  []SchemaIssue `json:"issues"`
+}
+
+//OK reports whether the DTOs match the SFDC schema
+func (r SchemaReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+//String is a drift report listing every issue on its own line
+func (r SchemaReport) String() string {
+	var b bytes.Buffer
+
+	if r.OK() {
+		fmt.Fprintf(&b, "SFDC schema matches the DTOs (%s)", strings.Join(r.Objects, ", "))
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "SFDC schema drift found in %s: %d issue(s)",
+		strings.Join(r.Objects, ", "), len(r.Issues))
+	for _, issue := range r.Issues {
+		b.WriteString("\n  ")
+		b.WriteString(issue.String())
+	}
+
+	return b.String()
+}
+
+//schemaObject describes how an SFDC object is used: the DTO its records are
+//read into, whether the DTO is written on create and update, and the fields
+//of the DTO (by force tag) that are never written. Records are upserted by
+//upsertKey, or by the external id of the sobject when it's empty. lookups
+//are fields that aren't on the DTO but are written with it, ex. the parent
+//record of a new child record.
+type schemaObject struct {
+	sobject    force.SObject
+	dto        interface{}
+	create     bool
+	update     bool
+	upsert     bool
+	upsertKey  string
+	notCreated []string
+	notUpdated []string
+	lookups    []string
+}
+
+//schemaObjects lists the SFDC objects used by the salesforce API. Keep it in
+//step with the way the API writes each object.
+var schemaObjects = []schemaObject{
+	{
+		//accounts are inserted and upserted by Clarify_Site_ID__c
+		sobject:    SFDCAccount{},
+		dto:        services.AccountDTO{},
+		create:     true,
+		update:     true,
+		upsert:     true,
+		notCreated: []string{"Id"},
+		notUpdated: []string{"Id", "Clarify_Site_ID__c"},
+	},
+	{
+		//contacts are inserted with their account (see CreateContact and
+		//CreateAccountWithContacts), updated by Id and bulk upserted by Id.
+		//Their roles are inserted separately.
+		sobject:    SFDCContact{},
+		dto:        services.ContactDTO{},
+		create:     true,
+		update:     true,
+		upsert:     true,
+		upsertKey:  "Id",
+		notCreated: []string{"Id", "Account", "Contact_Roles1__r"},
+		notUpdated: []string{"Id", "Account", "Contact_Roles1__r"},
+		lookups:    []string{"AccountId"},
+	},
+	{
+		//roles are inserted for their contact and otherwise only read
+		sobject: contactRoleSObject,
+		dto:     services.ContactRoleDTO{},
+		create:  true,
+		lookups: []string{"Contact__c"},
+	},
+	{
+		sobject: SFDCClientAsset{},
+		dto:     services.AssetDTO{},
+	},
+}
+
+var customDateType = reflect.TypeOf(services.CustomDate{})
+
+//fieldTypes are the SFDC field types that each kind of Go field can be
+//decoded from and encoded to
+var fieldTypes = map[reflect.Kind][]string{
+	reflect.String: {"string", "textarea", "picklist", "multipicklist", "combobox",
+		"id", "reference", "email", "phone", "url", "encryptedstring"},
+	reflect.Bool:    {"boolean"},
+	reflect.Int:     {"int"},
+	reflect.Float64: {"double", "int", "currency", "percent"},
+}
+
+//VerifySchema describes every SFDC object used by the API and checks that
+//each field referenced by the force tags of its DTO exists, has a type the
+//DTO field can hold, and is createable or updateable where it's written. A
+//typo in a force tag otherwise only surfaces as a query error at runtime, so
+//this is meant to be run at startup (see cmd/sfdcschema). An error is only
+//returned if the schema couldn't be described; drift is reported as issues.
+func (a API) VerifySchema() (SchemaReport, error) {
+	report := SchemaReport{}
+
+	for _, object := range schemaObjects {
+		err := a.verifySObject(&report, object)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func (a API) verifySObject(report *SchemaReport, object schemaObject) error {
+	name := object.sobject.ApiName()
+	description, err := a.describeSchemaObject(report, name)
+	if err != nil {
+		return err
+	}
+
+	dtoType := reflect.TypeOf(object.dto)
+
+	if object.upsert {
+		externalID := object.upsertKey
+		if externalID == "" {
+			externalID = object.sobject.ExternalIdApiName()
+		}
+		f := findSObjectField(description, externalID)
+		if f == nil {
+			report.add(name, externalID, dtoType.Name(), "external id field doesn't exist")
+		} else if !f.ExternalId && !f.IdLookup {
+			report.add(name, externalID, dtoType.Name(), "isn't an external id")
+		}
+	}
+
+	for _, field := range forceFields(dtoType) {
+		goField := dtoType.Name() + "." + field.goName
+		sfdcName := field.sfdcName
+
+		if field.typ.Kind() == reflect.Ptr && field.typ.Elem().Kind() == reflect.Struct {
+			err = a.verifyRelationship(report, description, field, goField)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := findSObjectField(description, sfdcName)
+		if f == nil {
+			report.add(name, sfdcName, goField, "field doesn't exist")
+			continue
+		}
+
+		if problem := fieldTypeProblem(field.typ, f); problem != "" {
+			report.add(name, sfdcName, goField, problem)
+		}
+		if f.DeprecatedAndHidden {
+			report.add(name, sfdcName, goField, "field is deprecated and hidden")
+		}
+		if object.create && !f.Createable && !containsString(object.notCreated, sfdcName) {
+			report.add(name, sfdcName, goField, "field is written on create but isn't createable")
+		}
+		if object.update && !f.Updateable && !containsString(object.notUpdated, sfdcName) {
+			report.add(name, sfdcName, goField, "field is written on update but isn't updateable")
+		}
+	}
+
+	for _, lookup := range object.lookups {
+		f := findSObjectField(description, lookup)
+		switch {
+		case f == nil:
+			report.add(name, lookup, dtoType.Name(), "lookup field doesn't exist")
+		case f.Type != "reference":
+			report.add(name, lookup, dtoType.Name(), fmt.Sprintf("SFDC type %s isn't a lookup", f.Type))
+		case object.create && !f.Createable:
+			report.add(name, lookup, dtoType.Name(), "lookup is written on create but isn't createable")
+		case (object.update || object.upsert) && !f.Updateable:
+			report.add(name, lookup, dtoType.Name(), "lookup is written on update but isn't updateable")
+		}
+	}
+
+	return nil
+}
+
+//verifyRelationship checks a DTO field holding a related record. A parent
+//record must be named by the relationship name of a reference field, and the
+//records of a child relationship are checked against the child object.
+func (a API) verifyRelationship(report *SchemaReport, description *force.SObjectDescription,
+	field forceField, goField string) error {
+	for _, f := range description.Fields {
+		if f.RelationshipName == field.sfdcName && f.Type == "reference" {
+			return nil
+		}
+	}
+
+	for _, child := range description.ChildRelationsips {
+		if child.RelationshipName != field.sfdcName {
+			continue
+		}
+
+		records, ok := relationshipRecordsType(field.typ)
+		if !ok || isSchemaObject(child.ChildSObject) {
+			//objects in schemaObjects are verified on their own
+			return nil
+		}
+
+		//child records are only ever read
+		return a.verifySObject(report, schemaObject{
+			sobject: sobjectName(child.ChildSObject),
+			dto:     reflect.Zero(records).Interface(),
+		})
+	}
+
+	report.add(description.Name, field.sfdcName, goField, "relationship doesn't exist")
+	return nil
+}
+
+//isSchemaObject reports whether an SFDC object is listed in schemaObjects
+func isSchemaObject(name string) bool {
+	for _, object := range schemaObjects {
+		if object.sobject.ApiName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (a API) describeSchemaObject(report *SchemaReport, name string) (*force.SObjectDescription, error) {
+	description, err := a.client.DescribeSFDCObject(sobjectName(name))
+	if err != nil {
+		return nil, fmt.Errorf("Error describing %s: %s", name, err)
+	}
+
+	report.Objects = append(report.Objects, name)
+	return description, nil
+}
+
+func (r *SchemaReport) add(object, field, goField, problem string) {
+	r.Issues = append(r.Issues, SchemaIssue{Object: object, Field: field, GoField: goField, Problem: problem})
+}
+
+//fieldTypeProblem describes why an SFDC field can't be held by a Go field
+//of the given type, or returns an empty string if it can
+func fieldTypeProblem(t reflect.Type, f *force.SObjectField) string {
+	var compatible []string
+
+	if t == customDateType {
+		compatible = []string{"date", "datetime"}
+	} else if types, ok := fieldTypes[t.Kind()]; ok {
+		compatible = types
+	} else {
+		return fmt.Sprintf("Go type %s can't be checked against SFDC type %s", t, f.Type)
+	}
+
+	if !containsString(compatible, f.Type) {
+		return fmt.Sprintf("SFDC type %s can't be held by Go type %s", f.Type, t)
+	}
+	return ""
+}
+
+//forceField is a field of a DTO that's mapped to SFDC by its force tag
+type forceField struct {
+	goName   string
+	sfdcName string
+	typ      reflect.Type
+}
+
+//forceFields returns the fields of a DTO that are mapped to SFDC, including
+//those of embedded structs. Fields tagged force:"-" are skipped.
+func forceFields(t reflect.Type) []forceField {
+	fields := []forceField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, forceFields(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		sfdcName := tagName(f.Tag.Get("force"))
+		if sfdcName == "-" {
+			continue
+		}
+		if sfdcName == "" {
+			sfdcName = f.Name
+		}
+
+		fields = append(fields, forceField{goName: f.Name, sfdcName: sfdcName, typ: f.Type})
+	}
+
+	return fields
+}
+
+//relationshipRecordsType returns the type of the records held by the wrapper
+//of a child relationship, which has a slice of records tagged force:"records"
+func relationshipRecordsType(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for _, field := range forceFields(t) {
+		if field.sfdcName != "records" || field.typ.Kind() != reflect.Slice {
+			continue
+		}
+
+		records := field.typ.Elem()
+		for records.Kind() == reflect.Ptr {
+			records = records.Elem()
+		}
+		return records, records.Kind() == reflect.Struct
+	}
+
+	return nil, false
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
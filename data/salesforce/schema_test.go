@@ -0,0 +1,139 @@
+package salesforce
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/force"
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifySchema(t *testing.T) {
+	Convey("Given the SFDC objects used by the DTOs", t, func() {
+		Convey("When the schema matches the force tags", func() {
+			report, err := api.VerifySchema()
+			Convey("Then no issues should be reported", func() {
+				So(err, ShouldBeNil)
+				So(report.OK(), ShouldBeTrue)
+				So(report.Objects, ShouldResemble,
+					[]string{"Account", "Contact", "Contact_Role__c", "Client_Asset__c"})
+				So(report.String(), ShouldStartWith, "SFDC schema matches the DTOs")
+			})
+		})
+		Convey("When a field referenced by a force tag doesn't exist", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Account" {
+					findSObjectField(description, "Payer__c").Name = "Payer2__c"
+				}
+			}
+			report, err := api.VerifySchema()
+			Convey("Then the missing field should be reported", func() {
+				So(err, ShouldBeNil)
+				So(report.OK(), ShouldBeFalse)
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].String(), ShouldEqual,
+					"Account.Payer__c (AccountDTO.Payer): field doesn't exist")
+			})
+		})
+		Convey("When a field has a type the DTO can't hold", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Client_Asset__c" {
+					findSObjectField(description, "End_Date__c").Type = "string"
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the type mismatch should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].Field, ShouldEqual, "End_Date__c")
+				So(report.Issues[0].Problem, ShouldContainSubstring, "SFDC type string")
+			})
+		})
+		Convey("When a written field isn't updateable", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Contact" {
+					findSObjectField(description, "Email").Updateable = false
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the field should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].GoField, ShouldEqual, "ContactDTO.Email")
+				So(report.String(), ShouldContainSubstring, "isn't updateable")
+			})
+		})
+		Convey("When a child relationship has been renamed", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Contact" {
+					description.ChildRelationsips[0].RelationshipName = "Contact_Roles__r"
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the relationship should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].Field, ShouldEqual, "Contact_Roles1__r")
+			})
+		})
+		Convey("When a written field isn't createable", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Contact" {
+					findSObjectField(description, "LastName").Createable = false
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the field should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].GoField, ShouldEqual, "ContactDTO.LastName")
+				So(report.Issues[0].Problem, ShouldEqual, "field is written on create but isn't createable")
+			})
+		})
+		Convey("When the lookup of an inserted role isn't createable", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Contact_Role__c" {
+					findSObjectField(description, "Contact__c").Createable = false
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the lookup should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].String(), ShouldEqual,
+					"Contact_Role__c.Contact__c (ContactRoleDTO): lookup is written on create but isn't createable")
+			})
+		})
+		Convey("When contacts can't be upserted by Id", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Contact" {
+					findSObjectField(description, "Id").IdLookup = false
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the upsert key should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].Field, ShouldEqual, "Id")
+				So(report.Issues[0].Problem, ShouldEqual, "isn't an external id")
+			})
+		})
+		Convey("When the upsert external id isn't an external id", func() {
+			describeDrift = func(description *force.SObjectDescription) {
+				if description.Name == "Account" {
+					findSObjectField(description, "Clarify_Site_ID__c").ExternalId = false
+				}
+			}
+			report, _ := api.VerifySchema()
+			Convey("Then the external id should be reported", func() {
+				So(len(report.Issues), ShouldEqual, 1)
+				So(report.Issues[0].Problem, ShouldEqual, "isn't an external id")
+			})
+		})
+		Convey("When an object can't be described", func() {
+			getQueryError = func() error { return errors.New("fake error") }
+			_, err := api.VerifySchema()
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			describeDrift = func(description *force.SObjectDescription) {}
+			getQueryError = func() error { return nil }
+		})
+	})
+}
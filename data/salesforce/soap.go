@@ -0,0 +1,113 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const soapInvalidSessionFault = "sf:INVALID_SESSION_ID"
+
+//soapEnvelope is a call of the SOAP partner API, for the operations the REST
+//API doesn't have. The Body is marshalled inside soapenv:Body, so it must not
+//have an XMLName of its own.
+type soapEnvelope struct {
+	XMLName   xml.Name    `xml:"soapenv:Envelope"`
+	SOAPEnv   string      `xml:"xmlns:soapenv,attr"`
+	Partner   string      `xml:"xmlns:urn,attr"`
+	SObject   string      `xml:"xmlns:urn1,attr"`
+	SessionID string      `xml:"soapenv:Header>urn:SessionHeader>urn:sessionId"`
+	Body      interface{} `xml:"soapenv:Body"`
+}
+
+//soapFault is the body of a failed SOAP call
+type soapFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+func (f soapFault) Error() string {
+	return f.Code + ": " + f.String
+}
+
+//soapError is an error of a record in the result of a SOAP call
+type soapError struct {
+	StatusCode string `xml:"statusCode"`
+	Message    string `xml:"message"`
+}
+
+//soapErrorMessage joins the errors of a record's result
+func soapErrorMessage(errors []soapError) string {
+	messages := make([]string, len(errors))
+	for i, e := range errors {
+		messages[i] = e.StatusCode + ": " + e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+//callSOAP sends a call of the SOAP partner API and reads its response into
+//response. The call is sent again after authenticating when the session has
+//expired.
+func (c *restClient) callSOAP(operation string, body interface{}, response interface{}) error {
+	err := c.postSOAP(operation, body, response)
+	if fault, ok := err.(soapFault); ok && fault.Code == soapInvalidSessionFault {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+		err = c.postSOAP(operation, body, response)
+	}
+	return err
+}
+
+func (c *restClient) postSOAP(operation string, body interface{}, response interface{}) error {
+	c.lock.RLock()
+	envelope := soapEnvelope{
+		SOAPEnv:   "http://schemas.xmlsoap.org/soap/envelope/",
+		Partner:   "urn:partner.soap.sforce.com",
+		SObject:   "urn:sobject.partner.soap.sforce.com",
+		SessionID: c.accessToken,
+		Body:      body,
+	}
+	c.lock.RUnlock()
+
+	data, err := xml.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	path := "/services/Soap/u/" + strings.TrimPrefix(c.config.Version, "v")
+	req, err := http.NewRequest("POST", c.url(path, nil), bytes.NewReader(append([]byte(xml.Header), data...)))
+	if err != nil {
+		return fmt.Errorf("Error creating %s request: %s", operation, err)
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=UTF-8")
+	req.Header.Set("SOAPAction", `""`)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error sending %s request: %s", operation, err)
+	}
+	defer resp.Body.Close()
+
+	c.logf("POST %s %s: %s", path, operation, resp.Status)
+	c.observeLimits(resp)
+
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading %s response: %s", operation, err)
+	}
+
+	fault := struct {
+		Fault *soapFault `xml:"Body>Fault"`
+	}{}
+	if err := xml.Unmarshal(data, &fault); err != nil {
+		return fmt.Errorf("%s failed: %s", operation, resp.Status)
+	}
+	if fault.Fault != nil {
+		return *fault.Fault
+	}
+	return xml.Unmarshal(data, response)
+}
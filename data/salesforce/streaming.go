@@ -0,0 +1,610 @@
+package salesforce
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//Replay ids to subscribe from when no event of a channel has been received
+const (
+	//ReplayNew receives the events published after subscribing
+	ReplayNew int64 = -1
+	//ReplayAll receives every event SFDC still keeps (24 hours for
+	//PushTopics, 3 days for Change Data Capture) and the new ones
+	ReplayAll int64 = -2
+)
+
+//Types of changes of a ChangeEvent
+const (
+	ChangeCreated   = "CREATE"
+	ChangeUpdated   = "UPDATE"
+	ChangeDeleted   = "DELETE"
+	ChangeUndeleted = "UNDELETE"
+)
+
+//pushTopicChangeTypes maps the event types of PushTopics to the change types
+//of Change Data Capture
+var pushTopicChangeTypes = map[string]string{
+	"created":   ChangeCreated,
+	"updated":   ChangeUpdated,
+	"deleted":   ChangeDeleted,
+	"undeleted": ChangeUndeleted,
+}
+
+//keyPrefixObjects are the objects whose ids start with a key prefix. They
+//tell which object the record of a PushTopic event is.
+var keyPrefixObjects = map[string]string{
+	"001": "Account",
+	"003": "Contact",
+}
+
+const bayeuxVersion = "1.0"
+
+//Bayeux meta channels
+const (
+	bayeuxHandshake = "/meta/handshake"
+	bayeuxSubscribe = "/meta/subscribe"
+	bayeuxConnect   = "/meta/connect"
+)
+
+//Reconnect advice of the Bayeux server
+const (
+	bayeuxAdviceHandshake = "handshake"
+	bayeuxAdviceNone      = "none"
+)
+
+//streamingPollTimeout is how long a connect request is allowed to take. SFDC
+//holds a long poll for up to 110 seconds when there are no events.
+const streamingPollTimeout = 2 * time.Minute
+
+//DefaultStreamingRetryInterval is how long the streaming client waits
+//before reconnecting after an error
+const DefaultStreamingRetryInterval = 5 * time.Second
+
+var errStreamingStopped = errors.New("The streaming client was stopped")
+
+//ChangeEvent is a change of an account or contact received from a PushTopic
+//or Change Data Capture channel. Account is set for changes of accounts and
+//Contact for changes of contacts; the record of an update only has the
+//fields that changed for Change Data Capture, or the fields of the PushTopic
+//query.
+type ChangeEvent struct {
+	Channel    string
+	ReplayID   int64
+	ChangeType string
+	EntityName string
+	RecordIDs  []string
+	//ChangedFields are the fields an update changed. They're only reported by
+	//Change Data Capture.
+	ChangedFields []string
+	CommitTime    time.Time
+	Account       *services.AccountDTO
+	Contact       *services.ContactDTO
+	//Record is the record as SFDC sent it
+	Record json.RawMessage
+}
+
+//ChangeHandler handles the change events of a channel. Handlers are called
+//one at a time, in the order the events were received, so they should hand
+//slow work off rather than hold up the connection.
+type ChangeHandler func(event *ChangeEvent)
+
+//bayeuxMessage is a message of the Bayeux protocol that CometD implements
+type bayeuxMessage struct {
+	Channel                  string                 `json:"channel"`
+	ID                       string                 `json:"id,omitempty"`
+	ClientID                 string                 `json:"clientId,omitempty"`
+	Version                  string                 `json:"version,omitempty"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string                 `json:"connectionType,omitempty"`
+	Subscription             string                 `json:"subscription,omitempty"`
+	Successful               bool                   `json:"successful,omitempty"`
+	Error                    string                 `json:"error,omitempty"`
+	Advice                   *bayeuxAdvice          `json:"advice,omitempty"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+	Data                     json.RawMessage        `json:"data,omitempty"`
+}
+
+type bayeuxAdvice struct {
+	Reconnect string `json:"reconnect,omitempty"`
+	Interval  int    `json:"interval,omitempty"`
+	Timeout   int    `json:"timeout,omitempty"`
+}
+
+//streamingEventData is the data of an event. PushTopic events have the
+//record in sobject and Change Data Capture events in payload.
+type streamingEventData struct {
+	Event struct {
+		ReplayID    int64  `json:"replayId"`
+		Type        string `json:"type"`
+		CreatedDate string `json:"createdDate"`
+	} `json:"event"`
+	SObject json.RawMessage `json:"sobject"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type changeEventHeader struct {
+	EntityName      string   `json:"entityName"`
+	RecordIDs       []string `json:"recordIds"`
+	ChangeType      string   `json:"changeType"`
+	ChangedFields   []string `json:"changedFields"`
+	CommitTimestamp int64    `json:"commitTimestamp"`
+}
+
+//streamingSubscription is a channel that has been subscribed to, along with
+//the replay id of the last event received from it
+type streamingSubscription struct {
+	replayID   int64
+	handlers   []ChangeHandler
+	subscribed bool
+}
+
+//StreamingClient receives changes of accounts and contacts from the SFDC
+//Streaming API as they happen. It subscribes to PushTopic (ex.
+//"/topic/AccountUpdates") or Change Data Capture (ex.
+//"/data/ContactChangeEvent") channels with CometD, and tracks the replay id
+//of the last event of each channel so that no events are missed when it
+//reconnects.
+type StreamingClient struct {
+	client     *restClient
+	httpClient *http.Client
+	mapping    *FieldMapping
+
+	//RetryInterval is how long to wait before reconnecting after an error
+	RetryInterval time.Duration
+
+	lock          sync.Mutex
+	clientID      string
+	subscriptions map[string]*streamingSubscription
+}
+
+//NewStreamingClient connects to the Streaming API with the settings of the
+//given options, the same as NewAPIWithConfig:
+//
+//	streaming, err := salesforce.NewStreamingClient(salesforce.FromEnv())
+//	streaming.Subscribe("/data/AccountChangeEvent", salesforce.ReplayNew, handler)
+//	err = streaming.Run(stop)
+func NewStreamingClient(options ...Option) (*StreamingClient, error) {
+	config, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newRESTClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	//the session of a CometD client is kept in a cookie, and connect
+	//requests are held open for longer than other requests take
+	httpClient := config.httpClient()
+	if httpClient.Timeout > 0 && httpClient.Timeout < streamingPollTimeout {
+		httpClient.Timeout = streamingPollTimeout
+	}
+	httpClient.Jar, err = cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamingClient{
+		client:        client,
+		httpClient:    httpClient,
+		mapping:       config.FieldMapping,
+		RetryInterval: DefaultStreamingRetryInterval,
+		subscriptions: map[string]*streamingSubscription{},
+	}, nil
+}
+
+//Subscribe registers a handler for the events of a channel. The first
+//subscription to a channel receives the events after replayID, which is
+//ReplayNew, ReplayAll or the replay id of the last event handled by a
+//previous client. Channels subscribed to while the client is running are
+//added when its current poll returns.
+func (s *StreamingClient) Subscribe(channel string, replayID int64, handler ChangeHandler) error {
+	if !strings.HasPrefix(channel, "/topic/") && !strings.HasPrefix(channel, "/data/") {
+		return fmt.Errorf("%s isn't a PushTopic or Change Data Capture channel", channel)
+	}
+	if handler == nil {
+		return errors.New("A handler is required to subscribe to a channel")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription, ok := s.subscriptions[channel]
+	if !ok {
+		subscription = &streamingSubscription{replayID: replayID}
+		s.subscriptions[channel] = subscription
+	}
+	subscription.handlers = append(subscription.handlers, handler)
+	return nil
+}
+
+//ReplayID returns the replay id of the last event handled from a channel.
+//Persist it to resume from there after a restart.
+func (s *StreamingClient) ReplayID(channel string) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if subscription, ok := s.subscriptions[channel]; ok {
+		return subscription.replayID
+	}
+	return ReplayNew
+}
+
+//Run connects to SFDC and delivers events to the handlers until stop is
+//closed. Dropped connections and expired sessions are reconnected, resuming
+//from the last event of each channel. Run only returns an error if SFDC
+//refuses a subscription or tells the client not to reconnect.
+func (s *StreamingClient) Run(stop <-chan struct{}) error {
+	for {
+		err := s.poll(stop)
+		if err == errStreamingStopped {
+			return nil
+		}
+		if fatal, ok := err.(streamingFatalError); ok {
+			return fatal.err
+		}
+		if err == nil {
+			continue
+		}
+
+		s.client.logf("streaming: %s; reconnecting in %s", err, s.RetryInterval)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+//streamingFatalError is an error that the client can't recover from by
+//reconnecting
+type streamingFatalError struct {
+	err error
+}
+
+func (e streamingFatalError) Error() string {
+	return e.err.Error()
+}
+
+//poll handshakes if the client has no CometD session, subscribes to the
+//channels that haven't been subscribed to in the session and waits for
+//events
+func (s *StreamingClient) poll(stop <-chan struct{}) error {
+	s.lock.Lock()
+	clientID := s.clientID
+	s.lock.Unlock()
+
+	if clientID == "" {
+		var err error
+		clientID, err = s.handshake(stop)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.subscribe(clientID, stop); err != nil {
+		return err
+	}
+
+	responses, err := s.send([]bayeuxMessage{{Channel: bayeuxConnect, ClientID: clientID,
+		ConnectionType: "long-polling"}}, stop)
+	if err != nil {
+		return err
+	}
+
+	var connectErr error
+	for _, response := range responses {
+		if response.Channel == bayeuxConnect {
+			if !response.Successful {
+				connectErr = s.metaError("connecting", response)
+			}
+			continue
+		}
+		s.dispatch(response)
+	}
+	return connectErr
+}
+
+//handshake starts a CometD session
+func (s *StreamingClient) handshake(stop <-chan struct{}) (string, error) {
+	responses, err := s.send([]bayeuxMessage{{Channel: bayeuxHandshake, Version: bayeuxVersion,
+		SupportedConnectionTypes: []string{"long-polling"}}}, stop)
+	if err != nil {
+		return "", err
+	}
+
+	for _, response := range responses {
+		if response.Channel != bayeuxHandshake {
+			continue
+		}
+		if !response.Successful {
+			if strings.HasPrefix(response.Error, "401::") {
+				if err := s.client.authenticate(); err != nil {
+					return "", streamingFatalError{err}
+				}
+			}
+			return "", s.metaError("handshaking", response)
+		}
+
+		s.lock.Lock()
+		s.clientID = response.ClientID
+		for _, subscription := range s.subscriptions {
+			subscription.subscribed = false
+		}
+		s.lock.Unlock()
+		return response.ClientID, nil
+	}
+	return "", errors.New("No handshake response was received")
+}
+
+//subscribe subscribes to the channels that haven't been subscribed to in the
+//session, from the replay id of the last event received from them
+func (s *StreamingClient) subscribe(clientID string, stop <-chan struct{}) error {
+	s.lock.Lock()
+	messages := []bayeuxMessage{}
+	for channel, subscription := range s.subscriptions {
+		if subscription.subscribed {
+			continue
+		}
+		messages = append(messages, bayeuxMessage{Channel: bayeuxSubscribe, ClientID: clientID,
+			Subscription: channel, Ext: map[string]interface{}{
+				"replay": map[string]int64{channel: subscription.replayID}}})
+	}
+	s.lock.Unlock()
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	responses, err := s.send(messages, stop)
+	if err != nil {
+		return err
+	}
+
+	for _, response := range responses {
+		if response.Channel != bayeuxSubscribe {
+			continue
+		}
+		if !response.Successful {
+			//only an unknown client is retried; a refused channel won't
+			//be accepted by subscribing again
+			err := s.metaError("subscribing to "+response.Subscription, response)
+			if _, ok := err.(streamingFatalError); !ok && !strings.HasPrefix(response.Error, "403::") {
+				err = streamingFatalError{err}
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		if subscription, ok := s.subscriptions[response.Subscription]; ok {
+			subscription.subscribed = true
+		}
+		s.lock.Unlock()
+		s.client.logf("streaming: subscribed to %s", response.Subscription)
+	}
+	return nil
+}
+
+//metaError is the error of an unsuccessful meta message. The session is
+//dropped if the server advises a new handshake or no longer knows the
+//client.
+func (s *StreamingClient) metaError(action string, response bayeuxMessage) error {
+	err := fmt.Errorf("Error %s: %s", action, response.Error)
+
+	reconnect := ""
+	if response.Advice != nil {
+		reconnect = response.Advice.Reconnect
+	}
+	if reconnect == bayeuxAdviceNone {
+		return streamingFatalError{err}
+	}
+	if reconnect == bayeuxAdviceHandshake || strings.HasPrefix(response.Error, "403::") {
+		s.lock.Lock()
+		s.clientID = ""
+		s.lock.Unlock()
+	}
+	return err
+}
+
+//send posts Bayeux messages to the CometD endpoint of the org. The request
+//is canceled when stop is closed.
+func (s *StreamingClient) send(messages []bayeuxMessage, stop <-chan struct{}) ([]bayeuxMessage, error) {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/cometd/" + strings.TrimPrefix(s.client.config.Version, "v")
+	req, err := http.NewRequest("POST", s.client.url(path, nil), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating streaming request: %s", err)
+	}
+	req.Cancel = stop
+
+	s.client.lock.RLock()
+	req.Header.Set("Authorization", "Bearer "+s.client.accessToken)
+	s.client.lock.RUnlock()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		select {
+		case <-stop:
+			return nil, errStreamingStopped
+		default:
+			return nil, fmt.Errorf("Error sending streaming request: %s", err)
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.lock.Lock()
+		s.clientID = ""
+		s.lock.Unlock()
+		if err := s.client.authenticate(); err != nil {
+			return nil, streamingFatalError{err}
+		}
+		return nil, errors.New("The SFDC session expired")
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Streaming request failed: %s", resp.Status)
+	}
+
+	responses := []bayeuxMessage{}
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal streaming response: %s", err)
+	}
+	return responses, nil
+}
+
+//dispatch passes an event to the handlers of its channel and records its
+//replay id once they've handled it
+func (s *StreamingClient) dispatch(message bayeuxMessage) {
+	s.lock.Lock()
+	subscription, ok := s.subscriptions[message.Channel]
+	var handlers []ChangeHandler
+	if ok {
+		handlers = subscription.handlers
+	}
+	s.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	event, err := s.changeEvent(message)
+	if err != nil {
+		s.client.logf("streaming: Error reading event of %s: %s", message.Channel, err)
+		return
+	}
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+
+	s.lock.Lock()
+	subscription.replayID = event.ReplayID
+	s.lock.Unlock()
+}
+
+//changeEvent reads the event of a PushTopic or Change Data Capture channel
+func (s *StreamingClient) changeEvent(message bayeuxMessage) (*ChangeEvent, error) {
+	data := streamingEventData{}
+	if err := json.Unmarshal(message.Data, &data); err != nil {
+		return nil, err
+	}
+
+	event := &ChangeEvent{Channel: message.Channel, ReplayID: data.Event.ReplayID}
+
+	if len(data.Payload) > 0 {
+		payload := struct {
+			Header changeEventHeader `json:"ChangeEventHeader"`
+		}{}
+		if err := json.Unmarshal(data.Payload, &payload); err != nil {
+			return nil, err
+		}
+		event.ChangeType = payload.Header.ChangeType
+		event.EntityName = payload.Header.EntityName
+		event.RecordIDs = payload.Header.RecordIDs
+		event.ChangedFields = payload.Header.ChangedFields
+		if payload.Header.CommitTimestamp > 0 {
+			event.CommitTime = time.Unix(0, payload.Header.CommitTimestamp*int64(time.Millisecond))
+		}
+		event.Record = data.Payload
+	} else {
+		id := struct {
+			ID string `json:"Id"`
+		}{}
+		if err := json.Unmarshal(data.SObject, &id); err != nil {
+			return nil, err
+		}
+		event.ChangeType = pushTopicChangeTypes[data.Event.Type]
+		if len(id.ID) >= 3 {
+			event.EntityName = keyPrefixObjects[id.ID[:3]]
+			event.RecordIDs = []string{id.ID}
+		}
+		event.CommitTime, _ = time.Parse(sfdcDateTimeFormat, data.Event.CreatedDate)
+		event.Record = data.SObject
+	}
+
+	if s.mapping != nil {
+		event.EntityName = mappedName(s.mapping.logicalObjects, event.EntityName)
+	}
+
+	record, err := s.logicalRecord(event.Record)
+	if err != nil {
+		return nil, err
+	}
+
+	//the ids of Change Data Capture records are only in the header
+	id := ""
+	if len(event.RecordIDs) == 1 {
+		id = event.RecordIDs[0]
+	}
+
+	switch event.EntityName {
+	case "Account":
+		event.Account = &services.AccountDTO{}
+		err = forcejson.Unmarshal(record, event.Account)
+		if event.Account.SalesForceID == "" {
+			event.Account.SalesForceID = id
+		}
+	case "Contact":
+		event.Contact = &services.ContactDTO{}
+		err = forcejson.Unmarshal(record, event.Contact)
+		if event.Contact.SalesForceID == "" {
+			event.Contact.SalesForceID = id
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+//logicalRecord prepares the record of an event to be read into a DTO. The
+//fields of compound fields (ex. the FirstName and LastName of a contact's
+//Name) are moved up to the record, and the field names are mapped back to
+//the logical names.
+func (s *StreamingClient) logicalRecord(record json.RawMessage) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	decoder.UseNumber()
+
+	fields := map[string]interface{}{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "ChangeEventHeader")
+
+	compounds := map[string]map[string]interface{}{}
+	for name, value := range fields {
+		if compound, ok := value.(map[string]interface{}); ok {
+			compounds[name] = compound
+		}
+	}
+	for name, compound := range compounds {
+		delete(fields, name)
+		for field, value := range compound {
+			if _, exists := fields[field]; !exists {
+				fields[field] = value
+			}
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil || s.mapping == nil {
+		return data, err
+	}
+	return renameFields(data, s.mapping.logicalFields)
+}
@@ -0,0 +1,226 @@
+package salesforce
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+//fakeBayeux is a CometD server that publishes the events queued on it. It
+//forgets its clients when unknownClient is set, the way SFDC does when a
+//client has been idle for too long.
+type fakeBayeux struct {
+	server *httptest.Server
+	events chan string
+
+	lock          sync.Mutex
+	handshakes    int
+	subscriptions []map[string]interface{}
+	unknownClient bool
+	refuse        bool
+}
+
+func newFakeBayeux() *fakeBayeux {
+	f := &fakeBayeux{events: make(chan string, 10)}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cometd/32.0" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		messages := []bayeuxMessage{}
+		json.NewDecoder(r.Body).Decode(&messages)
+
+		f.lock.Lock()
+		defer f.lock.Unlock()
+
+		responses := []string{}
+		for _, message := range messages {
+			switch message.Channel {
+			case bayeuxHandshake:
+				f.handshakes++
+				responses = append(responses, fmt.Sprintf(
+					`{"channel":"/meta/handshake","clientId":"client%d","successful":true}`, f.handshakes))
+			case bayeuxSubscribe:
+				f.subscriptions = append(f.subscriptions, message.Ext)
+				if f.refuse {
+					responses = append(responses, fmt.Sprintf(`{"channel":"/meta/subscribe","subscription":"%s",`+
+						`"successful":false,"error":"400::The channel you requested to subscribe to does not exist"}`,
+						message.Subscription))
+					continue
+				}
+				responses = append(responses, fmt.Sprintf(
+					`{"channel":"/meta/subscribe","subscription":"%s","successful":true}`, message.Subscription))
+			case bayeuxConnect:
+				if f.unknownClient {
+					f.unknownClient = false
+					responses = append(responses, `{"channel":"/meta/connect","successful":false,`+
+						`"error":"403::Unknown client","advice":{"reconnect":"handshake"}}`)
+					continue
+				}
+				f.lock.Unlock()
+				select {
+				case event := <-f.events:
+					responses = append(responses, event)
+				case <-time.After(20 * time.Millisecond):
+				}
+				f.lock.Lock()
+				responses = append(responses, `{"channel":"/meta/connect","successful":true}`)
+			}
+		}
+
+		fmt.Fprint(w, "[")
+		for i, response := range responses {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprint(w, response)
+		}
+		fmt.Fprint(w, "]")
+	}))
+	return f
+}
+
+func (f *fakeBayeux) subscribedReplays() []map[string]interface{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.subscriptions
+}
+
+const accountPushTopicEvent = `{"channel":"/topic/AccountUpdates","data":{` +
+	`"event":{"createdDate":"2015-06-01T17:15:20.000+0000","replayId":5,"type":"updated"},` +
+	`"sobject":{"Id":"001d000001TweFSAAZ","Name":"Blackbaud","Site_ID__c":"12345"}}}`
+
+const contactChangeEvent = `{"channel":"/data/ContactChangeEvent","data":{"schema":"abc",` +
+	`"payload":{"ChangeEventHeader":{"entityName":"Contact","recordIds":["003d000001SeyhqAAB"],` +
+	`"changeType":"UPDATE","changedFields":["Name","Email"],"commitTimestamp":1433178920000},` +
+	`"Name":{"FirstName":"Jane","LastName":"Doe"},"Email":"jane@example.com"},` +
+	`"event":{"replayId":7}}}`
+
+func TestStreamingClient(t *testing.T) {
+	Convey("Given a streaming client connected to a CometD server", t, func() {
+		fake := newFakeBayeux()
+		mapping, _ := NewFieldMapping(map[string]string{},
+			map[string]map[string]string{"Account": {"Clarify_Site_ID__c": "Site_ID__c"}})
+		streaming, err := NewStreamingClient(WithVersion("v32.0"), WithAccessToken("token", fake.server.URL))
+		So(err, ShouldBeNil)
+		streaming.mapping = mapping
+		streaming.RetryInterval = time.Millisecond
+
+		events := make(chan *ChangeEvent, 10)
+		handler := func(event *ChangeEvent) { events <- event }
+		stop := make(chan struct{})
+		done := make(chan error, 1)
+		run := func() {
+			go func() { done <- streaming.Run(stop) }()
+		}
+		next := func() *ChangeEvent {
+			select {
+			case event := <-events:
+				return event
+			case <-time.After(2 * time.Second):
+				return nil
+			}
+		}
+
+		Convey("When an account changes on a PushTopic", func() {
+			streaming.Subscribe("/topic/AccountUpdates", ReplayNew, handler)
+			fake.events <- accountPushTopicEvent
+			run()
+			event := next()
+			Convey("Then the handler should receive the account", func() {
+				So(event, ShouldNotBeNil)
+				So(event.ChangeType, ShouldEqual, ChangeUpdated)
+				So(event.EntityName, ShouldEqual, "Account")
+				So(event.RecordIDs, ShouldResemble, []string{"001d000001TweFSAAZ"})
+				So(event.Account.Name, ShouldEqual, "Blackbaud")
+				So(event.Account.SiteID, ShouldEqual, "12345")
+				So(event.ReplayID, ShouldEqual, 5)
+			})
+			Convey("Then it should subscribe from the replay id", func() {
+				replays := fake.subscribedReplays()
+				So(len(replays), ShouldEqual, 1)
+				So(replays[0]["replay"], ShouldResemble, map[string]interface{}{"/topic/AccountUpdates": float64(-1)})
+			})
+		})
+
+		Convey("When a contact changes with Change Data Capture", func() {
+			streaming.Subscribe("/data/ContactChangeEvent", ReplayAll, handler)
+			fake.events <- contactChangeEvent
+			run()
+			event := next()
+			Convey("Then the handler should receive the changed fields of the contact", func() {
+				So(event, ShouldNotBeNil)
+				So(event.ChangeType, ShouldEqual, ChangeUpdated)
+				So(event.ChangedFields, ShouldResemble, []string{"Name", "Email"})
+				So(event.Contact.SalesForceID, ShouldEqual, "003d000001SeyhqAAB")
+				So(event.Contact.FirstName, ShouldEqual, "Jane")
+				So(event.Contact.LastName, ShouldEqual, "Doe")
+				So(event.Contact.Email, ShouldEqual, "jane@example.com")
+				So(event.CommitTime.Unix(), ShouldEqual, 1433178920)
+			})
+		})
+
+		Convey("When the server forgets the client", func() {
+			streaming.Subscribe("/data/ContactChangeEvent", ReplayNew, handler)
+			fake.events <- contactChangeEvent
+			run()
+			next()
+			fake.lock.Lock()
+			fake.unknownClient = true
+			fake.lock.Unlock()
+			fake.events <- contactChangeEvent
+			event := next()
+			Convey("Then it should handshake again and resubscribe from the last event", func() {
+				So(event, ShouldNotBeNil)
+				So(fake.handshakes, ShouldEqual, 2)
+				replays := fake.subscribedReplays()
+				So(len(replays), ShouldEqual, 2)
+				So(replays[1]["replay"], ShouldResemble, map[string]interface{}{"/data/ContactChangeEvent": float64(7)})
+				So(streaming.ReplayID("/data/ContactChangeEvent"), ShouldEqual, 7)
+			})
+		})
+
+		Convey("When the server refuses a subscription", func() {
+			fake.refuse = true
+			streaming.Subscribe("/topic/Missing", ReplayNew, handler)
+			run()
+			Convey("Then Run should return an error", func() {
+				err := <-done
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "does not exist")
+			})
+		})
+
+		Convey("When the client is stopped", func() {
+			streaming.Subscribe("/topic/AccountUpdates", ReplayNew, handler)
+			run()
+			close(stop)
+			Convey("Then Run should return", func() {
+				So(<-done, ShouldBeNil)
+			})
+		})
+
+		Convey("When a channel that isn't a PushTopic or Change Data Capture channel is subscribed to", func() {
+			err := streaming.Subscribe("/meta/connect", ReplayNew, handler)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Reset(func() {
+			select {
+			case <-stop:
+			default:
+				close(stop)
+			}
+			fake.server.Close()
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package salesforce
+
+import "fmt"
+
+//maxUndeleteIDs is the most records SFDC undeletes in one call
+const maxUndeleteIDs = 200
+
+//undeleteBody is an undelete call of the SOAP partner API. The REST API has
+//no undelete.
+type undeleteBody struct {
+	IDs []string `xml:"urn:undelete>urn:ids"`
+}
+
+//undeleteResponse is the response to an undelete call
+type undeleteResponse struct {
+	Results []undeleteResult `xml:"Body>undeleteResponse>result"`
+}
+
+type undeleteResult struct {
+	ID      string      `xml:"id"`
+	Success bool        `xml:"success"`
+	Errors  []soapError `xml:"errors"`
+}
+
+//UndeleteSFDCObjects restores records from the recycle bin with the SOAP
+//API, at most maxUndeleteIDs at a time. The responses are in the order of
+//the ids; records that couldn't be restored have an error message.
+func (c *restClient) UndeleteSFDCObjects(ids []string) ([]SFDCResponse, error) {
+	responses := make([]SFDCResponse, 0, len(ids))
+
+	for start := 0; start < len(ids); start += maxUndeleteIDs {
+		end := start + maxUndeleteIDs
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		response := undeleteResponse{}
+		err := c.callSOAP("undelete", undeleteBody{IDs: ids[start:end]}, &response)
+		if err == nil && len(response.Results) != end-start {
+			err = fmt.Errorf("%d results were returned for %d records", len(response.Results), end-start)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error undeleting records: %s", err)
+		}
+
+		for _, result := range response.Results {
+			responses = append(responses, SFDCResponse{ID: result.ID, Success: result.Success,
+				ErrorMessage: soapErrorMessage(result.Errors)})
+		}
+	}
+
+	return responses, nil
+}
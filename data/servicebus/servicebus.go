@@ -1,6 +1,9 @@
 package servicebus
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/ma314smith/goazure"
 	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/spf13/viper"
 )
@@ -10,19 +13,100 @@ type API struct {
 	Relay goazure.ServiceBusRelay
 }
 
+//Config holds the settings used to call the service bus relay.
+type Config struct {
+	IssuerName string
+	IssuerKey  string
+	Namespace  string
+	Scope      string
+}
+
+//Option sets part of a Config.
+type Option func(*Config) error
+
+//WithCredentials sets the ACS issuer used to get relay tokens.
+func WithCredentials(issuerName, issuerKey string) Option {
+	return func(c *Config) error {
+		c.IssuerName = issuerName
+		c.IssuerKey = issuerKey
+		return nil
+	}
+}
+
+//WithRelay sets the service bus namespace and the scope of the relay.
+func WithRelay(namespace, scope string) Option {
+	return func(c *Config) error {
+		c.Namespace = namespace
+		c.Scope = scope
+		return nil
+	}
+}
+
+//FromEnv reads the settings in the GOAZURE_* environmental variables. Variables
+//that aren't set leave the settings unchanged.
+func FromEnv() Option {
+	return func(c *Config) error {
+		env := viper.New()
+		env.SetEnvPrefix("GOAZURE")
+		env.AutomaticEnv()
+
+		settings := map[string]*string{
+			"ACSISSUERNAME": &c.IssuerName,
+			"ACSISSUERKEY":  &c.IssuerKey,
+			"NAMESPACE":     &c.Namespace,
+			"SCOPE":         &c.Scope,
+		}
+		for key, setting := range settings {
+			if value := env.GetString(key); value != "" {
+				*setting = value
+			}
+		}
+
+		return nil
+	}
+}
+
 //NewAPI returns a valid API struct with a ServiceBusRelay configured from environmental variables.
 func NewAPI() API {
-	env := viper.New()
-	env.SetEnvPrefix("GOAZURE")
-	env.AutomaticEnv()
+	config := Config{}
+	FromEnv()(&config)
+
+	return newAPI(config)
+}
+
+//NewAPIWithConfig returns an API configured by the given options. An error is
+//returned if a setting is missing. goazure sends its requests with
+//http.DefaultClient, so unlike the salesforce API there's no HTTP client option.
+func NewAPIWithConfig(options ...Option) (API, error) {
+	config := Config{}
+	for _, option := range options {
+		if err := option(&config); err != nil {
+			return API{}, fmt.Errorf("Error configuring the service bus API: %s", err)
+		}
+	}
 
-	issuerName := env.GetString("ACSISSUERNAME")
-	issuerKey := env.GetString("ACSISSUERKEY")
-	namespace := env.GetString("NAMESPACE")
-	scope := env.GetString("SCOPE")
+	missing := []string{}
+	required := []struct{ name, value string }{
+		{"issuer name", config.IssuerName},
+		{"issuer key", config.IssuerKey},
+		{"namespace", config.Namespace},
+		{"scope", config.Scope},
+	}
+	for _, setting := range required {
+		if setting.value == "" {
+			missing = append(missing, setting.name)
+		}
+	}
+	if len(missing) > 0 {
+		return API{}, fmt.Errorf("Missing service bus settings: %s", strings.Join(missing, ", "))
+	}
+
+	return newAPI(config), nil
+}
 
-	acs := goazure.ACS{IssuerName: issuerName, IssuerKey: issuerKey}
-	sbr := goazure.ServiceBusRelay{Namespace: namespace, Scope: scope, AccessControl: &acs}
+func newAPI(config Config) API {
+	acs := goazure.ACS{IssuerName: config.IssuerName, IssuerKey: config.IssuerKey}
+	sbr := goazure.ServiceBusRelay{Namespace: config.Namespace, Scope: config.Scope, AccessControl: &acs}
 
 	return API{Relay: sbr}
 }
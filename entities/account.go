@@ -3,12 +3,14 @@
 package entities
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
 )
 
 // Account is a Blackbaud Account entity
 type Account struct {
+	id              string
+	parentID        string
 	name            string
 	siteID          int
 	businessUnit    BusinessUnit
@@ -17,17 +19,53 @@ type Account struct {
 	PrimaryAddress  *Address
 	BillingAddress  *Address
 	ShippingAddress *Address
+	changes         changeTracker
 }
 
 // NewAccount creates a valid Account object (with required fields)
 func NewAccount(name string) (*Account, error) {
 	if name == "" {
-		return nil, errors.New("account name cannot be blank")
+		return nil, newFieldError("name", ErrCodeRequired, "account name cannot be blank")
 	}
 
 	return &Account{name: name}, nil
 }
 
+// ID of the Account
+func (a *Account) ID() string {
+	return a.id
+}
+
+// SetID will update the ID of the account. Can't be the ID of the account's
+// parent.
+func (a *Account) SetID(id string) error {
+	if id != "" && id == a.parentID {
+		return newFieldError("salesForceID", ErrCodeInvalid,
+			"an account can not be its own parent")
+	}
+
+	a.id = id
+	return nil
+}
+
+// ParentID is the ID of the account's parent in an account hierarchy (ex. the
+// district of a school). Empty for top level accounts.
+func (a *Account) ParentID() string {
+	return a.parentID
+}
+
+// SetParentID will update the parent of the account. An empty string makes the
+// account a top level account. Can't be the account's own ID.
+func (a *Account) SetParentID(parentID string) error {
+	if parentID != "" && parentID == a.id {
+		return newFieldError("parentId", ErrCodeInvalid,
+			"an account can not be its own parent")
+	}
+
+	a.parentID = parentID
+	return nil
+}
+
 // Name of the Account
 func (a *Account) Name() string {
 	return a.name
@@ -36,7 +74,7 @@ func (a *Account) Name() string {
 // SetName will update the name of the account. Can't be an empty string.
 func (a *Account) SetName(name string) error {
 	if name == "" {
-		return errors.New("account name cannot be blank")
+		return newFieldError("name", ErrCodeRequired, "account name cannot be blank")
 	}
 
 	a.name = name
@@ -51,7 +89,7 @@ func (a *Account) SiteID() int {
 // SetSiteID will update the site ID of the account. Must be a positive integer.
 func (a *Account) SetSiteID(siteID int) error {
 	if siteID <= 0 {
-		return errors.New("siteID must be greater than 0")
+		return newFieldError("siteId", ErrCodeOutOfRange, "siteID must be greater than 0")
 	}
 
 	a.siteID = siteID
@@ -63,42 +101,80 @@ func (a *Account) BusinessUnit() BusinessUnit {
 	return a.businessUnit
 }
 
-// SetBusinessUnit will update the business unit of the account.
-// Restricted to the enum values of BusinessUnit.
+// SetBusinessUnit will update the business unit of the account. Restricted to
+// the business units in the registry (see SetBusinessUnits); aliases are
+// stored as the business unit they stand for. Deprecated business units are
+// accepted so that existing accounts can be read, but ValidateWrite rejects
+// them.
 func (a *Account) SetBusinessUnit(businessUnit BusinessUnit) error {
-	// ok is true if the business unit is in the map
-	_, ok := businessUnitValues[string(businessUnit)]
+	value, err := ParseBusinessUnit(string(businessUnit))
+	if err != nil {
+		return newFieldError("businessUnit", ErrCodeInvalid,
+			fmt.Sprintf("Invalid business unit: %s.", businessUnit))
+	}
+
+	a.businessUnit = value
+	return nil
+}
 
-	if !ok {
-		return fmt.Errorf("Invalid business unit: %s.", businessUnit)
+// ValidateWrite checks the rules that only apply when an account is saved
+// rather than read: a deprecated business unit can't be given to a new
+// account or set on an existing one.
+func (a *Account) ValidateWrite() error {
+	if a.businessUnit != "" && !a.businessUnit.IsWritable() && a.IsModified("businessUnit") {
+		return newFieldError("businessUnit", ErrCodeInvalid,
+			fmt.Sprintf("Business unit %s is deprecated and can't be assigned.", a.businessUnit))
 	}
 
-	a.businessUnit = businessUnit
 	return nil
 }
 
-// Address block
-type Address struct {
-	Street  string
-	City    string
-	State   string
-	ZipCode string
-	Country string
+// MarkClean records the current values of the account's fields as
+// unmodified. Call it after loading an account from a data store.
+func (a *Account) MarkClean() {
+	a.changes.markClean(a.fieldValues())
 }
 
-// BusinessUnit is used for enumeration of the Account field
-type BusinessUnit string
+// ModifiedFields returns the names of the fields changed since the account was
+// marked clean, using the JSON names of services.AccountDTO (ex. "industry").
+// A cleared field is reported as modified. Until MarkClean is called, every
+// field with a value is reported.
+func (a *Account) ModifiedFields() []string {
+	return a.changes.modified(a.fieldValues())
+}
 
-// BusinessUnit enumeration values
-const (
-	GMBU BusinessUnit = "GMBU"
-	ECBU BusinessUnit = "ECBU"
-	IBU  BusinessUnit = "IBU"
-)
+// IsModified reports whether the given field has changed since the account was
+// marked clean.
+func (a *Account) IsModified(field string) bool {
+	return a.changes.isModified(a.fieldValues(), field)
+}
+
+func (a *Account) fieldValues() map[string]string {
+	values := map[string]string{
+		"name":         a.name,
+		"parentId":     a.parentID,
+		"businessUnit": string(a.businessUnit),
+		"industry":     a.Industry,
+		"payer":        a.Payer,
+		"siteId":       "",
+	}
+
+	if a.siteID > 0 {
+		values["siteId"] = strconv.Itoa(a.siteID)
+	}
+
+	addressValues(values, "primary", a.PrimaryAddress)
+	addressValues(values, "billing", a.BillingAddress)
+	addressValues(values, "shipping", a.ShippingAddress)
 
-// map business unit strings to const. used for setting the business unit
-var businessUnitValues = map[string]BusinessUnit{
-	"GMBU": GMBU,
-	"ECBU": ECBU,
-	"IBU":  IBU,
+	return values
+}
+
+// Address block
+type Address struct {
+	Street  string `json:"street,omitempty"`
+	City    string `json:"city,omitempty"`
+	State   string `json:"state,omitempty"`
+	ZipCode string `json:"zipCode,omitempty"`
+	Country string `json:"country,omitempty"`
 }
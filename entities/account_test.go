@@ -101,3 +101,61 @@ func TestAccountSetBusinessUnit(t *testing.T) {
 		})
 	})
 }
+
+func TestAccountSetParentID(t *testing.T) {
+	Convey("Given an existing account with an ID", t, func() {
+		account, _ := NewAccount("Test School")
+		account.SetID("001d000001SCHOOL")
+		Convey("When the parent is set to another account", func() {
+			err := account.SetParentID("001d000001DISTRT")
+			Convey("Then the parent should be updated", func() {
+				So(err, ShouldBeNil)
+				So(account.ParentID(), ShouldEqual, "001d000001DISTRT")
+			})
+		})
+		Convey("When the parent is set to the account itself", func() {
+			err := account.SetParentID("001d000001SCHOOL")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+				So(account.ParentID(), ShouldBeEmpty)
+			})
+		})
+		Convey("When the parent is cleared", func() {
+			account.SetParentID("001d000001DISTRT")
+			err := account.SetParentID("")
+			Convey("Then the account should be a top level account", func() {
+				So(err, ShouldBeNil)
+				So(account.ParentID(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestAccountModifiedFields(t *testing.T) {
+	Convey("Given a new account", t, func() {
+		account, _ := NewAccount("Test School")
+		account.Industry = "Education"
+		Convey("Then every field with a value should be modified", func() {
+			So(account.ModifiedFields(), ShouldResemble, []string{"industry", "name"})
+		})
+		Convey("When the account is marked clean", func() {
+			account.MarkClean()
+			Convey("Then no fields should be modified", func() {
+				So(account.ModifiedFields(), ShouldBeEmpty)
+			})
+			Convey("Then changed and cleared fields should be modified", func() {
+				account.SetSiteID(5740)
+				account.Industry = ""
+				account.BillingAddress = &Address{City: "Charleston"}
+				So(account.ModifiedFields(), ShouldResemble,
+					[]string{"billingCity", "industry", "siteId"})
+				So(account.IsModified("industry"), ShouldBeTrue)
+				So(account.IsModified("name"), ShouldBeFalse)
+			})
+			Convey("Then setting a field to its current value shouldn't modify it", func() {
+				account.SetName("Test School")
+				So(account.ModifiedFields(), ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,160 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//BusinessUnit is a value of the Account Business_Unit__c picklist
+type BusinessUnit string
+
+//BusinessUnit values registered by default
+const (
+	GMBU BusinessUnit = "GMBU"
+	ECBU BusinessUnit = "ECBU"
+	IBU  BusinessUnit = "IBU"
+)
+
+//BusinessUnitDefinition describes a business unit in the registry. Aliases
+//are other names the business unit may be given as (ex. "K-12" for "K12").
+//Deprecated business units can still be read from existing accounts but
+//can't be assigned to an account.
+type BusinessUnitDefinition struct {
+	Value      BusinessUnit `json:"value"`
+	Label      string       `json:"label,omitempty"`
+	Aliases    []string     `json:"aliases,omitempty"`
+	Deprecated bool         `json:"deprecated,omitempty"`
+}
+
+var defaultBusinessUnits = []BusinessUnitDefinition{
+	{Value: GMBU, Label: "GMBU"},
+	{Value: ECBU, Label: "ECBU"},
+	{Value: IBU, Label: "IBU"},
+}
+
+var (
+	businessUnitsLock sync.RWMutex
+	businessUnits     map[BusinessUnit]BusinessUnitDefinition
+	//upper cased values and aliases mapped to the business unit they name
+	businessUnitNames map[string]BusinessUnit
+)
+
+func init() {
+	if err := SetBusinessUnits(defaultBusinessUnits); err != nil {
+		panic(err)
+	}
+}
+
+//SetBusinessUnits replaces the business unit registry (normally with the
+//Business_Unit__c picklist of the Salesforce org or a configuration file).
+//Values and aliases are matched without regard to case and must not repeat.
+func SetBusinessUnits(definitions []BusinessUnitDefinition) error {
+	if len(definitions) == 0 {
+		return errors.New("at least one business unit must be registered")
+	}
+
+	units := make(map[BusinessUnit]BusinessUnitDefinition, len(definitions))
+	names := map[string]BusinessUnit{}
+
+	for _, definition := range definitions {
+		value := BusinessUnit(strings.TrimSpace(string(definition.Value)))
+		if value == "" {
+			return errors.New("business unit values cannot be blank")
+		}
+		definition.Value = value
+		if definition.Label == "" {
+			definition.Label = string(value)
+		}
+
+		for _, name := range append([]string{string(value)}, definition.Aliases...) {
+			key := strings.ToUpper(strings.TrimSpace(name))
+			if key == "" {
+				return fmt.Errorf("business unit %s has a blank alias", value)
+			}
+			if other, ok := names[key]; ok && other != value {
+				return fmt.Errorf("business unit name %q is used by both %s and %s", name, other, value)
+			}
+			names[key] = value
+		}
+
+		units[value] = definition
+	}
+
+	businessUnitsLock.Lock()
+	businessUnits = units
+	businessUnitNames = names
+	businessUnitsLock.Unlock()
+
+	return nil
+}
+
+//BusinessUnits returns the registered business units, sorted by value.
+func BusinessUnits() []BusinessUnitDefinition {
+	businessUnitsLock.RLock()
+	defer businessUnitsLock.RUnlock()
+
+	definitions := make([]BusinessUnitDefinition, 0, len(businessUnits))
+	for _, definition := range businessUnits {
+		definitions = append(definitions, definition)
+	}
+
+	sort.Sort(businessUnitDefinitions(definitions))
+	return definitions
+}
+
+//ParseBusinessUnit returns the registered business unit with the given value
+//or alias, ignoring case and surrounding whitespace.
+func ParseBusinessUnit(s string) (BusinessUnit, error) {
+	businessUnitsLock.RLock()
+	value, ok := businessUnitNames[strings.ToUpper(strings.TrimSpace(s))]
+	businessUnitsLock.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("%q is not a registered business unit", s)
+	}
+	return value, nil
+}
+
+//IsValid reports whether the business unit is registered, deprecated or not.
+func (b BusinessUnit) IsValid() bool {
+	_, ok := b.definition()
+	return ok
+}
+
+//IsDeprecated reports whether the business unit is registered as deprecated.
+func (b BusinessUnit) IsDeprecated() bool {
+	definition, ok := b.definition()
+	return ok && definition.Deprecated
+}
+
+//IsWritable reports whether the business unit may be assigned to an account.
+func (b BusinessUnit) IsWritable() bool {
+	definition, ok := b.definition()
+	return ok && !definition.Deprecated
+}
+
+//Label returns the display label of the business unit, or the value itself
+//if it isn't registered.
+func (b BusinessUnit) Label() string {
+	if definition, ok := b.definition(); ok {
+		return definition.Label
+	}
+	return string(b)
+}
+
+func (b BusinessUnit) definition() (BusinessUnitDefinition, bool) {
+	businessUnitsLock.RLock()
+	definition, ok := businessUnits[b]
+	businessUnitsLock.RUnlock()
+
+	return definition, ok
+}
+
+type businessUnitDefinitions []BusinessUnitDefinition
+
+func (d businessUnitDefinitions) Len() int           { return len(d) }
+func (d businessUnitDefinitions) Less(i, j int) bool { return d[i].Value < d[j].Value }
+func (d businessUnitDefinitions) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,81 @@
+package entities
+
+import (
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetBusinessUnits(t *testing.T) {
+	Convey("Given a registry loaded with aliases and a deprecated business unit", t, func() {
+		err := SetBusinessUnits([]BusinessUnitDefinition{
+			{Value: GMBU, Label: "General Markets"},
+			{Value: "K12", Label: "K-12", Aliases: []string{"K-12", "ECBU"}},
+			{Value: IBU, Deprecated: true},
+		})
+		So(err, ShouldBeNil)
+		Convey("Then values and aliases should parse without regard to case", func() {
+			bu, err := ParseBusinessUnit("k-12")
+			So(err, ShouldBeNil)
+			So(bu, ShouldEqual, BusinessUnit("K12"))
+			So(bu.Label(), ShouldEqual, "K-12")
+			So(IBU.Label(), ShouldEqual, "IBU")
+		})
+		Convey("Then deprecated business units should be readable but not writable", func() {
+			So(IBU.IsValid(), ShouldBeTrue)
+			So(IBU.IsDeprecated(), ShouldBeTrue)
+			So(IBU.IsWritable(), ShouldBeFalse)
+			So(GMBU.IsWritable(), ShouldBeTrue)
+		})
+		Convey("Then the registered business units should be listed by value", func() {
+			So(len(BusinessUnits()), ShouldEqual, 3)
+			So(BusinessUnits()[0].Value, ShouldEqual, GMBU)
+		})
+		Convey("When an account is given an alias", func() {
+			account, _ := NewAccount("Test School")
+			err := account.SetBusinessUnit("ecbu")
+			Convey("Then the business unit it stands for should be stored", func() {
+				So(err, ShouldBeNil)
+				So(account.BusinessUnit(), ShouldEqual, BusinessUnit("K12"))
+				So(account.ValidateWrite(), ShouldBeNil)
+			})
+		})
+		Convey("When a new account is given a deprecated business unit", func() {
+			account, _ := NewAccount("Test School")
+			err := account.SetBusinessUnit(IBU)
+			Convey("Then it can be read but not written", func() {
+				So(err, ShouldBeNil)
+				So(account.ValidateWrite(), ShouldNotBeNil)
+			})
+		})
+		Convey("When a loaded account already has a deprecated business unit", func() {
+			account, _ := NewAccount("Test School")
+			account.SetBusinessUnit(IBU)
+			account.MarkClean()
+			account.Industry = "Education"
+			Convey("Then it can still be written", func() {
+				So(account.ValidateWrite(), ShouldBeNil)
+			})
+		})
+		Reset(func() {
+			SetBusinessUnits(defaultBusinessUnits)
+		})
+	})
+	Convey("Given business units that share an alias", t, func() {
+		err := SetBusinessUnits([]BusinessUnitDefinition{
+			{Value: GMBU, Aliases: []string{"GM"}},
+			{Value: ECBU, Aliases: []string{"gm"}},
+		})
+		Convey("Then the registry shouldn't be replaced", func() {
+			So(err, ShouldNotBeNil)
+			So(ECBU.IsWritable(), ShouldBeTrue)
+			So(len(BusinessUnits()), ShouldEqual, 3)
+		})
+	})
+	Convey("Given an empty registry", t, func() {
+		err := SetBusinessUnits(nil)
+		Convey("Then an error should occur", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package entities
+
+import "sort"
+
+//changeTracker remembers the values an entity's fields had when it was last
+//marked clean (ex. when it was loaded from a data store) so that the fields
+//modified since then can be found. Fields are named after the JSON names of
+//the data transfer objects (ex. "billingCity").
+type changeTracker struct {
+	original map[string]string
+}
+
+//markClean records the current field values as unmodified.
+func (t *changeTracker) markClean(current map[string]string) {
+	t.original = current
+}
+
+//modified returns the sorted names of the fields whose values differ from the
+//values recorded by markClean. Until the entity is marked clean every field
+//that has a value is considered modified.
+func (t *changeTracker) modified(current map[string]string) []string {
+	fields := []string{}
+
+	for field, value := range current {
+		if t.original == nil && value == "" {
+			continue
+		}
+		if t.original != nil && t.original[field] == value {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+//isModified reports whether a single field differs from its recorded value.
+func (t *changeTracker) isModified(current map[string]string, field string) bool {
+	if t.original == nil {
+		return current[field] != ""
+	}
+	return t.original[field] != current[field]
+}
+
+//phoneNumberValue compares phone numbers by their E.164 form so that
+//reformatting a number isn't reported as a change.
+func phoneNumberValue(p PhoneNumber) string {
+	if !p.IsParsed() {
+		return p.display
+	}
+	if p.extension != "" {
+		return p.e164 + "x" + p.extension
+	}
+	return p.e164
+}
+
+//addressValues adds the fields of an address to values, prefixing their names
+//with prefix (ex. "billing" gives "billingStreet").
+func addressValues(values map[string]string, prefix string, address *Address) {
+	if address == nil {
+		address = &Address{}
+	}
+
+	values[prefix+"Street"] = address.Street
+	values[prefix+"City"] = address.City
+	values[prefix+"State"] = address.State
+	values[prefix+"ZipCode"] = address.ZipCode
+	values[prefix+"Country"] = address.Country
+}
@@ -1,6 +1,9 @@
 package entities
 
-import "errors"
+import (
+	"fmt"
+	"strings"
+)
 
 //Required fields.
 //Name, Account, Contact Currency, maybe record type.
@@ -10,25 +13,26 @@ type Contact struct {
 	id              string
 	Name            *Name
 	email           string
-	Phone           string
-	Fax             string
+	phone           PhoneNumber
+	fax             PhoneNumber
 	Title           string
 	account         *Account
 	defaultAccount  string
 	roles           []*ContactRole
-	status          string
+	status          ContactStatus
 	Currency        CurrencyType
 	bbAuthID        string
 	bbAuthEmail     string
 	bbAuthFirstName string
 	bbAuthLastName  string
+	changes         changeTracker
 }
 
 //ContactRole is a role for a Blackbaud Contact entity.
 type ContactRole struct {
-	RoleName   string
-	RoleType   string
-	RoleStatus string
+	RoleName   string `json:"roleName,omitempty"`
+	RoleType   string `json:"roleType,omitempty"`
+	RoleStatus string `json:"roleStatus,omitempty"`
 }
 
 //Name represents the salutation, first name, and last name of a contact.
@@ -43,7 +47,8 @@ func BuildName(salutation, firstname, lastname string) (*Name, error) {
 	if len(lastname) > 0 {
 		return &Name{Salutation: salutation, FirstName: firstname, lastName: lastname}, nil
 	}
-	return nil, errors.New("A last name is required to build a Name struct.")
+	return nil, newFieldError("lastName", ErrCodeRequired,
+		"A last name is required to build a Name struct.")
 }
 
 //LastName of a Name struct.
@@ -54,36 +59,34 @@ func (n *Name) LastName() string {
 //SetLastName sets the lastName of a Name struct.
 func (n *Name) SetLastName(lastName string) error {
 	if len(lastName) == 0 {
-		return errors.New("Lastname can not be empty.")
+		return newFieldError("lastName", ErrCodeRequired, "Lastname can not be empty.")
 	}
 	n.lastName = lastName
 	return nil
 }
 
-//CurrencyType is an enum for setting a contact's preferred currency.
-type CurrencyType string
-
-//Enumeration for CurrencyType.
-const (
-	USD CurrencyType = "USD - U.S. Dollar"
-	CAD CurrencyType = "CAD - Canadian Dollar"
-	EUR CurrencyType = "EUR - Euro"
-	GBP CurrencyType = "GBP - British Pound"
-	JPY CurrencyType = "JPY - Japanese Yen"
-	AUD CurrencyType = "AUD - Australian Dollar"
-)
-
-//NewContact creates a valid Contact object with required fields.
+//NewContact creates a valid Contact object with required fields. The currency
+//must be an ISO 4217 code. Currencies that aren't enabled for the organization
+//are accepted so that existing contacts can be read, but ValidateWrite rejects
+//them. All invalid fields are reported together in a *ValidationError.
 func NewContact(name *Name, account *Account, currency CurrencyType) (*Contact, error) {
-	if len(name.LastName()) == 0 {
-		return nil, errors.New("Contact's Name must have a lastName")
+	errs := &ValidationError{}
+
+	if name == nil || len(name.LastName()) == 0 {
+		errs.Add("lastName", ErrCodeRequired, "Contact's Name must have a lastName")
 	}
 	if account == nil {
-		return nil, errors.New("Contact must have an account")
+		errs.Add("account", ErrCodeRequired, "Contact must have an account")
 	}
 
 	if currency == "" {
-		return nil, errors.New("Contact must have a currency type")
+		errs.Add("currency", ErrCodeRequired, "Contact must have a currency type")
+	} else {
+		errs.Merge("", validateCurrency(currency))
+	}
+
+	if errs.HasErrors() {
+		return nil, errs
 	}
 
 	return &Contact{Name: name, account: account, Currency: currency}, nil
@@ -99,6 +102,16 @@ func (c *Contact) Email() string {
 	return c.email
 }
 
+//Phone number of the contact.
+func (c *Contact) Phone() PhoneNumber {
+	return c.phone
+}
+
+//Fax number of the contact.
+func (c *Contact) Fax() PhoneNumber {
+	return c.fax
+}
+
 //Account of the contact.
 func (c *Contact) Account() *Account {
 	return c.account
@@ -110,7 +123,7 @@ func (c *Contact) DefaultAccount() string {
 }
 
 //Status of the cotnact.
-func (c *Contact) Status() string {
+func (c *Contact) Status() ContactStatus {
 	return c.status
 }
 
@@ -145,12 +158,87 @@ func (c *Contact) SetID(id string) error {
 	return nil
 }
 
-//SetEmail sets the contact's email.
+//SetEmail sets the contact's email. The email must be a syntactically valid
+//address; an empty string clears it.
 func (c *Contact) SetEmail(email string) error {
-	c.email = email
+	if strings.TrimSpace(email) == "" {
+		c.email = ""
+		return nil
+	}
+
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return newFieldError("email", ErrCodeInvalid, err.Error())
+	}
+
+	c.email = normalized
+	return nil
+}
+
+//SetPhone parses and sets the contact's phone number. Numbers without an
+//international prefix are interpreted using the country of the contact's
+//account address. An empty string clears the phone number.
+func (c *Contact) SetPhone(phone string) error {
+	number, err := c.parsePhoneNumber(phone)
+	if err != nil {
+		return newFieldError("phone", ErrCodeInvalid, err.Error())
+	}
+
+	c.phone = number
 	return nil
 }
 
+//SetFax parses and sets the contact's fax number the same way as SetPhone.
+func (c *Contact) SetFax(fax string) error {
+	number, err := c.parsePhoneNumber(fax)
+	if err != nil {
+		return newFieldError("fax", ErrCodeInvalid, err.Error())
+	}
+
+	c.fax = number
+	return nil
+}
+
+//LoadPhone sets a phone number read from a data store. Stored numbers weren't
+//always validated, so a number that can't be parsed is kept as it was stored
+//instead of failing the load. Use SetPhone for numbers being written.
+func (c *Contact) LoadPhone(phone string) {
+	c.phone = storedPhoneNumber(phone, c.phoneCountry())
+}
+
+//LoadFax sets a fax number read from a data store the same way as LoadPhone.
+func (c *Contact) LoadFax(fax string) {
+	c.fax = storedPhoneNumber(fax, c.phoneCountry())
+}
+
+func (c *Contact) parsePhoneNumber(raw string) (PhoneNumber, error) {
+	if strings.TrimSpace(raw) == "" {
+		return PhoneNumber{}, nil
+	}
+
+	return ParsePhoneNumber(raw, c.phoneCountry())
+}
+
+//phoneCountry infers the country used for national phone numbers from the
+//contact's account, preferring the primary address.
+func (c *Contact) phoneCountry() string {
+	if c.account == nil {
+		return ""
+	}
+
+	for _, address := range []*Address{c.account.PrimaryAddress,
+		c.account.BillingAddress, c.account.ShippingAddress} {
+		if address == nil {
+			continue
+		}
+		if code := CountryCode(address.Country); code != "" {
+			return code
+		}
+	}
+
+	return ""
+}
+
 //SetAccount sets the contact's account.
 func (c *Contact) SetAccount(account *Account) error {
 	c.account = account
@@ -163,9 +251,49 @@ func (c *Contact) SetDefaultAccount(id string) error {
 	return nil
 }
 
-//SetStatus sets the contact's status.
-func (c *Contact) SetStatus(status string) error {
+//SetStatus sets the contact's status without enforcing the allowed
+//transitions. Only known statuses are accepted; use TransitionStatus to change
+//the status of an existing contact.
+func (c *Contact) SetStatus(status ContactStatus) error {
+	if !status.IsValid() {
+		return newFieldError("status", ErrCodeInvalid,
+			fmt.Sprintf("Invalid contact status: %s.", status))
+	}
+
+	c.status = status
+	return nil
+}
+
+//LoadStatus sets a SFDC_Contact_Status__c picklist value read from a data
+//store. A value that isn't a known ContactStatus (ex. one added to the
+//picklist in SFDC) is kept as it is instead of failing the load.
+func (c *Contact) LoadStatus(picklistValue string) {
+	status, err := ParseContactStatus(picklistValue)
+	if err != nil {
+		status = ContactStatus(strings.TrimSpace(picklistValue))
+	}
+
 	c.status = status
+}
+
+//TransitionStatus moves the contact to the next status if the move is allowed
+//from its current status. Moving to the current status does nothing.
+func (c *Contact) TransitionStatus(next ContactStatus) error {
+	if next == c.status {
+		return nil
+	}
+
+	if !next.IsValid() || next == "" {
+		return newFieldError("status", ErrCodeInvalid,
+			fmt.Sprintf("Invalid contact status: %s.", next))
+	}
+
+	if !c.status.CanTransitionTo(next) {
+		return newFieldError("status", ErrCodeInvalid,
+			fmt.Sprintf("A %s contact can not be made %s.", c.status, next))
+	}
+
+	c.status = next
 	return nil
 }
 
@@ -198,3 +326,63 @@ func (c *Contact) SetBBAuthLastName(bbAuthLastName string) error {
 	c.bbAuthLastName = bbAuthLastName
 	return nil
 }
+
+//ValidateWrite checks the rules that only apply when a contact is saved rather
+//than read: a currency that isn't enabled for the organization can't be given
+//to a new contact or set on an existing one.
+func (c *Contact) ValidateWrite() error {
+	if c.Currency != "" && !c.Currency.IsEnabled() && c.IsModified("currency") {
+		return newFieldError("currency", ErrCodeInvalid,
+			fmt.Sprintf("currency %s is not enabled", c.Currency))
+	}
+
+	return nil
+}
+
+//MarkClean records the current values of the contact's fields as unmodified.
+//Call it after loading a contact from a data store.
+func (c *Contact) MarkClean() {
+	c.changes.markClean(c.fieldValues())
+}
+
+//ModifiedFields returns the names of the fields changed since the contact was
+//marked clean, using the JSON names of services.ContactDTO (ex. "firstName").
+//A cleared field is reported as modified. Until MarkClean is called, every
+//field with a value is reported. Changes to the contact's account and roles
+//aren't tracked.
+func (c *Contact) ModifiedFields() []string {
+	return c.changes.modified(c.fieldValues())
+}
+
+//IsModified reports whether the given field has changed since the contact was
+//marked clean.
+func (c *Contact) IsModified(field string) bool {
+	return c.changes.isModified(c.fieldValues(), field)
+}
+
+func (c *Contact) fieldValues() map[string]string {
+	values := map[string]string{
+		"email":           c.email,
+		"phone":           phoneNumberValue(c.phone),
+		"fax":             phoneNumberValue(c.fax),
+		"title":           c.Title,
+		"defaultAccount":  c.defaultAccount,
+		"status":          string(c.status),
+		"currency":        string(c.Currency),
+		"bbAuthId":        c.bbAuthID,
+		"bbAuthEmail":     c.bbAuthEmail,
+		"bbAuthFirstName": c.bbAuthFirstName,
+		"bbAuthLastName":  c.bbAuthLastName,
+		"salutation":      "",
+		"firstName":       "",
+		"lastName":        "",
+	}
+
+	if c.Name != nil {
+		values["salutation"] = c.Name.Salutation
+		values["firstName"] = c.Name.FirstName
+		values["lastName"] = c.Name.LastName()
+	}
+
+	return values
+}
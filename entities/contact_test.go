@@ -10,14 +10,14 @@ var contactEntity = &Contact{
 	id:              "123456test",
 	Name:            &Name{"Mr.", "Erik", "Tate"},
 	email:           "erik.tate@blackbaud.com",
-	Phone:           "(843)654-2566",
-	Fax:             "(843)654-2566",
+	phone:           PhoneNumber{"(843)654-2566", "+18436542566", "", "US"},
+	fax:             PhoneNumber{"(843)654-2566", "+18436542566", "", "US"},
 	Title:           "Application Developer II",
 	account:         &Account{name: "Test Account"},
 	roles:           []*ContactRole{&ContactRole{}},
 	defaultAccount:  "123",
 	status:          "Active",
-	Currency:        "USD - U.S. Dollar",
+	Currency:        USD,
 	bbAuthID:        "123456-1234-1234-1234-12345678",
 	bbAuthEmail:     "erik.tate@blackbaud.com",
 	bbAuthFirstName: "Erik",
@@ -52,6 +52,39 @@ func TestNewContact(t *testing.T) {
 			})
 		})
 	})
+	Convey("Given a currency that isn't an ISO 4217 code", t, func() {
+		account, _ := NewAccount("test")
+		Convey("When a contact creation is attempted", func() {
+			_, err := NewContact(&Name{"", "Erik", "Tate"}, account, "USD - U.S. Dollar")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a currency that isn't enabled", t, func() {
+		account, _ := NewAccount("test")
+		Convey("When a contact is created", func() {
+			contact, err := NewContact(&Name{"", "Erik", "Tate"}, account, CurrencyType("CHF"))
+			Convey("Then it should be built so existing contacts can be read", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("But it should not be written", func() {
+				So(contact.ValidateWrite(), ShouldNotBeNil)
+			})
+			Convey("Unless the currency was loaded that way", func() {
+				contact.MarkClean()
+				So(contact.ValidateWrite(), ShouldBeNil)
+			})
+		})
+		Convey("When an existing contact is given the currency", func() {
+			contact, _ := NewContact(&Name{"", "Erik", "Tate"}, account, USD)
+			contact.MarkClean()
+			contact.Currency = CurrencyType("CHF")
+			Convey("Then it should not be written", func() {
+				So(contact.ValidateWrite(), ShouldNotBeNil)
+			})
+		})
+	})
 	Convey("Given a name, account, and currency type", t, func() {
 		name := &Name{"Mr.", "Erik", "Tate"}
 		account, _ := NewAccount("test")
@@ -151,6 +184,29 @@ func TestContactGettersAndSetters(t *testing.T) {
 				So(contact.Email(), ShouldEqual, email)
 			})
 		})
+		Convey("When attempting to set an invalid email", func() {
+			err := contact.SetEmail("not an email")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When attempting to set a national phone number", func() {
+			err := contact.SetPhone("(843) 654-2566 ext. 12")
+			Convey("Then the phone number should be parsed into E.164 format", func() {
+				So(err, ShouldBeNil)
+				So(contact.Phone().E164(), ShouldEqual, "+18436542566")
+				So(contact.Phone().Extension(), ShouldEqual, "12")
+			})
+			Convey("And the original display format should be kept", func() {
+				So(contact.Phone().String(), ShouldEqual, "(843) 654-2566 ext. 12")
+			})
+		})
+		Convey("When attempting to set an invalid fax number", func() {
+			err := contact.SetFax("555-CALL-NOW")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
 		Convey("When attempting to set their account", func() {
 			account, _ := NewAccount("Super Test Account")
 			contact.SetAccount(account)
@@ -166,7 +222,7 @@ func TestContactGettersAndSetters(t *testing.T) {
 			})
 		})
 		Convey("When attempting to set their status", func() {
-			status := "Inactive"
+			status := ContactStatusInactive
 			contact.SetStatus(status)
 			Convey("Then the contact's status should be changed", func() {
 				So(contact.Status(), ShouldEqual, status)
@@ -210,6 +266,37 @@ func TestContactGettersAndSetters(t *testing.T) {
 	})
 }
 
+func TestContactPhoneCountryInference(t *testing.T) {
+	Convey("Given a contact whose account is in the United Kingdom", t, func() {
+		account, _ := NewAccount("Test Account")
+		account.PrimaryAddress = &Address{City: "London", Country: "United Kingdom"}
+		contact, _ := NewContact(&Name{"", "Erik", "Tate"}, account, USD)
+		Convey("When a national phone number is set", func() {
+			err := contact.SetPhone("020 7946 0958")
+			Convey("Then the number should be interpreted as a UK number", func() {
+				So(err, ShouldBeNil)
+				So(contact.Phone().E164(), ShouldEqual, "+442079460958")
+				So(contact.Phone().Country(), ShouldEqual, "GB")
+			})
+		})
+		Convey("When an international phone number is set", func() {
+			err := contact.SetPhone("+1 843-654-2566")
+			Convey("Then the international country code should be used", func() {
+				So(err, ShouldBeNil)
+				So(contact.Phone().E164(), ShouldEqual, "+18436542566")
+			})
+		})
+		Convey("When an empty phone number is set", func() {
+			contact.SetPhone("+1 843-654-2566")
+			err := contact.SetPhone("")
+			Convey("Then the phone number should be cleared", func() {
+				So(err, ShouldBeNil)
+				So(contact.Phone().IsZero(), ShouldBeTrue)
+			})
+		})
+	})
+}
+
 func TestNameSetLastName(t *testing.T) {
 	Convey("Given a valid name struct", t, func() {
 		name, _ := BuildName("Mr.", "Erik", "Tate")
@@ -258,3 +345,27 @@ func TestBuildName(t *testing.T) {
 		})
 	})
 }
+
+func TestContactModifiedFields(t *testing.T) {
+	Convey("Given a contact that has been marked clean", t, func() {
+		account, _ := NewAccount("Test Account")
+		contact, _ := NewContact(&Name{"Mr.", "Erik", "Tate"}, account, USD)
+		contact.SetPhone("(843) 654-2566")
+		contact.MarkClean()
+		Convey("When the phone number is only reformatted", func() {
+			contact.SetPhone("843.654.2566")
+			Convey("Then the phone number shouldn't be modified", func() {
+				So(contact.ModifiedFields(), ShouldBeEmpty)
+			})
+		})
+		Convey("When the first name and status are changed and the phone number cleared", func() {
+			contact.Name.FirstName = "Rik"
+			contact.SetPhone("")
+			contact.TransitionStatus(ContactStatusActive)
+			Convey("Then those fields should be modified", func() {
+				So(contact.ModifiedFields(), ShouldResemble, []string{"firstName", "phone", "status"})
+				So(contact.IsModified("lastName"), ShouldBeFalse)
+			})
+		})
+	})
+}
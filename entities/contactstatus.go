@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ContactStatus is the lifecycle status of a Contact. The values match the
+//SFDC_Contact_Status__c picklist.
+type ContactStatus string
+
+//ContactStatus enumeration values
+const (
+	ContactStatusPending  ContactStatus = "Pending"
+	ContactStatusActive   ContactStatus = "Active"
+	ContactStatusInactive ContactStatus = "Inactive"
+	ContactStatusMerged   ContactStatus = "Merged"
+)
+
+//contactStatusTransitions lists the statuses a contact may move to from each
+//status. Merged contacts have been folded into another record, so the status
+//is final. A contact without a status, or with a picklist value that isn't
+//listed here, may be given any status.
+var contactStatusTransitions = map[ContactStatus][]ContactStatus{
+	"": {ContactStatusPending, ContactStatusActive, ContactStatusInactive,
+		ContactStatusMerged},
+	ContactStatusPending:  {ContactStatusActive, ContactStatusInactive, ContactStatusMerged},
+	ContactStatusActive:   {ContactStatusInactive, ContactStatusMerged},
+	ContactStatusInactive: {ContactStatusActive, ContactStatusMerged},
+	ContactStatusMerged:   {},
+}
+
+//ParseContactStatus returns the ContactStatus for a SFDC_Contact_Status__c
+//picklist value. Matching ignores case and surrounding whitespace, and an
+//empty value means the contact has no status. Unknown values are an error;
+//Contact.LoadStatus keeps them for contacts read from a data store.
+func ParseContactStatus(picklistValue string) (ContactStatus, error) {
+	value := strings.TrimSpace(picklistValue)
+	if value == "" {
+		return "", nil
+	}
+
+	for status := range contactStatusTransitions {
+		if status != "" && strings.EqualFold(string(status), value) {
+			return status, nil
+		}
+	}
+
+	return "", fmt.Errorf("Invalid contact status: %s.", picklistValue)
+}
+
+//PicklistValue returns the SFDC_Contact_Status__c picklist value of the status.
+func (s ContactStatus) PicklistValue() string {
+	return string(s)
+}
+
+//IsValid reports whether the status is a known ContactStatus. The empty
+//status is valid.
+func (s ContactStatus) IsValid() bool {
+	_, ok := contactStatusTransitions[s]
+	return ok
+}
+
+//CanTransitionTo reports whether a contact with status s may be moved to the
+//next status.
+func (s ContactStatus) CanTransitionTo(next ContactStatus) bool {
+	transitions, ok := contactStatusTransitions[s]
+	if !ok {
+		transitions = contactStatusTransitions[""]
+	}
+
+	for _, allowed := range transitions {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
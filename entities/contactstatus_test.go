@@ -0,0 +1,131 @@
+package entities
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseContactStatus(t *testing.T) {
+	Convey("Given SFDC_Contact_Status__c picklist values", t, func() {
+		cases := map[string]ContactStatus{
+			"Active":    ContactStatusActive,
+			"inactive":  ContactStatusInactive,
+			" Pending ": ContactStatusPending,
+			"MERGED":    ContactStatusMerged,
+			"":          "",
+			"   ":       "",
+		}
+
+		for value, expected := range cases {
+			Convey(fmt.Sprintf("When %q is parsed", value), func() {
+				status, err := ParseContactStatus(value)
+				Convey(fmt.Sprintf("Then %q should be returned", expected), func() {
+					So(err, ShouldBeNil)
+					So(status, ShouldEqual, expected)
+					So(status.PicklistValue(), ShouldEqual, string(expected))
+				})
+			})
+		}
+	})
+	Convey("Given an unknown picklist value", t, func() {
+		Convey("When it is parsed", func() {
+			_, err := ParseContactStatus("Retired")
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestLoadContactStatus(t *testing.T) {
+	Convey("Given a picklist value that isn't a known status", t, func() {
+		contact := &Contact{}
+		Convey("When it is loaded", func() {
+			contact.LoadStatus(" On Leave ")
+			Convey("Then it should be kept as it is", func() {
+				So(contact.Status(), ShouldEqual, ContactStatus("On Leave"))
+				So(contact.Status().IsValid(), ShouldBeFalse)
+			})
+		})
+		Convey("When it is set", func() {
+			err := contact.SetStatus(ContactStatus("On Leave"))
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a known picklist value", t, func() {
+		contact := &Contact{}
+		Convey("When it is loaded", func() {
+			contact.LoadStatus("inactive")
+			Convey("Then the status should be returned", func() {
+				So(contact.Status(), ShouldEqual, ContactStatusInactive)
+			})
+		})
+	})
+}
+
+func TestContactStatusTransitions(t *testing.T) {
+	Convey("Given the contact status transition table", t, func() {
+		cases := []struct {
+			from, to ContactStatus
+			allowed  bool
+		}{
+			{"", ContactStatusActive, true},
+			{ContactStatusPending, ContactStatusActive, true},
+			{ContactStatusPending, ContactStatusInactive, true},
+			{ContactStatusActive, ContactStatusInactive, true},
+			{ContactStatusInactive, ContactStatusActive, true},
+			{ContactStatusActive, ContactStatusMerged, true},
+			{ContactStatusActive, ContactStatusPending, false},
+			{ContactStatusInactive, ContactStatusPending, false},
+			{ContactStatusMerged, ContactStatusActive, false},
+			{ContactStatusMerged, ContactStatusInactive, false},
+			{"On Leave", ContactStatusActive, true},
+			{"On Leave", ContactStatusInactive, true},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey(fmt.Sprintf("When a %q contact is moved to %q", c.from, c.to), func() {
+				contact := &Contact{status: c.from}
+				err := contact.TransitionStatus(c.to)
+				if c.allowed {
+					Convey("Then the status should change", func() {
+						So(err, ShouldBeNil)
+						So(contact.Status(), ShouldEqual, c.to)
+					})
+				} else {
+					Convey("Then an error should occur and the status should not change", func() {
+						So(err, ShouldNotBeNil)
+						So(contact.Status(), ShouldEqual, c.from)
+					})
+				}
+			})
+		}
+	})
+	Convey("Given an active contact", t, func() {
+		contact := &Contact{status: ContactStatusActive}
+		Convey("When it is moved to its current status", func() {
+			err := contact.TransitionStatus(ContactStatusActive)
+			Convey("Then nothing should happen", func() {
+				So(err, ShouldBeNil)
+				So(contact.Status(), ShouldEqual, ContactStatusActive)
+			})
+		})
+		Convey("When it is moved to an unknown status", func() {
+			err := contact.TransitionStatus(ContactStatus("Retired"))
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When its status is set to an unknown status", func() {
+			err := contact.SetStatus(ContactStatus("Retired"))
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
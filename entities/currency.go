@@ -0,0 +1,290 @@
+package entities
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//CurrencyType is an ISO 4217 currency code, as stored in the Salesforce
+//CurrencyIsoCode field (ex. "USD").
+type CurrencyType string
+
+//CurrencyType values enabled by default
+const (
+	USD CurrencyType = "USD"
+	CAD CurrencyType = "CAD"
+	EUR CurrencyType = "EUR"
+	GBP CurrencyType = "GBP"
+	JPY CurrencyType = "JPY"
+	AUD CurrencyType = "AUD"
+)
+
+//ParseCurrency returns the CurrencyType for an ISO code (ex. "usd") or a
+//display label in the "USD - U.S. Dollar" format. Unknown codes are an error.
+func ParseCurrency(s string) (CurrencyType, error) {
+	code := strings.TrimSpace(s)
+	if i := strings.Index(code, " - "); i >= 0 {
+		code = strings.TrimSpace(code[:i])
+	}
+
+	currency := CurrencyType(strings.ToUpper(code))
+	if !currency.IsValid() {
+		return "", fmt.Errorf("%q is not an ISO 4217 currency", s)
+	}
+
+	return currency, nil
+}
+
+//Code returns the ISO 4217 code of the currency.
+func (c CurrencyType) Code() string {
+	return string(c)
+}
+
+//DisplayName returns the English name of the currency (ex. "U.S. Dollar").
+func (c CurrencyType) DisplayName() string {
+	return currencyNames[c]
+}
+
+//Label returns the currency in the "USD - U.S. Dollar" format used by
+//Salesforce picklists.
+func (c CurrencyType) Label() string {
+	if name := c.DisplayName(); name != "" {
+		return string(c) + " - " + name
+	}
+	return string(c)
+}
+
+//IsValid reports whether the currency is a known ISO 4217 code.
+func (c CurrencyType) IsValid() bool {
+	_, ok := currencyNames[c]
+	return ok
+}
+
+//IsEnabled reports whether the currency is enabled for the organization.
+func (c CurrencyType) IsEnabled() bool {
+	enabledCurrenciesLock.RLock()
+	defer enabledCurrenciesLock.RUnlock()
+
+	return enabledCurrencies[c]
+}
+
+//EnabledCurrencies returns the currencies enabled for the organization,
+//sorted by code.
+func EnabledCurrencies() []CurrencyType {
+	enabledCurrenciesLock.RLock()
+	defer enabledCurrenciesLock.RUnlock()
+
+	currencies := make([]CurrencyType, 0, len(enabledCurrencies))
+	for currency := range enabledCurrencies {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Sort(currencyTypes(currencies))
+	return currencies
+}
+
+//SetEnabledCurrencies replaces the currencies enabled for the organization
+//(normally the active currencies of the Salesforce org). Every currency must
+//be a known ISO 4217 code.
+func SetEnabledCurrencies(currencies []CurrencyType) error {
+	enabled := make(map[CurrencyType]bool, len(currencies))
+	for _, currency := range currencies {
+		if !currency.IsValid() {
+			return fmt.Errorf("%q is not an ISO 4217 currency", currency)
+		}
+		enabled[currency] = true
+	}
+
+	if len(enabled) == 0 {
+		return fmt.Errorf("at least one currency must be enabled")
+	}
+
+	enabledCurrenciesLock.Lock()
+	enabledCurrencies = enabled
+	enabledCurrenciesLock.Unlock()
+
+	return nil
+}
+
+//validateCurrency checks that a currency is a known ISO code. Whether it's
+//enabled is only checked when it's written.
+func validateCurrency(currency CurrencyType) error {
+	if !currency.IsValid() {
+		return newFieldError("currency", ErrCodeInvalid,
+			fmt.Sprintf("%q is not an ISO 4217 currency", currency))
+	}
+
+	return nil
+}
+
+type currencyTypes []CurrencyType
+
+func (c currencyTypes) Len() int           { return len(c) }
+func (c currencyTypes) Less(i, j int) bool { return c[i] < c[j] }
+func (c currencyTypes) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+var enabledCurrenciesLock sync.RWMutex
+
+var enabledCurrencies = map[CurrencyType]bool{
+	USD: true, CAD: true, EUR: true, GBP: true, JPY: true, AUD: true,
+}
+
+//active ISO 4217 currency codes and their English names
+var currencyNames = map[CurrencyType]string{
+	"AED": "UAE Dirham",
+	"AFN": "Afghan Afghani",
+	"ALL": "Albanian Lek",
+	"AMD": "Armenian Dram",
+	"ANG": "Netherlands Antillean Guilder",
+	"AOA": "Angolan Kwanza",
+	"ARS": "Argentine Peso",
+	"AUD": "Australian Dollar",
+	"AWG": "Aruban Florin",
+	"AZN": "Azerbaijani Manat",
+	"BAM": "Convertible Mark",
+	"BBD": "Barbados Dollar",
+	"BDT": "Bangladeshi Taka",
+	"BGN": "Bulgarian Lev",
+	"BHD": "Bahraini Dinar",
+	"BIF": "Burundi Franc",
+	"BMD": "Bermuda Dollar",
+	"BND": "Brunei Dollar",
+	"BOB": "Bolivian Boliviano",
+	"BRL": "Brazilian Real",
+	"BSD": "Bahamian Dollar",
+	"BTN": "Bhutanese Ngultrum",
+	"BWP": "Botswana Pula",
+	"BYN": "Belarusian Ruble",
+	"BZD": "Belize Dollar",
+	"CAD": "Canadian Dollar",
+	"CDF": "Congolese Franc",
+	"CHF": "Swiss Franc",
+	"CLP": "Chilean Peso",
+	"CNY": "Chinese Yuan",
+	"COP": "Colombian Peso",
+	"CRC": "Costa Rican Colon",
+	"CUP": "Cuban Peso",
+	"CVE": "Cape Verde Escudo",
+	"CZK": "Czech Koruna",
+	"DJF": "Djibouti Franc",
+	"DKK": "Danish Krone",
+	"DOP": "Dominican Peso",
+	"DZD": "Algerian Dinar",
+	"EGP": "Egyptian Pound",
+	"ERN": "Eritrean Nakfa",
+	"ETB": "Ethiopian Birr",
+	"EUR": "Euro",
+	"FJD": "Fiji Dollar",
+	"FKP": "Falkland Islands Pound",
+	"GBP": "British Pound",
+	"GEL": "Georgian Lari",
+	"GHS": "Ghanaian Cedi",
+	"GIP": "Gibraltar Pound",
+	"GMD": "Gambian Dalasi",
+	"GNF": "Guinean Franc",
+	"GTQ": "Guatemalan Quetzal",
+	"GYD": "Guyana Dollar",
+	"HKD": "Hong Kong Dollar",
+	"HNL": "Honduran Lempira",
+	"HTG": "Haitian Gourde",
+	"HUF": "Hungarian Forint",
+	"IDR": "Indonesian Rupiah",
+	"ILS": "Israeli Shekel",
+	"INR": "Indian Rupee",
+	"IQD": "Iraqi Dinar",
+	"IRR": "Iranian Rial",
+	"ISK": "Iceland Krona",
+	"JMD": "Jamaican Dollar",
+	"JOD": "Jordanian Dinar",
+	"JPY": "Japanese Yen",
+	"KES": "Kenyan Shilling",
+	"KGS": "Kyrgyzstani Som",
+	"KHR": "Cambodian Riel",
+	"KMF": "Comoros Franc",
+	"KPW": "North Korean Won",
+	"KRW": "Korean Won",
+	"KWD": "Kuwaiti Dinar",
+	"KYD": "Cayman Islands Dollar",
+	"KZT": "Kazakhstani Tenge",
+	"LAK": "Lao Kip",
+	"LBP": "Lebanese Pound",
+	"LKR": "Sri Lanka Rupee",
+	"LRD": "Liberian Dollar",
+	"LSL": "Lesotho Loti",
+	"LYD": "Libyan Dinar",
+	"MAD": "Moroccan Dirham",
+	"MDL": "Moldovan Leu",
+	"MGA": "Malagasy Ariary",
+	"MKD": "Macedonian Denar",
+	"MMK": "Myanmar Kyat",
+	"MNT": "Mongolian Tugrik",
+	"MOP": "Macau Pataca",
+	"MRU": "Mauritanian Ouguiya",
+	"MUR": "Mauritius Rupee",
+	"MVR": "Maldives Rufiyaa",
+	"MWK": "Malawi Kwacha",
+	"MXN": "Mexican Peso",
+	"MYR": "Malaysian Ringgit",
+	"MZN": "Mozambique Metical",
+	"NAD": "Namibian Dollar",
+	"NGN": "Nigerian Naira",
+	"NIO": "Nicaraguan Cordoba",
+	"NOK": "Norwegian Krone",
+	"NPR": "Nepalese Rupee",
+	"NZD": "New Zealand Dollar",
+	"OMR": "Omani Rial",
+	"PAB": "Panamanian Balboa",
+	"PEN": "Peruvian Sol",
+	"PGK": "Papua New Guinea Kina",
+	"PHP": "Philippine Peso",
+	"PKR": "Pakistani Rupee",
+	"PLN": "Polish Zloty",
+	"PYG": "Paraguayan Guarani",
+	"QAR": "Qatar Riyal",
+	"RON": "Romanian Leu",
+	"RSD": "Serbian Dinar",
+	"RUB": "Russian Ruble",
+	"RWF": "Rwanda Franc",
+	"SAR": "Saudi Riyal",
+	"SBD": "Solomon Islands Dollar",
+	"SCR": "Seychelles Rupee",
+	"SDG": "Sudanese Pound",
+	"SEK": "Swedish Krona",
+	"SGD": "Singapore Dollar",
+	"SHP": "St Helena Pound",
+	"SLE": "Sierra Leonean Leone",
+	"SOS": "Somali Shilling",
+	"SRD": "Surinamese Dollar",
+	"SSP": "South Sudanese Pound",
+	"STN": "Sao Tome Dobra",
+	"SYP": "Syrian Pound",
+	"SZL": "Swazi Lilangeni",
+	"THB": "Thai Baht",
+	"TJS": "Tajik Somoni",
+	"TMT": "Turkmenistan Manat",
+	"TND": "Tunisian Dinar",
+	"TOP": "Tonga Pa'anga",
+	"TRY": "Turkish Lira",
+	"TTD": "Trinidad and Tobago Dollar",
+	"TWD": "Taiwan Dollar",
+	"TZS": "Tanzanian Shilling",
+	"UAH": "Ukraine Hryvnia",
+	"UGX": "Ugandan Shilling",
+	"USD": "U.S. Dollar",
+	"UYU": "Uruguayan Peso",
+	"UZS": "Uzbekistan Som",
+	"VES": "Venezuelan Bolivar",
+	"VND": "Vietnamese Dong",
+	"VUV": "Vanuatu Vatu",
+	"WST": "Samoan Tala",
+	"XAF": "CFA Franc (BEAC)",
+	"XCD": "East Caribbean Dollar",
+	"XOF": "CFA Franc (BCEAO)",
+	"XPF": "Pacific Franc",
+	"YER": "Yemeni Rial",
+	"ZAR": "South African Rand",
+	"ZMW": "Zambian Kwacha",
+	"ZWL": "Zimbabwe Dollar",
+}
@@ -0,0 +1,82 @@
+package entities
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCurrency(t *testing.T) {
+	Convey("Given ISO codes and display labels", t, func() {
+		cases := map[string]CurrencyType{
+			"USD":                   USD,
+			"usd":                   USD,
+			" CAD ":                 CAD,
+			"USD - U.S. Dollar":     USD,
+			"GBP - British Pound":   GBP,
+			"CHF - Some Other Name": CurrencyType("CHF"),
+		}
+
+		for input, expected := range cases {
+			Convey(fmt.Sprintf("When %q is parsed", input), func() {
+				currency, err := ParseCurrency(input)
+				Convey(fmt.Sprintf("Then %s should be returned", expected), func() {
+					So(err, ShouldBeNil)
+					So(currency, ShouldEqual, expected)
+				})
+			})
+		}
+	})
+	Convey("Given values that aren't ISO 4217 currencies", t, func() {
+		for _, input := range []string{"", "US", "XXXX", "U.S. Dollar", "ABC - Nothing"} {
+			Convey(fmt.Sprintf("When %q is parsed", input), func() {
+				_, err := ParseCurrency(input)
+				Convey("Then an error should occur", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestCurrencyNames(t *testing.T) {
+	Convey("Given the U.S. Dollar currency", t, func() {
+		Convey("Then its display name and label should match Salesforce", func() {
+			So(USD.Code(), ShouldEqual, "USD")
+			So(USD.DisplayName(), ShouldEqual, "U.S. Dollar")
+			So(USD.Label(), ShouldEqual, "USD - U.S. Dollar")
+		})
+	})
+}
+
+func TestSetEnabledCurrencies(t *testing.T) {
+	Convey("Given the default enabled currencies", t, func() {
+		defaults := EnabledCurrencies()
+		Convey("When the enabled currencies are replaced", func() {
+			err := SetEnabledCurrencies([]CurrencyType{USD, "CHF"})
+			Convey("Then only the given currencies should be enabled", func() {
+				So(err, ShouldBeNil)
+				So(EnabledCurrencies(), ShouldResemble, []CurrencyType{"CHF", USD})
+				So(CurrencyType("CHF").IsEnabled(), ShouldBeTrue)
+				So(EUR.IsEnabled(), ShouldBeFalse)
+			})
+		})
+		Convey("When an unknown currency is enabled", func() {
+			err := SetEnabledCurrencies([]CurrencyType{USD, "XXXX"})
+			Convey("Then an error should occur and the currencies should be unchanged", func() {
+				So(err, ShouldNotBeNil)
+				So(EnabledCurrencies(), ShouldResemble, defaults)
+			})
+		})
+		Convey("When no currencies are enabled", func() {
+			err := SetEnabledCurrencies(nil)
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			SetEnabledCurrencies(defaults)
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//FieldChange is a single field that differs between two entities. Field is
+//the path of the field using the JSON names of the data transfer objects
+//(ex. "account.billingCity" or "roles[0].roleName").
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+//Diff lists the fields that differ between two entities, sorted by field.
+type Diff struct {
+	Changes []FieldChange `json:"changes"`
+}
+
+//DiffAccounts compares a stored account with an updated one. A nil account
+//is compared as if every field were empty. The record IDs of the accounts
+//aren't compared.
+func DiffAccounts(old, new *Account) Diff {
+	return newDiff(accountDiffValues(old), accountDiffValues(new))
+}
+
+//DiffContacts compares a stored contact with an updated one, including the
+//contact's name, account and roles. A nil contact is compared as if every
+//field were empty. The record IDs of the contacts aren't compared.
+func DiffContacts(old, new *Contact) Diff {
+	diff := newDiff(contactDiffValues(old), contactDiffValues(new))
+
+	//phone numbers are compared in E.164 form so reformatting isn't a
+	//change, but they're reported as they were entered
+	for i, change := range diff.Changes {
+		switch change.Field {
+		case "phone":
+			diff.Changes[i].Old, diff.Changes[i].New = phoneDisplay(old, (*Contact).Phone),
+				phoneDisplay(new, (*Contact).Phone)
+		case "fax":
+			diff.Changes[i].Old, diff.Changes[i].New = phoneDisplay(old, (*Contact).Fax),
+				phoneDisplay(new, (*Contact).Fax)
+		}
+	}
+
+	return diff
+}
+
+func phoneDisplay(contact *Contact, number func(*Contact) PhoneNumber) string {
+	if contact == nil {
+		return ""
+	}
+	return number(contact).String()
+}
+
+//HasChanges reports whether any fields differ.
+func (d Diff) HasChanges() bool {
+	return len(d.Changes) > 0
+}
+
+//Fields returns the paths of the fields that differ.
+func (d Diff) Fields() []string {
+	fields := make([]string, len(d.Changes))
+	for i, change := range d.Changes {
+		fields[i] = change.Field
+	}
+	return fields
+}
+
+//JSON returns the diff as a JSON document, ex.
+//{"changes":[{"field":"industry","old":"Education","new":"Healthcare"}]}
+func (d Diff) JSON() ([]byte, error) {
+	if d.Changes == nil {
+		d.Changes = []FieldChange{}
+	}
+	return json.Marshal(d)
+}
+
+//String lists the changes on a single line for logging.
+func (d Diff) String() string {
+	if !d.HasChanges() {
+		return "no changes"
+	}
+
+	var b bytes.Buffer
+	for i, change := range d.Changes {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s: %q -> %q", change.Field, change.Old, change.New)
+	}
+
+	return b.String()
+}
+
+func newDiff(old, new map[string]string) Diff {
+	fields := map[string]bool{}
+	for field := range old {
+		fields[field] = true
+	}
+	for field := range new {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if old[field] != new[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	diff := Diff{}
+	for _, field := range names {
+		diff.Changes = append(diff.Changes, FieldChange{Field: field, Old: old[field], New: new[field]})
+	}
+
+	return diff
+}
+
+func accountDiffValues(account *Account) map[string]string {
+	if account == nil {
+		account = &Account{}
+	}
+	return account.fieldValues()
+}
+
+func contactDiffValues(contact *Contact) map[string]string {
+	if contact == nil {
+		contact = &Contact{}
+	}
+
+	values := contact.fieldValues()
+
+	if contact.account != nil {
+		for field, value := range contact.account.fieldValues() {
+			values["account."+field] = value
+		}
+		values["account.salesForceID"] = contact.account.ID()
+	}
+
+	for i, role := range contact.roles {
+		if role == nil {
+			continue
+		}
+		prefix := fmt.Sprintf("roles[%d].", i)
+		values[prefix+"roleType"] = role.RoleType
+		values[prefix+"roleName"] = role.RoleName
+		values[prefix+"roleStatus"] = role.RoleStatus
+	}
+
+	return values
+}
@@ -0,0 +1,82 @@
+package entities
+
+import (
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffAccounts(t *testing.T) {
+	Convey("Given a stored account and an updated copy", t, func() {
+		old, _ := NewAccount("Test School")
+		old.Industry = "Education"
+		old.BillingAddress = &Address{City: "Charleston", State: "SC"}
+		new, _ := NewAccount("Test School")
+		new.Industry = "Healthcare"
+		new.BillingAddress = &Address{City: "Columbia", State: "SC"}
+		new.SetSiteID(5740)
+		Convey("When the accounts are compared", func() {
+			diff := DiffAccounts(old, new)
+			Convey("Then every changed field should be listed with its old and new value", func() {
+				So(diff.Changes, ShouldResemble, []FieldChange{
+					{Field: "billingCity", Old: "Charleston", New: "Columbia"},
+					{Field: "industry", Old: "Education", New: "Healthcare"},
+					{Field: "siteId", Old: "", New: "5740"},
+				})
+			})
+			Convey("Then the diff should be available as JSON", func() {
+				data, err := diff.JSON()
+				So(err, ShouldBeNil)
+				So(string(data), ShouldStartWith,
+					`{"changes":[{"field":"billingCity","old":"Charleston","new":"Columbia"}`)
+			})
+		})
+		Convey("When an account is compared with itself", func() {
+			diff := DiffAccounts(old, old)
+			Convey("Then there should be no changes", func() {
+				So(diff.HasChanges(), ShouldBeFalse)
+				So(diff.String(), ShouldEqual, "no changes")
+				data, _ := diff.JSON()
+				So(string(data), ShouldEqual, `{"changes":[]}`)
+			})
+		})
+	})
+}
+
+func TestDiffContacts(t *testing.T) {
+	Convey("Given a stored contact and an updated copy", t, func() {
+		account, _ := NewAccount("Test Account")
+		old, _ := NewContact(&Name{"Mr.", "Erik", "Tate"}, account, USD)
+		old.SetPhone("(843) 654-2566")
+		old.SetRoles([]*ContactRole{{RoleName: "Admin", RoleStatus: "Active"}})
+
+		newAccount, _ := NewAccount("New Account")
+		new, _ := NewContact(&Name{"Mr.", "Rik", "Tate"}, newAccount, USD)
+		new.SetPhone("843.654.2566")
+		new.SetRoles([]*ContactRole{{RoleName: "Admin", RoleStatus: "Inactive"}})
+		Convey("When the contacts are compared", func() {
+			diff := DiffContacts(old, new)
+			Convey("Then nested name, account and role changes should be listed", func() {
+				So(diff.Fields(), ShouldResemble,
+					[]string{"account.name", "firstName", "roles[0].roleStatus"})
+				So(diff.Changes[1], ShouldResemble, FieldChange{Field: "firstName", Old: "Erik", New: "Rik"})
+				So(diff.String(), ShouldContainSubstring, `roles[0].roleStatus: "Active" -> "Inactive"`)
+			})
+		})
+		Convey("When the phone number is changed", func() {
+			new.SetPhone("843-555-1234")
+			diff := DiffContacts(old, new)
+			Convey("Then the numbers should be reported as they were entered", func() {
+				So(diff.Changes[2], ShouldResemble,
+					FieldChange{Field: "phone", Old: "(843) 654-2566", New: "843-555-1234"})
+			})
+		})
+		Convey("When a contact is compared with nil", func() {
+			diff := DiffContacts(nil, new)
+			Convey("Then every field of the contact should be new", func() {
+				So(diff.Fields(), ShouldContain, "lastName")
+				So(diff.Fields(), ShouldContain, "phone")
+			})
+		})
+	})
+}
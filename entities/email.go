@@ -0,0 +1,284 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//maximum lengths from RFC 5321 section 4.5.3.1
+const (
+	maxEmailLength       = 254
+	maxEmailLocalLength  = 64
+	maxEmailDomainLength = 253
+	maxDomainLabelLength = 63
+)
+
+//characters allowed in an unquoted (dot-atom) local part besides letters and
+//digits. see RFC 5322 section 3.2.3
+const emailAtext = "!#$%&'*+/=?^_`{|}~-"
+
+//NormalizeEmail validates the syntax of an email address and returns it with
+//surrounding whitespace removed and the domain lower cased. Internationalized
+//domain names are accepted and validated in their ASCII (punycode) form, but
+//the returned address keeps the domain as it was entered.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("email cannot be blank")
+	}
+
+	if utf8.RuneCountInString(email) > maxEmailLength {
+		return "", fmt.Errorf("email cannot be longer than %d characters", maxEmailLength)
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return "", fmt.Errorf("email %q is missing an @ sign", email)
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	if err := validateEmailLocalPart(local); err != nil {
+		return "", fmt.Errorf("email %q is invalid: %s", email, err)
+	}
+
+	if _, err := DomainToASCII(domain); err != nil {
+		return "", fmt.Errorf("email %q is invalid: %s", email, err)
+	}
+
+	return local + "@" + domain, nil
+}
+
+//EmailToASCII returns the email address with its domain converted to ASCII
+//(punycode) so that it can be handed to systems that don't support
+//internationalized domain names.
+func EmailToASCII(email string) (string, error) {
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	at := strings.LastIndex(normalized, "@")
+	domain, err := DomainToASCII(normalized[at+1:])
+	if err != nil {
+		return "", err
+	}
+
+	return normalized[:at] + "@" + domain, nil
+}
+
+func validateEmailLocalPart(local string) error {
+	if local == "" {
+		return errors.New("the local part cannot be blank")
+	}
+
+	if len(local) > maxEmailLocalLength {
+		return fmt.Errorf("the local part cannot be longer than %d bytes", maxEmailLocalLength)
+	}
+
+	if local[0] == '.' || local[len(local)-1] == '.' || strings.Contains(local, "..") {
+		return errors.New("the local part cannot start or end with a dot or contain consecutive dots")
+	}
+
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+		case strings.ContainsRune(emailAtext, r):
+		//non-ASCII characters are allowed by RFC 6531 (SMTPUTF8)
+		case r > utf8.RuneSelf && r != utf8.RuneError:
+		default:
+			return fmt.Errorf("the local part contains an invalid character %q", r)
+		}
+	}
+
+	return nil
+}
+
+//DomainToASCII validates a domain name and returns its ASCII form, encoding
+//any internationalized labels with punycode (RFC 3492) and the "xn--" prefix.
+func DomainToASCII(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return "", errors.New("the domain cannot be blank")
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("the domain %q must contain at least two labels", domain)
+	}
+
+	for i, label := range labels {
+		ascii, err := labelToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("the domain %q is invalid: %s", domain, err)
+		}
+		labels[i] = ascii
+	}
+
+	if isNumeric(labels[len(labels)-1]) {
+		return "", fmt.Errorf("the domain %q cannot have a numeric top level domain", domain)
+	}
+
+	ascii := strings.Join(labels, ".")
+	if len(ascii) > maxEmailDomainLength {
+		return "", fmt.Errorf("the domain cannot be longer than %d characters", maxEmailDomainLength)
+	}
+
+	return ascii, nil
+}
+
+func labelToASCII(label string) (string, error) {
+	if label == "" {
+		return "", errors.New("labels cannot be empty")
+	}
+
+	ascii := label
+	if !isASCII(label) {
+		encoded, err := punycodeEncode(label)
+		if err != nil {
+			return "", err
+		}
+		ascii = "xn--" + encoded
+	}
+
+	if len(ascii) > maxDomainLabelLength {
+		return "", fmt.Errorf("label %q is longer than %d characters", label, maxDomainLabelLength)
+	}
+
+	if ascii[0] == '-' || ascii[len(ascii)-1] == '-' {
+		return "", fmt.Errorf("label %q cannot start or end with a hyphen", label)
+	}
+
+	for _, r := range ascii {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return "", fmt.Errorf("label %q contains an invalid character %q", label, r)
+		}
+	}
+
+	return ascii, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+//punycode parameters from RFC 3492 section 5
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+//punycodeEncode implements the encoding procedure of RFC 3492 section 6.3.
+func punycodeEncode(s string) (string, error) {
+	runes := []rune(s)
+	output := make([]byte, 0, len(s)+8)
+
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+
+	for handled < len(runes) {
+		m := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+
+		delta += int(m-n) * (handled + 1)
+		if delta < 0 {
+			return "", errors.New("punycode overflow")
+		}
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyDigit(q))
+
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return string(output), nil
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
@@ -0,0 +1,95 @@
+package entities
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	Convey("Given a valid email address", t, func() {
+		cases := map[string]string{
+			"erik.tate@blackbaud.com":     "erik.tate@blackbaud.com",
+			"  Erik.Tate@BlackBaud.COM  ": "Erik.Tate@blackbaud.com",
+			"first+tag@sub.example.co.uk": "first+tag@sub.example.co.uk",
+			"o'brien@example.org":         "o'brien@example.org",
+			"user@bücher.de":              "user@bücher.de",
+			"josé@example.com":            "josé@example.com",
+			"user@xn--bcher-kva.example":  "user@xn--bcher-kva.example",
+			"user@münchen.example.com":    "user@münchen.example.com",
+			"a@b.co":                      "a@b.co",
+			"user@example.com.":           "user@example.com.",
+		}
+
+		for email, expected := range cases {
+			Convey(fmt.Sprintf("When %q is normalized", email), func() {
+				normalized, err := NormalizeEmail(email)
+				Convey("Then no error should occur", func() {
+					So(err, ShouldBeNil)
+					So(normalized, ShouldEqual, expected)
+				})
+			})
+		}
+	})
+	Convey("Given an invalid email address", t, func() {
+		cases := map[string]string{
+			"(a blank string)":            "",
+			"(a missing @ sign)":          "erik.tateblackbaud.com",
+			"(a missing local part)":      "@blackbaud.com",
+			"(a missing domain)":          "erik.tate@",
+			"(a single label domain)":     "erik.tate@localhost",
+			"(a leading dot)":             ".erik@blackbaud.com",
+			"(consecutive dots)":          "erik..tate@blackbaud.com",
+			"(whitespace)":                "erik tate@blackbaud.com",
+			"(an empty domain label)":     "erik@blackbaud..com",
+			"(a hyphenated label edge)":   "erik@-blackbaud.com",
+			"(an underscore domain)":      "erik@black_baud.com",
+			"(a numeric top level label)": "erik@127.0.0.1",
+		}
+
+		for description, email := range cases {
+			Convey(fmt.Sprintf("When an email with %s is normalized", description), func() {
+				_, err := NormalizeEmail(email)
+				Convey("Then an error should occur", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestDomainToASCII(t *testing.T) {
+	Convey("Given internationalized domain names", t, func() {
+		cases := map[string]string{
+			"bücher.de":         "xn--bcher-kva.de",
+			"MÜNCHEN.de":        "xn--mnchen-3ya.de",
+			"例え.テスト":            "xn--r8jz45g.xn--zckzah",
+			"blackbaud.com":     "blackbaud.com",
+			"straße.example.de": "xn--strae-oqa.example.de",
+		}
+
+		for domain, expected := range cases {
+			Convey(fmt.Sprintf("When %q is converted to ASCII", domain), func() {
+				ascii, err := DomainToASCII(domain)
+				Convey("Then the punycode form should be returned", func() {
+					So(err, ShouldBeNil)
+					So(ascii, ShouldEqual, expected)
+				})
+			})
+		}
+	})
+}
+
+func TestEmailToASCII(t *testing.T) {
+	Convey("Given an email address with an internationalized domain", t, func() {
+		email := "user@Bücher.de"
+		Convey("When it is converted to ASCII", func() {
+			ascii, err := EmailToASCII(email)
+			Convey("Then the domain should be punycode encoded", func() {
+				So(err, ShouldBeNil)
+				So(ascii, ShouldEqual, "user@xn--bcher-kva.de")
+			})
+		})
+	})
+}
@@ -0,0 +1,291 @@
+package entities
+
+import "encoding/json"
+
+//The entities keep their key fields private so that they can only be set
+//through validating setters. The types below mirror those fields for JSON
+//and gob encoding, and decoding goes back through the setters so that a
+//decoded entity is held to the same invariants as one built in code. Every
+//invalid field is reported in a single *ValidationError.
+//
+//Decoded entities haven't been marked clean, so all of their fields are
+//reported by ModifiedFields until MarkClean is called.
+
+type accountJSON struct {
+	ID              string       `json:"id,omitempty"`
+	ParentID        string       `json:"parentId,omitempty"`
+	Name            string       `json:"name"`
+	SiteID          int          `json:"siteId,omitempty"`
+	BusinessUnit    BusinessUnit `json:"businessUnit,omitempty"`
+	Industry        string       `json:"industry,omitempty"`
+	Payer           string       `json:"payer,omitempty"`
+	PrimaryAddress  *Address     `json:"primaryAddress,omitempty"`
+	BillingAddress  *Address     `json:"billingAddress,omitempty"`
+	ShippingAddress *Address     `json:"shippingAddress,omitempty"`
+}
+
+type nameJSON struct {
+	Salutation string `json:"salutation,omitempty"`
+	FirstName  string `json:"firstName,omitempty"`
+	LastName   string `json:"lastName"`
+}
+
+type phoneNumberJSON struct {
+	Number  string `json:"number"`
+	E164    string `json:"e164,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+type contactJSON struct {
+	ID              string         `json:"id,omitempty"`
+	Name            *Name          `json:"name"`
+	Email           string         `json:"email,omitempty"`
+	Phone           *PhoneNumber   `json:"phone,omitempty"`
+	Fax             *PhoneNumber   `json:"fax,omitempty"`
+	Title           string         `json:"title,omitempty"`
+	Account         *Account       `json:"account"`
+	DefaultAccount  string         `json:"defaultAccount,omitempty"`
+	Roles           []*ContactRole `json:"roles,omitempty"`
+	Status          ContactStatus  `json:"status,omitempty"`
+	Currency        CurrencyType   `json:"currency"`
+	BBAuthID        string         `json:"bbAuthId,omitempty"`
+	BBAuthEmail     string         `json:"bbAuthEmail,omitempty"`
+	BBAuthFirstName string         `json:"bbAuthFirstName,omitempty"`
+	BBAuthLastName  string         `json:"bbAuthLastName,omitempty"`
+}
+
+//MarshalJSON encodes every field of the account, including the private ones.
+func (a Account) MarshalJSON() ([]byte, error) {
+	return json.Marshal(accountJSON{
+		ID:              a.id,
+		ParentID:        a.parentID,
+		Name:            a.name,
+		SiteID:          a.siteID,
+		BusinessUnit:    a.businessUnit,
+		Industry:        a.Industry,
+		Payer:           a.Payer,
+		PrimaryAddress:  a.PrimaryAddress,
+		BillingAddress:  a.BillingAddress,
+		ShippingAddress: a.ShippingAddress,
+	})
+}
+
+//UnmarshalJSON decodes an account encoded by MarshalJSON, validating it the
+//same way as NewAccount and the account's setters. The account is left
+//unchanged if validation fails.
+func (a *Account) UnmarshalJSON(data []byte) error {
+	var v accountJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	errs := &ValidationError{}
+
+	account, err := NewAccount(v.Name)
+	if err != nil {
+		errs.Merge("", err)
+		account = &Account{}
+	}
+
+	errs.Merge("", account.SetID(v.ID))
+	errs.Merge("", account.SetParentID(v.ParentID))
+	if v.SiteID != 0 {
+		errs.Merge("", account.SetSiteID(v.SiteID))
+	}
+	if v.BusinessUnit != "" {
+		errs.Merge("", account.SetBusinessUnit(v.BusinessUnit))
+	}
+
+	if errs.HasErrors() {
+		return errs
+	}
+
+	account.Industry = v.Industry
+	account.Payer = v.Payer
+	account.PrimaryAddress = v.PrimaryAddress
+	account.BillingAddress = v.BillingAddress
+	account.ShippingAddress = v.ShippingAddress
+
+	*a = *account
+	return nil
+}
+
+//GobEncode encodes the account for gob using its JSON encoding.
+func (a Account) GobEncode() ([]byte, error) {
+	return a.MarshalJSON()
+}
+
+//GobDecode decodes and validates an account encoded by GobEncode.
+func (a *Account) GobDecode(data []byte) error {
+	return a.UnmarshalJSON(data)
+}
+
+//MarshalJSON encodes the name, including the last name.
+func (n Name) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nameJSON{Salutation: n.Salutation, FirstName: n.FirstName, LastName: n.lastName})
+}
+
+//UnmarshalJSON decodes a name encoded by MarshalJSON. The last name is
+//required, the same as for BuildName.
+func (n *Name) UnmarshalJSON(data []byte) error {
+	var v nameJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	name, err := BuildName(v.Salutation, v.FirstName, v.LastName)
+	if err != nil {
+		return err
+	}
+
+	*n = *name
+	return nil
+}
+
+//MarshalJSON encodes the phone number as it was entered along with its E.164
+//form and the country it was interpreted for.
+func (p PhoneNumber) MarshalJSON() ([]byte, error) {
+	return json.Marshal(phoneNumberJSON{Number: p.display, E164: p.e164, Country: p.country})
+}
+
+//UnmarshalJSON parses the number of a phone number encoded by MarshalJSON
+//again for its country. The E.164 form is recalculated rather than trusted.
+//A number encoded without an E.164 form is kept as it was stored.
+func (p *PhoneNumber) UnmarshalJSON(data []byte) error {
+	var v phoneNumberJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	//a number that was loaded without an E.164 form is decoded the same way
+	if v.E164 == "" {
+		*p = storedPhoneNumber(v.Number, v.Country)
+		return nil
+	}
+
+	number, err := ParsePhoneNumber(v.Number, v.Country)
+	if err != nil {
+		return err
+	}
+
+	*p = number
+	return nil
+}
+
+//MarshalJSON encodes every field of the contact, including its account and
+//the private fields.
+func (c Contact) MarshalJSON() ([]byte, error) {
+	v := contactJSON{
+		ID:              c.id,
+		Name:            c.Name,
+		Email:           c.email,
+		Title:           c.Title,
+		Account:         c.account,
+		DefaultAccount:  c.defaultAccount,
+		Roles:           c.roles,
+		Status:          c.status,
+		Currency:        c.Currency,
+		BBAuthID:        c.bbAuthID,
+		BBAuthEmail:     c.bbAuthEmail,
+		BBAuthFirstName: c.bbAuthFirstName,
+		BBAuthLastName:  c.bbAuthLastName,
+	}
+
+	if !c.phone.IsZero() {
+		v.Phone = &c.phone
+	}
+	if !c.fax.IsZero() {
+		v.Fax = &c.fax
+	}
+
+	return json.Marshal(v)
+}
+
+//UnmarshalJSON decodes a contact encoded by MarshalJSON, validating it the
+//same way as NewContact and the contact's setters. The contact is left
+//unchanged if validation fails.
+func (c *Contact) UnmarshalJSON(data []byte) error {
+	//the name, account and phone numbers validate themselves while being
+	//decoded, so their failures are collected separately
+	errs := &ValidationError{}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var v contactJSON
+	targets := map[string]interface{}{
+		"name":    &v.Name,
+		"account": &v.Account,
+		"phone":   &v.Phone,
+		"fax":     &v.Fax,
+	}
+	for _, field := range []string{"name", "account", "phone", "fax"} {
+		target := targets[field]
+		value, ok := raw[field]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			if _, ok := err.(*ValidationError); !ok {
+				errs.Add(field, ErrCodeInvalid, err.Error())
+			} else if field == "account" {
+				errs.Merge(field, err)
+			} else {
+				errs.Merge("", err)
+			}
+		}
+		delete(raw, field)
+	}
+
+	rest, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(rest, &v); err != nil {
+		return err
+	}
+
+	contact, err := NewContact(v.Name, v.Account, v.Currency)
+	if err != nil {
+		errs.Merge("", err)
+		contact = &Contact{}
+	}
+
+	errs.Merge("", contact.SetEmail(v.Email))
+
+	if errs.HasErrors() {
+		return errs
+	}
+
+	if v.Phone != nil {
+		contact.phone = *v.Phone
+	}
+	if v.Fax != nil {
+		contact.fax = *v.Fax
+	}
+
+	contact.LoadStatus(string(v.Status))
+	contact.id = v.ID
+	contact.Title = v.Title
+	contact.defaultAccount = v.DefaultAccount
+	contact.roles = v.Roles
+	contact.bbAuthID = v.BBAuthID
+	contact.bbAuthEmail = v.BBAuthEmail
+	contact.bbAuthFirstName = v.BBAuthFirstName
+	contact.bbAuthLastName = v.BBAuthLastName
+
+	*c = *contact
+	return nil
+}
+
+//GobEncode encodes the contact for gob using its JSON encoding.
+func (c Contact) GobEncode() ([]byte, error) {
+	return c.MarshalJSON()
+}
+
+//GobDecode decodes and validates a contact encoded by GobEncode.
+func (c *Contact) GobDecode(data []byte) error {
+	return c.UnmarshalJSON(data)
+}
@@ -0,0 +1,133 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestAccountJSON(t *testing.T) {
+	Convey("Given an account with private fields set", t, func() {
+		account, _ := NewAccount("Test School")
+		account.SetID("001d000001SCHOOLAA")
+		account.SetParentID("001d000001DISTRTAA")
+		account.SetSiteID(5740)
+		account.SetBusinessUnit(GMBU)
+		account.Industry = "Education"
+		account.BillingAddress = &Address{City: "Charleston", Country: "USA"}
+		Convey("When the account is encoded and decoded as JSON", func() {
+			data, err := json.Marshal(account)
+			So(err, ShouldBeNil)
+			decoded := &Account{}
+			err = json.Unmarshal(data, decoded)
+			Convey("Then every field should be preserved", func() {
+				So(err, ShouldBeNil)
+				So(decoded.ID(), ShouldEqual, "001d000001SCHOOLAA")
+				So(decoded.ParentID(), ShouldEqual, "001d000001DISTRTAA")
+				So(decoded.Name(), ShouldEqual, "Test School")
+				So(decoded.SiteID(), ShouldEqual, 5740)
+				So(decoded.BusinessUnit(), ShouldEqual, GMBU)
+				So(decoded.BillingAddress, ShouldResemble, account.BillingAddress)
+				So(DiffAccounts(account, decoded).HasChanges(), ShouldBeFalse)
+			})
+		})
+		Convey("When an account value is encoded", func() {
+			data, _ := json.Marshal(*account)
+			Convey("Then the private fields shouldn't be dropped", func() {
+				So(string(data), ShouldContainSubstring, `"siteId":5740`)
+			})
+		})
+	})
+	Convey("Given JSON for an account that breaks its invariants", t, func() {
+		data := []byte(`{"name":"","siteId":-1,"businessUnit":"XBU"}`)
+		Convey("When it is decoded", func() {
+			account := &Account{}
+			err := json.Unmarshal(data, account)
+			Convey("Then every invalid field should be reported", func() {
+				verr, ok := err.(*ValidationError)
+				So(ok, ShouldBeTrue)
+				So(len(verr.Errors), ShouldEqual, 3)
+				So(account.Name(), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestContactJSON(t *testing.T) {
+	Convey("Given a contact with private fields set", t, func() {
+		account, _ := NewAccount("Test Account")
+		account.SetSiteID(5740)
+		contact, _ := NewContact(&Name{"Mr.", "Erik", "Tate"}, account, USD)
+		contact.SetID("003d0000026MOlUAAW")
+		contact.SetEmail("erik.tate@blackbaud.com")
+		contact.SetPhone("(843) 654-2566 x123")
+		contact.SetStatus(ContactStatusActive)
+		contact.SetRoles([]*ContactRole{{RoleName: "Admin"}})
+		contact.SetBBAuthID("32FBC72D-C0FE-4B50-B0F4-EDCEFD7B4DEF")
+		Convey("When the contact is encoded and decoded as JSON", func() {
+			data, err := json.Marshal(contact)
+			So(err, ShouldBeNil)
+			decoded := &Contact{}
+			err = json.Unmarshal(data, decoded)
+			Convey("Then every field should be preserved", func() {
+				So(err, ShouldBeNil)
+				So(decoded.ID(), ShouldEqual, "003d0000026MOlUAAW")
+				So(decoded.Name.LastName(), ShouldEqual, "Tate")
+				So(decoded.Phone().E164(), ShouldEqual, "+18436542566")
+				So(decoded.Phone().Extension(), ShouldEqual, "123")
+				So(decoded.Account().SiteID(), ShouldEqual, 5740)
+				So(DiffContacts(contact, decoded).HasChanges(), ShouldBeFalse)
+			})
+		})
+		Convey("When the contact is encoded and decoded with gob", func() {
+			var buf bytes.Buffer
+			err := gob.NewEncoder(&buf).Encode(contact)
+			So(err, ShouldBeNil)
+			decoded := &Contact{}
+			err = gob.NewDecoder(&buf).Decode(decoded)
+			Convey("Then every field should be preserved", func() {
+				So(err, ShouldBeNil)
+				So(DiffContacts(contact, decoded).HasChanges(), ShouldBeFalse)
+			})
+		})
+	})
+	Convey("Given JSON for a contact that breaks its invariants", t, func() {
+		data := []byte(`{"name":{"firstName":"Erik"},"account":{"name":""},` +
+			`"email":"erik.tate","phone":{"number":"12"},"currency":"XXX","status":"Retired"}`)
+		Convey("When it is decoded", func() {
+			err := json.Unmarshal(data, &Contact{})
+			Convey("Then every invalid field should be reported", func() {
+				verr, ok := err.(*ValidationError)
+				So(ok, ShouldBeTrue)
+				fields := []string{}
+				for _, e := range verr.Errors {
+					fields = append(fields, e.Field)
+				}
+				So(fields, ShouldResemble, []string{"lastName", "account.name",
+					"currency", "email"})
+			})
+		})
+	})
+	Convey("Given a contact loaded with values that are only valid when read", t, func() {
+		account, _ := NewAccount("Test Account")
+		contact, _ := NewContact(&Name{"Mr.", "Erik", "Tate"}, account, CurrencyType("CHF"))
+		contact.LoadPhone("654-2566")
+		contact.LoadStatus("On Leave")
+		Convey("When the contact is encoded and decoded", func() {
+			data, err := json.Marshal(contact)
+			So(err, ShouldBeNil)
+			decoded := &Contact{}
+			err = json.Unmarshal(data, decoded)
+			Convey("Then the phone number should be kept as it was stored", func() {
+				So(err, ShouldBeNil)
+				So(decoded.Phone().String(), ShouldEqual, "654-2566")
+				So(decoded.Phone().IsParsed(), ShouldBeFalse)
+				So(decoded.Currency, ShouldEqual, CurrencyType("CHF"))
+				So(decoded.Status(), ShouldEqual, ContactStatus("On Leave"))
+			})
+		})
+	})
+}
@@ -0,0 +1,291 @@
+package entities
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//E.164 limits the full number (country code included) to 15 digits
+const maxE164Digits = 15
+
+//minE164Digits is the shortest full number accepted, which keeps a short
+//international number of a country without a known calling code from passing
+const minE164Digits = 7
+
+//DefaultPhoneCountry is the ISO 3166 alpha-2 code used to interpret phone
+//numbers without an international prefix when no country can be inferred.
+var DefaultPhoneCountry = "US"
+
+var phoneExtensionRegexp = regexp.MustCompile(`(?i)\s*(?:ext\.?|extension|x|#)\s*(\d{1,7})\s*$`)
+
+//PhoneNumber is a phone number parsed into E.164 format. The number as it
+//was entered is kept for display.
+type PhoneNumber struct {
+	display   string
+	e164      string
+	extension string
+	country   string
+}
+
+//ParsePhoneNumber parses a phone number into E.164 format. Numbers that begin
+//with "+" (or an international dialing prefix of "00" or "011") are treated
+//as international; all others are interpreted as national numbers of the
+//given country, which may be an ISO 3166 code or a country name.
+//International numbers with a calling code that isn't known are accepted as
+//they are, without a country.
+func ParsePhoneNumber(raw, country string) (PhoneNumber, error) {
+	display := strings.TrimSpace(raw)
+	if display == "" {
+		return PhoneNumber{}, errors.New("phone number cannot be blank")
+	}
+
+	number, extension := display, ""
+	if match := phoneExtensionRegexp.FindStringSubmatchIndex(number); match != nil {
+		extension = number[match[2]:match[3]]
+		number = number[:match[0]]
+	}
+
+	digits, international, err := phoneDigits(number)
+	if err != nil {
+		return PhoneNumber{}, fmt.Errorf("phone number %q is invalid: %s", display, err)
+	}
+
+	if !international {
+		switch {
+		case strings.HasPrefix(digits, "011"):
+			digits, international = digits[3:], true
+		case strings.HasPrefix(digits, "00"):
+			digits, international = digits[2:], true
+		}
+	}
+
+	var code, iso string
+	if international {
+		code, iso = callingCodeForNumber(digits)
+		digits = digits[len(code):]
+	} else {
+		iso = CountryCode(country)
+		if iso == "" {
+			iso = DefaultPhoneCountry
+		}
+		code = callingCodes[iso]
+		digits = nationalSignificantNumber(code, digits)
+	}
+
+	if err := validateNationalNumber(code, digits); err != nil {
+		return PhoneNumber{}, fmt.Errorf("phone number %q is invalid: %s", display, err)
+	}
+
+	return PhoneNumber{
+		display:   display,
+		e164:      "+" + code + digits,
+		extension: extension,
+		country:   iso,
+	}, nil
+}
+
+//storedPhoneNumber parses a phone number read from a data store, which may
+//have been saved before numbers were validated. A number that can't be parsed
+//is kept as it was stored, without an E.164 form, rather than rejected.
+func storedPhoneNumber(raw, country string) PhoneNumber {
+	display := strings.TrimSpace(raw)
+	if display == "" {
+		return PhoneNumber{}
+	}
+
+	number, err := ParsePhoneNumber(display, country)
+	if err != nil {
+		return PhoneNumber{display: display}
+	}
+	return number
+}
+
+//String returns the phone number in the format it was originally entered.
+func (p PhoneNumber) String() string {
+	return p.display
+}
+
+//E164 returns the phone number in E.164 format (ex. "+18436542566"),
+//without any extension.
+func (p PhoneNumber) E164() string {
+	return p.e164
+}
+
+//Extension returns the extension of the phone number, if one was entered.
+func (p PhoneNumber) Extension() string {
+	return p.extension
+}
+
+//Country returns the ISO 3166 alpha-2 code of the country the number was
+//interpreted for.
+func (p PhoneNumber) Country() string {
+	return p.country
+}
+
+//IsZero reports whether the phone number is unset.
+func (p PhoneNumber) IsZero() bool {
+	return p.e164 == "" && p.display == ""
+}
+
+//IsParsed reports whether the phone number has an E.164 form. Only numbers
+//loaded from a data store as they were stored don't.
+func (p PhoneNumber) IsParsed() bool {
+	return p.e164 != ""
+}
+
+func phoneDigits(number string) (digits string, international bool, err error) {
+	var b bytes.Buffer
+
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+':
+			if b.Len() > 0 || international {
+				return "", false, errors.New("+ is only allowed at the start")
+			}
+			international = true
+		case strings.ContainsRune(" -.()/", r):
+		default:
+			return "", false, fmt.Errorf("invalid character %q", r)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "", false, errors.New("no digits found")
+	}
+
+	return b.String(), international, nil
+}
+
+//nationalSignificantNumber strips the national trunk prefix from a number
+//dialed within the country.
+func nationalSignificantNumber(code, digits string) string {
+	switch {
+	case code == "1" && len(digits) == 11 && digits[0] == '1':
+		return digits[1:]
+	//Italy keeps its leading zero in international format
+	case code == "39":
+		return digits
+	case code == "7" && strings.HasPrefix(digits, "8") && len(digits) == 11:
+		return digits[1:]
+	case strings.HasPrefix(digits, "0"):
+		return strings.TrimLeft(digits, "0")
+	}
+	return digits
+}
+
+func validateNationalNumber(code, digits string) error {
+	if code == "1" {
+		if len(digits) != 10 {
+			return errors.New("North American numbers must have 10 digits")
+		}
+		if digits[0] < '2' || digits[3] < '2' {
+			return errors.New("North American area codes and exchanges cannot start with 0 or 1")
+		}
+		return nil
+	}
+
+	if len(digits) < 4 || len(code)+len(digits) < minE164Digits {
+		return errors.New("too few digits")
+	}
+
+	if len(code)+len(digits) > maxE164Digits {
+		return fmt.Errorf("E.164 numbers cannot have more than %d digits", maxE164Digits)
+	}
+
+	return nil
+}
+
+//callingCodeForNumber finds the country calling code an international number
+//starts with. Calling codes are prefix free, so at most one can match.
+func callingCodeForNumber(digits string) (code, iso string) {
+	for length := 1; length <= 3 && length <= len(digits); length++ {
+		if iso, ok := callingCodeCountries[digits[:length]]; ok {
+			return digits[:length], iso
+		}
+	}
+	return "", ""
+}
+
+//CountryCode returns the ISO 3166 alpha-2 code for a country given as an
+//alpha-2 code, an alpha-3 code or an English name (case insensitive). An
+//empty string is returned for unknown countries.
+func CountryCode(country string) string {
+	key := strings.ToUpper(strings.TrimSpace(strings.Replace(country, ".", "", -1)))
+	if key == "" {
+		return ""
+	}
+
+	if _, ok := callingCodes[key]; ok {
+		return key
+	}
+
+	return countryAliases[key]
+}
+
+//country calling codes keyed by ISO 3166 alpha-2 code. Countries that aren't
+//listed can still be given numbers in international format.
+var callingCodes = map[string]string{
+	"AE": "971", "AR": "54", "AT": "43", "AU": "61", "BE": "32", "BM": "1",
+	"BR": "55", "BS": "1", "CA": "1", "CH": "41", "CL": "56", "CN": "86",
+	"CO": "57", "CZ": "420", "DE": "49", "DK": "45", "EG": "20", "ES": "34",
+	"FI": "358", "FR": "33", "GB": "44", "GR": "30", "HK": "852", "HU": "36",
+	"ID": "62", "IE": "353", "IL": "972", "IN": "91", "IS": "354", "IT": "39",
+	"JM": "1", "JP": "81", "KE": "254", "KR": "82", "LU": "352", "MX": "52",
+	"MY": "60", "NG": "234", "NL": "31", "NO": "47", "NZ": "64", "PE": "51",
+	"PH": "63", "PK": "92", "PL": "48", "PR": "1", "PT": "351", "RO": "40",
+	"RU": "7", "SA": "966", "SE": "46", "SG": "65", "TH": "66", "TR": "90",
+	"TW": "886", "UA": "380", "US": "1", "VN": "84", "ZA": "27",
+}
+
+//the country reported for international numbers with a shared calling code
+var callingCodeCountries = map[string]string{
+	"1": "US", "7": "RU", "20": "EG", "27": "ZA", "30": "GR", "31": "NL",
+	"32": "BE", "33": "FR", "34": "ES", "36": "HU", "39": "IT", "40": "RO",
+	"41": "CH", "43": "AT", "44": "GB", "45": "DK", "46": "SE", "47": "NO",
+	"48": "PL", "49": "DE", "51": "PE", "52": "MX", "54": "AR", "55": "BR",
+	"56": "CL", "57": "CO", "60": "MY", "61": "AU", "62": "ID", "63": "PH",
+	"64": "NZ", "65": "SG", "66": "TH", "81": "JP", "82": "KR", "84": "VN",
+	"86": "CN", "90": "TR", "91": "IN", "92": "PK", "234": "NG", "254": "KE",
+	"351": "PT", "352": "LU", "353": "IE", "354": "IS", "358": "FI",
+	"380": "UA", "420": "CZ", "852": "HK", "886": "TW", "966": "SA",
+	"971": "AE", "972": "IL",
+}
+
+//alpha-3 codes and English names, upper cased without periods
+var countryAliases = map[string]string{
+	"ARE": "AE", "ARG": "AR", "AUT": "AT", "AUS": "AU", "BEL": "BE", "BMU": "BM",
+	"BRA": "BR", "BHS": "BS", "CAN": "CA", "CHE": "CH", "CHL": "CL", "CHN": "CN",
+	"COL": "CO", "CZE": "CZ", "DEU": "DE", "DNK": "DK", "EGY": "EG", "ESP": "ES",
+	"FIN": "FI", "FRA": "FR", "GBR": "GB", "GRC": "GR", "HKG": "HK", "HUN": "HU",
+	"IDN": "ID", "IRL": "IE", "ISR": "IL", "IND": "IN", "ISL": "IS", "ITA": "IT",
+	"JAM": "JM", "JPN": "JP", "KEN": "KE", "KOR": "KR", "LUX": "LU", "MEX": "MX",
+	"MYS": "MY", "NGA": "NG", "NLD": "NL", "NOR": "NO", "NZL": "NZ", "PER": "PE",
+	"PHL": "PH", "PAK": "PK", "POL": "PL", "PRI": "PR", "PRT": "PT", "ROU": "RO",
+	"RUS": "RU", "SAU": "SA", "SWE": "SE", "SGP": "SG", "THA": "TH", "TUR": "TR",
+	"TWN": "TW", "UKR": "UA", "USA": "US", "VNM": "VN", "ZAF": "ZA",
+
+	"UNITED STATES": "US", "UNITED STATES OF AMERICA": "US", "AMERICA": "US",
+	"UK": "GB", "UNITED KINGDOM": "GB", "GREAT BRITAIN": "GB", "ENGLAND": "GB",
+	"SCOTLAND": "GB", "WALES": "GB", "NORTHERN IRELAND": "GB", "CANADA": "CA",
+	"AUSTRALIA": "AU", "NEW ZEALAND": "NZ", "IRELAND": "IE", "GERMANY": "DE",
+	"FRANCE": "FR", "SPAIN": "ES", "ITALY": "IT", "NETHERLANDS": "NL",
+	"THE NETHERLANDS": "NL", "BELGIUM": "BE", "SWITZERLAND": "CH",
+	"AUSTRIA": "AT", "SWEDEN": "SE", "NORWAY": "NO", "DENMARK": "DK",
+	"FINLAND": "FI", "ICELAND": "IS", "PORTUGAL": "PT", "POLAND": "PL",
+	"MEXICO": "MX", "BRAZIL": "BR", "ARGENTINA": "AR", "CHILE": "CL",
+	"COLOMBIA": "CO", "PERU": "PE", "JAPAN": "JP", "CHINA": "CN",
+	"HONG KONG": "HK", "TAIWAN": "TW", "SOUTH KOREA": "KR", "KOREA": "KR",
+	"INDIA": "IN", "PAKISTAN": "PK", "SINGAPORE": "SG", "MALAYSIA": "MY",
+	"PHILIPPINES": "PH", "THAILAND": "TH", "VIETNAM": "VN", "INDONESIA": "ID",
+	"SOUTH AFRICA": "ZA", "NIGERIA": "NG", "KENYA": "KE", "EGYPT": "EG",
+	"ISRAEL": "IL", "SAUDI ARABIA": "SA", "UNITED ARAB EMIRATES": "AE",
+	"TURKEY": "TR", "RUSSIA": "RU", "UKRAINE": "UA", "GREECE": "GR",
+	"HUNGARY": "HU", "CZECH REPUBLIC": "CZ", "ROMANIA": "RO",
+	"LUXEMBOURG": "LU", "PUERTO RICO": "PR", "JAMAICA": "JM",
+	"BAHAMAS": "BS", "BERMUDA": "BM",
+}
@@ -0,0 +1,116 @@
+package entities
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestParsePhoneNumber(t *testing.T) {
+	Convey("Given valid phone numbers", t, func() {
+		cases := []struct {
+			raw, country, e164, extension string
+		}{
+			{"(843)654-2566", "", "+18436542566", ""},
+			{"843.654.2566", "USA", "+18436542566", ""},
+			{"1-843-654-2566", "US", "+18436542566", ""},
+			{"843-654-2566 x1234", "United States", "+18436542566", "1234"},
+			{"+44 20 7946 0958", "US", "+442079460958", ""},
+			{"011 44 20 7946 0958", "US", "+442079460958", ""},
+			{"0044 20 7946 0958", "", "+442079460958", ""},
+			{"020 7946 0958", "GBR", "+442079460958", ""},
+			{"(02) 9876 5432", "Australia", "+61298765432", ""},
+			{"06 12 34 56 78", "fr", "+33612345678", ""},
+			{"06 1234 5678", "Italy", "+390612345678", ""},
+			{"416-555-0199", "Canada", "+14165550199", ""},
+			{"+353 1 234 5678 ext 9", "", "+35312345678", "9"},
+			{"+212 5 22 12 34 56", "US", "+212522123456", ""},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey(fmt.Sprintf("When %q is parsed for country %q", c.raw, c.country), func() {
+				number, err := ParsePhoneNumber(c.raw, c.country)
+				Convey("Then the E.164 number should be returned", func() {
+					So(err, ShouldBeNil)
+					So(number.E164(), ShouldEqual, c.e164)
+					So(number.Extension(), ShouldEqual, c.extension)
+				})
+				Convey("And the display format should be unchanged", func() {
+					So(number.String(), ShouldEqual, c.raw)
+				})
+			})
+		}
+	})
+	Convey("Given invalid phone numbers", t, func() {
+		cases := map[string]string{
+			"(a blank string)":                 "",
+			"(letters)":                        "1-800-FLOWERS",
+			"(a misplaced plus sign)":          "843+654-2566",
+			"(too few North American digits)":  "654-2566",
+			"(an invalid area code)":           "(143) 654-2566",
+			"(too few digits for any country)": "+999 123",
+			"(too many digits)":                "+44 1234 5678 9012 345",
+			"(too few international digits)":   "+44 12",
+			"(punctuation only)":               "(-)",
+			"(an extension without a number)":  "ext. 12",
+			"(a North American 11 digit form)": "2-843-654-2566",
+		}
+
+		for description, raw := range cases {
+			Convey(fmt.Sprintf("When a phone number with %s is parsed", description), func() {
+				_, err := ParsePhoneNumber(raw, "US")
+				Convey("Then an error should occur", func() {
+					So(err, ShouldNotBeNil)
+				})
+			})
+		}
+	})
+}
+
+func TestStoredPhoneNumber(t *testing.T) {
+	Convey("Given a stored phone number that can't be parsed", t, func() {
+		number := storedPhoneNumber(" 654-2566 ", "US")
+		Convey("Then it should be kept as it was stored", func() {
+			So(number.String(), ShouldEqual, "654-2566")
+			So(number.IsZero(), ShouldBeFalse)
+			So(number.IsParsed(), ShouldBeFalse)
+		})
+	})
+	Convey("Given a stored phone number that can be parsed", t, func() {
+		number := storedPhoneNumber("(843) 654-2566", "US")
+		Convey("Then its E.164 form should be returned", func() {
+			So(number.E164(), ShouldEqual, "+18436542566")
+			So(number.IsParsed(), ShouldBeTrue)
+		})
+	})
+	Convey("Given a blank stored phone number", t, func() {
+		Convey("Then it should be unset", func() {
+			So(storedPhoneNumber(" ", "US").IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestCountryCode(t *testing.T) {
+	Convey("Given country names and codes", t, func() {
+		cases := map[string]string{
+			"US":             "US",
+			"usa":            "US",
+			"U.S.A.":         "US",
+			"United Kingdom": "GB",
+			"SWE":            "SE",
+			" canada ":       "CA",
+			"Atlantis":       "",
+			"":               "",
+		}
+
+		for country, expected := range cases {
+			Convey(fmt.Sprintf("When the code for %q is requested", country), func() {
+				Convey(fmt.Sprintf("Then %q should be returned", expected), func() {
+					So(CountryCode(country), ShouldEqual, expected)
+				})
+			})
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//Validation error codes reported in a FieldError
+const (
+	ErrCodeRequired   = "required"
+	ErrCodeInvalid    = "invalid"
+	ErrCodeOutOfRange = "out_of_range"
+)
+
+//FieldError describes why a single field failed validation. Field is the
+//path of the field (ex. "account.name") using the JSON names of the data
+//transfer objects.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//ValidationError collects every field-level failure found while building or
+//updating an entity so that all of them can be reported at once.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+//newFieldError returns a ValidationError holding a single field failure.
+func newFieldError(field, code, message string) error {
+	v := &ValidationError{}
+	v.Add(field, code, message)
+	return v
+}
+
+//Error lists the field failures in a single string.
+func (v *ValidationError) Error() string {
+	var b bytes.Buffer
+	b.WriteString("validation failed")
+
+	for i, e := range v.Errors {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s: %s", e.Field, e.Message)
+	}
+
+	return b.String()
+}
+
+//Add records a failure for the given field. A failure with the same field
+//and code as one already recorded is ignored.
+func (v *ValidationError) Add(field, code, message string) {
+	for _, e := range v.Errors {
+		if e.Field == field && e.Code == code {
+			return
+		}
+	}
+
+	v.Errors = append(v.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+//Merge adds the failures of err to v, prefixing their field paths with
+//prefix (ex. "account"). An error that isn't a ValidationError is recorded
+//as an invalid value of the prefix field itself. Nil errors are ignored.
+func (v *ValidationError) Merge(prefix string, err error) {
+	if err == nil {
+		return
+	}
+
+	other, ok := err.(*ValidationError)
+	if !ok {
+		v.Add(prefix, ErrCodeInvalid, err.Error())
+		return
+	}
+
+	for _, e := range other.Errors {
+		field := e.Field
+		if prefix != "" && field != "" {
+			field = prefix + "." + field
+		} else if prefix != "" {
+			field = prefix
+		}
+		v.Add(field, e.Code, e.Message)
+	}
+}
+
+//HasErrors reports whether any failures have been recorded.
+func (v *ValidationError) HasErrors() bool {
+	return len(v.Errors) > 0
+}
+
+//ErrorOrNil returns v if any failures have been recorded and nil otherwise,
+//so that an empty ValidationError is never returned as a non-nil error.
+func (v *ValidationError) ErrorOrNil() error {
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package entities
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidationError(t *testing.T) {
+	Convey("Given an empty ValidationError", t, func() {
+		errs := &ValidationError{}
+		Convey("When no failures are added", func() {
+			Convey("Then ErrorOrNil should return nil", func() {
+				So(errs.HasErrors(), ShouldBeFalse)
+				So(errs.ErrorOrNil(), ShouldBeNil)
+			})
+		})
+		Convey("When a failure is added", func() {
+			errs.Add("name", ErrCodeRequired, "account name cannot be blank")
+			Convey("Then ErrorOrNil should return the ValidationError", func() {
+				So(errs.ErrorOrNil(), ShouldEqual, errs)
+			})
+			Convey("And the message should include the field", func() {
+				So(errs.Error(), ShouldEqual, "validation failed: name: account name cannot be blank")
+			})
+		})
+		Convey("When the same failure is added twice", func() {
+			errs.Add("name", ErrCodeRequired, "account name cannot be blank")
+			errs.Add("name", ErrCodeRequired, "a different message")
+			Convey("Then it should only be recorded once", func() {
+				So(len(errs.Errors), ShouldEqual, 1)
+			})
+		})
+		Convey("When another ValidationError is merged with a prefix", func() {
+			other := &ValidationError{}
+			other.Add("name", ErrCodeRequired, "account name cannot be blank")
+			other.Add("siteId", ErrCodeOutOfRange, "siteID must be greater than 0")
+			errs.Merge("account", other)
+			Convey("Then the field paths should be prefixed", func() {
+				So(errs.Errors[0].Field, ShouldEqual, "account.name")
+				So(errs.Errors[1].Field, ShouldEqual, "account.siteId")
+				So(errs.Errors[1].Code, ShouldEqual, ErrCodeOutOfRange)
+			})
+		})
+		Convey("When a plain error is merged", func() {
+			errs.Merge("email", errors.New("bad email"))
+			Convey("Then it should be recorded as an invalid value of the prefix field", func() {
+				So(errs.Errors[0], ShouldResemble, FieldError{"email", ErrCodeInvalid, "bad email"})
+			})
+		})
+		Convey("When a nil error is merged", func() {
+			errs.Merge("email", nil)
+			Convey("Then nothing should be recorded", func() {
+				So(errs.HasErrors(), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestNewContactValidationErrors(t *testing.T) {
+	Convey("Given no name, account or currency", t, func() {
+		Convey("When a contact creation is attempted", func() {
+			_, err := NewContact(nil, nil, "")
+			Convey("Then every missing field should be reported", func() {
+				verr, ok := err.(*ValidationError)
+				So(ok, ShouldBeTrue)
+				So(len(verr.Errors), ShouldEqual, 3)
+				So(verr.Errors[0].Field, ShouldEqual, "lastName")
+				So(verr.Errors[1].Field, ShouldEqual, "account")
+				So(verr.Errors[2].Field, ShouldEqual, "currency")
+			})
+		})
+	})
+}
@@ -87,12 +87,55 @@ func (h *ContactHandler) UpdateContact(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("ContactHandler.UpdateContact Failed to decode contact: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
 	}
 
 	err = service.UpdateContact(contact)
 
 	if err != nil {
 		log.Printf("ContactHandler.UpdateContact Failed to update contact: %s", err)
+		writeError(w, err)
+		return
+	}
+
+	w.Write([]byte("{\"status\":true}"))
+}
+
+//GetPerson responds to an HTTP request for all of the accounts and contacts of
+//a BBAuth user. It's reliant on an "authID" parameter being present in the request's vars.
+func (h *ContactHandler) GetPerson(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	service := &services.ContactService{ContactRepo: h.contactRepo}
+	person, err := service.GetPerson(vars["authID"])
+
+	if err != nil {
+		log.Printf("ContactHandler.GetPerson failed: %s", err)
+		writeError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(services.ConvertPersonToPersonDTO(person))
+
+	if err != nil {
+		log.Printf("ContactHandler.GetPerson failed to marshal result: %s", err)
+	}
+
+	w.Write(data)
+}
+
+//SwitchDefaultAccount responds to an HTTP request to change the default account
+//of a BBAuth user. It's reliant on "authID" and "accountID" parameters being
+//present in the request's vars.
+func (h *ContactHandler) SwitchDefaultAccount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	service := &services.ContactService{ContactRepo: h.contactRepo}
+	err := service.SwitchDefaultAccount(vars["authID"], vars["accountID"])
+
+	if err != nil {
+		log.Printf("ContactHandler.SwitchDefaultAccount failed: %s", err)
+		writeError(w, err)
+		return
 	}
 
 	w.Write([]byte("{\"status\":true}"))
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/blackbaudIT/webcore/entities"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//writeError responds to a failed request. Validation failures are returned to
+//the client as a 400 listing every invalid field, and records that don't
+//exist as a 404; any other error is reported as a 500.
+func writeError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*services.NotFoundError); ok {
+		http.Error(w, http.StatusText(404), 404)
+		return
+	}
+
+	verr, ok := err.(*entities.ValidationError)
+	if !ok {
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	data, err := json.Marshal(verr)
+	if err != nil {
+		log.Printf("handlers.writeError failed to marshal validation error: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(400)
+	w.Write(data)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/nimajalali/go-force/forcejson"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//maxOutboundMessageSize is the largest outbound message that's read. SFDC
+//sends at most 100 notifications in a message.
+const maxOutboundMessageSize = 4 << 20
+
+//outboundAck is the response SFDC requires before it stops resending a
+//message
+const outboundAck = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body>
+<notificationsResponse xmlns="http://soap.sforce.com/2005/09/outbound"><Ack>true</Ack></notificationsResponse>
+</soapenv:Body>
+</soapenv:Envelope>`
+
+//outboundFault is the response to a message that couldn't be handled. SFDC
+//resends it later.
+const outboundFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body>
+<soapenv:Fault><faultcode>soapenv:Server</faultcode><faultstring>%s</faultstring></soapenv:Fault>
+</soapenv:Body>
+</soapenv:Envelope>`
+
+//OutboundNotification is a notification of an outbound message that an
+//Account or Contact was created or changed. Account or Contact is set, with
+//the fields the workflow's outbound message sends.
+type OutboundNotification struct {
+	NotificationID string
+	ActionID       string
+	ObjectType     string
+	ID             string
+	Account        *services.AccountDTO
+	Contact        *services.ContactDTO
+}
+
+//OutboundSubscriber handles the notifications of outbound messages, ex. by
+//removing the record from a cache. When a subscriber returns an error the
+//message isn't acknowledged, so SFDC sends it again later.
+type OutboundSubscriber func(notification *OutboundNotification) error
+
+//OutboundMessageHandler receives the SOAP outbound messages that SFDC
+//workflows send when an Account or Contact changes, and passes their
+//notifications to its subscribers. Messages from other orgs are refused.
+type OutboundMessageHandler struct {
+	organizationID string
+
+	lock        sync.RWMutex
+	subscribers []OutboundSubscriber
+}
+
+//NewOutboundMessageHandler creates a new OutboundMessageHandler that accepts
+//the messages of the org with the given 15 or 18 character id.
+func NewOutboundMessageHandler(organizationID string) *OutboundMessageHandler {
+	return &OutboundMessageHandler{organizationID: organizationID}
+}
+
+//Subscribe adds a subscriber to the notifications of the handler.
+func (h *OutboundMessageHandler) Subscribe(subscriber OutboundSubscriber) {
+	h.lock.Lock()
+	h.subscribers = append(h.subscribers, subscriber)
+	h.lock.Unlock()
+}
+
+//outboundEnvelope is a SOAP outbound message
+type outboundEnvelope struct {
+	XMLName       xml.Name              `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Notifications outboundNotifications `xml:"Body>notifications"`
+}
+
+type outboundNotifications struct {
+	OrganizationID string                 `xml:"OrganizationId"`
+	ActionID       string                 `xml:"ActionId"`
+	Notifications  []outboundNotification `xml:"Notification"`
+}
+
+type outboundNotification struct {
+	ID      string          `xml:"Id"`
+	SObject outboundSObject `xml:"sObject"`
+}
+
+//outboundSObject is the record of a notification. Its type is the xsi:type
+//of the element (ex. "sf:Account").
+type outboundSObject struct {
+	Type   string          `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Fields []outboundField `xml:",any"`
+}
+
+type outboundField struct {
+	XMLName xml.Name
+	Nil     string `xml:"http://www.w3.org/2001/XMLSchema-instance nil,attr"`
+	Value   string `xml:",chardata"`
+}
+
+//ReceiveOutboundMessage responds to an outbound message POSTed by SFDC. The
+//notifications are passed to every subscriber before the message is
+//acknowledged. A message with a notification that can't be read (ex. of an
+//object other than Account or Contact) isn't passed to the subscribers and
+//is faulted, so SFDC resends it until the workflow is fixed rather than it
+//being lost.
+func (h *OutboundMessageHandler) ReceiveOutboundMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(405), 405)
+		return
+	}
+
+	envelope := outboundEnvelope{}
+	err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxOutboundMessageSize)).Decode(&envelope)
+	if err != nil {
+		log.Printf("OutboundMessageHandler.ReceiveOutboundMessage failed to read message: %s", err)
+		http.Error(w, http.StatusText(400), 400)
+		return
+	}
+
+	message := envelope.Notifications
+	if !sameOrganization(message.OrganizationID, h.organizationID) {
+		log.Printf("OutboundMessageHandler.ReceiveOutboundMessage refused message from org %s", message.OrganizationID)
+		http.Error(w, http.StatusText(403), 403)
+		return
+	}
+
+	h.lock.RLock()
+	subscribers := h.subscribers
+	h.lock.RUnlock()
+
+	notifications := make([]*OutboundNotification, len(message.Notifications))
+	for i, n := range message.Notifications {
+		notifications[i], err = newOutboundNotification(message.ActionID, n)
+		if err != nil {
+			log.Printf("OutboundMessageHandler.ReceiveOutboundMessage failed to read notification %s: %s", n.ID, err)
+			writeOutboundResponse(w, 500, fmt.Sprintf(outboundFault, "The notifications couldn't be read"))
+			return
+		}
+	}
+
+	for _, notification := range notifications {
+		for _, subscriber := range subscribers {
+			if err := subscriber(notification); err != nil {
+				log.Printf("OutboundMessageHandler.ReceiveOutboundMessage failed to handle notification %s: %s",
+					notification.NotificationID, err)
+				writeOutboundResponse(w, 500, fmt.Sprintf(outboundFault, "The notifications couldn't be handled"))
+				return
+			}
+		}
+	}
+
+	writeOutboundResponse(w, 200, outboundAck)
+}
+
+//newOutboundNotification reads the record of a notification into the DTO of
+//its type. Notifications of other objects are an error.
+func newOutboundNotification(actionID string, n outboundNotification) (*OutboundNotification, error) {
+	objectType := n.SObject.Type
+	if i := strings.Index(objectType, ":"); i >= 0 {
+		objectType = objectType[i+1:]
+	}
+
+	fields := map[string]string{}
+	for _, field := range n.SObject.Fields {
+		value := strings.TrimSpace(field.Value)
+		if field.Nil == "true" || value == "" {
+			continue
+		}
+		fields[field.XMLName.Local] = value
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	notification := &OutboundNotification{
+		NotificationID: n.ID,
+		ActionID:       actionID,
+		ObjectType:     objectType,
+		ID:             fields["Id"],
+	}
+
+	switch objectType {
+	case "Account":
+		notification.Account = &services.AccountDTO{}
+		err = forcejson.Unmarshal(data, notification.Account)
+	case "Contact":
+		notification.Contact = &services.ContactDTO{}
+		err = forcejson.Unmarshal(data, notification.Contact)
+	default:
+		err = fmt.Errorf("notifications of %s aren't supported", objectType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+//sameOrganization compares org ids by their case-sensitive 15 character
+//form, so an 18 character id matches its 15 character form
+func sameOrganization(id, expected string) bool {
+	if len(id) < 15 || len(expected) < 15 {
+		return false
+	}
+	return id[:15] == expected[:15]
+}
+
+func writeOutboundResponse(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-type", "text/xml; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
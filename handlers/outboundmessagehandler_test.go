@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+//outboundMessage is an outbound message as SFDC sends it, with the given org
+//id and notifications.
+const outboundMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+ <soapenv:Body>
+  <notifications xmlns="http://soap.sforce.com/2005/09/outbound">
+   <OrganizationId>%s</OrganizationId>
+   <ActionId>04kd0000000PCgvAAG</ActionId>
+   <SessionId xsi:nil="true"/>
+   <EnterpriseUrl>https://na1.salesforce.com/services/Soap/c/32.0/00Dd0000000hXUJ</EnterpriseUrl>
+   <PartnerUrl>https://na1.salesforce.com/services/Soap/u/32.0/00Dd0000000hXUJ</PartnerUrl>
+   %s
+  </notifications>
+ </soapenv:Body>
+</soapenv:Envelope>`
+
+const accountNotification = `<Notification>
+    <Id>04ld000000TzMKpAAN</Id>
+    <sObject xsi:type="sf:Account" xmlns:sf="urn:sobject.enterprise.soap.sforce.com">
+     <sf:Id>001d000001TweFmAAJ</sf:Id>
+     <sf:Clarify_Site_ID__c>5740</sf:Clarify_Site_ID__c>
+     <sf:Name>Blackbaud</sf:Name>
+     <sf:Industry xsi:nil="true"/>
+    </sObject>
+   </Notification>`
+
+const contactNotification = `<Notification>
+    <Id>04ld000000TzMKqAAN</Id>
+    <sObject xsi:type="sf:Contact" xmlns:sf="urn:sobject.enterprise.soap.sforce.com">
+     <sf:Id>003d000001SeyhqAAB</sf:Id>
+     <sf:Email>jane@example.com</sf:Email>
+     <sf:FirstName>Jane</sf:FirstName>
+     <sf:LastName>Doe</sf:LastName>
+    </sObject>
+   </Notification>`
+
+const opportunityNotification = `<Notification>
+    <Id>04ld000000TzMKrAAN</Id>
+    <sObject xsi:type="sf:Opportunity" xmlns:sf="urn:sobject.enterprise.soap.sforce.com">
+     <sf:Id>006d000000LOBAkAAP</sf:Id>
+    </sObject>
+   </Notification>`
+
+func postOutboundMessage(handler *OutboundMessageHandler, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("POST", "/sfdc/outbound", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ReceiveOutboundMessage(w, r)
+	return w
+}
+
+func TestReceiveOutboundMessage(t *testing.T) {
+	Convey("Given an outbound message handler for an org", t, func() {
+		handler := NewOutboundMessageHandler("00Dd0000000hXUJ")
+		received := []*OutboundNotification{}
+		handler.Subscribe(func(n *OutboundNotification) error {
+			received = append(received, n)
+			return nil
+		})
+
+		Convey("When a message with an Account and a Contact notification is received", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00Dd0000000hXUJEA2",
+				accountNotification+contactNotification))
+			Convey("Then the message should be acknowledged", func() {
+				So(w.Code, ShouldEqual, 200)
+				So(w.Header().Get("Content-type"), ShouldStartWith, "text/xml")
+				So(w.Body.String(), ShouldContainSubstring, "<Ack>true</Ack>")
+			})
+			Convey("Then the subscriber should receive the account", func() {
+				So(len(received), ShouldEqual, 2)
+				So(received[0].NotificationID, ShouldEqual, "04ld000000TzMKpAAN")
+				So(received[0].ActionID, ShouldEqual, "04kd0000000PCgvAAG")
+				So(received[0].ObjectType, ShouldEqual, "Account")
+				So(received[0].ID, ShouldEqual, "001d000001TweFmAAJ")
+				So(received[0].Account.Name, ShouldEqual, "Blackbaud")
+				So(received[0].Account.SiteID, ShouldEqual, "5740")
+				So(received[0].Account.Industry, ShouldBeEmpty)
+				So(received[0].Contact, ShouldBeNil)
+			})
+			Convey("Then the subscriber should receive the contact", func() {
+				So(received[1].ObjectType, ShouldEqual, "Contact")
+				So(received[1].ID, ShouldEqual, "003d000001SeyhqAAB")
+				So(received[1].Contact.Email, ShouldEqual, "jane@example.com")
+				So(received[1].Contact.LastName, ShouldEqual, "Doe")
+				So(received[1].Account, ShouldBeNil)
+			})
+		})
+		Convey("When a message is sent with the 15 character org id", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00Dd0000000hXUJ", accountNotification))
+			Convey("Then it should be acknowledged", func() {
+				So(w.Code, ShouldEqual, 200)
+				So(len(received), ShouldEqual, 1)
+			})
+		})
+		Convey("When a message from another org is received", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00Dd0000000hXUKEA2", accountNotification))
+			Convey("Then it should be refused without notifying the subscriber", func() {
+				So(w.Code, ShouldEqual, 403)
+				So(received, ShouldBeEmpty)
+			})
+		})
+		Convey("When the org id only differs by case", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00DD0000000HXUJEA2", accountNotification))
+			Convey("Then the message should be refused", func() {
+				So(w.Code, ShouldEqual, 403)
+			})
+		})
+		Convey("When the message has no org id", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "", accountNotification))
+			Convey("Then the message should be refused", func() {
+				So(w.Code, ShouldEqual, 403)
+			})
+		})
+		Convey("When the message isn't valid XML", func() {
+			w := postOutboundMessage(handler, `<soapenv:Envelope><soapenv:Body><notifications>`)
+			Convey("Then a bad request should be returned", func() {
+				So(w.Code, ShouldEqual, 400)
+				So(received, ShouldBeEmpty)
+			})
+		})
+		Convey("When a notification can't be read", func() {
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00Dd0000000hXUJEA2",
+				accountNotification+opportunityNotification))
+			Convey("Then the message should be faulted without notifying the subscriber", func() {
+				So(w.Code, ShouldEqual, 500)
+				So(w.Body.String(), ShouldContainSubstring, "<faultcode>soapenv:Server</faultcode>")
+				So(w.Body.String(), ShouldNotContainSubstring, "<Ack>")
+				So(received, ShouldBeEmpty)
+			})
+		})
+		Convey("When a subscriber fails", func() {
+			handler.Subscribe(func(n *OutboundNotification) error {
+				return errors.New("fake error")
+			})
+			w := postOutboundMessage(handler, fmt.Sprintf(outboundMessage, "00Dd0000000hXUJEA2", accountNotification))
+			Convey("Then the message should be faulted so SFDC resends it", func() {
+				So(w.Code, ShouldEqual, 500)
+				So(w.Body.String(), ShouldContainSubstring, "<soapenv:Fault>")
+				So(w.Body.String(), ShouldContainSubstring, "The notifications couldn't be handled")
+			})
+		})
+		Convey("When the message isn't POSTed", func() {
+			r, _ := http.NewRequest("GET", "/sfdc/outbound", nil)
+			w := httptest.NewRecorder()
+			handler.ReceiveOutboundMessage(w, r)
+			Convey("Then the method should not be allowed", func() {
+				So(w.Code, ShouldEqual, 405)
+			})
+		})
+	})
+}
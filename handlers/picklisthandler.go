@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/gorilla/mux"
+	"github.com/blackbaudIT/webcore/services"
+)
+
+//PicklistHandler holds a PicklistService and uses it to respond to http
+//requests for picklist values. Unlike the other handlers it holds the service
+//itself so that its cache is shared between requests.
+type PicklistHandler struct {
+	service *services.PicklistService
+}
+
+//NewPicklistHandler creates a new PicklistHandler using a given PicklistService.
+func NewPicklistHandler(service *services.PicklistService) *PicklistHandler {
+	return &PicklistHandler{service: service}
+}
+
+//GetPicklist responds to an HTTP request for the values of a picklist. The
+//picklist is identified by a "name" var (ex. "industry") or by "object" and
+//"field" vars. The optional "recordTypeId" query parameter limits the values to
+//a record type, and "controllingValue" limits the values of a dependent
+//picklist to those valid for that value of its controlling field. Picklists
+//the service doesn't allow are a 404.
+func (h *PicklistHandler) GetPicklist(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	recordTypeID := query.Get("recordTypeId")
+
+	var picklist *services.PicklistDTO
+	var err error
+	if vars["name"] != "" {
+		picklist, err = h.service.GetNamedPicklist(vars["name"], recordTypeID)
+	} else {
+		picklist, err = h.service.GetPicklist(vars["object"], vars["field"], recordTypeID)
+	}
+
+	if err != nil {
+		log.Printf("PicklistHandler.GetPicklist failed: %s", err)
+		writeError(w, err)
+		return
+	}
+
+	if controllingValue, ok := query["controllingValue"]; ok && picklist.ControllerField != "" {
+		values, err := h.service.GetDependentValues(picklist.Object, picklist.Field, recordTypeID,
+			controllingValue[0])
+		if err != nil {
+			log.Printf("PicklistHandler.GetPicklist failed to filter values: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+
+		filtered := *picklist
+		filtered.Values = values
+		picklist = &filtered
+	}
+
+	data, err := json.Marshal(picklist)
+
+	if err != nil {
+		log.Printf("PicklistHandler.GetPicklist failed to marshal result: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Write(data)
+}
@@ -3,8 +3,11 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/blackbaudIT/webcore/entities"
 )
@@ -16,12 +19,24 @@ type AccountRepository interface {
 	CreateAccount(account *entities.Account) (id string, siteID int, err error)
 	UpdateAccount(account *entities.Account) error
 	GetContactCount(accountID string) (int, error)
+	GetChildAccounts(parentID string) ([]*AccountDTO, error)
+	GetAncestorAccounts(id string) ([]*AccountDTO, error)
+	DeleteAccount(id string) error
+	GetDeletedAccounts() ([]*AccountDTO, error)
+	UndeleteAccount(id string) error
+}
+
+// AccountBulkRepository is an interface for writing many accounts at once.
+// The Row of each result is the index of the account it's for.
+type AccountBulkRepository interface {
+	BulkUpsertAccounts(accounts []*entities.Account) ([]*BulkRowResult, error)
 }
 
 // AccountDTO is an data transfer object for entities.Account
 type AccountDTO struct {
 	Name            string `json:"name,omitempty" force:"Name,omitempty"`
 	SalesForceID    string `json:"salesForceID,omitempty" force:"Id,omitempty"`
+	ParentID        string `json:"parentId,omitempty" force:"ParentId,omitempty"`
 	SiteID          string `json:"siteId,omitempty" force:"Clarify_Site_ID__c,omitempty"`
 	BusinessUnit    string `json:"businessUnit,omitempty" force:"Business_Unit__c,omitempty"`
 	Industry        string `json:"industry,omitempty" force:"Industry,omitempty"`
@@ -41,72 +56,161 @@ type AccountDTO struct {
 	ShippingState   string `json:"shippingState,omitempty" force:"Physical_State_Province__c,omitempty"`
 	ShippingZipCode string `json:"shippingZipCode,omitempty" force:"Physical_Zip_Postal_Code__c,omitempty"`
 	ShippingCountry string `json:"shippingCountry,omitempty" force:"Physical_Country__c,omitempty"`
+	// Clear names the fields, by their JSON names, that an update clears.
+	// Empty fields are otherwise left unchanged.
+	Clear []string `json:"clear,omitempty" force:"-"`
 }
 
+// toEntity converts the DTO into an Account entity. When validation fails, the
+// partially built account is returned along with an *entities.ValidationError
+// describing every invalid field.
 func (a *AccountDTO) toEntity() (*entities.Account, error) {
-	account, err := entities.NewAccount(a.Name)
+	errs := &entities.ValidationError{}
 
+	account, err := entities.NewAccount(a.Name)
 	if err != nil {
-		return account,
-			fmt.Errorf("Error converting to Account Entity: %v", err.Error())
+		// keep validating the remaining fields so every problem is reported
+		errs.Merge("", err)
+		account = &entities.Account{}
 	}
 
-	account.Payer = a.Payer
-	account.Industry = a.Industry
+	errs.Merge("", a.applyTo(account))
+
+	return account, errs.ErrorOrNil()
+}
+
+// applyTo copies the non-empty fields of the DTO onto the account, then clears
+// the fields named in Clear. Address fields are applied one at a time so that
+// a partial address only changes the parts that were given.
+func (a *AccountDTO) applyTo(account *entities.Account) error {
+	errs := &entities.ValidationError{}
+
+	if a.Name != "" {
+		errs.Merge("", account.SetName(a.Name))
+	}
+	if a.Payer != "" {
+		account.Payer = a.Payer
+	}
+	if a.Industry != "" {
+		account.Industry = a.Industry
+	}
+	if a.SalesForceID != "" {
+		errs.Merge("", account.SetID(a.SalesForceID))
+	}
+	if a.ParentID != "" {
+		errs.Merge("", account.SetParentID(a.ParentID))
+	}
 
 	if a.SiteID != "" {
 		siteID, err := strconv.Atoi(a.SiteID)
 		if err != nil {
-			return account,
-				fmt.Errorf("Error converting site ID: %v", err.Error())
-		}
-
-		err = account.SetSiteID(siteID)
-		if err != nil {
-			return account,
-				fmt.Errorf("Error converting site ID: %v", err.Error())
+			errs.Add("siteId", entities.ErrCodeInvalid,
+				fmt.Sprintf("Error converting site ID: %v", err.Error()))
+		} else {
+			errs.Merge("", account.SetSiteID(siteID))
 		}
 	}
 
 	if a.BusinessUnit != "" {
-		err = account.SetBusinessUnit(entities.BusinessUnit(a.BusinessUnit))
-		if err != nil {
-			return account,
-				fmt.Errorf("Error converting BusinessUnit: %v", err.Error())
+		errs.Merge("", account.SetBusinessUnit(entities.BusinessUnit(a.BusinessUnit)))
+	}
+
+	account.PrimaryAddress = applyAddress(account.PrimaryAddress, a.PrimaryStreet,
+		a.PrimaryCity, a.PrimaryState, a.PrimaryZipCode, a.PrimaryCountry)
+	account.BillingAddress = applyAddress(account.BillingAddress, a.BillingStreet,
+		a.BillingCity, a.BillingState, a.BillingZipCode, a.BillingCountry)
+	account.ShippingAddress = applyAddress(account.ShippingAddress, a.ShippingStreet,
+		a.ShippingCity, a.ShippingState, a.ShippingZipCode, a.ShippingCountry)
+
+	for _, field := range a.Clear {
+		errs.Merge("", clearAccountField(account, field))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// clearAccountField clears the field of an account with the given JSON name.
+// The name and Site ID are required, and a business unit can only be replaced,
+// so they can't be cleared.
+func clearAccountField(account *entities.Account, field string) error {
+	errs := &entities.ValidationError{}
+
+	switch field {
+	case "payer":
+		account.Payer = ""
+	case "industry":
+		account.Industry = ""
+	case "parentId":
+		account.SetParentID("")
+	case "name", "siteId":
+		errs.Add(field, entities.ErrCodeRequired, fmt.Sprintf("%s is required and can't be cleared", field))
+	default:
+		if !clearAddressPart(account, field) {
+			errs.Add(field, entities.ErrCodeInvalid, fmt.Sprintf("%s can't be cleared", field))
 		}
 	}
 
-	if a.PrimaryStreet != "" || a.PrimaryCity != "" || a.PrimaryState != "" ||
-		a.PrimaryZipCode != "" || a.PrimaryCountry != "" {
-		account.PrimaryAddress = &entities.Address{}
-		account.PrimaryAddress.Street = a.PrimaryStreet
-		account.PrimaryAddress.City = a.PrimaryCity
-		account.PrimaryAddress.State = a.PrimaryState
-		account.PrimaryAddress.ZipCode = a.PrimaryZipCode
-		account.PrimaryAddress.Country = a.PrimaryCountry
+	return errs.ErrorOrNil()
+}
+
+// clearAddressPart clears a part of one of the account's addresses, named like
+// the address fields of AccountDTO (ex. "billingCity"). It's false for fields
+// that aren't address parts.
+func clearAddressPart(account *entities.Account, field string) bool {
+	addresses := map[string]*entities.Address{
+		"primary":  account.PrimaryAddress,
+		"billing":  account.BillingAddress,
+		"shipping": account.ShippingAddress,
 	}
 
-	if a.BillingStreet != "" || a.BillingCity != "" || a.BillingState != "" ||
-		a.BillingZipCode != "" || a.BillingCountry != "" {
-		account.BillingAddress = &entities.Address{}
-		account.BillingAddress.Street = a.BillingStreet
-		account.BillingAddress.City = a.BillingCity
-		account.BillingAddress.State = a.BillingState
-		account.BillingAddress.ZipCode = a.BillingZipCode
-		account.BillingAddress.Country = a.BillingCountry
+	for prefix, address := range addresses {
+		if !strings.HasPrefix(field, prefix) {
+			continue
+		}
+		if address == nil {
+			// there's nothing to clear, but the name still has to be valid
+			address = &entities.Address{}
+		}
+
+		parts := map[string]*string{"Street": &address.Street, "City": &address.City,
+			"State": &address.State, "ZipCode": &address.ZipCode, "Country": &address.Country}
+		part, ok := parts[strings.TrimPrefix(field, prefix)]
+		if ok {
+			*part = ""
+		}
+		return ok
 	}
 
-	if a.ShippingStreet != "" || a.ShippingCity != "" || a.ShippingState != "" ||
-		a.ShippingZipCode != "" || a.ShippingCountry != "" {
-		account.ShippingAddress = &entities.Address{}
-		account.ShippingAddress.Street = a.ShippingStreet
-		account.ShippingAddress.City = a.ShippingCity
-		account.ShippingAddress.State = a.ShippingState
-		account.ShippingAddress.ZipCode = a.ShippingZipCode
-		account.ShippingAddress.Country = a.ShippingCountry
+	return false
+}
+
+// applyAddress copies the non-empty address parts onto address, creating it if
+// needed. A nil address is only created if at least one part is given.
+func applyAddress(address *entities.Address, street, city, state, zipCode, country string) *entities.Address {
+	if street == "" && city == "" && state == "" && zipCode == "" && country == "" {
+		return address
 	}
 
-	return account, err
+	if address == nil {
+		address = &entities.Address{}
+	}
+	if street != "" {
+		address.Street = street
+	}
+	if city != "" {
+		address.City = city
+	}
+	if state != "" {
+		address.State = state
+	}
+	if zipCode != "" {
+		address.ZipCode = zipCode
+	}
+	if country != "" {
+		address.Country = country
+	}
+
+	return address
 }
 
 // ConvertAccountEntityToAccountDTO converts an entity account to a data tranfer
@@ -114,6 +218,8 @@ func (a *AccountDTO) toEntity() (*entities.Account, error) {
 func ConvertAccountEntityToAccountDTO(account *entities.Account) *AccountDTO {
 	dto := &AccountDTO{
 		Name:         account.Name(),
+		SalesForceID: account.ID(),
+		ParentID:     account.ParentID(),
 		SiteID:       strconv.Itoa(account.SiteID()),
 		BusinessUnit: string(account.BusinessUnit()),
 		Industry:     account.Industry,
@@ -147,9 +253,13 @@ func ConvertAccountEntityToAccountDTO(account *entities.Account) *AccountDTO {
 	return dto
 }
 
-// AccountService provides interaction with Account data
+// AccountService provides interaction with Account data. AssetRepo is only
+// needed for asset roll-ups across an account hierarchy and deletes without
+// force, and BulkRepo for bulk upserts.
 type AccountService struct {
 	AccountRepo AccountRepository
+	AssetRepo   AssetRepository
+	BulkRepo    AccountBulkRepository
 }
 
 // GetAccount returns an account by ID
@@ -166,10 +276,54 @@ func (as *AccountService) CreateAccount(a AccountDTO) (id string, siteID int, er
 		return "", 0, err
 	}
 
+	err = account.ValidateWrite()
+	if err != nil {
+		return "", 0, err
+	}
+
 	id, siteID, err = as.AccountRepo.CreateAccount(account)
 	return id, siteID, err
 }
 
+// BulkUpsert creates or updates many accounts at once, matching existing
+// accounts by SiteID. Every account is validated first and only the valid
+// ones are sent to the data store. The report has a result for every account;
+// an error is only returned if the bulk operation as a whole failed.
+func (as *AccountService) BulkUpsert(accounts []AccountDTO) (*BulkReport, error) {
+	if as.BulkRepo == nil {
+		return nil, errors.New("An AccountBulkRepository is required for bulk upserts")
+	}
+
+	report := newBulkReport(len(accounts))
+	valid := []*entities.Account{}
+	sent := []int{}
+
+	for i, a := range accounts {
+		account, err := a.toEntity()
+		if err == nil {
+			err = account.ValidateWrite()
+		}
+		if err == nil && account.SiteID() <= 0 {
+			err = fmt.Errorf("A valid SiteID is required to upsert an account (SiteID: %v)", a.SiteID)
+		}
+		if err != nil {
+			report.invalid(i, err)
+			continue
+		}
+
+		valid = append(valid, account)
+		sent = append(sent, i)
+	}
+
+	if len(valid) == 0 {
+		return report, nil
+	}
+
+	results, err := as.BulkRepo.BulkUpsertAccounts(valid)
+	report.record(sent, results)
+	return report, err
+}
+
 //QueryAccounts returns a slice of the accunts returned by the query.
 func (as *AccountService) QueryAccounts(query string) ([]*AccountDTO, error) {
 	accounts, err := as.AccountRepo.QueryAccounts(query)
@@ -177,21 +331,218 @@ func (as *AccountService) QueryAccounts(query string) ([]*AccountDTO, error) {
 	return accounts, err
 }
 
-// UpdateAccount updatesn account
+// UpdateAccount updates an account. The current account is loaded by its
+// SalesForceID (or SiteID) and the non-empty fields of the DTO are applied to
+// it, and the fields named in its Clear cleared, so only the fields that
+// actually change are sent to the data store.
 func (as *AccountService) UpdateAccount(a AccountDTO) error {
-	account, err := a.toEntity()
+	id := a.SalesForceID
+	if id == "" {
+		id = a.SiteID
+	}
+
+	current, err := as.AccountRepo.GetAccount(id)
+	if err != nil {
+		return fmt.Errorf("Error getting account to update: %s", err)
+	}
+
+	account, err := current.toEntity()
+	if err != nil {
+		return fmt.Errorf("Error converting current account: %s", err)
+	}
+	account.MarkClean()
 
+	err = a.applyTo(account)
 	if err != nil {
 		return err
 	}
 
+	err = account.ValidateWrite()
+	if err != nil {
+		return err
+	}
+
+	if len(account.ModifiedFields()) == 0 {
+		return nil
+	}
+
 	err = as.AccountRepo.UpdateAccount(account)
 	return err
 }
 
+//DeleteAccount moves the account with the given SalesForceID or SiteID to the
+//recycle bin. Unless force is set, an account that still has contacts or
+//active assets isn't deleted and a *DeleteRefusedError is returned; checking
+//the assets requires the AssetRepo of the service to be set.
+func (as *AccountService) DeleteAccount(id string, force bool) error {
+	account, err := as.AccountRepo.GetAccount(id)
+	if err != nil {
+		return fmt.Errorf("Error getting account to delete: %s", err)
+	}
+
+	if !force {
+		count, err := as.AccountRepo.GetContactCount(account.SalesForceID)
+		if err != nil {
+			return fmt.Errorf("Error getting contact count of %s: %s", id, err)
+		}
+		if count > 0 {
+			return &DeleteRefusedError{ID: id, Reason: fmt.Sprintf("the account has %d contacts", count)}
+		}
+
+		if as.AssetRepo == nil {
+			return errors.New("An AssetRepository is required to check the assets of an account before deleting it")
+		}
+		active, err := as.activeAssets(account.SalesForceID)
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return &DeleteRefusedError{ID: id, Reason: fmt.Sprintf("the account has %d active assets", len(active))}
+		}
+	}
+
+	return as.AccountRepo.DeleteAccount(account.SalesForceID)
+}
+
+//GetDeletedAccounts returns the accounts in the recycle bin.
+func (as *AccountService) GetDeletedAccounts() ([]*AccountDTO, error) {
+	accounts, err := as.AccountRepo.GetDeletedAccounts()
+
+	return accounts, err
+}
+
+//UndeleteAccount restores the account with the given SalesForceID or SiteID
+//from the recycle bin.
+func (as *AccountService) UndeleteAccount(id string) error {
+	return as.AccountRepo.UndeleteAccount(id)
+}
+
 //GetContactCount returns the number of contacts currently associated with a given account.
 func (as *AccountService) GetContactCount(accountID string) (int, error) {
 	count, err := as.AccountRepo.GetContactCount(accountID)
 
 	return count, err
 }
+
+//GetChildAccounts returns the accounts directly below the given account in the
+//account hierarchy.
+func (as *AccountService) GetChildAccounts(id string) ([]*AccountDTO, error) {
+	accounts, err := as.AccountRepo.GetChildAccounts(id)
+
+	return accounts, err
+}
+
+//GetAncestorAccounts returns the parent of the given account, then its parent,
+//and so on up to the top level account.
+func (as *AccountService) GetAncestorAccounts(id string) ([]*AccountDTO, error) {
+	accounts, err := as.AccountRepo.GetAncestorAccounts(id)
+
+	return accounts, err
+}
+
+//GetDescendantAccounts returns every account below the given account in the
+//account hierarchy, nearest levels first. Each account is only visited once,
+//so a cycle in the hierarchy can't cause an endless walk.
+func (as *AccountService) GetDescendantAccounts(id string) ([]*AccountDTO, error) {
+	visited := map[string]bool{id: true}
+	descendants := []*AccountDTO{}
+	queue := []string{id}
+
+	for len(queue) > 0 {
+		children, err := as.AccountRepo.GetChildAccounts(queue[0])
+		if err != nil {
+			return descendants, fmt.Errorf("Error getting child accounts of %s: %s", queue[0], err)
+		}
+		queue = queue[1:]
+
+		for _, child := range children {
+			if child.SalesForceID == "" || visited[child.SalesForceID] {
+				continue
+			}
+			visited[child.SalesForceID] = true
+			descendants = append(descendants, child)
+			queue = append(queue, child.SalesForceID)
+		}
+	}
+
+	return descendants, nil
+}
+
+//GetHierarchyContactCount returns the number of contacts associated with the
+//given account and every account below it.
+func (as *AccountService) GetHierarchyContactCount(id string) (int, error) {
+	ids, err := as.hierarchyIDs(id)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, accountID := range ids {
+		count, err := as.AccountRepo.GetContactCount(accountID)
+		if err != nil {
+			return 0, fmt.Errorf("Error getting contact count of %s: %s", accountID, err)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+//GetHierarchyActiveAssets returns the active assets of the given account and
+//every account below it. Requires the AssetRepo of the service to be set.
+func (as *AccountService) GetHierarchyActiveAssets(id string) ([]*AssetDTO, error) {
+	if as.AssetRepo == nil {
+		return nil, errors.New("An AssetRepository is required to roll up assets")
+	}
+
+	ids, err := as.hierarchyIDs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []*AssetDTO{}
+	for _, accountID := range ids {
+		assets, err := as.activeAssets(accountID)
+		if err != nil {
+			return nil, err
+		}
+		active = append(active, assets...)
+	}
+
+	return active, nil
+}
+
+//activeAssets returns the active assets of a single account.
+func (as *AccountService) activeAssets(accountID string) ([]*AssetDTO, error) {
+	query := as.AssetRepo.BuildAssetsByAccountIDQuery(accountID)
+	assets, err := as.AssetRepo.QueryAssets(query)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting assets of %s: %s", accountID, err)
+	}
+
+	now := time.Now()
+	active := []*AssetDTO{}
+	for _, asset := range assets {
+		if asset.IsActive(now) {
+			active = append(active, asset)
+		}
+	}
+
+	return active, nil
+}
+
+//hierarchyIDs returns the given account ID followed by the IDs of every
+//account below it.
+func (as *AccountService) hierarchyIDs(id string) ([]string, error) {
+	descendants, err := as.GetDescendantAccounts(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{id}
+	for _, account := range descendants {
+		ids = append(ids, account.SalesForceID)
+	}
+
+	return ids, nil
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"errors"
 	"strconv"
 	"testing"
+	"time"
 
 	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
 	"github.com/blackbaudIT/webcore/entities"
@@ -38,6 +40,9 @@ type mockAccountRepository struct {
 }
 
 func (m mockAccountRepository) GetAccount(id string) (*AccountDTO, error) {
+	if _, ok := contactCounts[id]; ok {
+		return &AccountDTO{Name: "Hierarchy Account", SalesForceID: id}, nil
+	}
 	return &accountDTO, nil
 }
 
@@ -49,12 +54,83 @@ func (m mockAccountRepository) QueryAccounts(query string) ([]*AccountDTO, error
 	return []*AccountDTO{&accountDTO}, nil
 }
 
+// updatedAccount records the last account handed to UpdateAccount
+var updatedAccount *entities.Account
+
 func (m mockAccountRepository) UpdateAccount(account *entities.Account) error {
+	updatedAccount = account
 	return nil
 }
 
 func (m mockAccountRepository) GetContactCount(accountID string) (int, error) {
-	return 0, nil
+	return contactCounts[accountID], nil
+}
+
+// accountChildren mocks a district with two schools, one of which lists the
+// district as its own child to create a cycle.
+var accountChildren = map[string][]*AccountDTO{
+	"001d000001DISTRT": {
+		{Name: "School 1", SalesForceID: "001d000001SCHL01", ParentID: "001d000001DISTRT"},
+		{Name: "School 2", SalesForceID: "001d000001SCHL02", ParentID: "001d000001DISTRT"},
+	},
+	"001d000001SCHL02": {
+		{Name: "District", SalesForceID: "001d000001DISTRT"},
+	},
+}
+
+var contactCounts = map[string]int{
+	"001d000001DISTRT": 3,
+	"001d000001SCHL01": 10,
+	"001d000001SCHL02": 20,
+}
+
+func (m mockAccountRepository) GetChildAccounts(parentID string) ([]*AccountDTO, error) {
+	if parentID == "" {
+		return nil, errors.New("parentID cannot be empty")
+	}
+	return accountChildren[parentID], nil
+}
+
+func (m mockAccountRepository) GetAncestorAccounts(id string) ([]*AccountDTO, error) {
+	if id == "001d000001SCHL01" {
+		return []*AccountDTO{{Name: "District", SalesForceID: "001d000001DISTRT"}}, nil
+	}
+	return []*AccountDTO{}, nil
+}
+
+// deletedAccountID records the id of the last account handed to DeleteAccount
+var deletedAccountID string
+
+func (m mockAccountRepository) DeleteAccount(id string) error {
+	deletedAccountID = id
+	return nil
+}
+
+func (m mockAccountRepository) GetDeletedAccounts() ([]*AccountDTO, error) {
+	return []*AccountDTO{{Name: "Deleted Org", SalesForceID: "001d000001DELETED"}}, nil
+}
+
+func (m mockAccountRepository) UndeleteAccount(id string) error {
+	if id == "" {
+		return errors.New("An ID must be provided to undelete an account")
+	}
+	return nil
+}
+
+// mockHierarchyAssetRepository returns one expired and one active asset for
+// every account
+type mockHierarchyAssetRepository struct{}
+
+func (m mockHierarchyAssetRepository) BuildAssetsByAccountIDQuery(accountID string) string {
+	return accountID
+}
+
+func (m mockHierarchyAssetRepository) QueryAssets(query string) ([]*AssetDTO, error) {
+	expired, _ := time.Parse(customDateLayout, "2015-01-01")
+	return []*AssetDTO{
+		{ProductLine: query, EndDate: CustomDate{expired}},
+		{ProductLine: query, EndDate: endDate},
+	}, nil
 }
 
 func TestAccountDTOToEntity(t *testing.T) {
@@ -98,6 +174,23 @@ func TestAccountDTOToEntity(t *testing.T) {
 			})
 		})
 	})
+	Convey("Given an Account Data Transfer Object with several invalid fields", t, func() {
+		accountDTOCopy := accountDTO
+		accountDTOCopy.Name = ""
+		accountDTOCopy.SiteID = "a1234"
+		accountDTOCopy.BusinessUnit = "NOBU"
+		Convey("When it is converted to an Account entity", func() {
+			_, err := accountDTOCopy.toEntity()
+			Convey("Then every invalid field should be reported", func() {
+				verr, ok := err.(*entities.ValidationError)
+				So(ok, ShouldBeTrue)
+				So(len(verr.Errors), ShouldEqual, 3)
+				So(verr.Errors[0].Field, ShouldEqual, "name")
+				So(verr.Errors[1].Field, ShouldEqual, "siteId")
+				So(verr.Errors[2].Field, ShouldEqual, "businessUnit")
+			})
+		})
+	})
 	Convey("Given an Account DTO with fully populated fields", t, func() {
 		Convey("When it is converted to an Account Entity", func() {
 			accountEntity, err := accountDTO.toEntity()
@@ -282,7 +375,7 @@ func TestUpdateAccount(t *testing.T) {
 	})
 	Convey("Given an invalid Account DTO", t, func() {
 		accountDTOCopy := accountDTO
-		accountDTOCopy.Name = ""
+		accountDTOCopy.SiteID = "not a number"
 		Convey("When an account is updated through the AccountService", func() {
 			err := accountService.UpdateAccount(accountDTOCopy)
 			Convey("Then an error should occur", func() {
@@ -291,3 +384,285 @@ func TestUpdateAccount(t *testing.T) {
 		})
 	})
 }
+
+func TestUpdateAccountModifiedFields(t *testing.T) {
+	Convey("Given an Account DTO that changes the industry and billing city", t, func() {
+		updatedAccount = nil
+		dto := AccountDTO{Name: accountDTO.Name, SiteID: accountDTO.SiteID,
+			Industry: "Education", BillingCity: "Charleston", BillingState: accountDTO.BillingState}
+		Convey("When the account is updated through the AccountService", func() {
+			err := accountService.UpdateAccount(dto)
+			Convey("Then only the changed fields should be modified", func() {
+				So(err, ShouldBeNil)
+				So(updatedAccount.ModifiedFields(), ShouldResemble,
+					[]string{"billingCity", "industry"})
+				So(updatedAccount.BillingAddress.Street, ShouldEqual, accountDTO.BillingStreet)
+			})
+		})
+	})
+	Convey("Given an Account DTO that only changes the industry", t, func() {
+		updatedAccount = nil
+		dto := AccountDTO{SalesForceID: accountDTO.SalesForceID, Industry: "Education"}
+		Convey("When the account is updated through the AccountService", func() {
+			err := accountService.UpdateAccount(dto)
+			Convey("Then the name should not be required and kept as it is", func() {
+				So(err, ShouldBeNil)
+				So(updatedAccount.ModifiedFields(), ShouldResemble, []string{"industry"})
+				So(updatedAccount.Name(), ShouldEqual, accountDTO.Name)
+			})
+		})
+	})
+	Convey("Given an Account DTO that clears the payer and billing city", t, func() {
+		updatedAccount = nil
+		dto := AccountDTO{Name: accountDTO.Name, SiteID: accountDTO.SiteID,
+			Clear: []string{"payer", "billingCity"}}
+		Convey("When the account is updated through the AccountService", func() {
+			err := accountService.UpdateAccount(dto)
+			Convey("Then the fields should be cleared and modified", func() {
+				So(err, ShouldBeNil)
+				So(updatedAccount.ModifiedFields(), ShouldResemble, []string{"billingCity", "payer"})
+				So(updatedAccount.Payer, ShouldBeEmpty)
+				So(updatedAccount.BillingAddress.City, ShouldBeEmpty)
+				So(updatedAccount.BillingAddress.Street, ShouldEqual, accountDTO.BillingStreet)
+			})
+		})
+	})
+	Convey("Given an Account DTO that clears fields that can't be cleared", t, func() {
+		updatedAccount = nil
+		dto := AccountDTO{Name: accountDTO.Name, SiteID: accountDTO.SiteID,
+			Clear: []string{"name", "billingPlanet"}}
+		Convey("When the account is updated through the AccountService", func() {
+			err := accountService.UpdateAccount(dto)
+			Convey("Then every field should be reported", func() {
+				verr, ok := err.(*entities.ValidationError)
+				So(ok, ShouldBeTrue)
+				So(len(verr.Errors), ShouldEqual, 2)
+				So(verr.Errors[0].Code, ShouldEqual, entities.ErrCodeRequired)
+				So(verr.Errors[1].Field, ShouldEqual, "billingPlanet")
+				So(updatedAccount, ShouldBeNil)
+			})
+		})
+	})
+	Convey("Given an Account DTO without changes", t, func() {
+		updatedAccount = nil
+		dto := AccountDTO{Name: accountDTO.Name, SiteID: accountDTO.SiteID}
+		Convey("When the account is updated through the AccountService", func() {
+			err := accountService.UpdateAccount(dto)
+			Convey("Then nothing should be sent to the repository", func() {
+				So(err, ShouldBeNil)
+				So(updatedAccount, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestGetAncestorAccounts(t *testing.T) {
+	Convey("Given a school in a district", t, func() {
+		Convey("When its ancestors are requested", func() {
+			ancestors, err := accountService.GetAncestorAccounts("001d000001SCHL01")
+			Convey("Then the district should be returned", func() {
+				So(err, ShouldBeNil)
+				So(ancestors[0].SalesForceID, ShouldEqual, "001d000001DISTRT")
+			})
+		})
+	})
+}
+
+func TestGetDescendantAccounts(t *testing.T) {
+	Convey("Given a district with schools and a cycle in its hierarchy", t, func() {
+		Convey("When its descendants are requested", func() {
+			descendants, err := accountService.GetDescendantAccounts("001d000001DISTRT")
+			Convey("Then each school should be returned once", func() {
+				So(err, ShouldBeNil)
+				So(len(descendants), ShouldEqual, 2)
+				So(descendants[0].SalesForceID, ShouldEqual, "001d000001SCHL01")
+				So(descendants[1].SalesForceID, ShouldEqual, "001d000001SCHL02")
+			})
+		})
+	})
+	Convey("Given an account the repository can't look up", t, func() {
+		Convey("When its descendants are requested", func() {
+			_, err := accountService.GetDescendantAccounts("")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestHierarchyRollUps(t *testing.T) {
+	Convey("Given a district with schools", t, func() {
+		service := AccountService{AccountRepo: mockAccountRepository{},
+			AssetRepo: mockHierarchyAssetRepository{}}
+		Convey("When the contact count of the hierarchy is requested", func() {
+			count, err := service.GetHierarchyContactCount("001d000001DISTRT")
+			Convey("Then the contacts of every account should be counted", func() {
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 33)
+			})
+		})
+		Convey("When the active assets of the hierarchy are requested", func() {
+			assets, err := service.GetHierarchyActiveAssets("001d000001DISTRT")
+			Convey("Then only the active assets of every account should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(assets), ShouldEqual, 3)
+				So(assets[0].ProductLine, ShouldEqual, "001d000001DISTRT")
+			})
+		})
+		Convey("When the service has no AssetRepository", func() {
+			service.AssetRepo = nil
+			_, err := service.GetHierarchyActiveAssets("001d000001DISTRT")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+// mockNoAssetRepository has no assets for any account
+type mockNoAssetRepository struct {
+	mockAssetQueryBuilder
+}
+
+func (m mockNoAssetRepository) QueryAssets(query string) ([]*AssetDTO, error) {
+	return []*AssetDTO{}, nil
+}
+
+func TestDeleteAccount(t *testing.T) {
+	Convey("Given an AccountService", t, func() {
+		service := AccountService{AccountRepo: mockAccountRepository{}, AssetRepo: mockNoAssetRepository{}}
+		Convey("When an account without contacts is deleted by its SiteID", func() {
+			err := service.DeleteAccount(accountDTO.SiteID, false)
+			Convey("Then the account should be deleted by its SalesForceID", func() {
+				So(err, ShouldBeNil)
+				So(deletedAccountID, ShouldEqual, accountDTO.SalesForceID)
+			})
+		})
+		Convey("When an account with contacts is deleted", func() {
+			err := service.DeleteAccount("001d000001SCHL01", false)
+			Convey("Then the delete should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &DeleteRefusedError{})
+				So(err.Error(), ShouldContainSubstring, "10 contacts")
+				So(deletedAccountID, ShouldBeEmpty)
+			})
+		})
+		Convey("When an account with contacts is deleted with force", func() {
+			err := service.DeleteAccount("001d000001SCHL01", true)
+			Convey("Then the account should be deleted", func() {
+				So(err, ShouldBeNil)
+				So(deletedAccountID, ShouldEqual, "001d000001SCHL01")
+			})
+		})
+		Convey("When an account with active assets is deleted", func() {
+			service.AssetRepo = mockHierarchyAssetRepository{}
+			err := service.DeleteAccount(accountDTO.SalesForceID, false)
+			Convey("Then the delete should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &DeleteRefusedError{})
+				So(err.Error(), ShouldContainSubstring, "1 active assets")
+			})
+		})
+		Convey("When an account is deleted by a service without an AssetRepo", func() {
+			service.AssetRepo = nil
+			err := service.DeleteAccount(accountDTO.SalesForceID, false)
+			Convey("Then an error should be returned without deleting the account", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "AssetRepository is required")
+				So(deletedAccountID, ShouldBeEmpty)
+			})
+			Convey("Then the account should still be deleted with force", func() {
+				So(service.DeleteAccount(accountDTO.SalesForceID, true), ShouldBeNil)
+				So(deletedAccountID, ShouldEqual, accountDTO.SalesForceID)
+			})
+		})
+
+		Reset(func() {
+			deletedAccountID = ""
+		})
+	})
+}
+
+func TestDeletedAccounts(t *testing.T) {
+	Convey("Given an AccountService", t, func() {
+		Convey("When the deleted accounts are requested", func() {
+			accounts, err := accountService.GetDeletedAccounts()
+			Convey("Then the accounts in the recycle bin should be returned", func() {
+				So(err, ShouldBeNil)
+				So(accounts[0].SalesForceID, ShouldEqual, "001d000001DELETED")
+			})
+		})
+		Convey("When an account is undeleted", func() {
+			err := accountService.UndeleteAccount("001d000001DELETED")
+			Convey("Then no error should be returned", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+// mockBulkRepository upserts accounts and contacts, failing accounts named
+// "Duplicate Org" the way SFDC rejects rows of a bulk job
+type mockBulkRepository struct{}
+
+func (m mockBulkRepository) BulkUpsertAccounts(accounts []*entities.Account) ([]*BulkRowResult, error) {
+	results := make([]*BulkRowResult, len(accounts))
+	for i, account := range accounts {
+		results[i] = &BulkRowResult{Row: i, ID: "001d000001BULK" + strconv.Itoa(i) + "AAA", Success: true}
+		if account.Name() == "Duplicate Org" {
+			results[i] = &BulkRowResult{Row: i, Error: "DUPLICATE_VALUE:duplicate value found"}
+		}
+	}
+	return results, nil
+}
+
+func (m mockBulkRepository) BulkUpsertContacts(contacts []*entities.Contact) ([]*BulkRowResult, error) {
+	results := make([]*BulkRowResult, len(contacts))
+	for i, contact := range contacts {
+		results[i] = &BulkRowResult{Row: i, ID: contact.ID(), Success: true}
+		if contact.ID() == "" {
+			results[i].ID = "003d000001BULK" + strconv.Itoa(i) + "AAA"
+			results[i].Created = true
+		}
+	}
+	return results, nil
+}
+
+func TestAccountBulkUpsert(t *testing.T) {
+	Convey("Given accounts to import", t, func() {
+		service := AccountService{AccountRepo: mockAccountRepository{}, BulkRepo: mockBulkRepository{}}
+		duplicate := accountDTO
+		duplicate.Name = "Duplicate Org"
+		noSiteID := accountDTO
+		noSiteID.SiteID = ""
+		invalid := accountDTO
+		invalid.Name = ""
+		accounts := []AccountDTO{accountDTO, invalid, duplicate, noSiteID, accountDTO}
+
+		Convey("When they're upserted in bulk", func() {
+			report, err := service.BulkUpsert(accounts)
+			Convey("Then every row should have a result in input order", func() {
+				So(err, ShouldBeNil)
+				So(len(report.Results), ShouldEqual, 5)
+				for i, result := range report.Results {
+					So(result.Row, ShouldEqual, i)
+				}
+				So(report.Results[0].Success, ShouldBeTrue)
+				So(report.Results[4].Success, ShouldBeTrue)
+				So(report.Results[4].ID, ShouldEqual, "001d000001BULK2AAA")
+			})
+			Convey("Then invalid and rejected rows should be reported", func() {
+				failed := report.Failed()
+				So(len(failed), ShouldEqual, 3)
+				So(failed[0].Row, ShouldEqual, 1)
+				So(failed[1].Error, ShouldContainSubstring, "DUPLICATE_VALUE")
+				So(failed[2].Error, ShouldContainSubstring, "SiteID")
+			})
+		})
+		Convey("When the service has no AccountBulkRepository", func() {
+			service.BulkRepo = nil
+			_, err := service.BulkUpsert(accounts)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -1,5 +1,7 @@
 package services
 
+import "time"
+
 // AssetQueryBuilder is an interface for generating asset query strings
 type AssetQueryBuilder interface {
 	BuildAssetsByAccountIDQuery(accountID string) string
@@ -18,6 +20,16 @@ type AssetDTO struct {
 	MaterialType string     `json:"materialType,omitempty" force:"Material_Type__c,omitempty"`
 }
 
+// IsActive reports whether the asset is still in effect at the given time.
+// Assets without an end date don't expire.
+func (a *AssetDTO) IsActive(asOf time.Time) bool {
+	if !a.EndDate.IsSet() {
+		return true
+	}
+
+	return !a.EndDate.Time.Before(asOf.Truncate(24 * time.Hour))
+}
+
 // AssetService provides interaction with Asset data
 type AssetService struct {
 	AssetRepo AssetRepository
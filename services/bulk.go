@@ -0,0 +1,58 @@
+package services
+
+//BulkRowResult is the outcome of one row of a bulk operation. Row is the
+//index of the row in the input. Rows that fail validation are reported
+//without being sent to the data store.
+type BulkRowResult struct {
+	Row     int    `json:"row"`
+	ID      string `json:"id,omitempty"`
+	Created bool   `json:"created,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+//BulkReport holds the result of every row of a bulk operation, in the order
+//of the input
+type BulkReport struct {
+	Results []*BulkRowResult `json:"results"`
+}
+
+//Failed returns the results of the rows that weren't written
+func (r *BulkReport) Failed() []*BulkRowResult {
+	failed := []*BulkRowResult{}
+	for _, result := range r.Results {
+		if !result.Success {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+//newBulkReport starts a report for the given number of rows. Rows are
+//failed until a result is recorded for them.
+func newBulkReport(rows int) *BulkReport {
+	report := &BulkReport{Results: make([]*BulkRowResult, rows)}
+	for i := range report.Results {
+		report.Results[i] = &BulkRowResult{Row: i, Error: "The row wasn't processed"}
+	}
+	return report
+}
+
+//invalid records a row that failed validation
+func (r *BulkReport) invalid(row int, err error) {
+	r.Results[row] = &BulkRowResult{Row: row, Error: err.Error()}
+}
+
+//record copies the results of the rows that were sent to the data store.
+//The rows of the results are indexes into sent, which holds the input row of
+//each row that was sent.
+func (r *BulkReport) record(sent []int, results []*BulkRowResult) {
+	for _, result := range results {
+		if result.Row < 0 || result.Row >= len(sent) {
+			continue
+		}
+		recorded := *result
+		recorded.Row = sent[result.Row]
+		r.Results[recorded.Row] = &recorded
+	}
+}
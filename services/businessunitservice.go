@@ -0,0 +1,85 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//BusinessUnitRepository is an interface for accessing the values of the
+//Account Business_Unit__c picklist
+type BusinessUnitRepository interface {
+	GetBusinessUnitPicklist() ([]*PicklistValueDTO, error)
+}
+
+//BusinessUnitService loads the business unit registry used to validate
+//accounts
+type BusinessUnitService struct {
+	BusinessUnitRepo BusinessUnitRepository
+}
+
+//NewBusinessUnitService returns a pointer to a BusinessUnitService
+//instantiated with the given BusinessUnitRepository.
+func NewBusinessUnitService(repo BusinessUnitRepository) *BusinessUnitService {
+	return &BusinessUnitService{BusinessUnitRepo: repo}
+}
+
+//LoadFromPicklist replaces the business unit registry with the values of the
+//Business_Unit__c picklist. Inactive picklist values are registered as
+//deprecated, and the aliases of business units already in the registry are
+//kept. The registry is left unchanged if the picklist can't be loaded.
+func (bs *BusinessUnitService) LoadFromPicklist() ([]entities.BusinessUnitDefinition, error) {
+	values, err := bs.BusinessUnitRepo.GetBusinessUnitPicklist()
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving business units: %s", err)
+	}
+
+	current := map[entities.BusinessUnit]entities.BusinessUnitDefinition{}
+	for _, definition := range entities.BusinessUnits() {
+		current[definition.Value] = definition
+	}
+
+	definitions := make([]entities.BusinessUnitDefinition, len(values))
+	for index, value := range values {
+		bu := entities.BusinessUnit(value.Value)
+		definitions[index] = entities.BusinessUnitDefinition{
+			Value:      bu,
+			Label:      value.Label,
+			Aliases:    current[bu].Aliases,
+			Deprecated: !value.Active,
+		}
+	}
+
+	err = entities.SetBusinessUnits(definitions)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading business units: %s", err)
+	}
+
+	return entities.BusinessUnits(), nil
+}
+
+//LoadBusinessUnitConfig replaces the business unit registry with the JSON
+//list of entities.BusinessUnitDefinition read from r, ex.
+//[{"value":"K12","label":"K-12","aliases":["ECBU"]},{"value":"IBU","deprecated":true}]
+func LoadBusinessUnitConfig(r io.Reader) ([]entities.BusinessUnitDefinition, error) {
+	definitions := []entities.BusinessUnitDefinition{}
+
+	err := json.NewDecoder(r).Decode(&definitions)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding business unit configuration: %s", err)
+	}
+
+	err = entities.SetBusinessUnits(definitions)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading business units: %s", err)
+	}
+
+	return entities.BusinessUnits(), nil
+}
+
+//BusinessUnits returns the business units currently in the registry.
+func (bs *BusinessUnitService) BusinessUnits() []entities.BusinessUnitDefinition {
+	return entities.BusinessUnits()
+}
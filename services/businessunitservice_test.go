@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+type mockBusinessUnitRepository struct {
+	values []*PicklistValueDTO
+	err    error
+}
+
+func (m mockBusinessUnitRepository) GetBusinessUnitPicklist() ([]*PicklistValueDTO, error) {
+	return m.values, m.err
+}
+
+func TestLoadBusinessUnits(t *testing.T) {
+	Convey("Given the business units registered by default", t, func() {
+		defaults := entities.BusinessUnits()
+		Convey("When the business units are loaded from the picklist", func() {
+			service := NewBusinessUnitService(mockBusinessUnitRepository{values: []*PicklistValueDTO{
+				{Value: "GMBU", Label: "General Markets", Active: true},
+				{Value: "K12", Label: "K-12", Active: true},
+				{Value: "IBU", Label: "International", Active: false},
+			}})
+			definitions, err := service.LoadFromPicklist()
+			Convey("Then inactive values should be deprecated", func() {
+				So(err, ShouldBeNil)
+				So(len(definitions), ShouldEqual, 3)
+				So(entities.BusinessUnit("K12").IsWritable(), ShouldBeTrue)
+				So(entities.IBU.IsDeprecated(), ShouldBeTrue)
+				So(entities.ECBU.IsValid(), ShouldBeFalse)
+			})
+			Convey("Then an account with a new business unit can be converted", func() {
+				dto := accountDTO
+				dto.BusinessUnit = "K12"
+				_, err := dto.toEntity()
+				So(err, ShouldBeNil)
+			})
+			Convey("Then an account can't be created with a deprecated business unit", func() {
+				dto := accountDTO
+				dto.BusinessUnit = "IBU"
+				_, _, err := accountService.CreateAccount(dto)
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When the picklist can't be loaded", func() {
+			service := NewBusinessUnitService(mockBusinessUnitRepository{err: errors.New("fake error")})
+			_, err := service.LoadFromPicklist()
+			Convey("Then an error should be returned and the registry unchanged", func() {
+				So(err, ShouldNotBeNil)
+				So(service.BusinessUnits(), ShouldResemble, defaults)
+			})
+		})
+		Convey("When the business units are loaded from configuration", func() {
+			config := `[{"value":"K12","aliases":["ECBU"]},{"value":"IBU","deprecated":true}]`
+			definitions, err := LoadBusinessUnitConfig(strings.NewReader(config))
+			Convey("Then aliases should resolve to their business unit", func() {
+				So(err, ShouldBeNil)
+				So(len(definitions), ShouldEqual, 2)
+				bu, _ := entities.ParseBusinessUnit("ECBU")
+				So(bu, ShouldEqual, entities.BusinessUnit("K12"))
+			})
+		})
+		Convey("When the configuration is invalid", func() {
+			_, err := LoadBusinessUnitConfig(strings.NewReader(`{"value":"K12"}`))
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			entities.SetBusinessUnits(defaults)
+		})
+	})
+}
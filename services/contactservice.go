@@ -12,7 +12,17 @@ type ContactRepository interface {
 	ContactQueryBuilder
 	GetContact(id string) (*ContactDTO, error)
 	QueryContacts(query string) ([]*ContactDTO, error)
-	UpdateContact(contact *ContactDTO) error
+	CreateContact(contact *entities.Contact) (string, error)
+	UpdateContact(contact *entities.Contact) error
+	DeleteContact(id string) error
+	GetDeletedContacts() ([]*ContactDTO, error)
+	UndeleteContact(id string) error
+}
+
+//ContactBulkRepository is an interface for writing many contacts at once. The
+//Row of each result is the index of the contact it's for.
+type ContactBulkRepository interface {
+	BulkUpsertContacts(contacts []*entities.Contact) ([]*BulkRowResult, error)
 }
 
 //ContactQueryBuilder is an interface for building Contact queries.
@@ -20,6 +30,7 @@ type ContactQueryBuilder interface {
 	GetByAuthID(id string) (string, error)
 	GetByEmail(email string) (string, error)
 	GetByIDs(ids []string) (string, error)
+	GetByAccountID(accountID string) (string, error)
 }
 
 //ContactDTO is a data transfer object for entities.Contact
@@ -42,6 +53,9 @@ type ContactDTO struct {
 	BBAuthEmail     string               `json:"bbAuthEmail,omitempty" force:"BBAuth_Email__c,omitempty"`
 	BBAuthFirstName string               `json:"bbAuthFirstName,omitempty" force:"BBAuth_First_Name__c,omitempty"`
 	BBAuthLastName  string               `json:"bbAuthLastName,omitempty" force:"BBAuth_Last_Name__c,omitempty"`
+	//Clear names the fields, by their JSON names, that an update clears. Empty
+	//fields are otherwise left unchanged.
+	Clear []string `json:"clear,omitempty" force:"-"`
 }
 
 //ContactRolesWrapper wraps a slice of ContactRoleDTO pointers so that the SFDC
@@ -68,38 +82,78 @@ func (c *ContactRoleDTO) ToEntity() (*entities.ContactRole, error) {
 	return role, nil
 }
 
-//ToEntity converts a ContactDTO into a Contact entity.
+//ToEntity converts a ContactDTO into a Contact entity. Every invalid field,
+//including those of the nested account, is reported in a single
+//*entities.ValidationError.
 func (c *ContactDTO) ToEntity() (*entities.Contact, error) {
-	if c.Account == nil {
-		return nil, errors.New("Nil value passed as AccountDTO")
-	}
+	return c.toEntity(false)
+}
 
-	account, err := c.Account.toEntity()
+//loadEntity converts a ContactDTO read from the data store into a Contact
+//entity. Unlike ToEntity, values that were stored without being validated,
+//like phone numbers and statuses added to the picklist in SFDC, are kept as
+//they are instead of failing the load.
+func (c *ContactDTO) loadEntity() (*entities.Contact, error) {
+	return c.toEntity(true)
+}
 
-	if err != nil {
-		return nil, errors.New("Failed to convert AccountDTO to account")
+func (c *ContactDTO) toEntity(stored bool) (*entities.Contact, error) {
+	errs := &entities.ValidationError{}
+
+	var account *entities.Account
+	if c.Account == nil {
+		errs.Add("account", entities.ErrCodeRequired, "Nil value passed as AccountDTO")
+	} else {
+		// an invalid account is still returned so the contact can be validated
+		a, err := c.Account.toEntity()
+		errs.Merge("account", err)
+		account = a
 	}
 
 	name, err := entities.BuildName(c.Salutation, c.FirstName, c.LastName)
+	errs.Merge("", err)
 
+	// Salesforce returns the ISO code, but display labels are still accepted
+	currency := entities.CurrencyType(c.Currency)
+	if c.Currency != "" {
+		if parsed, err := entities.ParseCurrency(c.Currency); err == nil {
+			currency = parsed
+		}
+	}
+
+	contact, err := entities.NewContact(name, account, currency)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to build name: %s", err)
+		errs.Merge("", err)
+		contact = &entities.Contact{}
+		contact.SetAccount(account)
 	}
 
-	contact, err := entities.NewContact(name, account, entities.CurrencyType(c.Currency))
+	errs.Merge("", contact.SetEmail(c.Email))
+	if stored {
+		contact.LoadPhone(c.Phone)
+		contact.LoadFax(c.Fax)
+	} else {
+		errs.Merge("", contact.SetPhone(c.Phone))
+		errs.Merge("", contact.SetFax(c.Fax))
+	}
 
-	if err != nil {
-		return contact,
-			fmt.Errorf("Error converting to contact Entity: %v", err.Error())
+	status, err := entities.ParseContactStatus(c.Status)
+	if err != nil && !stored {
+		errs.Add("status", entities.ErrCodeInvalid, err.Error())
+	}
+
+	if errs.HasErrors() {
+		return nil, errs
 	}
 
-	contact.Phone = c.Phone
-	contact.Fax = c.Fax
 	contact.Title = c.Title
 	contact.SetID(c.SalesForceID)
 	contact.SetDefaultAccount(c.DefaultAccount)
-	contact.SetEmail(c.Email)
-	contact.SetStatus(c.Status)
+	if stored {
+		contact.LoadStatus(c.Status)
+	} else {
+		contact.SetStatus(status)
+	}
 	contact.SetBBAuthID(c.BBAuthID)
 	contact.SetBBAuthEmail(c.BBAuthEmail)
 	contact.SetBBAuthFirstName(c.BBAuthFirstName)
@@ -116,7 +170,116 @@ func (c *ContactDTO) ToEntity() (*entities.Contact, error) {
 		contact.SetRoles(roles)
 	}
 
-	return contact, err
+	return contact, nil
+}
+
+//applyTo copies the non-empty fields of the DTO onto the contact, then clears
+//the fields named in Clear. The account and roles of the contact can't be
+//changed this way.
+func (c *ContactDTO) applyTo(contact *entities.Contact) error {
+	errs := &entities.ValidationError{}
+
+	if contact.Name == nil {
+		contact.Name = &entities.Name{}
+	}
+	if c.Salutation != "" {
+		contact.Name.Salutation = c.Salutation
+	}
+	if c.FirstName != "" {
+		contact.Name.FirstName = c.FirstName
+	}
+	if c.LastName != "" {
+		errs.Merge("", contact.Name.SetLastName(c.LastName))
+	}
+	if c.Title != "" {
+		contact.Title = c.Title
+	}
+	if c.Email != "" {
+		errs.Merge("", contact.SetEmail(c.Email))
+	}
+	if c.Phone != "" {
+		errs.Merge("", contact.SetPhone(c.Phone))
+	}
+	if c.Fax != "" {
+		errs.Merge("", contact.SetFax(c.Fax))
+	}
+
+	if c.Currency != "" {
+		currency, err := entities.ParseCurrency(c.Currency)
+		if err != nil {
+			errs.Add("currency", entities.ErrCodeInvalid, err.Error())
+		} else {
+			contact.Currency = currency
+		}
+	}
+
+	if c.Status != "" {
+		status, err := entities.ParseContactStatus(c.Status)
+		if err != nil {
+			errs.Add("status", entities.ErrCodeInvalid, err.Error())
+		} else {
+			errs.Merge("", contact.SetStatus(status))
+		}
+	}
+
+	if c.DefaultAccount != "" {
+		contact.SetDefaultAccount(c.DefaultAccount)
+	}
+	if c.BBAuthID != "" {
+		contact.SetBBAuthID(c.BBAuthID)
+	}
+	if c.BBAuthEmail != "" {
+		contact.SetBBAuthEmail(c.BBAuthEmail)
+	}
+	if c.BBAuthFirstName != "" {
+		contact.SetBBAuthFirstName(c.BBAuthFirstName)
+	}
+	if c.BBAuthLastName != "" {
+		contact.SetBBAuthLastName(c.BBAuthLastName)
+	}
+
+	for _, field := range c.Clear {
+		errs.Merge("", clearContactField(contact, field))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+//clearContactField clears the field of a contact with the given JSON name.
+//Required fields, the status and the account can't be cleared.
+func clearContactField(contact *entities.Contact, field string) error {
+	errs := &entities.ValidationError{}
+
+	switch field {
+	case "salutation":
+		contact.Name.Salutation = ""
+	case "firstName":
+		contact.Name.FirstName = ""
+	case "title":
+		contact.Title = ""
+	case "email":
+		contact.SetEmail("")
+	case "phone":
+		contact.SetPhone("")
+	case "fax":
+		contact.SetFax("")
+	case "defaultAccount":
+		contact.SetDefaultAccount("")
+	case "bbAuthId":
+		contact.SetBBAuthID("")
+	case "bbAuthEmail":
+		contact.SetBBAuthEmail("")
+	case "bbAuthFirstName":
+		contact.SetBBAuthFirstName("")
+	case "bbAuthLastName":
+		contact.SetBBAuthLastName("")
+	case "lastName", "currency", "account":
+		errs.Add(field, entities.ErrCodeRequired, fmt.Sprintf("%s is required and can't be cleared", field))
+	default:
+		errs.Add(field, entities.ErrCodeInvalid, fmt.Sprintf("%s can't be cleared", field))
+	}
+
+	return errs.ErrorOrNil()
 }
 
 //ContactRoleToContactRoleDTO converts a ContactRole entitiy into a ContactRoleDTO.
@@ -139,12 +302,13 @@ func ConvertContactEntityToContactDTO(contact *entities.Contact) *ContactDTO {
 		LastName:        contact.Name.LastName(),
 		SalesForceID:    contact.ID(),
 		Email:           contact.Email(),
-		Phone:           contact.Phone,
-		Fax:             contact.Fax,
+		Phone:           contact.Phone().String(),
+		Fax:             contact.Fax().String(),
 		Title:           contact.Title,
 		Account:         ConvertAccountEntityToAccountDTO(contact.Account()),
+		Currency:        string(contact.Currency),
 		DefaultAccount:  contact.DefaultAccount(),
-		Status:          contact.Status(),
+		Status:          contact.Status().PicklistValue(),
 		BBAuthID:        contact.BBAuthID(),
 		BBAuthEmail:     contact.BBAuthEmail(),
 		BBAuthFirstName: contact.BBAuthFirstName(),
@@ -161,9 +325,26 @@ func ConvertContactEntityToContactDTO(contact *entities.Contact) *ContactDTO {
 	return dto
 }
 
-//ContactService provides interaction with Contact data.
+//ContactService provides interaction with Contact data. BulkRepo is only
+//needed for bulk upserts.
+//Contacts are checked for duplicates at their account when they're created,
+//and when they're updated if the DuplicatePolicy is DuplicatesBlock. A nil
+//Matcher uses NewDuplicateMatcher.
 type ContactService struct {
-	ContactRepo ContactRepository
+	ContactRepo     ContactRepository
+	BulkRepo        ContactBulkRepository
+	Matcher         *DuplicateMatcher
+	DuplicatePolicy DuplicatePolicy
+}
+
+//CreateContactResult is the outcome of CreateContact. ID is the new contact
+//when Created is set, or the existing contact it was linked to when Linked is
+//set. Duplicates are the likely duplicates of the contact, best match first.
+type CreateContactResult struct {
+	ID         string            `json:"id"`
+	Created    bool              `json:"created"`
+	Linked     bool              `json:"linked"`
+	Duplicates []*DuplicateMatch `json:"duplicates,omitempty"`
 }
 
 //NewContactService returns a pointer to a valid ContactService given a
@@ -224,14 +405,250 @@ func (cs *ContactService) QueryContacts(query string) ([]*ContactDTO, error) {
 	return contacts, err
 }
 
-//UpdateContact updates a contact..
-func (cs *ContactService) UpdateContact(contactDTO *ContactDTO) error {
+//BulkUpsert creates or updates many contacts at once. Contacts with a
+//SalesForceID are updated and the others are created. Every contact is
+//validated first and only the valid ones are sent to the data store. The
+//report has a result for every contact; an error is only returned if the bulk
+//operation as a whole failed.
+func (cs *ContactService) BulkUpsert(contacts []ContactDTO) (*BulkReport, error) {
+	if cs.BulkRepo == nil {
+		return nil, errors.New("A ContactBulkRepository is required for bulk upserts")
+	}
+
+	report := newBulkReport(len(contacts))
+	valid := []*entities.Contact{}
+	sent := []int{}
+
+	for i, c := range contacts {
+		contact, err := c.ToEntity()
+		if err == nil {
+			err = contact.ValidateWrite()
+		}
+		if err != nil {
+			report.invalid(i, err)
+			continue
+		}
+
+		valid = append(valid, contact)
+		sent = append(sent, i)
+	}
+
+	if len(valid) == 0 {
+		return report, nil
+	}
+
+	results, err := cs.BulkRepo.BulkUpsertContacts(valid)
+	report.record(sent, results)
+	return report, err
+}
+
+//Activate moves the contact with the given SFDC ID to the Active status.
+func (cs *ContactService) Activate(id string) error {
+	return cs.transitionStatus(id, entities.ContactStatusActive)
+}
+
+//Deactivate moves the contact with the given SFDC ID to the Inactive status.
+func (cs *ContactService) Deactivate(id string) error {
+	return cs.transitionStatus(id, entities.ContactStatusInactive)
+}
+
+//transitionStatus loads a contact with its account, moves it to the next
+//status if the contact's current status allows it, and saves it.
+func (cs *ContactService) transitionStatus(id string, next entities.ContactStatus) error {
+	dto, err := queryContact(cs.ContactRepo, id)
+	if err != nil {
+		return err
+	}
+
+	contact, err := dto.loadEntity()
+	if err != nil {
+		return err
+	}
+	contact.MarkClean()
+
+	err = contact.TransitionStatus(next)
+	if err != nil {
+		return err
+	}
+
+	return cs.ContactRepo.UpdateContact(contact)
+}
+
+//DeleteContact moves the contact with the given SFDC ID to the recycle bin.
+//Unless force is set, an Active contact isn't deleted and a
+//*DeleteRefusedError is returned; deactivate it first.
+func (cs *ContactService) DeleteContact(id string, force bool) error {
+	if !force {
+		contact, err := cs.ContactRepo.GetContact(id)
+		if err != nil {
+			return fmt.Errorf("Error getting contact to delete: %s", err)
+		}
+		if status, _ := entities.ParseContactStatus(contact.Status); status == entities.ContactStatusActive {
+			return &DeleteRefusedError{ID: id, Reason: "the contact is active"}
+		}
+	}
+
+	return cs.ContactRepo.DeleteContact(id)
+}
+
+//GetDeletedContacts returns the contacts in the recycle bin.
+func (cs *ContactService) GetDeletedContacts() ([]*ContactDTO, error) {
+	contacts, err := cs.ContactRepo.GetDeletedContacts()
+
+	return contacts, err
+}
+
+//UndeleteContact restores the contact with the given SFDC ID from the recycle
+//bin.
+func (cs *ContactService) UndeleteContact(id string) error {
+	return cs.ContactRepo.UndeleteContact(id)
+}
+
+//FindDuplicates returns the contacts of the contact's account that are likely
+//the same person, best match first. The account must have an SFDC ID.
+func (cs *ContactService) FindDuplicates(contactDTO *ContactDTO) ([]*DuplicateMatch, error) {
+	if contactDTO.Account == nil || contactDTO.Account.SalesForceID == "" {
+		return nil, errors.New("An account SFDC ID is required to find duplicate contacts")
+	}
+
+	query, err := cs.ContactRepo.GetByAccountID(contactDTO.Account.SalesForceID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := cs.ContactRepo.QueryContacts(query)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying duplicate contacts: %s", err)
+	}
+
+	matcher := cs.Matcher
+	if matcher == nil {
+		matcher = NewDuplicateMatcher()
+	}
+	return matcher.Matches(contactDTO, candidates), nil
+}
+
+//CreateContact creates a contact of an existing account. The account's contacts
+//are checked for duplicates of it first, and when there are any the
+//DuplicatePolicy decides whether the contact is created anyway, refused with a
+//*DuplicateContactError, or linked to the best match instead.
+func (cs *ContactService) CreateContact(contactDTO *ContactDTO) (*CreateContactResult, error) {
 	contact, err := contactDTO.ToEntity()
+	if err != nil {
+		return nil, err
+	}
+
+	err = contact.ValidateWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := cs.FindDuplicates(contactDTO)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CreateContactResult{Duplicates: matches}
+	if len(matches) > 0 {
+		switch cs.DuplicatePolicy {
+		case DuplicatesBlock:
+			return result, &DuplicateContactError{Matches: matches}
+		case DuplicatesLink:
+			result.ID = matches[0].Contact.SalesForceID
+			result.Linked = true
+			return result, nil
+		}
+	}
 
+	result.ID, err = cs.ContactRepo.CreateContact(contact)
 	if err != nil {
+		return nil, err
+	}
+	result.Created = true
+	return result, nil
+}
+
+//UpdateContact updates a contact. The current contact is loaded by its SFDC ID
+//and the non-empty fields of the DTO are applied to it, so only the fields
+//that actually change are sent to the data store. The DTO therefore only needs
+//the SalesForceID, the fields being changed and, in Clear, the fields being
+//cleared. A *NotFoundError is returned when there's no such contact.
+func (cs *ContactService) UpdateContact(contactDTO *ContactDTO) error {
+	current, err := queryContact(cs.ContactRepo, contactDTO.SalesForceID)
+	if _, ok := err.(*NotFoundError); ok {
 		return err
 	}
+	if err != nil {
+		return fmt.Errorf("Error getting contact to update: %s", err)
+	}
+
+	contact, err := current.loadEntity()
+	if err != nil {
+		return fmt.Errorf("Error converting current contact: %s", err)
+	}
+	contact.MarkClean()
+
+	err = contactDTO.applyTo(contact)
+	if err != nil {
+		return err
+	}
+
+	err = contact.ValidateWrite()
+	if err != nil {
+		return err
+	}
+
+	if len(contact.ModifiedFields()) == 0 {
+		return nil
+	}
 
-	err = cs.ContactRepo.UpdateContact(ConvertContactEntityToContactDTO(contact))
+	if cs.DuplicatePolicy == DuplicatesBlock && duplicateFieldsModified(contact) {
+		updated := ConvertContactEntityToContactDTO(contact)
+		updated.Account = current.Account
+		matches, err := cs.FindDuplicates(updated)
+		if err != nil {
+			return err
+		}
+		if len(matches) > 0 {
+			return &DuplicateContactError{Matches: matches}
+		}
+	}
+
+	err = cs.ContactRepo.UpdateContact(contact)
 	return err
 }
+
+//queryContact reads a contact by its SFDC ID with a query, which unlike
+//GetContact also reads the contact's account and roles. A *NotFoundError is
+//returned when there's no such contact.
+func queryContact(repo ContactRepository, id string) (*ContactDTO, error) {
+	if id == "" {
+		return nil, errors.New("An SFDC ID is required to get a contact")
+	}
+
+	query, err := repo.GetByIDs([]string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	contacts, err := repo.QueryContacts(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(contacts) == 0 {
+		return nil, &NotFoundError{Resource: "Contact", ID: id}
+	}
+	return contacts[0], nil
+}
+
+//duplicateFieldsModified reports whether a field that duplicates are matched
+//by has changed.
+func duplicateFieldsModified(contact *entities.Contact) bool {
+	for _, field := range contact.ModifiedFields() {
+		switch field {
+		case "salutation", "firstName", "lastName", "email", "phone":
+			return true
+		}
+	}
+	return false
+}
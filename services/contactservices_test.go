@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
@@ -32,16 +33,51 @@ type mockContactRepository struct {
 }
 
 func (m mockContactRepository) GetContact(id string) (*ContactDTO, error) {
+	if id == "003d0000026MOlUMRG" {
+		merged := contactDTO
+		merged.SalesForceID = id
+		merged.Status = "Merged"
+		return &merged, nil
+	}
+	if id == legacyContactID {
+		legacy := contactDTO
+		legacy.SalesForceID = id
+		legacy.Phone = "654-2566"
+		legacy.Currency = "CHF"
+		legacy.Status = "On Leave"
+		return &legacy, nil
+	}
 	if len(id) > 0 {
 		return &contactDTO, nil
 	}
 	return nil, errors.New("An ID must be provided to get a contact")
 }
 
+// legacyContactID is a contact stored before its values were validated
+const legacyContactID = "003d0000026MOlULGC"
+
 func (m mockContactRepository) QueryContacts(query string) ([]*ContactDTO, error) {
 	var contacts []*ContactDTO
 	err := errors.New("Bad query")
 
+	if query == "account:"+accountDTO.SalesForceID {
+		return accountContacts, nil
+	}
+
+	if strings.HasPrefix(query, "ids:") {
+		for _, id := range strings.Split(strings.TrimPrefix(query, "ids:"), ",") {
+			if id == missingContactID {
+				continue
+			}
+			contact, err := m.GetContact(id)
+			if err != nil {
+				return nil, err
+			}
+			contacts = append(contacts, contact)
+		}
+		return contacts, nil
+	}
+
 	if query == "success!" {
 		contacts = append(contacts, &contactDTO)
 		err = nil
@@ -50,7 +86,38 @@ func (m mockContactRepository) QueryContacts(query string) ([]*ContactDTO, error
 	return contacts, err
 }
 
-func (m mockContactRepository) UpdateContact(contact *ContactDTO) error {
+// updatedContact records the last contact handed to UpdateContact
+var updatedContact *entities.Contact
+
+// createdContact records the last contact handed to CreateContact
+var createdContact *entities.Contact
+
+func (m mockContactRepository) CreateContact(contact *entities.Contact) (string, error) {
+	createdContact = contact
+	return "003d000001NEWCONAAB", nil
+}
+
+func (m mockContactRepository) UpdateContact(contact *entities.Contact) error {
+	updatedContact = contact
+	return nil
+}
+
+// deletedContactID records the id of the last contact handed to DeleteContact
+var deletedContactID string
+
+func (m mockContactRepository) DeleteContact(id string) error {
+	deletedContactID = id
+	return nil
+}
+
+func (m mockContactRepository) GetDeletedContacts() ([]*ContactDTO, error) {
+	return []*ContactDTO{{LastName: "Deleted", SalesForceID: "003d000001DELETED"}}, nil
+}
+
+func (m mockContactRepository) UndeleteContact(id string) error {
+	if id == "" {
+		return errors.New("An ID must be provided to undelete a contact")
+	}
 	return nil
 }
 
@@ -70,9 +137,29 @@ func (m mockContactRepository) GetByEmail(email string) (string, error) {
 	return "", errors.New("Must provide a valid email address")
 }
 
+// accountContacts are the contacts of accountDTO, the candidate duplicates of
+// its new contacts
+var accountContacts = []*ContactDTO{
+	{SalesForceID: "003d000001ROBERTAA", FirstName: "Robert", LastName: "Smith", Email: "RSmith@Example.com",
+		Phone: "843-654-2000", Account: &accountDTO},
+	{SalesForceID: "003d000001JANEDOAA", FirstName: "Jane", LastName: "Doe", Email: "jane.doe@example.com",
+		Account: &accountDTO},
+}
+
+func (m mockContactRepository) GetByAccountID(accountID string) (string, error) {
+	if len(accountID) > 0 {
+		return "account:" + accountID, nil
+	}
+
+	return "", errors.New("Must provide an account ID")
+}
+
+// missingContactID is a contact that queries don't find
+const missingContactID = "003d000001MISSINGA"
+
 func (m mockContactRepository) GetByIDs(ids []string) (string, error) {
 	if len(ids) > 0 {
-		return "success!", nil
+		return "ids:" + strings.Join(ids, ","), nil
 	}
 
 	return "", errors.New("Must provide a slice of IDs")
@@ -109,6 +196,56 @@ func TestContactDTOToEntity(t *testing.T) {
 			})
 		})
 	})
+	Convey("Given a Contact Data Transfer object with an invalid email", t, func() {
+		contactDTOCopy := contactDTO
+		contactDTOCopy.Email = "erik.tate@blackbaud"
+		Convey("When attempting to convert to a Contact entity", func() {
+			_, err := contactDTOCopy.ToEntity()
+			Convey("An error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a Contact Data Transfer object with an invalid phone number", t, func() {
+		contactDTOCopy := contactDTO
+		contactDTOCopy.Phone = "654-2566"
+		Convey("When attempting to convert to a Contact entity", func() {
+			_, err := contactDTOCopy.ToEntity()
+			Convey("An error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a Contact Data Transfer object with an unknown status", t, func() {
+		contactDTOCopy := contactDTO
+		contactDTOCopy.Status = "Retired"
+		Convey("When attempting to convert to a Contact entity", func() {
+			_, err := contactDTOCopy.ToEntity()
+			Convey("An error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given a Contact Data Transfer object with invalid contact and account fields", t, func() {
+		contactDTOCopy := contactDTO
+		accountDTOCopy := accountDTO
+		accountDTOCopy.Name = ""
+		contactDTOCopy.Account = &accountDTOCopy
+		contactDTOCopy.LastName = ""
+		contactDTOCopy.Email = "not an email"
+		Convey("When attempting to convert to a Contact entity", func() {
+			_, err := contactDTOCopy.ToEntity()
+			Convey("Then every invalid field should be reported", func() {
+				verr, ok := err.(*entities.ValidationError)
+				So(ok, ShouldBeTrue)
+				fields := []string{}
+				for _, e := range verr.Errors {
+					fields = append(fields, e.Field)
+				}
+				So(fields, ShouldResemble, []string{"account.name", "lastName", "email"})
+			})
+		})
+	})
 	Convey("Given a valid Contact Data Transfer object", t, func() {
 		contactDTOCopy := contactDTO
 		Convey("When attempting to convert to a Contact entity", func() {
@@ -117,6 +254,10 @@ func TestContactDTOToEntity(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(contact, ShouldNotBeNil)
 			})
+			Convey("And the phone number should be parsed", func() {
+				So(contact.Phone().E164(), ShouldEqual, "+18436542566")
+				So(contact.Phone().String(), ShouldEqual, contactDTOCopy.Phone)
+			})
 		})
 	})
 }
@@ -129,6 +270,9 @@ func TestConvertContactEntityToContactDTO(t *testing.T) {
 			Convey("Then a ContactDTO should be returned", func() {
 				So(convertedContactDTO, ShouldNotBeNil)
 			})
+			Convey("And the currency should be the ISO code", func() {
+				So(convertedContactDTO.Currency, ShouldEqual, "USD")
+			})
 		})
 	})
 }
@@ -289,4 +433,343 @@ func TestUpdateContact(t *testing.T) {
 			})
 		})
 	})
+	Convey("Given a contact DTO of a contact that doesn't exist", t, func() {
+		dto := ContactDTO{SalesForceID: missingContactID, Title: "Senior Developer"}
+		Convey("When an update is attempted", func() {
+			err := NewContactService(mockContactRepository{}).UpdateContact(&dto)
+			Convey("Then a not found error should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+			})
+		})
+	})
+	Convey("Given a contact DTO with a changed title and reformatted phone number", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, LastName: "Tate",
+			Title: "Senior Developer", Phone: "843.654.2566"}
+		Convey("When an update is attempted", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then only the title should be sent as modified", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.ModifiedFields(), ShouldResemble, []string{"title"})
+			})
+		})
+	})
+	Convey("Given a stored contact with a phone number that isn't valid", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: legacyContactID, Title: "Senior Developer"}
+		Convey("When another field is updated", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then the stored phone number should be kept as it is", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.ModifiedFields(), ShouldResemble, []string{"title"})
+				So(updatedContact.Phone().String(), ShouldEqual, "654-2566")
+			})
+		})
+		Convey("When the contact is deactivated", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.Deactivate(legacyContactID)
+			Convey("Then the unknown status and currency that isn't enabled should not stop it", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.Status(), ShouldEqual, entities.ContactStatusInactive)
+				So(updatedContact.Currency, ShouldEqual, entities.CurrencyType("CHF"))
+			})
+		})
+		Convey("When the phone number is replaced with one that isn't valid", func() {
+			dto.Phone = "555-2566"
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then a validation error should occur", func() {
+				So(err, ShouldHaveSameTypeAs, &entities.ValidationError{})
+			})
+		})
+	})
+	Convey("Given a contact DTO that clears the title and fax", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, Clear: []string{"title", "fax"}}
+		Convey("When an update is attempted", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then the fields should be cleared and modified", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.ModifiedFields(), ShouldResemble, []string{"fax", "title"})
+				So(updatedContact.Title, ShouldBeEmpty)
+				So(updatedContact.Fax().IsZero(), ShouldBeTrue)
+			})
+		})
+	})
+	Convey("Given a contact DTO that clears a required field", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, Clear: []string{"lastName"}}
+		Convey("When an update is attempted", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then the field should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &entities.ValidationError{})
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+	})
+	Convey("Given a contact DTO with a currency that isn't enabled", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, Currency: "CHF"}
+		Convey("When an update is attempted", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then the currency should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+	})
+	Convey("Given a contact DTO without changes", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, LastName: contactDTO.LastName}
+		Convey("When an update is attempted", func() {
+			cs := NewContactService(mockContactRepository{})
+			err := cs.UpdateContact(&dto)
+			Convey("Then nothing should be sent to the repository", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestActivateAndDeactivateContact(t *testing.T) {
+	Convey("Given an active contact", t, func() {
+		cs := NewContactService(mockContactRepository{})
+		id := contactDTO.SalesForceID
+		Convey("When the contact is deactivated", func() {
+			updatedContact = nil
+			err := cs.Deactivate(id)
+			Convey("Then the inactive contact should be saved", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.Status(), ShouldEqual, entities.ContactStatusInactive)
+				So(updatedContact.ModifiedFields(), ShouldResemble, []string{"status"})
+			})
+		})
+		Convey("When the contact is activated", func() {
+			updatedContact = nil
+			err := cs.Activate(id)
+			Convey("Then the contact should be saved unchanged", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.Status(), ShouldEqual, entities.ContactStatusActive)
+				So(updatedContact.ModifiedFields(), ShouldBeEmpty)
+			})
+		})
+	})
+	Convey("Given a merged contact", t, func() {
+		cs := NewContactService(mockContactRepository{})
+		id := "003d0000026MOlUMRG"
+		updatedContact = nil
+		Convey("When the contact is activated", func() {
+			err := cs.Activate(id)
+			Convey("Then the transition should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+		Convey("When the contact is deactivated", func() {
+			err := cs.Deactivate(id)
+			Convey("Then the transition should be refused", func() {
+				So(err, ShouldNotBeNil)
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+	})
+	Convey("Given a repository that reads a contact by its ID without its account", t, func() {
+		cs := NewContactService(accountlessContactRepository{})
+		updatedContact = nil
+		Convey("When the contact is deactivated", func() {
+			err := cs.Deactivate(contactDTO.SalesForceID)
+			Convey("Then the contact should be loaded with its account and saved", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact.Status(), ShouldEqual, entities.ContactStatusInactive)
+				So(updatedContact.Account().ID(), ShouldEqual, accountDTO.SalesForceID)
+			})
+		})
+	})
+	Convey("Given a contact that can't be found", t, func() {
+		cs := NewContactService(mockContactRepository{})
+		Convey("When the contact is activated", func() {
+			err := cs.Activate("")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When a contact that doesn't exist is deactivated", func() {
+			err := cs.Deactivate(missingContactID)
+			Convey("Then a NotFoundError should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+			})
+		})
+	})
+}
+
+// accountlessContactRepository reads a contact by its ID without its account,
+// the way the SFDC repository does; queries still include it
+type accountlessContactRepository struct {
+	mockContactRepository
+}
+
+func (m accountlessContactRepository) GetContact(id string) (*ContactDTO, error) {
+	contact, err := m.mockContactRepository.GetContact(id)
+	if err != nil {
+		return nil, err
+	}
+	accountless := *contact
+	accountless.Account = nil
+	return &accountless, nil
+}
+
+func TestContactBulkUpsert(t *testing.T) {
+	Convey("Given contacts to import", t, func() {
+		service := ContactService{ContactRepo: mockContactRepository{}, BulkRepo: mockBulkRepository{}}
+		newContact := contactDTO
+		newContact.SalesForceID = ""
+		noAccount := contactDTO
+		noAccount.Account = nil
+		contacts := []ContactDTO{noAccount, contactDTO, newContact}
+
+		Convey("When they're upserted in bulk", func() {
+			report, err := service.BulkUpsert(contacts)
+			Convey("Then the valid contacts should be updated or created", func() {
+				So(err, ShouldBeNil)
+				So(report.Results[1].Success, ShouldBeTrue)
+				So(report.Results[1].ID, ShouldEqual, "003d0000026MOlUAAW")
+				So(report.Results[2].Created, ShouldBeTrue)
+			})
+			Convey("Then invalid contacts should be reported without being sent", func() {
+				So(report.Results[0].Success, ShouldBeFalse)
+				So(report.Results[0].Error, ShouldContainSubstring, "account")
+			})
+		})
+	})
+}
+
+func TestDeleteContact(t *testing.T) {
+	Convey("Given a ContactService", t, func() {
+		Convey("When an active contact is deleted", func() {
+			err := contactService.DeleteContact(contactDTO.SalesForceID, false)
+			Convey("Then the delete should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &DeleteRefusedError{})
+				So(deletedContactID, ShouldBeEmpty)
+			})
+		})
+		Convey("When an active contact is deleted with force", func() {
+			err := contactService.DeleteContact(contactDTO.SalesForceID, true)
+			Convey("Then the contact should be deleted", func() {
+				So(err, ShouldBeNil)
+				So(deletedContactID, ShouldEqual, contactDTO.SalesForceID)
+			})
+		})
+		Convey("When a contact that isn't active is deleted", func() {
+			err := contactService.DeleteContact("003d0000026MOlUMRG", false)
+			Convey("Then the contact should be deleted", func() {
+				So(err, ShouldBeNil)
+				So(deletedContactID, ShouldEqual, "003d0000026MOlUMRG")
+			})
+		})
+		Convey("When the deleted contacts are requested", func() {
+			contacts, err := contactService.GetDeletedContacts()
+			Convey("Then the contacts in the recycle bin should be returned", func() {
+				So(err, ShouldBeNil)
+				So(contacts[0].SalesForceID, ShouldEqual, "003d000001DELETED")
+			})
+		})
+
+		Reset(func() {
+			deletedContactID = ""
+		})
+	})
+}
+
+func TestCreateContact(t *testing.T) {
+	Convey("Given a new contact that duplicates a contact of its account", t, func() {
+		createdContact = nil
+		dto := &ContactDTO{FirstName: "Bob", LastName: "Smith", Email: "rsmith+support@example.com",
+			Account: &accountDTO, Currency: "USD"}
+		cs := NewContactService(mockContactRepository{})
+
+		Convey("When the duplicate policy is to warn", func() {
+			result, err := cs.CreateContact(dto)
+			Convey("Then the contact should be created and the duplicate returned", func() {
+				So(err, ShouldBeNil)
+				So(result.Created, ShouldBeTrue)
+				So(result.ID, ShouldEqual, "003d000001NEWCONAAB")
+				So(len(result.Duplicates), ShouldEqual, 1)
+				So(result.Duplicates[0].Contact.SalesForceID, ShouldEqual, "003d000001ROBERTAA")
+				So(createdContact, ShouldNotBeNil)
+			})
+		})
+		Convey("When the duplicate policy is to block", func() {
+			cs.DuplicatePolicy = DuplicatesBlock
+			result, err := cs.CreateContact(dto)
+			Convey("Then the contact should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &DuplicateContactError{})
+				So(result.Created, ShouldBeFalse)
+				So(createdContact, ShouldBeNil)
+			})
+		})
+		Convey("When the duplicate policy is to link", func() {
+			cs.DuplicatePolicy = DuplicatesLink
+			result, err := cs.CreateContact(dto)
+			Convey("Then the existing contact should be returned instead", func() {
+				So(err, ShouldBeNil)
+				So(result.Linked, ShouldBeTrue)
+				So(result.ID, ShouldEqual, "003d000001ROBERTAA")
+				So(createdContact, ShouldBeNil)
+			})
+		})
+	})
+	Convey("Given a new contact without duplicates", t, func() {
+		createdContact = nil
+		dto := &ContactDTO{FirstName: "Erik", LastName: "Tate", Email: "erik.tate@example.com",
+			Account: &accountDTO, Currency: "USD"}
+		cs := ContactService{ContactRepo: mockContactRepository{}, DuplicatePolicy: DuplicatesBlock}
+		Convey("When the contact is created", func() {
+			result, err := cs.CreateContact(dto)
+			Convey("Then it should be created", func() {
+				So(err, ShouldBeNil)
+				So(result.Created, ShouldBeTrue)
+				So(result.Duplicates, ShouldBeEmpty)
+			})
+		})
+	})
+	Convey("Given a new contact without an account SFDC ID", t, func() {
+		account := accountDTO
+		account.SalesForceID = ""
+		dto := &ContactDTO{FirstName: "Erik", LastName: "Tate", Account: &account, Currency: "USD"}
+		Convey("When the contact is created", func() {
+			_, err := NewContactService(mockContactRepository{}).CreateContact(dto)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestUpdateContactDuplicates(t *testing.T) {
+	Convey("Given a contact renamed to duplicate another contact of its account", t, func() {
+		updatedContact = nil
+		dto := ContactDTO{SalesForceID: contactDTO.SalesForceID, FirstName: "Jane", LastName: "Doe",
+			Email: "Jane.Doe@example.com"}
+		Convey("When duplicates are blocked", func() {
+			cs := ContactService{ContactRepo: mockContactRepository{}, DuplicatePolicy: DuplicatesBlock}
+			err := cs.UpdateContact(&dto)
+			Convey("Then the update should be refused", func() {
+				So(err, ShouldHaveSameTypeAs, &DuplicateContactError{})
+				So(updatedContact, ShouldBeNil)
+			})
+		})
+		Convey("When duplicates are only warned about", func() {
+			err := NewContactService(mockContactRepository{}).UpdateContact(&dto)
+			Convey("Then the contact should be updated", func() {
+				So(err, ShouldBeNil)
+				So(updatedContact, ShouldNotBeNil)
+			})
+		})
+	})
 }
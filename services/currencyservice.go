@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//CurrencyRepository is an interface for accessing the currencies enabled for
+//the organization
+type CurrencyRepository interface {
+	GetActiveCurrencies() ([]string, error)
+}
+
+//CurrencyService provides interaction with the organization's currencies
+type CurrencyService struct {
+	CurrencyRepo CurrencyRepository
+}
+
+//NewCurrencyService returns a pointer to a CurrencyService instantiated with
+//the given CurrencyRepository.
+func NewCurrencyService(repo CurrencyRepository) *CurrencyService {
+	return &CurrencyService{CurrencyRepo: repo}
+}
+
+//LoadEnabledCurrencies reads the active currencies from the repository and
+//makes them the only currencies contacts can be written with. The enabled
+//currencies are left unchanged if any code isn't a known ISO 4217 currency.
+func (cs *CurrencyService) LoadEnabledCurrencies() ([]entities.CurrencyType, error) {
+	codes, err := cs.CurrencyRepo.GetActiveCurrencies()
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving active currencies: %s", err)
+	}
+
+	currencies := make([]entities.CurrencyType, len(codes))
+	for index, code := range codes {
+		currency, err := entities.ParseCurrency(code)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading active currencies: %s", err)
+		}
+		currencies[index] = currency
+	}
+
+	err = entities.SetEnabledCurrencies(currencies)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading active currencies: %s", err)
+	}
+
+	return currencies, nil
+}
+
+//EnabledCurrencies returns the currencies contacts can currently be created
+//with.
+func (cs *CurrencyService) EnabledCurrencies() []entities.CurrencyType {
+	return entities.EnabledCurrencies()
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+type mockCurrencyRepository struct {
+	codes []string
+	err   error
+}
+
+func (m mockCurrencyRepository) GetActiveCurrencies() ([]string, error) {
+	return m.codes, m.err
+}
+
+func TestLoadEnabledCurrencies(t *testing.T) {
+	Convey("Given the currencies enabled by default", t, func() {
+		defaults := entities.EnabledCurrencies()
+		Convey("When the active currencies are loaded from the repository", func() {
+			service := NewCurrencyService(mockCurrencyRepository{codes: []string{"USD", "CHF"}})
+			currencies, err := service.LoadEnabledCurrencies()
+			Convey("Then the active currencies should be enabled", func() {
+				So(err, ShouldBeNil)
+				So(currencies, ShouldResemble, []entities.CurrencyType{entities.USD, "CHF"})
+				So(service.EnabledCurrencies(), ShouldResemble, []entities.CurrencyType{"CHF", entities.USD})
+			})
+		})
+		Convey("When the repository returns an unknown currency", func() {
+			service := NewCurrencyService(mockCurrencyRepository{codes: []string{"USD", "ZZZ"}})
+			_, err := service.LoadEnabledCurrencies()
+			Convey("Then an error should be returned and the currencies unchanged", func() {
+				So(err, ShouldNotBeNil)
+				So(entities.EnabledCurrencies(), ShouldResemble, defaults)
+			})
+		})
+		Convey("When the repository fails", func() {
+			service := NewCurrencyService(mockCurrencyRepository{err: errors.New("fake error")})
+			_, err := service.LoadEnabledCurrencies()
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Reset(func() {
+			entities.SetEnabledCurrencies(defaults)
+		})
+	})
+}
@@ -0,0 +1,13 @@
+package services
+
+//DeleteRefusedError is returned when a record isn't deleted because other
+//records depend on it or it's still in use. Deleting it with force skips the
+//checks.
+type DeleteRefusedError struct {
+	ID     string
+	Reason string
+}
+
+func (e *DeleteRefusedError) Error() string {
+	return "Refused to delete " + e.ID + ": " + e.Reason + " (delete with force to delete it anyway)"
+}
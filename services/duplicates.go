@@ -0,0 +1,344 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//DefaultDuplicateThreshold is the score from which a candidate contact is
+//considered a duplicate.
+const DefaultDuplicateThreshold = 0.8
+
+//The weights of the signals of a duplicate score. Only the signals both
+//contacts have are weighted, so two contacts without phones are compared by
+//email and name alone.
+const (
+	emailWeight = 0.45
+	nameWeight  = 0.35
+	phoneWeight = 0.2
+)
+
+//matchingSignal is the signal score from which a signal is given as a reason
+//of a match.
+const matchingSignal = 0.9
+
+//DuplicatePolicy decides what CreateContact does when the new contact has
+//duplicates at its account.
+type DuplicatePolicy int
+
+const (
+	//DuplicatesWarn creates the contact and returns the duplicates with it.
+	DuplicatesWarn DuplicatePolicy = iota
+	//DuplicatesBlock refuses to create the contact.
+	DuplicatesBlock
+	//DuplicatesLink returns the best matching contact instead of creating one.
+	DuplicatesLink
+)
+
+//DuplicateMatch is a contact that is likely the same person as another, with
+//the score of the match and the signals that matched ("email", "name" or
+//"phone").
+type DuplicateMatch struct {
+	Contact *ContactDTO `json:"contact"`
+	Score   float64     `json:"score"`
+	Reasons []string    `json:"reasons"`
+}
+
+//DuplicateContactError is returned when a contact isn't written because it
+//duplicates existing contacts.
+type DuplicateContactError struct {
+	Matches []*DuplicateMatch
+}
+
+func (e *DuplicateContactError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, match := range e.Matches {
+		ids[i] = match.Contact.SalesForceID
+	}
+	return fmt.Sprintf("Contact duplicates existing contacts: %s", strings.Join(ids, ", "))
+}
+
+//DuplicateMatcher scores how likely two contacts are the same person by their
+//normalized emails, the similarity of their names and their phone numbers.
+//Salutations are ignored, except that conflicting ones (ex. Mr. and Mrs.)
+//lower the name score, and nicknames are compared as the names they're short
+//for.
+type DuplicateMatcher struct {
+	Threshold float64
+	//Nicknames maps lowercase nicknames to the names they're short for.
+	Nicknames map[string]string
+}
+
+//NewDuplicateMatcher returns a DuplicateMatcher with the default threshold and
+//common English nicknames.
+func NewDuplicateMatcher() *DuplicateMatcher {
+	return &DuplicateMatcher{Threshold: DefaultDuplicateThreshold, Nicknames: defaultNicknames}
+}
+
+var defaultNicknames = map[string]string{
+	"abby": "abigail", "al": "albert", "alex": "alexander", "andy": "andrew", "tony": "anthony",
+	"ben": "benjamin", "bob": "robert", "bobby": "robert", "rob": "robert", "robbie": "robert",
+	"bill": "william", "billy": "william", "will": "william", "liam": "william",
+	"cathy": "catherine", "kate": "katherine", "katie": "katherine", "kathy": "katherine",
+	"chris": "christopher", "chuck": "charles", "charlie": "charles", "dan": "daniel", "danny": "daniel",
+	"dave": "david", "deb": "deborah", "debbie": "deborah", "don": "donald", "ed": "edward", "eddie": "edward",
+	"beth": "elizabeth", "betty": "elizabeth", "liz": "elizabeth", "lizzie": "elizabeth",
+	"greg": "gregory", "jim": "james", "jimmy": "james", "jamie": "james", "jen": "jennifer", "jenny": "jennifer",
+	"jeff": "jeffrey", "joe": "joseph", "joey": "joseph", "jon": "jonathan", "johnny": "john", "jack": "john",
+	"josh": "joshua", "ken": "kenneth", "larry": "lawrence", "maggie": "margaret", "meg": "margaret",
+	"peggy": "margaret", "matt": "matthew", "mike": "michael", "mickey": "michael", "nick": "nicholas",
+	"pat": "patricia", "patty": "patricia", "pete": "peter", "rick": "richard", "dick": "richard",
+	"rich": "richard", "ron": "ronald", "sam": "samuel", "steve": "stephen", "sue": "susan", "susie": "susan",
+	"ted": "edward", "tom": "thomas", "tommy": "thomas", "vicky": "victoria", "zach": "zachary",
+}
+
+var (
+	salutations = map[string]bool{
+		"mr": true, "mrs": true, "ms": true, "miss": true, "mx": true, "dr": true, "prof": true, "rev": true,
+	}
+	nameSuffixes = map[string]bool{
+		"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true,
+	}
+	salutationGenders = map[string]string{"mr": "m", "mrs": "f", "ms": "f", "miss": "f"}
+)
+
+//Matches returns the candidates whose score against the contact reaches the
+//threshold, best match first. The contact itself is skipped when it's among
+//the candidates.
+func (m *DuplicateMatcher) Matches(contact *ContactDTO, candidates []*ContactDTO) []*DuplicateMatch {
+	matches := []*DuplicateMatch{}
+	for _, candidate := range candidates {
+		if contact.SalesForceID != "" && candidate.SalesForceID == contact.SalesForceID {
+			continue
+		}
+		score, reasons := m.Score(contact, candidate)
+		if score >= m.Threshold {
+			matches = append(matches, &DuplicateMatch{Contact: candidate, Score: score, Reasons: reasons})
+		}
+	}
+
+	sort.Stable(byScore(matches))
+	return matches
+}
+
+//Score returns how likely two contacts are the same person, from 0 to 1, and
+//the signals that matched.
+func (m *DuplicateMatcher) Score(a, b *ContactDTO) (float64, []string) {
+	var total, weights float64
+	reasons := []string{}
+	add := func(reason string, weight, score float64) {
+		total += weight * score
+		weights += weight
+		if score >= matchingSignal {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if emailA, emailB := duplicateEmail(a.Email), duplicateEmail(b.Email); emailA != "" && emailB != "" {
+		score := 0.0
+		if emailA == emailB {
+			score = 1
+		}
+		add("email", emailWeight, score)
+	}
+
+	if score, ok := m.nameScore(a, b); ok {
+		add("name", nameWeight, score)
+	}
+
+	if phoneA, phoneB := duplicatePhone(a), duplicatePhone(b); phoneA != "" && phoneB != "" {
+		score := 0.0
+		if phoneA == phoneB {
+			score = 1
+		}
+		add("phone", phoneWeight, score)
+	}
+
+	if weights == 0 {
+		return 0, reasons
+	}
+	return total / weights, reasons
+}
+
+//nameScore compares the last names and, when both contacts have one, the first
+//names of two contacts. It's false when either contact has no last name.
+func (m *DuplicateMatcher) nameScore(a, b *ContactDTO) (float64, bool) {
+	firstA, salutationA := m.firstName(a)
+	firstB, salutationB := m.firstName(b)
+	lastA, lastB := lastName(a.LastName), lastName(b.LastName)
+	if lastA == "" || lastB == "" {
+		return 0, false
+	}
+
+	score := similarity(lastA, lastB)
+	if firstA != "" && firstB != "" {
+		score = 0.4*similarity(firstA, firstB) + 0.6*score
+	}
+
+	genderA, genderB := salutationGenders[salutationA], salutationGenders[salutationB]
+	if genderA != "" && genderB != "" && genderA != genderB {
+		score /= 2
+	}
+	return score, true
+}
+
+//firstName returns the normalized first name of a contact, without middle
+//names and as the name it's short for, and the contact's salutation, which may
+//also have been typed into the first name.
+func (m *DuplicateMatcher) firstName(c *ContactDTO) (string, string) {
+	salutation := ""
+	if words := nameWords(c.Salutation); len(words) > 0 {
+		salutation = words[0]
+	}
+
+	words := nameWords(c.FirstName)
+	for len(words) > 0 && salutations[words[0]] {
+		salutation = words[0]
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return "", salutation
+	}
+
+	first := words[0]
+	if name, ok := m.Nicknames[first]; ok {
+		first = name
+	}
+	return first, salutation
+}
+
+//lastName returns a normalized last name without suffixes like Jr.
+func lastName(name string) string {
+	words := nameWords(name)
+	for len(words) > 0 && nameSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, "")
+}
+
+//nameWords splits a name into lowercase words of letters only, so
+//punctuation like the period of "Dr." and hyphens are ignored.
+func nameWords(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
+
+//duplicateEmail normalizes an email for comparison. Unlike NormalizeEmail the
+//local part is lowercased too and a +tag is removed, since people rarely have
+//two mailboxes that differ only by those.
+func duplicateEmail(email string) string {
+	email, err := entities.NormalizeEmail(email)
+	if err != nil {
+		return ""
+	}
+	at := strings.LastIndex(email, "@")
+	local := strings.ToLower(email[:at])
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	return local + email[at:]
+}
+
+//duplicatePhone returns the E.164 form of a contact's phone number, or an
+//empty string when it isn't a valid number. National numbers are read in the
+//country of the contact's account, the same as when the contact is validated.
+func duplicatePhone(contact *ContactDTO) string {
+	number, err := entities.ParsePhoneNumber(contact.Phone, phoneCountry(contact.Account))
+	if err != nil {
+		return ""
+	}
+	return number.E164()
+}
+
+//phoneCountry returns the ISO 3166 code of the first of an account's
+//addresses that has a known country, or an empty string when none has.
+func phoneCountry(account *AccountDTO) string {
+	if account == nil {
+		return ""
+	}
+	for _, country := range []string{account.PrimaryCountry, account.BillingCountry, account.ShippingCountry} {
+		if code := entities.CountryCode(country); code != "" {
+			return code
+		}
+	}
+	return ""
+}
+
+//similarity is the Jaro-Winkler similarity of two strings, from 0 to 1, which
+//favours strings that share a prefix and tolerates typos and transpositions.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := len(ra)
+	if len(rb) > window {
+		window = len(rb)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		start, end := i-window, i+window+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(rb) {
+			end = len(rb)
+		}
+		for j := start; j < end; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < len(ra) && prefix < len(rb) && prefix < 4 && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+type byScore []*DuplicateMatch
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
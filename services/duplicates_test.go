@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+func TestDuplicateScore(t *testing.T) {
+	Convey("Given a duplicate matcher", t, func() {
+		matcher := NewDuplicateMatcher()
+
+		Convey("When two contacts share an email that differs only by case and tag", func() {
+			score, reasons := matcher.Score(
+				&ContactDTO{FirstName: "Bob", LastName: "Smith", Email: "Bob.Smith+work@Example.com"},
+				&ContactDTO{FirstName: "Robert", LastName: "Smith", Email: "bob.smith@example.COM"})
+			Convey("Then they should be a duplicate on email and name", func() {
+				So(score, ShouldAlmostEqual, 1)
+				So(reasons, ShouldResemble, []string{"email", "name"})
+			})
+		})
+		Convey("When two contacts have similar names and the same phone", func() {
+			score, reasons := matcher.Score(
+				&ContactDTO{FirstName: "Dr. Katherine", LastName: "Johnston", Phone: "(843) 654-2566"},
+				&ContactDTO{FirstName: "Kate", LastName: "Johnson Jr.", Phone: "843.654.2566"})
+			Convey("Then they should be a duplicate", func() {
+				So(score, ShouldBeGreaterThanOrEqualTo, DefaultDuplicateThreshold)
+				So(reasons, ShouldContain, "phone")
+			})
+		})
+		Convey("When two contacts have the same national phone number written differently", func() {
+			score, reasons := matcher.Score(
+				&ContactDTO{FirstName: "Katherine", LastName: "Johnston", Phone: "(843)654-2566"},
+				&ContactDTO{FirstName: "Kate", LastName: "Johnston", Phone: "843-654-2566"})
+			Convey("Then the phone should match", func() {
+				So(score, ShouldBeGreaterThanOrEqualTo, DefaultDuplicateThreshold)
+				So(reasons, ShouldContain, "phone")
+			})
+		})
+		Convey("When two contacts of a UK account have the same national phone number", func() {
+			account := &AccountDTO{BillingCountry: "United Kingdom"}
+			score, reasons := matcher.Score(
+				&ContactDTO{FirstName: "Oliver", LastName: "Hughes", Phone: "020 7946 0958", Account: account},
+				&ContactDTO{FirstName: "Olly", LastName: "Hughes", Phone: "+44 (20) 7946-0958", Account: account})
+			Convey("Then the numbers should be read in the account's country and match", func() {
+				So(score, ShouldBeGreaterThanOrEqualTo, DefaultDuplicateThreshold)
+				So(reasons, ShouldContain, "phone")
+			})
+		})
+		Convey("When two contacts with the same last name and phone have conflicting salutations", func() {
+			score, _ := matcher.Score(
+				&ContactDTO{Salutation: "Mr.", FirstName: "Chris", LastName: "Smith", Phone: "843-654-2566"},
+				&ContactDTO{Salutation: "Mrs.", FirstName: "Chris", LastName: "Smith", Phone: "843-654-2566"})
+			Convey("Then they shouldn't be a duplicate", func() {
+				So(score, ShouldBeLessThan, DefaultDuplicateThreshold)
+			})
+		})
+		Convey("When two contacts share a name but have different emails", func() {
+			score, reasons := matcher.Score(
+				&ContactDTO{FirstName: "John", LastName: "Smith", Email: "john@example.com"},
+				&ContactDTO{FirstName: "John", LastName: "Smith", Email: "jsmith@another.org"})
+			Convey("Then they shouldn't be a duplicate", func() {
+				So(score, ShouldBeLessThan, DefaultDuplicateThreshold)
+				So(reasons, ShouldResemble, []string{"name"})
+			})
+		})
+		Convey("When the contacts have nothing to compare", func() {
+			score, _ := matcher.Score(&ContactDTO{}, &ContactDTO{})
+			Convey("Then the score should be zero", func() {
+				So(score, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestDuplicateMatches(t *testing.T) {
+	Convey("Given a contact and the contacts of its account", t, func() {
+		contact := &ContactDTO{SalesForceID: "003d000001SELFAAA", FirstName: "Jon", LastName: "Smyth",
+			Email: "jon.smith@example.com"}
+		candidates := []*ContactDTO{
+			contact,
+			{SalesForceID: "003d000001OTHERAA", FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"},
+			{SalesForceID: "003d000001CLOSEAA", FirstName: "Jonathan", LastName: "Smith"},
+			{SalesForceID: "003d000001EXACTAA", FirstName: "Jonathan", LastName: "Smith", Email: "Jon.Smith@example.com"},
+		}
+		Convey("When matching the contact against them", func() {
+			matches := NewDuplicateMatcher().Matches(contact, candidates)
+			Convey("Then the duplicates should be returned best match first, without the contact itself", func() {
+				So(len(matches), ShouldEqual, 2)
+				So(matches[0].Contact.SalesForceID, ShouldEqual, "003d000001EXACTAA")
+				So(matches[1].Contact.SalesForceID, ShouldEqual, "003d000001CLOSEAA")
+				So(matches[0].Score, ShouldBeGreaterThan, matches[1].Score)
+			})
+		})
+	})
+}
+
+func TestSimilarity(t *testing.T) {
+	Convey("Given pairs of names", t, func() {
+		Convey("Then the Jaro-Winkler similarity should be returned", func() {
+			So(similarity("martha", "marhta"), ShouldAlmostEqual, 0.961, 0.001)
+			So(similarity("dwayne", "duane"), ShouldAlmostEqual, 0.84, 0.001)
+			So(similarity("smith", "smith"), ShouldEqual, 1)
+			So(similarity("abc", "xyz"), ShouldEqual, 0)
+			So(similarity("", "smith"), ShouldEqual, 0)
+		})
+	})
+}
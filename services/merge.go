@@ -0,0 +1,424 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//MergeRepository is an interface for merging duplicate records into a master
+//record. The modified fields of the master are saved, the child records of
+//the duplicates are moved to the master and the duplicates are deleted.
+type MergeRepository interface {
+	MergeContacts(master *entities.Contact, duplicateIDs []string) (*MergeResult, error)
+	MergeAccounts(master *entities.Account, duplicateIDs []string) (*MergeResult, error)
+}
+
+//MergeResult is the outcome of a merge in the data store. RelatedIDs are the
+//child records that were moved to the master, and Native is set when the
+//data store's own merge operation was used.
+type MergeResult struct {
+	RelatedIDs []string
+	Native     bool
+}
+
+//MergeAuditor records the merges that were made, so that they can be
+//reviewed or undone by hand
+type MergeAuditor interface {
+	RecordMerge(record *MergeRecord) error
+}
+
+//MergeRecord is the audit trail of a merge. The duplicates are kept as they
+//were before the merge, in Contacts or Accounts, since they're deleted by it.
+type MergeRecord struct {
+	ObjectType   string         `json:"objectType"`
+	MasterID     string         `json:"masterId"`
+	DuplicateIDs []string       `json:"duplicateIds"`
+	Fields       []*MergedField `json:"fields,omitempty"`
+	RelatedIDs   []string       `json:"relatedIds,omitempty"`
+	Native       bool           `json:"native"`
+	MergedAt     time.Time      `json:"mergedAt"`
+	Contacts     []*ContactDTO  `json:"contacts,omitempty"`
+	Accounts     []*AccountDTO  `json:"accounts,omitempty"`
+}
+
+//MergedField is a field of the master that took the value of a duplicate
+type MergedField struct {
+	Field    string `json:"field"`
+	Previous string `json:"previous"`
+	Value    string `json:"value"`
+	RecordID string `json:"recordId"`
+}
+
+//MergeAuditLog is a MergeAuditor that writes every merge as a line of JSON
+type MergeAuditLog struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+//NewMergeAuditLog returns a MergeAuditLog that writes to w
+func NewMergeAuditLog(w io.Writer) *MergeAuditLog {
+	return &MergeAuditLog{w: w}
+}
+
+//RecordMerge writes the merge to the log
+func (l *MergeAuditLog) RecordMerge(record *MergeRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+//MergeValue is the value of a field of one of the records being merged
+type MergeValue struct {
+	RecordID string
+	Value    string
+}
+
+//MergeRule chooses the surviving value of a field. The values are those of
+//the master first and then of the duplicates in the order they were given.
+//An empty value never clears the master's value.
+type MergeRule func(values []MergeValue) MergeValue
+
+//KeepMaster keeps the master's value, even an empty one
+func KeepMaster(values []MergeValue) MergeValue {
+	return values[0]
+}
+
+//KeepFirstNonEmpty keeps the master's value unless it's empty, and otherwise
+//the value of the first duplicate that has one. It's the default rule.
+func KeepFirstNonEmpty(values []MergeValue) MergeValue {
+	for _, value := range values {
+		if value.Value != "" {
+			return value
+		}
+	}
+	return values[0]
+}
+
+//KeepLongest keeps the longest value, ex. for a field where the most complete
+//value is best. Ties are won by the earlier record.
+func KeepLongest(values []MergeValue) MergeValue {
+	longest := values[0]
+	for _, value := range values[1:] {
+		if len(value.Value) > len(longest.Value) {
+			longest = value
+		}
+	}
+	return longest
+}
+
+//MergeRules choose the surviving value of each field of a merge. Fields are
+//named by their json names, ex. "email" or "billingAddress" for the whole
+//billing address of an account. Fields without a rule use Default, or
+//KeepFirstNonEmpty when it isn't set.
+type MergeRules struct {
+	Default MergeRule
+	Fields  map[string]MergeRule
+}
+
+func (r *MergeRules) rule(field string) MergeRule {
+	if r != nil {
+		if rule, ok := r.Fields[field]; ok && rule != nil {
+			return rule
+		}
+		if r.Default != nil {
+			return r.Default
+		}
+	}
+	return KeepFirstNonEmpty
+}
+
+//mergeField is a field of a record, made of one or more DTO fields that are
+//merged together, like the parts of an address
+type mergeField struct {
+	name  string
+	parts []*string
+}
+
+func (f mergeField) value() string {
+	values := []string{}
+	for _, part := range f.parts {
+		if *part != "" {
+			values = append(values, *part)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+//contactMergeFields are the fields of a contact that take part in a merge.
+//The status isn't merged: the master keeps its own.
+func contactMergeFields(c *ContactDTO) []mergeField {
+	return []mergeField{
+		{"salutation", []*string{&c.Salutation}},
+		{"firstName", []*string{&c.FirstName}},
+		{"lastName", []*string{&c.LastName}},
+		{"email", []*string{&c.Email}},
+		{"phone", []*string{&c.Phone}},
+		{"fax", []*string{&c.Fax}},
+		{"title", []*string{&c.Title}},
+		{"defaultAccount", []*string{&c.DefaultAccount}},
+		{"bbAuthId", []*string{&c.BBAuthID}},
+		{"bbAuthEmail", []*string{&c.BBAuthEmail}},
+		{"bbAuthFirstName", []*string{&c.BBAuthFirstName}},
+		{"bbAuthLastName", []*string{&c.BBAuthLastName}},
+	}
+}
+
+//accountMergeFields are the fields of an account that take part in a merge.
+//The Site ID isn't merged: the master keeps its own.
+func accountMergeFields(a *AccountDTO) []mergeField {
+	return []mergeField{
+		{"name", []*string{&a.Name}},
+		{"parentId", []*string{&a.ParentID}},
+		{"businessUnit", []*string{&a.BusinessUnit}},
+		{"industry", []*string{&a.Industry}},
+		{"payer", []*string{&a.Payer}},
+		{"billingAddress", []*string{&a.BillingStreet, &a.BillingCity, &a.BillingState, &a.BillingZipCode,
+			&a.BillingCountry}},
+		{"shippingAddress", []*string{&a.ShippingStreet, &a.ShippingCity, &a.ShippingState, &a.ShippingZipCode,
+			&a.ShippingCountry}},
+	}
+}
+
+//mergeFields applies the rules to the fields of the records, the master
+//first, and copies the surviving values onto the master's fields. It returns
+//the fields that took the value of a duplicate.
+func mergeFields(rules *MergeRules, ids []string, records [][]mergeField) []*MergedField {
+	merged := []*MergedField{}
+	master := records[0]
+
+	for f, field := range master {
+		values := make([]MergeValue, len(records))
+		for i, record := range records {
+			values[i] = MergeValue{RecordID: ids[i], Value: record[f].value()}
+		}
+
+		chosen := rules.rule(field.name)(values)
+		if chosen.RecordID == ids[0] || chosen.Value == "" {
+			continue
+		}
+		for i, id := range ids {
+			if id != chosen.RecordID {
+				continue
+			}
+			if chosen.Value != values[0].Value {
+				merged = append(merged, &MergedField{Field: field.name, Previous: values[0].Value,
+					Value: chosen.Value, RecordID: id})
+			}
+			for p, part := range field.parts {
+				*part = *records[i][f].parts[p]
+			}
+			break
+		}
+	}
+
+	return merged
+}
+
+//checkMergeIDs checks that there are duplicates to merge and that no record
+//is given twice
+func checkMergeIDs(masterID string, duplicateIDs []string) error {
+	if masterID == "" {
+		return errors.New("A master record is required to merge")
+	}
+	if len(duplicateIDs) == 0 {
+		return errors.New("At least one duplicate is required to merge")
+	}
+
+	seen := map[string]bool{masterID: true}
+	for _, id := range duplicateIDs {
+		if seen[id] {
+			return fmt.Errorf("%s is given more than once", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+//MergeService merges duplicate contacts and accounts. The surviving value of
+//each field is chosen by the Rules, and every merge is recorded by the
+//Auditor when one is set.
+type MergeService struct {
+	AccountRepo AccountRepository
+	ContactRepo ContactRepository
+	MergeRepo   MergeRepository
+	Auditor     MergeAuditor
+	Rules       *MergeRules
+}
+
+//NewMergeService returns a pointer to a MergeService that uses the default
+//merge rules and doesn't audit merges
+func NewMergeService(accountRepo AccountRepository, contactRepo ContactRepository,
+	mergeRepo MergeRepository) *MergeService {
+	return &MergeService{AccountRepo: accountRepo, ContactRepo: contactRepo, MergeRepo: mergeRepo}
+}
+
+//MergeContacts merges duplicate contacts into a master contact, by their 15
+//or 18 character SFDC IDs. The master takes the surviving values of the
+//duplicates' fields and their contact roles, and the duplicates are deleted.
+//Merged contacts and contacts of different BBAuth users can't be merged.
+func (ms *MergeService) MergeContacts(masterID string, duplicateIDs []string) (*MergeRecord, error) {
+	if err := checkMergeIDs(masterID, duplicateIDs); err != nil {
+		return nil, err
+	}
+
+	contacts := make([]*ContactDTO, len(duplicateIDs)+1)
+	ids := make([]string, len(contacts))
+	for i, id := range append([]string{masterID}, duplicateIDs...) {
+		//the contacts are queried so that the audit has the duplicates' roles
+		contact, err := queryContact(ms.ContactRepo, id)
+		if _, ok := err.(*NotFoundError); ok {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error getting contact %s to merge: %s", id, err)
+		}
+		status, err := entities.ParseContactStatus(contact.Status)
+		if err == nil && status == entities.ContactStatusMerged {
+			return nil, fmt.Errorf("Contact %s has already been merged", id)
+		}
+		if contact.BBAuthID != "" && contacts[0] != nil && contacts[0].BBAuthID != "" &&
+			!strings.EqualFold(contact.BBAuthID, contacts[0].BBAuthID) {
+			return nil, fmt.Errorf("Contact %s belongs to a different BBAuth user than the master", id)
+		}
+		contacts[i] = contact
+		ids[i] = contact.SalesForceID
+	}
+	if err := checkMergeIDs(ids[0], ids[1:]); err != nil {
+		return nil, err
+	}
+
+	master, err := contacts[0].loadEntity()
+	if err != nil {
+		return nil, fmt.Errorf("Error converting master contact: %s", err)
+	}
+	master.MarkClean()
+
+	merged := *contacts[0]
+	records := [][]mergeField{contactMergeFields(&merged)}
+	for _, contact := range contacts[1:] {
+		records = append(records, contactMergeFields(contact))
+	}
+	fields := mergeFields(ms.Rules, ids, records)
+
+	if err := merged.applyTo(master); err != nil {
+		return nil, err
+	}
+	if err := master.ValidateWrite(); err != nil {
+		return nil, err
+	}
+
+	result, err := ms.MergeRepo.MergeContacts(master, ids[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	record := &MergeRecord{ObjectType: "Contact", MasterID: ids[0], DuplicateIDs: ids[1:],
+		Fields: fields, RelatedIDs: result.RelatedIDs, Native: result.Native, MergedAt: time.Now().UTC(),
+		Contacts: contacts[1:]}
+	return record, ms.audit(record)
+}
+
+//MergeAccounts merges duplicate accounts into a master account, by their SFDC
+//IDs or Clarify Site IDs. The master takes the surviving values of the
+//duplicates' fields, except their Site IDs, along with their contacts, assets
+//and child accounts, and the duplicates are deleted.
+func (ms *MergeService) MergeAccounts(masterID string, duplicateIDs []string) (*MergeRecord, error) {
+	if err := checkMergeIDs(masterID, duplicateIDs); err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*AccountDTO, len(duplicateIDs)+1)
+	ids := make([]string, len(accounts))
+	for i, id := range append([]string{masterID}, duplicateIDs...) {
+		account, err := ms.AccountRepo.GetAccount(id)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting account %s to merge: %s", id, err)
+		}
+		accounts[i] = account
+		ids[i] = account.SalesForceID
+	}
+	if err := checkMergeIDs(ids[0], ids[1:]); err != nil {
+		return nil, err
+	}
+	for _, id := range ids[1:] {
+		if id == accounts[0].ParentID {
+			return nil, fmt.Errorf("Account %s is the parent of the master and can't be merged into it", id)
+		}
+	}
+
+	master, err := accounts[0].toEntity()
+	if err != nil {
+		return nil, fmt.Errorf("Error converting master account: %s", err)
+	}
+	master.MarkClean()
+
+	merged := *accounts[0]
+	records := [][]mergeField{accountMergeFields(&merged)}
+	for _, account := range accounts[1:] {
+		records = append(records, accountMergeFields(account))
+	}
+	fields := mergeFields(ms.Rules, ids, records)
+	for _, id := range ids[1:] {
+		if merged.ParentID == id {
+			merged.ParentID = accounts[0].ParentID
+		}
+	}
+
+	if err := merged.applyTo(master); err != nil {
+		return nil, err
+	}
+	if err := master.ValidateWrite(); err != nil {
+		return nil, err
+	}
+	//an address taken from a duplicate replaces the master's whole address,
+	//rather than only its non-empty parts
+	for _, field := range fields {
+		switch field.Field {
+		case "billingAddress":
+			master.BillingAddress = applyAddress(nil, merged.BillingStreet, merged.BillingCity,
+				merged.BillingState, merged.BillingZipCode, merged.BillingCountry)
+		case "shippingAddress":
+			master.ShippingAddress = applyAddress(nil, merged.ShippingStreet, merged.ShippingCity,
+				merged.ShippingState, merged.ShippingZipCode, merged.ShippingCountry)
+		}
+	}
+	if err := master.ValidateWrite(); err != nil {
+		return nil, err
+	}
+
+	result, err := ms.MergeRepo.MergeAccounts(master, ids[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	record := &MergeRecord{ObjectType: "Account", MasterID: ids[0], DuplicateIDs: ids[1:],
+		Fields: fields, RelatedIDs: result.RelatedIDs, Native: result.Native, MergedAt: time.Now().UTC(),
+		Accounts: accounts[1:]}
+	return record, ms.audit(record)
+}
+
+//audit records a merge. The merge has already been made when it fails, so
+//the error says so.
+func (ms *MergeService) audit(record *MergeRecord) error {
+	if ms.Auditor == nil {
+		return nil
+	}
+	if err := ms.Auditor.RecordMerge(record); err != nil {
+		return fmt.Errorf("%s %s was merged, but the merge couldn't be recorded: %s",
+			record.ObjectType, record.MasterID, err)
+	}
+	return nil
+}
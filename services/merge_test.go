@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//mergeContactRepository queries the contacts of its map by their 15 or 18
+//character SFDC IDs
+type mergeContactRepository struct {
+	mockContactRepository
+	contacts map[string]ContactDTO
+}
+
+func (m mergeContactRepository) QueryContacts(query string) ([]*ContactDTO, error) {
+	contacts := []*ContactDTO{}
+	for _, id := range strings.Split(strings.TrimPrefix(query, "ids:"), ",") {
+		for _, contact := range m.contacts {
+			if contact.SalesForceID == id || contact.SalesForceID[:15] == id {
+				c := contact
+				contacts = append(contacts, &c)
+			}
+		}
+	}
+	return contacts, nil
+}
+
+//mergeAccountRepository returns the accounts of its map by SFDC ID or Site ID
+type mergeAccountRepository struct {
+	mockAccountRepository
+	accounts map[string]AccountDTO
+}
+
+func (m mergeAccountRepository) GetAccount(id string) (*AccountDTO, error) {
+	for _, account := range m.accounts {
+		if account.SalesForceID == id || account.SiteID == id {
+			return &account, nil
+		}
+	}
+	return nil, errors.New("Account not found")
+}
+
+//mockMergeRepository records the last merge
+type mockMergeRepository struct {
+	contact      *entities.Contact
+	account      *entities.Account
+	duplicateIDs []string
+	err          error
+}
+
+func (m *mockMergeRepository) MergeContacts(master *entities.Contact, duplicateIDs []string) (*MergeResult, error) {
+	m.contact, m.duplicateIDs = master, duplicateIDs
+	return &MergeResult{RelatedIDs: []string{"a0Xd000001ROLE01AA"}, Native: true}, m.err
+}
+
+func (m *mockMergeRepository) MergeAccounts(master *entities.Account, duplicateIDs []string) (*MergeResult, error) {
+	m.account, m.duplicateIDs = master, duplicateIDs
+	return &MergeResult{RelatedIDs: []string{"003d000001CHILD1AA"}}, m.err
+}
+
+//mergedField returns the field of a merge record with the given name
+func mergedField(record *MergeRecord, name string) *MergedField {
+	for _, field := range record.Fields {
+		if field.Field == name {
+			return field
+		}
+	}
+	return nil
+}
+
+type failingAuditor struct{}
+
+func (failingAuditor) RecordMerge(record *MergeRecord) error {
+	return errors.New("disk full")
+}
+
+var mergeContacts = map[string]ContactDTO{
+	"003d000001MASTERAA": {SalesForceID: "003d000001MASTERAA", FirstName: "Bob", LastName: "Smith",
+		Email: "bob@example.com", Account: &accountDTO, Currency: "USD", Status: "Active"},
+	"003d000001DUPE01AA": {SalesForceID: "003d000001DUPE01AA", FirstName: "Robert", LastName: "Smith",
+		Email: "robert.smith@example.com", Phone: "843-654-2566", Title: "Director", Account: &accountDTO,
+		Currency: "USD", Status: "Inactive", ContactRoles: &ContactRolesWrapper{Roles: []*ContactRoleDTO{
+			{RoleType: "Billing", RoleName: "Primary", RoleStatus: "Active"}}}},
+	"003d000001DUPE02AA": {SalesForceID: "003d000001DUPE02AA", LastName: "Smith", Title: "Executive Director",
+		Account: &accountDTO, Currency: "USD"},
+	"003d000001MERGEDAA": {SalesForceID: "003d000001MERGEDAA", LastName: "Smith", Account: &accountDTO,
+		Currency: "USD", Status: "Merged"},
+	"003d000001BBAUTHAA": {SalesForceID: "003d000001BBAUTHAA", LastName: "Smith", Account: &accountDTO,
+		Currency: "USD", BBAuthID: "32FBC72D-C0FE-4B50-B0F4-EDCEFD7B4DEF"},
+	"003d000001OTHERAA": {SalesForceID: "003d000001OTHERAA", LastName: "Smith", Account: &accountDTO,
+		Currency: "USD", BBAuthID: "A1B2C3D4-C0FE-4B50-B0F4-EDCEFD7B4DEF"},
+}
+
+func TestMergeContacts(t *testing.T) {
+	Convey("Given a merge service", t, func() {
+		mergeRepo := &mockMergeRepository{}
+		var audit bytes.Buffer
+		ms := NewMergeService(mockAccountRepository{},
+			mergeContactRepository{contacts: mergeContacts}, mergeRepo)
+		ms.Auditor = NewMergeAuditLog(&audit)
+
+		Convey("When duplicates are merged into a contact with the default rules", func() {
+			record, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001DUPE01AA", "003d000001DUPE02AA"})
+			Convey("Then the master should keep its values and take those it's missing", func() {
+				So(err, ShouldBeNil)
+				So(mergeRepo.duplicateIDs, ShouldResemble, []string{"003d000001DUPE01AA", "003d000001DUPE02AA"})
+				So(mergeRepo.contact.ID(), ShouldEqual, "003d000001MASTERAA")
+				So(mergeRepo.contact.Email(), ShouldEqual, "bob@example.com")
+				So(mergeRepo.contact.Title, ShouldEqual, "Director")
+				So(mergeRepo.contact.ModifiedFields(), ShouldResemble, []string{"phone", "title"})
+			})
+			Convey("Then the master should keep its status", func() {
+				So(mergeRepo.contact.Status(), ShouldEqual, entities.ContactStatusActive)
+			})
+			Convey("Then the merge should be recorded", func() {
+				So(record.ObjectType, ShouldEqual, "Contact")
+				So(record.Native, ShouldBeTrue)
+				So(record.RelatedIDs, ShouldResemble, []string{"a0Xd000001ROLE01AA"})
+				So(len(record.Contacts), ShouldEqual, 2)
+				So(mergedField(record, "title"), ShouldResemble, &MergedField{Field: "title", Value: "Director",
+					RecordID: "003d000001DUPE01AA"})
+
+				logged := &MergeRecord{}
+				So(json.Unmarshal(audit.Bytes(), logged), ShouldBeNil)
+				So(logged.MasterID, ShouldEqual, "003d000001MASTERAA")
+				So(logged.Contacts[0].Email, ShouldEqual, "robert.smith@example.com")
+				So(logged.Contacts[0].ContactRoles.Roles[0].RoleName, ShouldEqual, "Primary")
+			})
+		})
+		Convey("When the master is given by its 15 character id", func() {
+			record, err := ms.MergeContacts("003d000001MASTE", []string{"003d000001DUPE01AA"})
+			Convey("Then the merge should use its SFDC ID", func() {
+				So(err, ShouldBeNil)
+				So(mergeRepo.contact.ID(), ShouldEqual, "003d000001MASTERAA")
+				So(record.MasterID, ShouldEqual, "003d000001MASTERAA")
+			})
+		})
+		Convey("When the master is also given as a duplicate by its 15 character id", func() {
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001MASTE"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(mergeRepo.contact, ShouldBeNil)
+			})
+		})
+		Convey("When a contact doesn't exist", func() {
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001NOTFOUND"})
+			Convey("Then a not found error should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+			})
+		})
+		Convey("When the rules choose other values", func() {
+			ms.Rules = &MergeRules{Default: KeepMaster, Fields: map[string]MergeRule{
+				"title": KeepLongest, "firstName": KeepLongest,
+			}}
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001DUPE01AA", "003d000001DUPE02AA"})
+			Convey("Then the fields should follow the rules", func() {
+				So(err, ShouldBeNil)
+				So(mergeRepo.contact.Title, ShouldEqual, "Executive Director")
+				So(mergeRepo.contact.Name.FirstName, ShouldEqual, "Robert")
+				So(mergeRepo.contact.Phone().E164(), ShouldBeEmpty)
+			})
+		})
+		Convey("When a contact that was already merged is merged", func() {
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001MERGEDAA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(mergeRepo.contact, ShouldBeNil)
+			})
+		})
+		Convey("When contacts of different BBAuth users are merged", func() {
+			_, err := ms.MergeContacts("003d000001BBAUTHAA", []string{"003d000001OTHERAA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(mergeRepo.contact, ShouldBeNil)
+			})
+		})
+		Convey("When the master is given as a duplicate", func() {
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001MASTERAA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When no duplicates are given", func() {
+			_, err := ms.MergeContacts("003d000001MASTERAA", nil)
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When the merge can't be recorded", func() {
+			ms.Auditor = failingAuditor{}
+			record, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001DUPE01AA"})
+			Convey("Then the merge should be returned with an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "was merged")
+				So(record, ShouldNotBeNil)
+			})
+		})
+		Convey("When the data store fails to merge", func() {
+			mergeRepo.err = errors.New("fake error")
+			_, err := ms.MergeContacts("003d000001MASTERAA", []string{"003d000001DUPE01AA"})
+			Convey("Then an error should be returned and nothing recorded", func() {
+				So(err, ShouldNotBeNil)
+				So(audit.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+var mergeAccounts = map[string]AccountDTO{
+	"master": {Name: "Blackbaud", SalesForceID: "001d000001MASTERAA", SiteID: "5740",
+		BillingStreet: "2000 Daniel Island Dr", BillingCity: "Charleston"},
+	"duplicate": {Name: "Blackbaud, Inc.", SalesForceID: "001d000001DUPE01AA", SiteID: "5741",
+		Industry: "Software", BillingStreet: "65 Fairchild St", BillingCity: "Charleston",
+		BillingState: "SC", BillingZipCode: "29492"},
+	"child": {Name: "Blackbaud Child", SalesForceID: "001d000001CHILD1AA", SiteID: "5742",
+		ParentID: "001d000001DUPE01AA"},
+}
+
+func TestMergeAccounts(t *testing.T) {
+	Convey("Given a merge service", t, func() {
+		mergeRepo := &mockMergeRepository{}
+		ms := NewMergeService(mergeAccountRepository{accounts: mergeAccounts}, mockContactRepository{}, mergeRepo)
+
+		Convey("When an account is merged into another by Site ID", func() {
+			record, err := ms.MergeAccounts("5740", []string{"5741"})
+			Convey("Then the master should take the values it's missing and keep its Site ID", func() {
+				So(err, ShouldBeNil)
+				So(mergeRepo.duplicateIDs, ShouldResemble, []string{"001d000001DUPE01AA"})
+				So(mergeRepo.account.Name(), ShouldEqual, "Blackbaud")
+				So(mergeRepo.account.Industry, ShouldEqual, "Software")
+				So(mergeRepo.account.SiteID(), ShouldEqual, 5740)
+				So(record.MasterID, ShouldEqual, "001d000001MASTERAA")
+				So(record.Native, ShouldBeFalse)
+			})
+		})
+		Convey("When the duplicate has the longer billing address", func() {
+			ms.Rules = &MergeRules{Fields: map[string]MergeRule{"billingAddress": KeepLongest}}
+			record, err := ms.MergeAccounts("001d000001MASTERAA", []string{"001d000001DUPE01AA"})
+			Convey("Then its whole address should replace the master's", func() {
+				So(err, ShouldBeNil)
+				So(*mergeRepo.account.BillingAddress, ShouldResemble, entities.Address{Street: "65 Fairchild St",
+					City: "Charleston", State: "SC", ZipCode: "29492"})
+				So(mergedField(record, "billingAddress"), ShouldResemble, &MergedField{Field: "billingAddress",
+					Previous: "2000 Daniel Island Dr, Charleston", Value: "65 Fairchild St, Charleston, SC, 29492",
+					RecordID: "001d000001DUPE01AA"})
+			})
+		})
+		Convey("When an account's parent is merged into it", func() {
+			_, err := ms.MergeAccounts("5742", []string{"5741"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(mergeRepo.account, ShouldBeNil)
+			})
+		})
+		Convey("When the same account is given by its SFDC ID and Site ID", func() {
+			_, err := ms.MergeAccounts("5740", []string{"001d000001MASTERAA"})
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
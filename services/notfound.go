@@ -0,0 +1,11 @@
+package services
+
+//NotFoundError is returned when the record a request is for doesn't exist.
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " " + e.ID + " was not found"
+}
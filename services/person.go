@@ -0,0 +1,234 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//Person groups the Salesforce contacts of a single BBAuth user. SFDC holds one
+//contact per account the user belongs to, and every one of those contacts
+//stores the user's default account in Default_Account__c.
+type Person struct {
+	bbAuthID       string
+	contacts       []*entities.Contact
+	duplicates     []*entities.Contact
+	defaultAccount string
+}
+
+//PersonDTO is a data transfer object for a Person.
+type PersonDTO struct {
+	BBAuthID       string        `json:"bbAuthId"`
+	DefaultAccount string        `json:"defaultAccount,omitempty"`
+	Accounts       []*AccountDTO `json:"accounts"`
+	Contacts       []*ContactDTO `json:"contacts"`
+}
+
+//NewPerson groups contacts that share a BBAuth ID. Every contact must have an
+//account with an SFDC ID. When the user has several contacts on one account,
+//the person's contact for it is the active one, or else the one with the
+//lowest SFDC ID, and the others are kept as duplicates. The default account is
+//the first Default_Account__c value of the contacts that is one of the
+//person's accounts; if none is, the person has no default.
+func NewPerson(contacts []*entities.Contact) (*Person, error) {
+	if len(contacts) == 0 {
+		return nil, errors.New("A person must have at least one contact")
+	}
+
+	p := &Person{bbAuthID: contacts[0].BBAuthID()}
+	if p.bbAuthID == "" {
+		return nil, errors.New("A person's contacts must have a BBAuthID")
+	}
+
+	accounts := map[string]int{}
+	for _, contact := range contacts {
+		if contact.BBAuthID() != p.bbAuthID {
+			return nil, fmt.Errorf("Contact %s belongs to BBAuthID %s, not %s",
+				contact.ID(), contact.BBAuthID(), p.bbAuthID)
+		}
+
+		if contact.Account() == nil || contact.Account().ID() == "" {
+			return nil, fmt.Errorf("Contact %s must have an account with an SFDC ID", contact.ID())
+		}
+
+		id := contact.Account().ID()
+		i, ok := accounts[id]
+		if !ok {
+			accounts[id] = len(p.contacts)
+			p.contacts = append(p.contacts, contact)
+			continue
+		}
+
+		if preferContact(contact, p.contacts[i]) {
+			contact, p.contacts[i] = p.contacts[i], contact
+		}
+		p.duplicates = append(p.duplicates, contact)
+	}
+
+	for _, contact := range contacts {
+		if _, ok := accounts[contact.DefaultAccount()]; ok {
+			p.defaultAccount = contact.DefaultAccount()
+			break
+		}
+	}
+
+	return p, nil
+}
+
+//preferContact reports whether contact a should represent a person at an
+//account rather than contact b: active contacts are preferred, then the
+//lowest SFDC ID so that the choice doesn't depend on the query order.
+func preferContact(a, b *entities.Contact) bool {
+	activeA := a.Status() == entities.ContactStatusActive
+	activeB := b.Status() == entities.ContactStatusActive
+	if activeA != activeB {
+		return activeA
+	}
+	return a.ID() < b.ID()
+}
+
+//BBAuthID of the person.
+func (p *Person) BBAuthID() string {
+	return p.bbAuthID
+}
+
+//Contacts of the person, one per account.
+func (p *Person) Contacts() []*entities.Contact {
+	return p.contacts
+}
+
+//Duplicates are the person's other contacts on accounts that they already have
+//a contact for, usually duplicate contacts that haven't been merged yet.
+func (p *Person) Duplicates() []*entities.Contact {
+	return p.duplicates
+}
+
+//Accounts the person belongs to, in the same order as their contacts.
+func (p *Person) Accounts() []*entities.Account {
+	accounts := make([]*entities.Account, len(p.contacts))
+	for i, contact := range p.contacts {
+		accounts[i] = contact.Account()
+	}
+	return accounts
+}
+
+//DefaultAccount is the SFDC ID of the person's default account. Empty if the
+//person has no valid default.
+func (p *Person) DefaultAccount() string {
+	return p.defaultAccount
+}
+
+//ContactForAccount returns the person's contact for the given account, or nil
+//if the person doesn't belong to it.
+func (p *Person) ContactForAccount(accountID string) *entities.Contact {
+	for _, contact := range p.contacts {
+		if contact.Account().ID() == accountID {
+			return contact
+		}
+	}
+	return nil
+}
+
+//DefaultContact returns the person's contact for their default account, or nil
+//if the person has no default.
+func (p *Person) DefaultContact() *entities.Contact {
+	return p.ContactForAccount(p.defaultAccount)
+}
+
+//SetDefaultAccount changes the person's default account. The account must be
+//one the person belongs to. Every contact of the person, duplicates included,
+//is updated so that they agree on the default.
+func (p *Person) SetDefaultAccount(accountID string) error {
+	if p.ContactForAccount(accountID) == nil {
+		errs := &entities.ValidationError{}
+		errs.Add("defaultAccount", entities.ErrCodeInvalid,
+			fmt.Sprintf("Account %s is not one of BBAuthID %s's accounts", accountID, p.bbAuthID))
+		return errs
+	}
+
+	for _, contact := range p.allContacts() {
+		contact.SetDefaultAccount(accountID)
+	}
+	p.defaultAccount = accountID
+
+	return nil
+}
+
+//allContacts returns the contacts of the person followed by the duplicates.
+func (p *Person) allContacts() []*entities.Contact {
+	return append(append([]*entities.Contact{}, p.contacts...), p.duplicates...)
+}
+
+//ConvertPersonToPersonDTO converts a Person into a PersonDTO.
+func ConvertPersonToPersonDTO(person *Person) *PersonDTO {
+	dto := &PersonDTO{
+		BBAuthID:       person.BBAuthID(),
+		DefaultAccount: person.DefaultAccount(),
+		Accounts:       make([]*AccountDTO, len(person.contacts)),
+		Contacts:       make([]*ContactDTO, len(person.contacts)),
+	}
+
+	for i, contact := range person.contacts {
+		dto.Contacts[i] = ConvertContactEntityToContactDTO(contact)
+		dto.Accounts[i] = dto.Contacts[i].Account
+	}
+
+	return dto
+}
+
+//GetPerson returns all of the contacts of a BBAuth user grouped as a Person. A
+//*NotFoundError is returned when the user has no contacts.
+func (cs *ContactService) GetPerson(authID string) (*Person, error) {
+	dtos, err := cs.GetContactsByAuthID(authID)
+	if err != nil {
+		return nil, err
+	}
+	if len(dtos) == 0 {
+		return nil, &NotFoundError{Resource: "Person", ID: authID}
+	}
+
+	errs := &entities.ValidationError{}
+	contacts := make([]*entities.Contact, len(dtos))
+	for i, dto := range dtos {
+		contact, err := dto.loadEntity()
+		if err != nil {
+			errs.Merge("contacts."+dto.SalesForceID, err)
+			continue
+		}
+		contact.MarkClean()
+		contacts[i] = contact
+	}
+	if errs.HasErrors() {
+		return nil, errs
+	}
+
+	return NewPerson(contacts)
+}
+
+//SwitchDefaultAccount changes the default account of a BBAuth user and saves
+//every contact whose Default_Account__c changed.
+func (cs *ContactService) SwitchDefaultAccount(authID, accountID string) error {
+	person, err := cs.GetPerson(authID)
+	if err != nil {
+		return err
+	}
+
+	err = person.SetDefaultAccount(accountID)
+	if err != nil {
+		return err
+	}
+
+	for _, contact := range person.allContacts() {
+		if !contact.IsModified("defaultAccount") {
+			continue
+		}
+
+		err = cs.ContactRepo.UpdateContact(contact)
+		if err != nil {
+			return fmt.Errorf("Error updating contact %s: %s", contact.ID(), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"testing"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+	"github.com/blackbaudIT/webcore/entities"
+)
+
+//mockPersonRepository returns two contacts of the same BBAuth user, one for a
+//school and one for its district, both defaulting to the school.
+type mockPersonRepository struct {
+	mockContactRepository
+	updated []*entities.Contact
+	//contacts replace the school and district contacts when set
+	contacts []*ContactDTO
+}
+
+func (m *mockPersonRepository) QueryContacts(query string) ([]*ContactDTO, error) {
+	if m.contacts != nil {
+		return m.contacts, nil
+	}
+
+	school := contactDTO
+	school.SalesForceID = "003d0000026SCHOOL"
+	school.Account = &AccountDTO{Name: "School", SalesForceID: "001d000001SCHOOLAA"}
+	school.DefaultAccount = "001d000001SCHOOLAA"
+
+	district := school
+	district.SalesForceID = "003d0000026DISTRT"
+	district.Account = &AccountDTO{Name: "District", SalesForceID: "001d000001DISTRTAA"}
+
+	return []*ContactDTO{&school, &district}, nil
+}
+
+func (m *mockPersonRepository) UpdateContact(contact *entities.Contact) error {
+	m.updated = append(m.updated, contact)
+	return nil
+}
+
+func TestNewPerson(t *testing.T) {
+	Convey("Given contacts with different BBAuthIDs", t, func() {
+		first, _ := contactDTO.ToEntity()
+		second, _ := contactDTO.ToEntity()
+		second.SetBBAuthID("00000000-0000-0000-0000-000000000000")
+		Convey("When they are grouped as a person", func() {
+			_, err := NewPerson([]*entities.Contact{first, second})
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+	Convey("Given two contacts for the same account", t, func() {
+		first, _ := contactDTO.ToEntity()
+		first.SetID("003d0000026MOlUAAX")
+		second, _ := contactDTO.ToEntity()
+		second.SetID("003d0000026MOlUAAY")
+		Convey("When they are grouped as a person", func() {
+			person, err := NewPerson([]*entities.Contact{second, first})
+			Convey("Then the contact with the lowest ID should represent the account", func() {
+				So(err, ShouldBeNil)
+				So(person.Contacts(), ShouldResemble, []*entities.Contact{first})
+				So(person.Duplicates(), ShouldResemble, []*entities.Contact{second})
+			})
+		})
+		Convey("When only the second contact is active", func() {
+			first.SetStatus(entities.ContactStatusInactive)
+			person, err := NewPerson([]*entities.Contact{first, second})
+			Convey("Then the active contact should represent the account", func() {
+				So(err, ShouldBeNil)
+				So(person.Contacts(), ShouldResemble, []*entities.Contact{second})
+				So(person.Duplicates(), ShouldResemble, []*entities.Contact{first})
+			})
+		})
+	})
+	Convey("Given no contacts", t, func() {
+		Convey("When they are grouped as a person", func() {
+			_, err := NewPerson([]*entities.Contact{})
+			Convey("Then an error should occur", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestGetPerson(t *testing.T) {
+	Convey("Given a BBAuth user with contacts on two accounts", t, func() {
+		cs := NewContactService(&mockPersonRepository{})
+		Convey("When the person is requested", func() {
+			person, err := cs.GetPerson(contactDTO.BBAuthID)
+			Convey("Then their accounts and default account should be exposed", func() {
+				So(err, ShouldBeNil)
+				So(len(person.Accounts()), ShouldEqual, 2)
+				So(person.DefaultAccount(), ShouldEqual, "001d000001SCHOOLAA")
+				So(person.DefaultContact().ID(), ShouldEqual, "003d0000026SCHOOL")
+				dto := ConvertPersonToPersonDTO(person)
+				So(dto.Accounts[1].Name, ShouldEqual, "District")
+			})
+		})
+	})
+}
+
+func TestGetPersonErrors(t *testing.T) {
+	Convey("Given a BBAuth user without contacts", t, func() {
+		cs := NewContactService(&mockPersonRepository{contacts: []*ContactDTO{}})
+		Convey("When the person is requested", func() {
+			_, err := cs.GetPerson(contactDTO.BBAuthID)
+			Convey("Then a *NotFoundError should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+			})
+		})
+	})
+	Convey("Given a BBAuth user with a contact that can't be converted", t, func() {
+		invalid := contactDTO
+		invalid.LastName = ""
+		cs := NewContactService(&mockPersonRepository{contacts: []*ContactDTO{&invalid}})
+		Convey("When the person is requested", func() {
+			_, err := cs.GetPerson(contactDTO.BBAuthID)
+			Convey("Then a validation error naming the contact should be returned", func() {
+				verr, ok := err.(*entities.ValidationError)
+				So(ok, ShouldBeTrue)
+				So(verr.Errors[0].Field, ShouldEqual, "contacts.003d0000026MOlUAAW.lastName")
+			})
+		})
+	})
+}
+
+func TestSwitchDefaultAccount(t *testing.T) {
+	Convey("Given a BBAuth user with contacts on two accounts", t, func() {
+		repo := &mockPersonRepository{}
+		cs := NewContactService(repo)
+		Convey("When the default is switched to the other account", func() {
+			err := cs.SwitchDefaultAccount(contactDTO.BBAuthID, "001d000001DISTRTAA")
+			Convey("Then every contact should be updated with only the default account", func() {
+				So(err, ShouldBeNil)
+				So(len(repo.updated), ShouldEqual, 2)
+				for _, contact := range repo.updated {
+					So(contact.DefaultAccount(), ShouldEqual, "001d000001DISTRTAA")
+					So(contact.ModifiedFields(), ShouldResemble, []string{"defaultAccount"})
+				}
+			})
+		})
+		Convey("When the default is switched to the current default", func() {
+			err := cs.SwitchDefaultAccount(contactDTO.BBAuthID, "001d000001SCHOOLAA")
+			Convey("Then no contacts should be updated", func() {
+				So(err, ShouldBeNil)
+				So(repo.updated, ShouldBeEmpty)
+			})
+		})
+		Convey("When the default is switched to an account the user doesn't belong to", func() {
+			err := cs.SwitchDefaultAccount(contactDTO.BBAuthID, "001d000001OTHERAAA")
+			Convey("Then a validation error should occur", func() {
+				_, ok := err.(*entities.ValidationError)
+				So(ok, ShouldBeTrue)
+				So(repo.updated, ShouldBeEmpty)
+			})
+		})
+	})
+}
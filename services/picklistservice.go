@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+//PicklistRepository is an interface for accessing the values of picklist
+//fields. An empty recordTypeID returns every value of the field; otherwise
+//only the values available to that record type are returned.
+type PicklistRepository interface {
+	GetPicklist(object, field, recordTypeID string) (*PicklistDTO, error)
+}
+
+//PicklistDTO is a data transfer object for the values of a picklist field.
+//ControllerField is set for dependent picklists, whose values list the
+//controlling field values they are valid for.
+type PicklistDTO struct {
+	Object          string              `json:"object"`
+	Field           string              `json:"field"`
+	RecordTypeID    string              `json:"recordTypeId,omitempty"`
+	ControllerField string              `json:"controllerField,omitempty"`
+	Values          []*PicklistValueDTO `json:"values"`
+}
+
+//PicklistValueDTO is a data transfer object for a value of a picklist field
+type PicklistValueDTO struct {
+	Value    string   `json:"value"`
+	Label    string   `json:"label,omitempty"`
+	Active   bool     `json:"active"`
+	Default  bool     `json:"default,omitempty"`
+	ValidFor []string `json:"validFor,omitempty"`
+}
+
+//Names of the picklists webcore knows the SFDC object and field of
+const (
+	PicklistIndustry      = "industry"
+	PicklistBusinessUnit  = "businessUnit"
+	PicklistCurrency      = "currency"
+	PicklistContactStatus = "contactStatus"
+	PicklistRoleType      = "roleType"
+)
+
+//namedPicklists maps picklist names to their SFDC object and field
+var namedPicklists = map[string][2]string{
+	PicklistIndustry:      {"Account", "Industry"},
+	PicklistBusinessUnit:  {"Account", "Business_Unit__c"},
+	PicklistCurrency:      {"Contact", "CurrencyIsoCode"},
+	PicklistContactStatus: {"Contact", "SFDC_Contact_Status__c"},
+	PicklistRoleType:      {"Contact_Role__c", "Role_Type__c"},
+}
+
+//DefaultPicklistRefreshInterval is how long picklists are cached when a
+//PicklistService isn't given a refresh interval
+const DefaultPicklistRefreshInterval = time.Hour
+
+//PicklistService provides the values of picklist fields, caching them for
+//RefreshInterval. Only the fields in Fields, named by SFDC object and field
+//(ex. "Account.Industry"), can be requested so that the cache stays bounded;
+//when Fields is nil, the fields of the named picklists can. A PicklistService
+//is safe for concurrent use and should be shared so that its cache is.
+type PicklistService struct {
+	PicklistRepo    PicklistRepository
+	RefreshInterval time.Duration
+	Fields          map[string]bool
+
+	lock    sync.Mutex
+	cache   map[string]*cachedPicklist
+	loading map[string]*picklistLoad
+	now     func() time.Time
+}
+
+type cachedPicklist struct {
+	picklist *PicklistDTO
+	loaded   time.Time
+}
+
+//picklistLoad is a picklist being loaded from the repository. Requests for the
+//same picklist wait for it instead of loading it again.
+type picklistLoad struct {
+	done     chan struct{}
+	picklist *PicklistDTO
+	err      error
+}
+
+//NewPicklistService returns a pointer to a PicklistService instantiated with
+//the given PicklistRepository. A refreshInterval of 0 uses
+//DefaultPicklistRefreshInterval.
+func NewPicklistService(repo PicklistRepository, refreshInterval time.Duration) *PicklistService {
+	return &PicklistService{PicklistRepo: repo, RefreshInterval: refreshInterval}
+}
+
+//GetNamedPicklist returns one of the picklists webcore knows by name (ex.
+//PicklistIndustry).
+func (ps *PicklistService) GetNamedPicklist(name, recordTypeID string) (*PicklistDTO, error) {
+	field, ok := namedPicklists[name]
+	if !ok {
+		return nil, &NotFoundError{Resource: "Picklist", ID: name}
+	}
+
+	return ps.GetPicklist(field[0], field[1], recordTypeID)
+}
+
+//GetPicklist returns the values of a picklist field, from the cache if they
+//were loaded less than RefreshInterval ago. If reloading fails, the cached
+//values are returned until they can be reloaded. A *NotFoundError is returned
+//for fields that can't be requested. The returned picklist is shared and must
+//not be modified.
+func (ps *PicklistService) GetPicklist(object, field, recordTypeID string) (*PicklistDTO, error) {
+	if !ps.isAllowed(object, field) {
+		return nil, &NotFoundError{Resource: "Picklist", ID: object + "." + field}
+	}
+
+	key := object + "." + field + "/" + recordTypeID
+
+	ps.lock.Lock()
+	if ps.cache == nil {
+		ps.cache = map[string]*cachedPicklist{}
+	}
+	if ps.loading == nil {
+		ps.loading = map[string]*picklistLoad{}
+	}
+
+	now := ps.currentTime()
+	cached, ok := ps.cache[key]
+	if ok && now.Sub(cached.loaded) < ps.refreshInterval() {
+		ps.lock.Unlock()
+		return cached.picklist, nil
+	}
+
+	//the lock isn't held while loading, so other picklists can be served
+	load, loading := ps.loading[key]
+	if loading {
+		ps.lock.Unlock()
+		<-load.done
+	} else {
+		load = &picklistLoad{done: make(chan struct{})}
+		ps.loading[key] = load
+		ps.lock.Unlock()
+
+		load.picklist, load.err = ps.PicklistRepo.GetPicklist(object, field, recordTypeID)
+
+		ps.lock.Lock()
+		delete(ps.loading, key)
+		if load.err == nil {
+			if ps.cache == nil {
+				ps.cache = map[string]*cachedPicklist{}
+			}
+			ps.cache[key] = &cachedPicklist{picklist: load.picklist, loaded: now}
+		}
+		ps.lock.Unlock()
+		close(load.done)
+	}
+
+	if load.err != nil {
+		if ok {
+			log.Printf("PicklistService.GetPicklist failed to refresh %s, using cached values: %s", key, load.err)
+			return cached.picklist, nil
+		}
+		return nil, fmt.Errorf("Error retrieving picklist %s.%s: %s", object, field, load.err)
+	}
+
+	return load.picklist, nil
+}
+
+//isAllowed reports whether the picklist of a field can be requested
+func (ps *PicklistService) isAllowed(object, field string) bool {
+	if ps.Fields != nil {
+		return ps.Fields[object+"."+field]
+	}
+
+	for _, named := range namedPicklists {
+		if named[0] == object && named[1] == field {
+			return true
+		}
+	}
+	return false
+}
+
+//GetDependentValues returns the values of a dependent picklist that are
+//valid for the given value of its controlling field. Every value is returned
+//for picklists that aren't dependent.
+func (ps *PicklistService) GetDependentValues(object, field, recordTypeID, controllingValue string) ([]*PicklistValueDTO, error) {
+	picklist, err := ps.GetPicklist(object, field, recordTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if picklist.ControllerField == "" {
+		return picklist.Values, nil
+	}
+
+	values := []*PicklistValueDTO{}
+	for _, value := range picklist.Values {
+		for _, valid := range value.ValidFor {
+			if valid == controllingValue {
+				values = append(values, value)
+				break
+			}
+		}
+	}
+
+	return values, nil
+}
+
+//Refresh empties the cache so that every picklist is reloaded the next time
+//it's requested.
+func (ps *PicklistService) Refresh() {
+	ps.lock.Lock()
+	ps.cache = nil
+	ps.lock.Unlock()
+}
+
+func (ps *PicklistService) refreshInterval() time.Duration {
+	if ps.RefreshInterval <= 0 {
+		return DefaultPicklistRefreshInterval
+	}
+	return ps.RefreshInterval
+}
+
+func (ps *PicklistService) currentTime() time.Time {
+	if ps.now != nil {
+		return ps.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/blackbaudIT/webcore/Godeps/_workspace/src/github.com/smartystreets/goconvey/convey"
+)
+
+//mockPicklistRepository counts its calls and fails once fail is set
+type mockPicklistRepository struct {
+	calls int
+	fail  bool
+}
+
+func (m *mockPicklistRepository) GetPicklist(object, field, recordTypeID string) (*PicklistDTO, error) {
+	m.calls++
+	if m.fail {
+		return nil, errors.New("fake error")
+	}
+
+	return &PicklistDTO{
+		Object:          object,
+		Field:           field,
+		RecordTypeID:    recordTypeID,
+		ControllerField: "Business_Unit__c",
+		Values: []*PicklistValueDTO{
+			{Value: "Cause & Cure", Active: true, ValidFor: []string{"GMBU"}},
+			{Value: "Education", Active: true, ValidFor: []string{"K12", "IBU"}},
+		},
+	}, nil
+}
+
+func TestPicklistService(t *testing.T) {
+	Convey("Given a PicklistService with a one minute refresh interval", t, func() {
+		repo := &mockPicklistRepository{}
+		service := NewPicklistService(repo, time.Minute)
+		now := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+		service.now = func() time.Time { return now }
+		Convey("When a named picklist is requested twice", func() {
+			first, err := service.GetNamedPicklist(PicklistIndustry, "")
+			second, _ := service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then it should only be loaded once", func() {
+				So(err, ShouldBeNil)
+				So(first.Object, ShouldEqual, "Account")
+				So(first.Field, ShouldEqual, "Industry")
+				So(second, ShouldEqual, first)
+				So(repo.calls, ShouldEqual, 1)
+			})
+		})
+		Convey("When the picklist is requested for different record types", func() {
+			service.GetNamedPicklist(PicklistIndustry, "")
+			service.GetNamedPicklist(PicklistIndustry, "012d0000000RTK12AA")
+			Convey("Then each should be loaded separately", func() {
+				So(repo.calls, ShouldEqual, 2)
+			})
+		})
+		Convey("When the refresh interval passes", func() {
+			service.GetNamedPicklist(PicklistIndustry, "")
+			now = now.Add(2 * time.Minute)
+			service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then the picklist should be reloaded", func() {
+				So(repo.calls, ShouldEqual, 2)
+			})
+		})
+		Convey("When reloading fails", func() {
+			first, _ := service.GetNamedPicklist(PicklistIndustry, "")
+			now = now.Add(2 * time.Minute)
+			repo.fail = true
+			second, err := service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then the cached values should be returned", func() {
+				So(err, ShouldBeNil)
+				So(second, ShouldEqual, first)
+			})
+		})
+		Convey("When the cache is refreshed", func() {
+			service.GetNamedPicklist(PicklistIndustry, "")
+			service.Refresh()
+			service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then the picklist should be reloaded", func() {
+				So(repo.calls, ShouldEqual, 2)
+			})
+		})
+		Convey("When the first load fails", func() {
+			repo.fail = true
+			_, err := service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then an error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("When an unknown picklist is requested", func() {
+			_, err := service.GetNamedPicklist("shoeSize", "")
+			Convey("Then a *NotFoundError should be returned", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+				So(repo.calls, ShouldEqual, 0)
+			})
+		})
+		Convey("When a field that isn't allowed is requested", func() {
+			_, err := service.GetPicklist("Account", "Shoe_Size__c", "")
+			Convey("Then a *NotFoundError should be returned without loading it", func() {
+				So(err, ShouldHaveSameTypeAs, &NotFoundError{})
+				So(repo.calls, ShouldEqual, 0)
+			})
+		})
+		Convey("When a field is allowed by the service", func() {
+			service.Fields = map[string]bool{"Account.Shoe_Size__c": true}
+			_, err := service.GetPicklist("Account", "Shoe_Size__c", "")
+			_, named := service.GetNamedPicklist(PicklistIndustry, "")
+			Convey("Then only that field should be loaded", func() {
+				So(err, ShouldBeNil)
+				So(named, ShouldHaveSameTypeAs, &NotFoundError{})
+				So(repo.calls, ShouldEqual, 1)
+			})
+		})
+		Convey("When the dependent values of a controlling value are requested", func() {
+			values, err := service.GetDependentValues("Account", "Industry", "", "K12")
+			Convey("Then only the values valid for it should be returned", func() {
+				So(err, ShouldBeNil)
+				So(len(values), ShouldEqual, 1)
+				So(values[0].Value, ShouldEqual, "Education")
+			})
+		})
+	})
+}
+
+//blockingPicklistRepository holds every load until release is closed
+type blockingPicklistRepository struct {
+	lock    sync.Mutex
+	calls   int
+	started chan string
+	release chan struct{}
+}
+
+func (m *blockingPicklistRepository) GetPicklist(object, field, recordTypeID string) (*PicklistDTO, error) {
+	m.lock.Lock()
+	m.calls++
+	m.lock.Unlock()
+
+	m.started <- object + "." + field
+	<-m.release
+	return &PicklistDTO{Object: object, Field: field}, nil
+}
+
+func TestPicklistServiceConcurrency(t *testing.T) {
+	Convey("Given a picklist that is being loaded", t, func() {
+		repo := &blockingPicklistRepository{started: make(chan string, 2), release: make(chan struct{})}
+		service := NewPicklistService(repo, time.Minute)
+		results := make(chan *PicklistDTO, 3)
+		go func() {
+			picklist, _ := service.GetNamedPicklist(PicklistIndustry, "")
+			results <- picklist
+		}()
+		So(<-repo.started, ShouldEqual, "Account.Industry")
+
+		Convey("When it and another picklist are requested", func() {
+			go func() {
+				picklist, _ := service.GetNamedPicklist(PicklistIndustry, "")
+				results <- picklist
+			}()
+			go func() {
+				picklist, _ := service.GetNamedPicklist(PicklistContactStatus, "")
+				results <- picklist
+			}()
+			Convey("Then only the other picklist should be loaded while the first is", func() {
+				So(<-repo.started, ShouldEqual, "Contact.SFDC_Contact_Status__c")
+				close(repo.release)
+				first, second, third := <-results, <-results, <-results
+				So(first, ShouldNotBeNil)
+				So(second, ShouldNotBeNil)
+				So(third, ShouldNotBeNil)
+				So(repo.calls, ShouldEqual, 2)
+			})
+		})
+	})
+}